@@ -0,0 +1,264 @@
+package audiobook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// maxArtworkSize limit the size of the ID3 tags and of the moov atoms read
+// in memory
+const maxArtworkSize = 32 << 20
+
+// readArtwork return the image embedded in an audio file, the attached
+// picture of an ID3v2 tag in a MP3 file or the covr atom of a MP4 file,
+// the front cover is preferred to the other pictures
+func readArtwork(r io.Reader) ([]byte, string, bool) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(8)
+
+	var data []byte
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		data = readID3Picture(br)
+	case len(magic) == 8 && string(magic[4:]) == "ftyp":
+		data = readMP4Cover(br)
+	}
+
+	mediaType := imageType(data)
+	if mediaType == "" {
+		return nil, "", false
+	}
+	return data, mediaType, true
+}
+
+// imageType return the media type of a JPEG or a PNG image, other images
+// are not used as cover
+func imageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	}
+	return ""
+}
+
+// readID3Picture read the APIC frames of ID3v2.3 and ID3v2.4 tags and the
+// PIC frames of ID3v2.2 tags, unsynchronised tags are not read
+func readID3Picture(r io.Reader) []byte {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil
+	}
+	version := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+	if flags&0x80 != 0 || size > maxArtworkSize || version < 2 || version > 4 {
+		return nil
+	}
+
+	tag := make([]byte, size)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil
+	}
+	if flags&0x40 != 0 && version > 2 {
+		// skip the extended header, its size includes itself in v2.4
+		if len(tag) < 4 {
+			return nil
+		}
+		n := int(binary.BigEndian.Uint32(tag)) + 4
+		if version == 4 {
+			n = syncsafe(tag[:4])
+		}
+		if n > len(tag) {
+			return nil
+		}
+		tag = tag[n:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	var picture []byte
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+		var n int
+		switch version {
+		case 2:
+			n = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			n = int(binary.BigEndian.Uint32(tag[4:8]))
+		case 4:
+			n = syncsafe(tag[4:8])
+		}
+		if n < 0 || n > len(tag)-headerSize {
+			break
+		}
+		body := tag[headerSize : headerSize+n]
+		tag = tag[headerSize+n:]
+
+		if id != "APIC" && id != "PIC" {
+			continue
+		}
+		data, pictureType, ok := parsePictureFrame(body, version == 2)
+		if !ok {
+			continue
+		}
+		if pictureType == 3 {
+			return data
+		}
+		if picture == nil {
+			picture = data
+		}
+	}
+
+	return picture
+}
+
+// parsePictureFrame return the image and the picture type of an attached
+// picture frame, the MIME type or image format is not used as it is
+// often wrong
+func parsePictureFrame(body []byte, v22 bool) ([]byte, byte, bool) {
+	if len(body) < 2 {
+		return nil, 0, false
+	}
+	encoding := body[0]
+	body = body[1:]
+
+	if v22 {
+		if len(body) < 3 {
+			return nil, 0, false
+		}
+		body = body[3:]
+	} else {
+		i := bytes.IndexByte(body, 0)
+		if i < 0 {
+			return nil, 0, false
+		}
+		body = body[i+1:]
+	}
+
+	if len(body) < 1 {
+		return nil, 0, false
+	}
+	pictureType := body[0]
+	body = body[1:]
+
+	// the description ends with a null character of the encoding
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(body); i += 2 {
+			if body[i] == 0 && body[i+1] == 0 {
+				return body[i+2:], pictureType, true
+			}
+		}
+		return nil, 0, false
+	}
+	i := bytes.IndexByte(body, 0)
+	if i < 0 {
+		return nil, 0, false
+	}
+	return body[i+1:], pictureType, true
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// readMP4Cover read the moov atom of a MP4 file and return the first image
+// of moov/udta/meta/ilst/covr, the media data before it is skipped
+func readMP4Cover(r io.Reader) []byte {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:])
+		headerSize := int64(8)
+		if size == 1 {
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return nil
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headerSize = 16
+		}
+		// an atom of size 0 extends to the end of the file
+		if size == 0 && kind != "moov" {
+			return nil
+		}
+		if size != 0 && size < headerSize {
+			return nil
+		}
+
+		if kind != "moov" {
+			if _, err := io.CopyN(ioutil.Discard, r, size-headerSize); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		var moov []byte
+		var err error
+		if size == 0 {
+			moov, err = ioutil.ReadAll(io.LimitReader(r, maxArtworkSize))
+		} else if size-headerSize <= maxArtworkSize {
+			moov = make([]byte, size-headerSize)
+			_, err = io.ReadFull(r, moov)
+		}
+		if err != nil || moov == nil {
+			return nil
+		}
+
+		ilst := findAtom(moov, "udta", "meta", "ilst")
+		covr := findAtom(ilst, "covr")
+		for len(covr) >= 16 {
+			n := int(binary.BigEndian.Uint32(covr[:4]))
+			if n < 16 || n > len(covr) {
+				return nil
+			}
+			// data atoms have a type indicator and a locale before the
+			// image
+			if string(covr[4:8]) == "data" {
+				return covr[16:n]
+			}
+			covr = covr[n:]
+		}
+		return nil
+	}
+}
+
+// findAtom return the content of the atom at a path in the content of a
+// parent atom, the meta atom has a version and flags before its children
+func findAtom(data []byte, path ...string) []byte {
+	for _, kind := range path {
+		var found []byte
+		for len(data) >= 8 {
+			n := int(binary.BigEndian.Uint32(data[:4]))
+			if n < 8 || n > len(data) {
+				return nil
+			}
+			if string(data[4:8]) == kind {
+				found = data[8:n]
+				break
+			}
+			data = data[n:]
+		}
+		if found == nil {
+			return nil
+		}
+		if kind == "meta" {
+			if len(found) < 4 {
+				return nil
+			}
+			found = found[4:]
+		}
+		data = found
+	}
+	return data
+}
@@ -0,0 +1,245 @@
+// Package audiobook read the metadata and the cover of audiobook packages
+// as OPDS 2.0 publications: Readium audiobooks, a zip with a Readium Web
+// Publication Manifest, and W3C Lightweight Packaging Format files with a
+// publication manifest.
+//
+// The cover is the resource of the manifest with the cover relation, or
+// the artwork embedded in the first track when the manifest has none.
+package audiobook
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// media types of the audiobook packages
+const (
+	ReadiumMediaType = "application/audiobook+zip"
+	LPFMediaType     = "application/lpf+zip"
+)
+
+// ErrNoManifest is returned for a package without manifest.json or
+// publication.json
+var ErrNoManifest = errors.New("audiobook: no manifest in package")
+
+// Audiobook is the publication read from an audiobook package
+type Audiobook struct {
+	// Publication has the metadata of the manifest with the total
+	// duration in seconds, it has no link as the location of the file is
+	// not known
+	Publication opds2.Publication
+	// MediaType is ReadiumMediaType or LPFMediaType
+	MediaType string
+	// Tracks are the paths of the reading order in the package
+	Tracks []string
+	// Cover is the cover image, nil when the package has none
+	Cover *Cover
+}
+
+// Cover is an image of an audiobook package
+type Cover struct {
+	// Path of the image in the package, the path of the track for an
+	// embedded artwork
+	Path      string
+	MediaType string
+	Data      []byte
+}
+
+// manifest is what is read from a manifest, hrefs are relative to it
+type manifest struct {
+	publication opds2.Publication
+	tracks      []string
+	cover       string
+	coverType   string
+}
+
+// ParseFile read a Readium audiobook or a LPF file
+func ParseFile(name string) (*Audiobook, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(f, info.Size())
+}
+
+// Parse read an audiobook package of size bytes, the format is detected
+// from the manifest found
+func Parse(r io.ReaderAt, size int64) (*Audiobook, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	var m *manifest
+	a := &Audiobook{}
+	if data, err := readFile(files, "manifest.json"); err == nil {
+		a.MediaType = ReadiumMediaType
+		m, err = parseManifest(data)
+		if err != nil {
+			return nil, err
+		}
+	} else if data, err := readFile(files, "publication.json"); err == nil {
+		a.MediaType = LPFMediaType
+		m, err = parseW3CManifest(data)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, ErrNoManifest
+	}
+
+	a.Publication = m.publication
+	for _, t := range m.tracks {
+		a.Tracks = append(a.Tracks, packagePath(t))
+	}
+
+	if m.cover != "" {
+		p := packagePath(m.cover)
+		if data, err := readFile(files, p); err == nil {
+			mediaType := m.coverType
+			if mediaType == "" {
+				mediaType = imageType(data)
+			}
+			a.Cover = &Cover{Path: p, MediaType: mediaType, Data: data}
+		}
+	}
+	if a.Cover == nil && len(a.Tracks) > 0 {
+		if f, ok := files[a.Tracks[0]]; ok {
+			if rc, err := f.Open(); err == nil {
+				if data, mediaType, ok := readArtwork(rc); ok {
+					a.Cover = &Cover{Path: a.Tracks[0], MediaType: mediaType, Data: data}
+				}
+				rc.Close()
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// packagePath return the path in the package of an href relative to the
+// manifest at its root
+func packagePath(href string) string {
+	if i := strings.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
+	}
+	return strings.TrimPrefix(path.Clean("/"+href), "/")
+}
+
+// maxFileSize limit the size of the files of the archive read in memory,
+// a larger file is an error rather than a zip bomb filling the memory
+const maxFileSize = 32 << 20
+
+var errTooLarge = errors.New("audiobook: file too large")
+
+func readFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, errTooLarge
+	}
+
+	return data, nil
+}
+
+// ParseManifest read a Readium Web Publication Manifest alone, the
+// audiobook has no media type and no cover
+func ParseManifest(data []byte) (*Audiobook, error) {
+	m, err := parseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Audiobook{Publication: m.publication, Tracks: m.tracks}, nil
+}
+
+// parseManifest read a Readium Web Publication Manifest, the duration of
+// the publication is the sum of the durations of the reading order when
+// the manifest does not have it
+func parseManifest(data []byte) (*manifest, error) {
+	p, err := opds2.ParsePublicationBuffer(data)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{publication: *p}
+
+	var info map[string]interface{}
+	json.Unmarshal(data, &info)
+
+	readingOrder, _ := info["readingOrder"].([]interface{})
+	var duration float64
+	for _, item := range readingOrder {
+		l, _ := item.(map[string]interface{})
+		if href, ok := l["href"].(string); ok {
+			m.tracks = append(m.tracks, href)
+		}
+		d, _ := l["duration"].(float64)
+		duration += d
+	}
+	if m.publication.Metadata.Duration == 0 {
+		m.publication.Metadata.Duration = int(duration + 0.5)
+	}
+
+	for _, key := range []string{"resources", "links"} {
+		links, _ := info[key].([]interface{})
+		for _, item := range links {
+			l, _ := item.(map[string]interface{})
+			if href, ok := l["href"].(string); ok && m.cover == "" && hasRel(l["rel"], "cover") {
+				m.cover = href
+				m.coverType, _ = l["type"].(string)
+			}
+		}
+	}
+
+	// links of the package are not links of the publication
+	m.publication.Links = nil
+
+	return m, nil
+}
+
+// hasRel tell if the rel of a link, a string or an array, has a relation
+func hasRel(rel interface{}, value string) bool {
+	switch r := rel.(type) {
+	case string:
+		return r == value
+	case []interface{}:
+		for _, v := range r {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package audiobook
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// buildPackage return a zip package with the files given by name
+func buildPackage(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestParseManifest(t *testing.T) {
+	a, err := ParseManifest([]byte(`{
+		"metadata": {"title": "Moby Dick", "identifier": "urn:isbn:9780000000001"},
+		"readingOrder": [
+			{"href": "01.mp3", "type": "audio/mpeg", "duration": 1800.4},
+			{"href": "02.mp3", "type": "audio/mpeg", "duration": 1200}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Publication.Metadata.Title.String() != "Moby Dick" {
+		t.Errorf("title = %v", a.Publication.Metadata.Title)
+	}
+	if a.Publication.Metadata.Duration != 3000 {
+		t.Errorf("duration = %d", a.Publication.Metadata.Duration)
+	}
+	if len(a.Tracks) != 2 || a.Tracks[1] != "02.mp3" {
+		t.Errorf("tracks = %v", a.Tracks)
+	}
+}
+
+func TestParseManifestMalformed(t *testing.T) {
+	for _, test := range []string{`[]`, `{`} {
+		if _, err := ParseManifest([]byte(test)); err == nil {
+			t.Errorf("%s: no error", test)
+		}
+	}
+
+	// values of the wrong type are ignored like missing values
+	tests := []string{
+		`{"metadata":{"identifier":123}}`,
+		`{"metadata":"x"}`,
+		`{"metadata":{"title":"t","duration":"PT1H"}}`,
+		`{"metadata":{"title":"t","author":[1]}}`,
+		`{"metadata":{"title":"t"},"links":[{"href":1}]}`,
+		`{"metadata":{"title":"t"},"links":"x","readingOrder":"x","resources":[1,{"rel":2}]}`,
+	}
+	for _, test := range tests {
+		if _, err := ParseManifest([]byte(test)); err != nil {
+			t.Errorf("%s: %v", test, err)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  bool
+	}{
+		{"not a zip", []byte("ID3"), true},
+		{"no manifest", buildPackage(t, map[string]string{"01.mp3": ""}), true},
+		{"wrong types in manifest", buildPackage(t, map[string]string{"manifest.json": `{"metadata":{"identifier":123}}`}), false},
+		{"wrong types in publication", buildPackage(t, map[string]string{"publication.json": `{"name":1,"author":{"name":[2]},"readingOrder":"x","duration":5}`}), false},
+		{"broken id3 artwork", buildPackage(t, map[string]string{
+			"manifest.json": `{"metadata":{"title":"t"},"readingOrder":[{"href":"01.mp3"}]}`,
+			"01.mp3":        "ID3\x03\x00\x00\x00\x00\x00\x20APIC\xff\xff\xff\xff\x00\x00",
+		}), false},
+		{"broken mp4 artwork", buildPackage(t, map[string]string{
+			"manifest.json": `{"metadata":{"title":"t"},"readingOrder":[{"href":"01.m4a"}]}`,
+			"01.m4a":        "\x00\x00\x00\x01ftyp\xff\xff\xff\xff\xff\xff\xff\xff",
+		}), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := Parse(bytes.NewReader(test.data), int64(len(test.data)))
+			if (err != nil) != test.err {
+				t.Fatalf("err = %v", err)
+			}
+			if a != nil && a.Cover != nil {
+				t.Errorf("cover = %v", a.Cover)
+			}
+		})
+	}
+}
+
+func TestParseLargeCover(t *testing.T) {
+	data := buildPackage(t, map[string]string{
+		"manifest.json": `{"metadata":{"title":"t"},"resources":[{"href":"cover.jpg","type":"image/jpeg","rel":"cover"}]}`,
+		"cover.jpg":     "\xff\xd8\xff" + strings.Repeat("\x00", maxFileSize),
+	})
+	a, err := Parse(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Cover != nil {
+		t.Errorf("cover of %d bytes read", len(a.Cover.Data))
+	}
+}
@@ -0,0 +1,221 @@
+package audiobook
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// w3cRoles are the properties of the contributors of a W3C publication
+// manifest with the list they are added to
+var w3cRoles = []struct {
+	property string
+	list     func(m *opds2.PublicationMetadata) *[]opds2.Contributor
+}{
+	{"author", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Author }},
+	{"creator", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Author }},
+	{"readBy", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Narrator }},
+	{"translator", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Translator }},
+	{"editor", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Editor }},
+	{"artist", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Artist }},
+	{"illustrator", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Illustrator }},
+	{"colorist", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Colorist }},
+	{"inker", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Inker }},
+	{"letterer", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Letterer }},
+	{"penciler", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Penciler }},
+	{"contributor", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Contributor }},
+	{"publisher", func(m *opds2.PublicationMetadata) *[]opds2.Contributor { return &m.Publisher }},
+}
+
+// parseW3CManifest read the publication.json of a LPF file, a W3C
+// publication manifest in JSON-LD
+func parseW3CManifest(data []byte) (*manifest, error) {
+	var info map[string]interface{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+	meta := &m.publication.Metadata
+
+	if t, ok := info["type"].(string); ok && t == "Audiobook" {
+		meta.RDFType = "http://schema.org/Audiobook"
+	}
+	for _, v := range list(info["inLanguage"]) {
+		if l, ok := v.(string); ok {
+			meta.Language = append(meta.Language, l)
+		}
+	}
+	language := ""
+	if len(meta.Language) > 0 {
+		language = meta.Language[0]
+	}
+
+	meta.Title = localizable(info["name"], language)
+	meta.Identifier, _ = info["id"].(string)
+	meta.Description, _ = info["description"].(string)
+
+	for _, role := range w3cRoles {
+		for _, v := range list(info[role.property]) {
+			if c, ok := w3cContributor(v, language); ok {
+				l := role.list(meta)
+				*l = append(*l, c)
+			}
+		}
+	}
+	if s, ok := info["datePublished"].(string); ok {
+		if t, ok := parseDate(s); ok {
+			meta.PublicationDate = &t
+		}
+	}
+	if s, ok := info["dateModified"].(string); ok {
+		if t, ok := parseDate(s); ok {
+			meta.Modified = &t
+		}
+	}
+
+	var duration float64
+	for _, v := range list(info["readingOrder"]) {
+		switch item := v.(type) {
+		case string:
+			m.tracks = append(m.tracks, item)
+		case map[string]interface{}:
+			if href, ok := item["url"].(string); ok {
+				m.tracks = append(m.tracks, href)
+			}
+			if s, ok := item["duration"].(string); ok {
+				duration += parseDuration(s)
+			}
+		}
+	}
+	if s, ok := info["duration"].(string); ok {
+		meta.Duration = int(parseDuration(s) + 0.5)
+	} else {
+		meta.Duration = int(duration + 0.5)
+	}
+
+	for _, key := range []string{"resources", "links"} {
+		for _, v := range list(info[key]) {
+			l, _ := v.(map[string]interface{})
+			if href, ok := l["url"].(string); ok && m.cover == "" && hasRel(l["rel"], "cover") {
+				m.cover = href
+				m.coverType, _ = l["encodingFormat"].(string)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// list return the values of a property that can be a single value or an
+// array
+func list(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+	return []interface{}{v}
+}
+
+// localizable read a string or a localizable string with a value and a
+// language, or an array of them, the strings without language are in the
+// language of the publication when others have one
+func localizable(v interface{}, language string) opds2.MultiLanguage {
+	var m opds2.MultiLanguage
+
+	var plain []string
+	for _, item := range list(v) {
+		switch item := item.(type) {
+		case string:
+			plain = append(plain, item)
+		case map[string]interface{}:
+			value, _ := item["value"].(string)
+			l, _ := item["language"].(string)
+			if l == "" {
+				plain = append(plain, value)
+				continue
+			}
+			if m.MultiString == nil {
+				m.MultiString = make(map[string]string)
+			}
+			if _, ok := m.MultiString[l]; !ok {
+				m.MultiString[l] = value
+			}
+		}
+	}
+
+	if len(plain) == 0 {
+		return m
+	}
+	if m.MultiString == nil {
+		m.SingleString = plain[0]
+		return m
+	}
+	if language == "" {
+		language = "und"
+	}
+	if _, ok := m.MultiString[language]; !ok {
+		m.MultiString[language] = plain[0]
+	}
+	return m
+}
+
+// w3cContributor read a contributor, a name or an entity with a name
+func w3cContributor(v interface{}, language string) (opds2.Contributor, bool) {
+	var c opds2.Contributor
+
+	switch v := v.(type) {
+	case string:
+		c.Name.SingleString = v
+	case map[string]interface{}:
+		c.Name = localizable(v["name"], language)
+		c.Identifier, _ = v["id"].(string)
+		if u, ok := v["url"].(string); ok {
+			c.Links = []opds2.Link{{Href: u}}
+		}
+	}
+
+	return c, c.Name.String() != ""
+}
+
+// durationPattern match the ISO 8601 durations of W3C manifests like
+// PT1H2M3.5S
+var durationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:([\d.]+)S)?)?$`)
+
+// parseDuration return a duration in seconds, 0 when it is not valid
+func parseDuration(s string) float64 {
+	m := durationPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+
+	var seconds float64
+	for i, unit := range []float64{24 * 3600, 3600, 60, 1} {
+		if v, err := strconv.ParseFloat(m[i+1], 64); err == nil {
+			seconds += v * unit
+		}
+	}
+	return seconds
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
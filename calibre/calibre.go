@@ -0,0 +1,429 @@
+// Package calibre read the books of a Calibre library as OPDS 2.0
+// publications, from its metadata.db database or, without it, from the
+// metadata.opf files Calibre writes next to the books.
+//
+// The database is read with a minimal SQLite reader, changes still in the
+// write-ahead log of a library open in Calibre are not seen.
+//
+//	books, errs := calibre.ReadLibrary("Calibre Library")
+//	for _, book := range books {
+//		fmt.Println(book.Publication.Metadata.Title, book.Formats)
+//	}
+package calibre
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// DatabaseName is the name of the database of a library
+const DatabaseName = "metadata.db"
+
+// ErrNotLibrary is returned for a database without the books table of
+// Calibre
+var ErrNotLibrary = errors.New("calibre: not a calibre library")
+
+// FileError is an error reading the database or a metadata.opf file of a
+// library
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Book is a book of a Calibre library
+type Book struct {
+	// Publication has the metadata of the book, it has no link as the
+	// location of the library is not known
+	Publication opds2.Publication
+	// ID of the book in the database, 0 for a book read from its
+	// metadata.opf
+	ID int64
+	// Path of the directory of the book, slash separated and relative to
+	// the library
+	Path string
+	// Formats are the files of the book
+	Formats []Format
+	// Cover is the path of the cover image relative to the library, empty
+	// when the book has none
+	Cover string
+	// Rating from 0 to 5 stars, 0 when the book is not rated
+	Rating float64
+	// Identifiers by type, like "isbn", "amazon" or "goodreads"
+	Identifiers map[string]string
+}
+
+// Format is a file of a book
+type Format struct {
+	// Name of the format in Calibre, like "EPUB" or "PDF"
+	Name string
+	// Path of the file, slash separated and relative to the library
+	Path      string
+	MediaType string
+	// Size of the file in bytes as recorded by Calibre, 0 when unknown
+	Size int64
+}
+
+// mediaTypes are the media types of the formats by their lowercase
+// extension
+var mediaTypes = map[string]string{
+	"epub":      "application/epub+zip",
+	"kepub":     "application/kepub+zip",
+	"pdf":       "application/pdf",
+	"cbz":       "application/vnd.comicbook+zip",
+	"cbr":       "application/vnd.comicbook-rar",
+	"cb7":       "application/x-cb7",
+	"mobi":      "application/x-mobipocket-ebook",
+	"azw":       "application/vnd.amazon.ebook",
+	"azw3":      "application/x-mobi8-ebook",
+	"fb2":       "application/x-fictionbook+xml",
+	"djvu":      "image/vnd.djvu",
+	"txt":       "text/plain",
+	"rtf":       "application/rtf",
+	"html":      "text/html",
+	"htmlz":     "application/zip",
+	"zip":       "application/zip",
+	"docx":      "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"odt":       "application/vnd.oasis.opendocument.text",
+	"lit":       "application/x-ms-reader",
+	"lrf":       "application/x-sony-bbeb",
+	"mp3":       "audio/mpeg",
+	"m4b":       "audio/mp4",
+	"m4a":       "audio/mp4",
+	"audiobook": "application/audiobook+zip",
+}
+
+// MediaType return the media type of a Calibre format like "EPUB",
+// application/octet-stream when it is not known
+func MediaType(format string) string {
+	if t, ok := mediaTypes[strings.ToLower(format)]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// ReadLibrary read the books of a library directory, from metadata.db when
+// the library has one, sorted by id, or else from the metadata.opf files,
+// with the errors of the files that could not be read
+func ReadLibrary(dir string) ([]Book, []error) {
+	f, err := os.Open(filepath.Join(dir, DatabaseName))
+	if os.IsNotExist(err) {
+		return ReadSidecars(dir)
+	}
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer f.Close()
+
+	books, err := readDatabase(f)
+	if err != nil {
+		return nil, []error{&FileError{Path: f.Name(), Err: err}}
+	}
+	for i := range books {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(books[i].Cover))); err != nil {
+			books[i].Cover = ""
+		}
+	}
+	return books, nil
+}
+
+func readDatabase(f *os.File) ([]Book, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDatabase(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return readBooks(db)
+}
+
+// links are the rows of a link table by book
+type links map[int64][]row
+
+// readLinks read a table linking books to the rows of another table, the
+// rows of each book are in the order of the link table
+func readLinks(db *database, linkTable string, column string, table string) (links, error) {
+	values, err := db.rows(table)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]row, len(values))
+	for _, v := range values {
+		byID[v.int("id")] = v
+	}
+
+	rows, err := db.rows(linkTable)
+	if err != nil {
+		return nil, err
+	}
+	l := make(links)
+	for _, r := range rows {
+		if v, ok := byID[r.int(column)]; ok {
+			book := r.int("book")
+			l[book] = append(l[book], v)
+		}
+	}
+	return l, nil
+}
+
+// byBook read a table with a book column, like comments or data
+func byBook(db *database, table string) (links, error) {
+	rows, err := db.rows(table)
+	if err != nil {
+		return nil, err
+	}
+	l := make(links)
+	for _, r := range rows {
+		book := r.int("book")
+		l[book] = append(l[book], r)
+	}
+	return l, nil
+}
+
+func readBooks(db *database) ([]Book, error) {
+	if _, ok := db.tables["books"]; !ok {
+		return nil, ErrNotLibrary
+	}
+	rows, err := db.rows("books")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		authors, series, tags, publishers, languages, ratings links
+		comments, data, identifiers                           links
+	)
+	for _, l := range []struct {
+		links                    *links
+		linkTable, column, table string
+	}{
+		{&authors, "books_authors_link", "author", "authors"},
+		{&series, "books_series_link", "series", "series"},
+		{&tags, "books_tags_link", "tag", "tags"},
+		{&publishers, "books_publishers_link", "publisher", "publishers"},
+		{&languages, "books_languages_link", "lang_code", "languages"},
+		{&ratings, "books_ratings_link", "rating", "ratings"},
+	} {
+		if *l.links, err = readLinks(db, l.linkTable, l.column, l.table); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range []struct {
+		links *links
+		table string
+	}{
+		{&comments, "comments"},
+		{&data, "data"},
+		{&identifiers, "identifiers"},
+	} {
+		if *l.links, err = byBook(db, l.table); err != nil {
+			return nil, err
+		}
+	}
+
+	books := make([]Book, 0, len(rows))
+	for _, r := range rows {
+		id := r.int("id")
+		b := Book{ID: id, Path: r.text("path"), Identifiers: make(map[string]string)}
+		meta := &b.Publication.Metadata
+
+		meta.RDFType = "http://schema.org/Book"
+		meta.Title.SingleString = r.text("title")
+		if sortAs := r.text("sort"); sortAs != meta.Title.SingleString {
+			meta.SortAs = sortAs
+		}
+		if t, ok := parseTimestamp(r.text("pubdate")); ok {
+			meta.PublicationDate = &t
+		}
+		if t, ok := parseTimestamp(r.text("last_modified")); ok {
+			meta.Modified = &t
+		}
+
+		for _, a := range authors[id] {
+			c := opds2.Contributor{Name: opds2.MultiLanguage{SingleString: a.text("name")}, SortAs: a.text("sort")}
+			if link := a.text("link"); link != "" {
+				c.Links = []opds2.Link{{Href: link}}
+			}
+			meta.Author = append(meta.Author, c)
+		}
+		for _, s := range series[id] {
+			if meta.BelongsTo == nil {
+				meta.BelongsTo = &opds2.BelongsTo{}
+			}
+			c := opds2.Collection{Name: s.text("name"), Position: float32(r.float("series_index"))}
+			if sortAs := s.text("sort"); sortAs != c.Name {
+				c.SortAs = sortAs
+			}
+			meta.BelongsTo.Series = append(meta.BelongsTo.Series, c)
+		}
+		for _, t := range tags[id] {
+			meta.Subject = append(meta.Subject, opds2.Subject{Name: t.text("name")})
+		}
+		for _, p := range publishers[id] {
+			meta.Publisher = append(meta.Publisher, opds2.Contributor{Name: opds2.MultiLanguage{SingleString: p.text("name")}})
+		}
+		for _, l := range languages[id] {
+			meta.Language = append(meta.Language, languageTag(l.text("lang_code")))
+		}
+		for _, rating := range ratings[id] {
+			b.Rating = stars(rating.float("rating"))
+		}
+		for _, c := range comments[id] {
+			meta.Description = strings.TrimSpace(c.text("text"))
+		}
+
+		for _, i := range identifiers[id] {
+			b.Identifiers[strings.ToLower(i.text("type"))] = i.text("val")
+		}
+		// the isbn column of old libraries
+		if isbn := r.text("isbn"); isbn != "" && b.Identifiers["isbn"] == "" {
+			b.Identifiers["isbn"] = isbn
+		}
+		b.mapIdentifiers(r.text("uuid"))
+
+		for _, d := range data[id] {
+			format := d.text("format")
+			name := d.text("name") + "." + strings.ToLower(format)
+			b.Formats = append(b.Formats, Format{
+				Name:      format,
+				Path:      path.Join(b.Path, name),
+				MediaType: MediaType(format),
+				Size:      d.int("uncompressed_size"),
+			})
+		}
+		if r.int("has_cover") != 0 {
+			b.Cover = path.Join(b.Path, "cover.jpg")
+		}
+
+		books = append(books, b)
+	}
+
+	return books, nil
+}
+
+// mapIdentifiers set the identifier, the other identifiers and the rating
+// of the publication of a book
+func (b *Book) mapIdentifiers(uuid string) {
+	meta := &b.Publication.Metadata
+	meta.Identifier = identifier(b.Identifiers, uuid)
+	meta.Rating = b.Rating
+
+	var types []string
+	for t := range b.Identifiers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	if uuid != "" {
+		types = append(types, "uuid")
+	}
+	for _, t := range types {
+		value := b.Identifiers[t]
+		if t == "uuid" {
+			value = uuid
+		}
+		if i := identifierURI(t, value); i != "" && i != meta.Identifier {
+			meta.AltIdentifier = append(meta.AltIdentifier, i)
+		}
+	}
+}
+
+// identifierURI return an identifier of a type as an uri, in the type:value
+// form of Calibre when the type has no uri form
+func identifierURI(t string, value string) string {
+	switch {
+	case value == "":
+		return ""
+	case t == "isbn":
+		return "urn:isbn:" + value
+	case t == "uuid":
+		return "urn:uuid:" + strings.ToLower(value)
+	case t == "doi":
+		return "https://doi.org/" + value
+	case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"):
+		return value
+	}
+	return t + ":" + value
+}
+
+// identifier return the identifier of a book as an urn, its isbn or else
+// its uuid
+func identifier(identifiers map[string]string, uuid string) string {
+	if isbn := identifiers["isbn"]; isbn != "" {
+		return "urn:isbn:" + isbn
+	}
+	if uuid != "" {
+		return "urn:uuid:" + strings.ToLower(uuid)
+	}
+	if doi := identifiers["doi"]; doi != "" {
+		return "https://doi.org/" + doi
+	}
+	return ""
+}
+
+// undefinedYear is the year of the dates Calibre uses for no date
+const undefinedYear = 101
+
+// timestampLayouts are the forms of the dates of the database
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			if t.Year() <= undefinedYear {
+				return time.Time{}, false
+			}
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// iso639 are the two letters codes of the common ISO 639-2 codes Calibre
+// stores, the codes without two letters form are valid language tags
+var iso639 = map[string]string{
+	"ara": "ar", "bul": "bg", "cat": "ca", "ces": "cs", "cze": "cs", "dan": "da",
+	"deu": "de", "ger": "de", "ell": "el", "gre": "el", "eng": "en", "spa": "es",
+	"est": "et", "eus": "eu", "baq": "eu", "fas": "fa", "per": "fa", "fin": "fi",
+	"fra": "fr", "fre": "fr", "gle": "ga", "glg": "gl", "heb": "he", "hin": "hi",
+	"hrv": "hr", "hun": "hu", "ind": "id", "isl": "is", "ice": "is", "ita": "it",
+	"jpn": "ja", "kor": "ko", "lat": "la", "lit": "lt", "lav": "lv", "nld": "nl",
+	"dut": "nl", "nor": "no", "nob": "nb", "nno": "nn", "pol": "pl", "por": "pt",
+	"ron": "ro", "rum": "ro", "rus": "ru", "slk": "sk", "slo": "sk", "slv": "sl",
+	"srp": "sr", "swe": "sv", "tha": "th", "tur": "tr", "ukr": "uk", "vie": "vi",
+	"zho": "zh", "chi": "zh",
+}
+
+// languageTag return the BCP 47 tag of an ISO 639 code
+func languageTag(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if tag, ok := iso639[code]; ok {
+		return tag
+	}
+	return code
+}
+
+// stars return the number of stars of a rating of Calibre, in half stars
+// from 0 to 10
+func stars(rating float64) float64 {
+	if rating < 0 || rating > 10 {
+		return 0
+	}
+	return rating / 2
+}
@@ -0,0 +1,161 @@
+package calibre
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// testdata/library/metadata.db is a library of 40 books written by sqlite3
+// with pages of 1024 bytes, the description of the first book spans
+// overflow pages
+const libraryDir = "testdata/library"
+
+func TestReadLibrary(t *testing.T) {
+	books, errs := ReadLibrary(libraryDir)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(books) != 40 {
+		t.Fatalf("%d books", len(books))
+	}
+	for i, b := range books {
+		if b.ID != int64(i+1) {
+			t.Errorf("book %d has id %d", i, b.ID)
+		}
+	}
+
+	moby := books[0]
+	meta := moby.Publication.Metadata
+	if meta.Title.String() != "Moby Dick" || meta.SortAs != "" || meta.RDFType != "http://schema.org/Book" {
+		t.Errorf("title = %q, sort as = %q", meta.Title.String(), meta.SortAs)
+	}
+	author := opds2.Contributor{Name: opds2.MultiLanguage{SingleString: "Herman Melville"}, SortAs: "Melville, Herman",
+		Links: []opds2.Link{{Href: "https://en.wikipedia.org/wiki/Herman_Melville"}}}
+	if !reflect.DeepEqual(meta.Author, []opds2.Contributor{author}) {
+		t.Errorf("authors = %+v", meta.Author)
+	}
+	if meta.BelongsTo == nil || !reflect.DeepEqual(meta.BelongsTo.Series, []opds2.Collection{{Name: "The Sea", SortAs: "Sea, The", Position: 2}}) {
+		t.Errorf("belongs to = %+v", meta.BelongsTo)
+	}
+	if !reflect.DeepEqual(meta.Subject, []opds2.Subject{{Name: "Fiction"}, {Name: "Whales"}}) {
+		t.Errorf("subjects = %+v", meta.Subject)
+	}
+	if len(meta.Publisher) != 1 || meta.Publisher[0].Name.String() != "Harper" {
+		t.Errorf("publishers = %+v", meta.Publisher)
+	}
+	if !reflect.DeepEqual([]string(meta.Language), []string{"en"}) {
+		t.Errorf("languages = %q", meta.Language)
+	}
+	if !strings.HasPrefix(meta.Description, "<p>Call me Ishmael.</p>") || !strings.HasSuffix(meta.Description, "<p>Chapter 399.</p>") {
+		t.Errorf("description of %d bytes", len(meta.Description))
+	}
+	if meta.PublicationDate == nil || !meta.PublicationDate.Equal(time.Date(1851, 10, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("published = %v", meta.PublicationDate)
+	}
+	if meta.Modified == nil || !meta.Modified.Equal(time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC)) {
+		t.Errorf("modified = %v", meta.Modified)
+	}
+
+	if moby.Rating != 4 || meta.Rating != 4 {
+		t.Errorf("rating = %v, publication rating = %v", moby.Rating, meta.Rating)
+	}
+	if !reflect.DeepEqual(moby.Identifiers, map[string]string{"isbn": "9780000000001", "goodreads": "153747", "amazon": "B0000000X"}) {
+		t.Errorf("identifiers = %v", moby.Identifiers)
+	}
+	if meta.Identifier != "urn:isbn:9780000000001" {
+		t.Errorf("identifier = %q", meta.Identifier)
+	}
+	if want := []string{"amazon:B0000000X", "goodreads:153747", "urn:uuid:2b0d4a6e-0000-4000-8000-000000000001"}; !reflect.DeepEqual(meta.AltIdentifier, want) {
+		t.Errorf("alternate identifiers = %q, want %q", meta.AltIdentifier, want)
+	}
+
+	formats := []Format{
+		{Name: "EPUB", Path: "Herman Melville/Moby Dick (1)/Moby Dick - Herman Melville.epub", MediaType: "application/epub+zip", Size: 1000},
+		{Name: "PDF", Path: "Herman Melville/Moby Dick (1)/Moby Dick - Herman Melville.pdf", MediaType: "application/pdf", Size: 2000},
+	}
+	if !reflect.DeepEqual(moby.Formats, formats) {
+		t.Errorf("formats = %+v", moby.Formats)
+	}
+	if moby.Cover != "Herman Melville/Moby Dick (1)/cover.jpg" {
+		t.Errorf("cover = %q", moby.Cover)
+	}
+
+	hugo := books[1].Publication.Metadata
+	if hugo.Title.String() != "Les Misérables" || hugo.SortAs != "Misérables, Les" {
+		t.Errorf("title = %q, sort as = %q", hugo.Title.String(), hugo.SortAs)
+	}
+	if hugo.Identifier != "urn:uuid:d2d8fe6c-0000-4000-8000-000000000002" || !reflect.DeepEqual(hugo.AltIdentifier, []string{"https://doi.org/10.1000/182"}) {
+		t.Errorf("identifier = %q, alternate identifiers = %q", hugo.Identifier, hugo.AltIdentifier)
+	}
+	// Calibre stores the year 101 for an unknown date
+	if hugo.PublicationDate != nil || hugo.Rating != 0 || books[1].Cover != "" {
+		t.Errorf("published = %v, rating = %v, cover = %q", hugo.PublicationDate, hugo.Rating, books[1].Cover)
+	}
+}
+
+func TestReadSidecars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calibre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	book := filepath.Join(dir, "Herman Melville", "Moby Dick (1)")
+	if err := os.MkdirAll(book, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		SidecarName: `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="uuid_id" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:identifier opf:scheme="calibre" id="calibre_id">1</dc:identifier>
+    <dc:identifier opf:scheme="uuid" id="uuid_id">2b0d4a6e-0000-4000-8000-000000000001</dc:identifier>
+    <dc:identifier opf:scheme="ISBN">9780000000001</dc:identifier>
+    <dc:identifier opf:scheme="GOODREADS">153747</dc:identifier>
+    <dc:title>Moby Dick</dc:title>
+    <dc:creator opf:file-as="Melville, Herman" opf:role="aut">Herman Melville</dc:creator>
+    <dc:language>eng</dc:language>
+    <meta name="calibre:rating" content="6"/>
+  </metadata>
+  <guide>
+    <reference type="cover" title="Cover" href="cover.jpg"/>
+  </guide>
+</package>`,
+		"cover.jpg":                        "\xff\xd8\xff",
+		"Moby Dick - Herman Melville.epub": "epub",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(book, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	books, errs := ReadLibrary(dir)
+	if len(errs) > 0 || len(books) != 1 {
+		t.Fatalf("%d books, errors %v", len(books), errs)
+	}
+	b := books[0]
+	meta := b.Publication.Metadata
+	if b.ID != 1 || b.Path != "Herman Melville/Moby Dick (1)" || b.Cover != "Herman Melville/Moby Dick (1)/cover.jpg" {
+		t.Errorf("id = %d, path = %q, cover = %q", b.ID, b.Path, b.Cover)
+	}
+	if len(b.Formats) != 1 || b.Formats[0].Name != "EPUB" || b.Formats[0].Size != 4 {
+		t.Errorf("formats = %+v", b.Formats)
+	}
+	if meta.Identifier != "urn:isbn:9780000000001" || !reflect.DeepEqual(meta.AltIdentifier, []string{"goodreads:153747", "urn:uuid:2b0d4a6e-0000-4000-8000-000000000001"}) {
+		t.Errorf("identifier = %q, alternate identifiers = %q", meta.Identifier, meta.AltIdentifier)
+	}
+	if b.Rating != 3 || meta.Rating != 3 {
+		t.Errorf("rating = %v, publication rating = %v", b.Rating, meta.Rating)
+	}
+	if !reflect.DeepEqual([]string(meta.Language), []string{"en"}) || meta.Modified == nil {
+		t.Errorf("languages = %q, modified = %v", meta.Language, meta.Modified)
+	}
+}
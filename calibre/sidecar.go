@@ -0,0 +1,152 @@
+package calibre
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/epub"
+)
+
+// SidecarName is the name of the metadata files Calibre writes in the
+// directory of each book
+const SidecarName = "metadata.opf"
+
+// sidecar are the calibre metadata of a metadata.opf that are not in the
+// publication read from it
+type sidecar struct {
+	Identifiers []struct {
+		Scheme string `xml:"scheme,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"metadata>identifier"`
+	Metas []struct {
+		Name    string `xml:"name,attr"`
+		Content string `xml:"content,attr"`
+	} `xml:"metadata>meta"`
+	Guide []struct {
+		Type string `xml:"type,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"guide>reference"`
+}
+
+// ReadSidecars read the books of a library from the metadata.opf files of
+// their directories, sorted by path, with the errors of the files that
+// could not be read, every other file of the directory of a book is one of
+// its formats
+func ReadSidecars(dir string) ([]Book, []error) {
+	var books []Book
+	var errs []error
+
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+			return nil
+		}
+		if info.IsDir() || info.Name() != SidecarName {
+			return nil
+		}
+		b, err := readSidecar(dir, name)
+		if err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+			return nil
+		}
+		books = append(books, b)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return books, errs
+}
+
+func readSidecar(dir string, name string) (Book, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return Book{}, err
+	}
+	book, err := epub.ParsePackage(data)
+	if err != nil {
+		return Book{}, err
+	}
+	var s sidecar
+	if err := xml.Unmarshal(data, &s); err != nil {
+		return Book{}, err
+	}
+
+	rel, err := filepath.Rel(dir, filepath.Dir(name))
+	if err != nil {
+		return Book{}, err
+	}
+	b := Book{Publication: book.Publication, Path: filepath.ToSlash(rel), Identifiers: make(map[string]string)}
+	meta := &b.Publication.Metadata
+
+	uuid := ""
+	for _, i := range s.Identifiers {
+		value := strings.TrimSpace(i.Value)
+		switch scheme := strings.ToLower(i.Scheme); scheme {
+		case "calibre":
+			b.ID, _ = strconv.ParseInt(value, 10, 64)
+		case "uuid":
+			uuid = value
+		case "":
+		default:
+			b.Identifiers[scheme] = value
+		}
+	}
+	for _, m := range s.Metas {
+		if m.Name == "calibre:rating" {
+			if rating, err := strconv.ParseFloat(m.Content, 64); err == nil {
+				b.Rating = stars(rating)
+			}
+		}
+	}
+	b.mapIdentifiers(uuid)
+	for i, l := range meta.Language {
+		meta.Language[i] = languageTag(l)
+	}
+	// Calibre rewrite the file when the metadata of the book change
+	if meta.Modified == nil {
+		if info, err := os.Stat(name); err == nil {
+			t := info.ModTime().UTC().Truncate(time.Second)
+			meta.Modified = &t
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(name))
+	if err != nil {
+		return Book{}, err
+	}
+	cover := "cover.jpg"
+	for _, g := range s.Guide {
+		if g.Type == "cover" && g.Href != "" {
+			cover = g.Href
+		}
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || f.Name() == SidecarName {
+			continue
+		}
+		if f.Name() == cover {
+			b.Cover = path.Join(b.Path, f.Name())
+			continue
+		}
+		format := strings.TrimPrefix(filepath.Ext(f.Name()), ".")
+		if format == "" {
+			continue
+		}
+		b.Formats = append(b.Formats, Format{
+			Name:      strings.ToUpper(format),
+			Path:      path.Join(b.Path, f.Name()),
+			MediaType: MediaType(format),
+			Size:      f.Size(),
+		})
+	}
+
+	return b, nil
+}
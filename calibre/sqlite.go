@@ -0,0 +1,490 @@
+package calibre
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrNotSQLite is returned for a metadata.db that is not a SQLite 3
+// database
+var ErrNotSQLite = errors.New("calibre: not a sqlite database")
+
+var errCorrupt = errors.New("calibre: corrupt database")
+
+// b-tree page types
+const (
+	interiorTable = 0x05
+	leafTable     = 0x0d
+)
+
+// database is a read-only SQLite 3 database, only the tables with a rowid
+// are read, indexes are not used as every row is read
+type database struct {
+	r        io.ReaderAt
+	size     int64
+	pageSize int
+	usable   int
+	encoding byte
+	tables   map[string]*table
+}
+
+type table struct {
+	root    uint32
+	columns []string
+	// rowid is the index of the INTEGER PRIMARY KEY column, an alias of
+	// the rowid stored as NULL in the records, -1 without it
+	rowid int
+}
+
+// row is a row of a table by column name, the values are nil, int64,
+// float64, string or []byte
+type row map[string]interface{}
+
+func (r row) int(column string) int64 {
+	switch v := r[column].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func (r row) float(column string) float64 {
+	switch v := r[column].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func (r row) text(column string) string {
+	switch v := r[column].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// openDatabase read the header and the schema of a database of size bytes
+func openDatabase(r io.ReaderAt, size int64) (*database, error) {
+	header := make([]byte, 100)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrNotSQLite
+		}
+		return nil, err
+	}
+	if !bytes.HasPrefix(header, []byte("SQLite format 3\x00")) {
+		return nil, ErrNotSQLite
+	}
+
+	db := &database{r: r, size: size, tables: make(map[string]*table)}
+	db.pageSize = int(binary.BigEndian.Uint16(header[16:]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	if db.pageSize < 512 || db.pageSize&(db.pageSize-1) != 0 {
+		return nil, errCorrupt
+	}
+	db.usable = db.pageSize - int(header[20])
+	if db.usable < 480 {
+		return nil, errCorrupt
+	}
+	db.encoding = header[59]
+	if db.encoding == 0 {
+		db.encoding = 1
+	}
+
+	// sqlite_master has the type, name, tbl_name, rootpage and sql columns
+	master := &table{root: 1, columns: []string{"type", "name", "tbl_name", "rootpage", "sql"}, rowid: -1}
+	rows, err := db.scan(master)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if r.text("type") != "table" {
+			continue
+		}
+		columns, rowid := parseColumns(r.text("sql"))
+		db.tables[strings.ToLower(r.text("name"))] = &table{
+			root:    uint32(r.int("rootpage")),
+			columns: columns,
+			rowid:   rowid,
+		}
+	}
+
+	return db, nil
+}
+
+// rows return every row of a table, nil when the database has no such
+// table
+func (db *database) rows(name string) ([]row, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, nil
+	}
+	return db.scan(t)
+}
+
+func (db *database) page(n uint32) ([]byte, error) {
+	offset := int64(n-1) * int64(db.pageSize)
+	if n == 0 || offset+int64(db.pageSize) > db.size {
+		return nil, errCorrupt
+	}
+	p := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(p, offset); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// scan walk the b-tree of a table from its root in rowid order
+func (db *database) scan(t *table) ([]row, error) {
+	var rows []row
+	visited := make(map[uint32]bool)
+
+	var walk func(n uint32) error
+	walk = func(n uint32) error {
+		if visited[n] {
+			return errCorrupt
+		}
+		visited[n] = true
+
+		p, err := db.page(n)
+		if err != nil {
+			return err
+		}
+		// the first page starts with the database header
+		start := 0
+		if n == 1 {
+			start = 100
+		}
+		if len(p) < start+8 {
+			return errCorrupt
+		}
+		kind := p[start]
+		count := int(binary.BigEndian.Uint16(p[start+3:]))
+		pointers := start + 8
+		if kind == interiorTable {
+			pointers = start + 12
+		}
+		if pointers+2*count > len(p) {
+			return errCorrupt
+		}
+
+		for i := 0; i < count; i++ {
+			cell := int(binary.BigEndian.Uint16(p[pointers+2*i:]))
+			if cell >= db.usable {
+				return errCorrupt
+			}
+			switch kind {
+			case interiorTable:
+				if cell+4 > len(p) {
+					return errCorrupt
+				}
+				if err := walk(binary.BigEndian.Uint32(p[cell:])); err != nil {
+					return err
+				}
+			case leafTable:
+				r, err := db.leafCell(p, cell, t)
+				if err != nil {
+					return err
+				}
+				rows = append(rows, r)
+			default:
+				return errCorrupt
+			}
+		}
+
+		if kind == interiorTable {
+			return walk(binary.BigEndian.Uint32(p[start+8:]))
+		}
+		return nil
+	}
+
+	if err := walk(t.root); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// leafCell read the row of a cell of a table leaf page, the end of a large
+// record is in a list of overflow pages
+func (db *database) leafCell(p []byte, cell int, t *table) (row, error) {
+	payloadSize, n := varint(p[cell:])
+	if n == 0 {
+		return nil, errCorrupt
+	}
+	cell += n
+	rowid, n := varint(p[cell:])
+	if n == 0 {
+		return nil, errCorrupt
+	}
+	cell += n
+
+	size := int(payloadSize)
+	if payloadSize > uint64(db.size) {
+		return nil, errCorrupt
+	}
+	local := db.localSize(size)
+	if cell+local > db.usable {
+		return nil, errCorrupt
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, p[cell:cell+local]...)
+
+	if local < size {
+		if cell+local+4 > db.usable {
+			return nil, errCorrupt
+		}
+		next := binary.BigEndian.Uint32(p[cell+local:])
+		visited := make(map[uint32]bool)
+		for len(payload) < size {
+			if next == 0 || visited[next] {
+				return nil, errCorrupt
+			}
+			visited[next] = true
+			o, err := db.page(next)
+			if err != nil {
+				return nil, err
+			}
+			next = binary.BigEndian.Uint32(o)
+			chunk := o[4:db.usable]
+			if rest := size - len(payload); len(chunk) > rest {
+				chunk = chunk[:rest]
+			}
+			payload = append(payload, chunk...)
+		}
+	}
+
+	values, err := db.record(payload)
+	if err != nil {
+		return nil, err
+	}
+	r := make(row, len(t.columns))
+	for i, c := range t.columns {
+		// columns added after the row was written are missing
+		if i < len(values) {
+			r[c] = values[i]
+		}
+	}
+	if t.rowid >= 0 {
+		r[t.columns[t.rowid]] = int64(rowid)
+	}
+	return r, nil
+}
+
+// localSize return the part of a payload stored in a table leaf page
+func (db *database) localSize(size int) int {
+	max := db.usable - 35
+	if size <= max {
+		return size
+	}
+	min := (db.usable-12)*32/255 - 23
+	local := min + (size-min)%(db.usable-4)
+	if local > max {
+		return min
+	}
+	return local
+}
+
+// record decode the values of a record, a header with the serial type of
+// each column followed by their data
+func (db *database) record(payload []byte) ([]interface{}, error) {
+	headerSize, n := varint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, errCorrupt
+	}
+
+	var types []uint64
+	for pos := n; pos < int(headerSize); {
+		t, n := varint(payload[pos:int(headerSize)])
+		if n == 0 {
+			return nil, errCorrupt
+		}
+		types = append(types, t)
+		pos += n
+	}
+
+	var values []interface{}
+	data := payload[headerSize:]
+	for _, t := range types {
+		var size int
+		switch {
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = int((t - 12) / 2)
+		}
+		if size > len(data) {
+			return nil, errCorrupt
+		}
+		b := data[:size]
+		data = data[size:]
+
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t <= 6:
+			// big-endian two's complement integers
+			v := int64(int8(b[0]))
+			for _, c := range b[1:] {
+				v = v<<8 | int64(c)
+			}
+			values = append(values, v)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(b)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t >= 12 && t%2 == 0:
+			values = append(values, b)
+		case t >= 13:
+			values = append(values, db.decodeText(b))
+		default:
+			return nil, errCorrupt
+		}
+	}
+
+	return values, nil
+}
+
+func (db *database) decodeText(b []byte) string {
+	if db.encoding == 1 {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if db.encoding == 2 {
+			u[i] = binary.LittleEndian.Uint16(b[2*i:])
+		} else {
+			u[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+// varint read a variable length integer of up to 9 bytes, n is 0 when the
+// data is truncated
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// parseColumns return the column names of a CREATE TABLE statement and the
+// index of its INTEGER PRIMARY KEY column, -1 when it has none
+func parseColumns(sql string) ([]string, int) {
+	start := strings.IndexByte(sql, '(')
+	end := strings.LastIndexByte(sql, ')')
+	if start < 0 || end < start {
+		return nil, -1
+	}
+
+	var columns []string
+	rowid := -1
+	for _, definition := range splitDefinitions(sql[start+1 : end]) {
+		name, rest, quoted := columnName(strings.TrimSpace(definition))
+		if name == "" {
+			continue
+		}
+		if !quoted {
+			switch strings.ToUpper(name) {
+			case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+				continue
+			}
+		}
+
+		upper := strings.ToUpper(strings.Join(strings.Fields(rest), " "))
+		if strings.HasPrefix(upper, "INTEGER") && strings.Contains(upper, "PRIMARY KEY") && !strings.Contains(upper, "PRIMARY KEY DESC") {
+			rowid = len(columns)
+		}
+		columns = append(columns, name)
+	}
+
+	return columns, rowid
+}
+
+// splitDefinitions split the definitions of a table on the commas out of
+// parentheses and quotes
+func splitDefinitions(s string) []string {
+	var definitions []string
+	depth := 0
+	var quote byte
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			definitions = append(definitions, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(definitions, s[last:])
+}
+
+// columnName return the name starting a definition, unquoted, and the
+// rest of the definition, a name that is not quoted end at a space or a
+// parenthesis like in UNIQUE(a, b)
+func columnName(definition string) (string, string, bool) {
+	if definition == "" {
+		return "", "", false
+	}
+
+	closing := byte(0)
+	switch definition[0] {
+	case '"', '\'', '`':
+		closing = definition[0]
+	case '[':
+		closing = ']'
+	}
+	if closing != 0 {
+		if end := strings.IndexByte(definition[1:], closing); end >= 0 {
+			return definition[1 : end+1], definition[end+2:], true
+		}
+	}
+
+	end := strings.IndexAny(definition, " \t\r\n(")
+	if end < 0 {
+		return definition, "", false
+	}
+	return definition[:end], definition[end:], false
+}
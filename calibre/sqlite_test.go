@@ -0,0 +1,129 @@
+package calibre
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func openFixture(t *testing.T, data []byte) *database {
+	db, err := openDatabase(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestEncodings(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding byte
+	}{
+		{libraryDir + "/metadata.db", 1},
+		{"testdata/utf16le.db", 2},
+		{"testdata/utf16be.db", 3},
+	}
+	for _, test := range tests {
+		db := openFixture(t, readFixture(t, test.name))
+		if db.encoding != test.encoding {
+			t.Errorf("%s: encoding %d", test.name, db.encoding)
+		}
+		books, err := readBooks(db)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(books) < 3 {
+			t.Fatalf("%s: %d books", test.name, len(books))
+		}
+		meta := books[1].Publication.Metadata
+		if meta.Title.String() != "Les Misérables" || meta.Author[0].Name.String() != "Victor Hugo" {
+			t.Errorf("%s: %q by %+v", test.name, meta.Title.String(), meta.Author)
+		}
+		// the description spans overflow pages
+		description := books[0].Publication.Metadata.Description
+		if len(description) != 7513 || !strings.HasSuffix(description, "<p>Chapter 399.</p>") {
+			t.Errorf("%s: description of %d bytes", test.name, len(description))
+		}
+	}
+}
+
+func TestCorruptDatabase(t *testing.T) {
+	data := readFixture(t, libraryDir+"/metadata.db")
+	db := openFixture(t, data)
+	pageOffset := func(n uint32) int { return int(n-1) * db.pageSize }
+
+	// the books table is large enough to have an interior root page
+	books := db.tables["books"].root
+	if data[pageOffset(books)] != interiorTable {
+		t.Fatalf("books root page of type %d", data[pageOffset(books)])
+	}
+	// the only comment is the first cell of the leaf root of its table,
+	// the end of its record is in overflow pages
+	comments := pageOffset(db.tables["comments"].root)
+	cell := comments + int(binary.BigEndian.Uint16(data[comments+8:]))
+	size, n := varint(data[cell:])
+	_, m := varint(data[cell+n:])
+	overflow := cell + n + m + db.localSize(int(size))
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+		err     error
+	}{
+		{"header", func(b []byte) []byte { b[0] = 'X'; return b }, ErrNotSQLite},
+		{"empty", func(b []byte) []byte { return b[:50] }, ErrNotSQLite},
+		{"page size", func(b []byte) []byte { binary.BigEndian.PutUint16(b[16:], 768); return b }, errCorrupt},
+		{"reserved space", func(b []byte) []byte { b[20] = 255; return b }, errCorrupt},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-db.pageSize] }, errCorrupt},
+		{"page type", func(b []byte) []byte { b[pageOffset(books)] = 0x02; return b }, errCorrupt},
+		{"cell count", func(b []byte) []byte { binary.BigEndian.PutUint16(b[pageOffset(books)+3:], 0xffff); return b }, errCorrupt},
+		{"cycle", func(b []byte) []byte { binary.BigEndian.PutUint32(b[pageOffset(books)+8:], books); return b }, errCorrupt},
+		{"page number", func(b []byte) []byte { binary.BigEndian.PutUint32(b[pageOffset(books)+8:], 1<<30); return b }, errCorrupt},
+		{"no overflow page", func(b []byte) []byte { binary.BigEndian.PutUint32(b[overflow:], 0); return b }, errCorrupt},
+		{"overflow cycle", func(b []byte) []byte {
+			first := binary.BigEndian.Uint32(b[overflow:])
+			binary.BigEndian.PutUint32(b[pageOffset(first):], first)
+			return b
+		}, errCorrupt},
+	}
+	for _, test := range tests {
+		corrupted := test.corrupt(append([]byte(nil), data...))
+		_, err := openDatabase(bytes.NewReader(corrupted), int64(len(corrupted)))
+		if err == nil {
+			db, _ := openDatabase(bytes.NewReader(corrupted), int64(len(corrupted)))
+			_, err = readBooks(db)
+		}
+		if err != test.err {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		sql     string
+		columns []string
+		rowid   int
+	}{
+		{`CREATE TABLE books ( id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT DEFAULT 'a, b', "sort" TEXT)`, []string{"id", "title", "sort"}, 0},
+		{`CREATE TABLE t (a TEXT, [b c] INTEGER, id INTEGER PRIMARY KEY, UNIQUE(a, id))`, []string{"a", "b c", "id"}, 2},
+		{`CREATE TABLE t (id INTEGER PRIMARY KEY DESC, CHECK(id > 0))`, []string{"id"}, -1},
+		{`CREATE TABLE t (id INT PRIMARY KEY)`, []string{"id"}, -1},
+	}
+	for _, test := range tests {
+		columns, rowid := parseColumns(test.sql)
+		if strings.Join(columns, ",") != strings.Join(test.columns, ",") || rowid != test.rowid {
+			t.Errorf("%s: columns %q, rowid %d", test.sql, columns, rowid)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opds-community/libopds2-go/calibre"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// ScanCalibre read the books of a Calibre library and return them in a feed
+// with an acquisition link to each format, the covers of the library are
+// linked where they are so CoverDir and CoverURL are not used
+func ScanCalibre(dir string, opts Options) (opds2.Feed, []error) {
+	if opts.Title == "" {
+		opts.Title = "Catalog"
+	}
+	feed := opds2.New(opts.Title)
+	if opts.SelfURL != "" {
+		feed.AddLink(opts.SelfURL, "self", "application/opds+json", false)
+	}
+
+	books, errs := calibre.ReadLibrary(dir)
+
+	var modified time.Time
+	for _, b := range books {
+		p := b.Publication
+		for _, f := range b.Formats {
+			p.AddLink(resolve(opts.BaseURL, escapePath(f.Path)), f.MediaType, AcquisitionRel, "")
+		}
+		if b.Cover != "" {
+			mediaType, height, width := imageInfo(filepath.Join(dir, filepath.FromSlash(b.Cover)))
+			p.AddImage(resolve(opts.BaseURL, escapePath(b.Cover)), mediaType, height, width)
+		}
+		if p.Images == nil {
+			p.Images = []opds2.Link{}
+		}
+		if p.Metadata.Modified != nil && p.Metadata.Modified.After(modified) {
+			modified = *p.Metadata.Modified
+		}
+		feed.Publications = append(feed.Publications, p)
+	}
+	if !modified.IsZero() {
+		feed.Metadata.Modified = &modified
+	}
+
+	return feed, errs
+}
+
+// imageInfo return the media type and the size of an image file, the
+// media type of Calibre covers when it cannot be read
+func imageInfo(name string) (string, int, int) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "image/jpeg", 0, 0
+	}
+	defer f.Close()
+
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return "image/jpeg", 0, 0
+	}
+	return "image/" + format, config.Height, config.Width
+}
@@ -0,0 +1,296 @@
+// Package catalog build an OPDS 2.0 catalog from a directory of publication
+// files, so a collection can be self-hosted as static files next to the
+// catalog.
+//
+// EPUB, PDF, CBZ and CBR comics, Readium audiobooks and LPF files are read,
+// other files are ignored.
+//
+//	feed, errs := catalog.Scan("books", catalog.Options{
+//		BaseURL:  "https://example.com/books/",
+//		CoverDir: "books/covers",
+//		CoverURL: "https://example.com/books/covers/",
+//	})
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"image"
+	// formats of the covers measured
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/audiobook"
+	"github.com/opds-community/libopds2-go/comic"
+	"github.com/opds-community/libopds2-go/epub"
+	"github.com/opds-community/libopds2-go/opds2"
+	"github.com/opds-community/libopds2-go/pdf"
+)
+
+// AcquisitionRel is the relation of the links to the files
+const AcquisitionRel = "http://opds-spec.org/acquisition"
+
+// Options change the catalog built from a directory
+type Options struct {
+	// Title of the feed, "Catalog" when empty
+	Title string
+	// SelfURL is the url of the feed, there is no self link when it is
+	// empty
+	SelfURL string
+	// BaseURL is the url of the directory scanned, the acquisition links
+	// are relative paths from the directory when it is empty, for a feed
+	// written in it
+	BaseURL string
+	// CoverDir is the directory where the covers are written, there is no
+	// cover when it is empty
+	CoverDir string
+	// CoverURL is the url of CoverDir, it is the path of CoverDir from the
+	// directory scanned when empty
+	CoverURL string
+}
+
+// FileError is an error reading a file of the directory
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// file is a publication read from a file with its cover
+type file struct {
+	publication opds2.Publication
+	mediaType   string
+	cover       []byte
+	coverType   string
+}
+
+// extractors read the publication of a file by extension
+var extractors = map[string]func(name string) (*file, error){
+	".epub":      extractEPUB,
+	".pdf":       extractPDF,
+	".cbz":       extractComic,
+	".cbr":       extractComic,
+	".audiobook": extractAudiobook,
+	".lpf":       extractAudiobook,
+}
+
+func extractEPUB(name string) (*file, error) {
+	book, err := epub.ParseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{publication: book.Publication, mediaType: epub.MediaType}
+	if book.Cover != nil {
+		f.cover, f.coverType = book.Cover.Data, book.Cover.MediaType
+	}
+	return f, nil
+}
+
+func extractPDF(name string) (*file, error) {
+	doc, err := pdf.ParseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{publication: doc.Publication, mediaType: pdf.MediaType}
+	if doc.Cover != nil {
+		f.cover, f.coverType = doc.Cover.Data, doc.Cover.MediaType
+	}
+	return f, nil
+}
+
+func extractComic(name string) (*file, error) {
+	c, err := comic.ParseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{publication: c.Publication, mediaType: c.MediaType}
+	if c.Cover != nil {
+		f.cover, f.coverType = c.Cover.Data, c.Cover.MediaType
+	}
+	return f, nil
+}
+
+func extractAudiobook(name string) (*file, error) {
+	a, err := audiobook.ParseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{publication: a.Publication, mediaType: a.MediaType}
+	if a.Cover != nil {
+		f.cover, f.coverType = a.Cover.Data, a.Cover.MediaType
+	}
+	return f, nil
+}
+
+// Scan read every publication file in the directory tree, sorted by path,
+// and return them in a feed with the errors of the files that could not be
+// read, the publications without title are named after their file
+func Scan(dir string, opts Options) (opds2.Feed, []error) {
+	var errs []error
+
+	if opts.Title == "" {
+		opts.Title = "Catalog"
+	}
+	feed := opds2.New(opts.Title)
+	if opts.SelfURL != "" {
+		feed.AddLink(opts.SelfURL, "self", "application/opds+json", false)
+	}
+
+	var names []string
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+			return nil
+		}
+		if !info.IsDir() && extractors[strings.ToLower(filepath.Ext(name))] != nil {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	sort.Strings(names)
+
+	var modified time.Time
+	for _, name := range names {
+		p, err := readFile(dir, name, opts)
+		if err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+			continue
+		}
+		if p.Metadata.Modified != nil && p.Metadata.Modified.After(modified) {
+			modified = *p.Metadata.Modified
+		}
+		feed.Publications = append(feed.Publications, p)
+	}
+	if !modified.IsZero() {
+		feed.Metadata.Modified = &modified
+	}
+
+	return feed, errs
+}
+
+// readFile return the publication of a file with an acquisition link and
+// its cover
+func readFile(dir string, name string, opts Options) (opds2.Publication, error) {
+
+	f, err := extractors[strings.ToLower(filepath.Ext(name))](name)
+	if err != nil {
+		return opds2.Publication{}, err
+	}
+	p := f.publication
+
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		return opds2.Publication{}, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	if p.Metadata.Title.String() == "" {
+		p.Metadata.Title.SingleString = strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	}
+	if p.Metadata.Modified == nil {
+		if info, err := os.Stat(name); err == nil {
+			t := info.ModTime().UTC().Truncate(time.Second)
+			p.Metadata.Modified = &t
+		}
+	}
+
+	p.AddLink(resolve(opts.BaseURL, escapePath(rel)), f.mediaType, AcquisitionRel, "")
+
+	if f.cover != nil && opts.CoverDir != "" {
+		href, err := writeCover(dir, rel, f.cover, f.coverType, opts)
+		if err != nil {
+			return opds2.Publication{}, err
+		}
+		height, width := 0, 0
+		if config, _, err := image.DecodeConfig(bytes.NewReader(f.cover)); err == nil {
+			height, width = config.Height, config.Width
+		}
+		p.AddImage(href, f.coverType, height, width)
+	}
+	if p.Images == nil {
+		p.Images = []opds2.Link{}
+	}
+
+	return p, nil
+}
+
+// writeCover write a cover in CoverDir named after the hash of the path of
+// its publication and return its url
+func writeCover(dir string, rel string, data []byte, mediaType string, opts Options) (string, error) {
+
+	sum := sha1.Sum([]byte(rel))
+	name := hex.EncodeToString(sum[:])[:16] + coverExtension(mediaType)
+
+	if err := os.MkdirAll(opts.CoverDir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(opts.CoverDir, name), data, 0644); err != nil {
+		return "", err
+	}
+
+	base := opts.CoverURL
+	if base == "" {
+		coverDir, err := filepath.Rel(dir, opts.CoverDir)
+		if err != nil {
+			coverDir = opts.CoverDir
+		}
+		base = escapePath(filepath.ToSlash(coverDir))
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base + name, nil
+}
+
+func coverExtension(mediaType string) string {
+	switch mediaType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return ""
+}
+
+// escapePath escape each segment of a slash separated path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// resolve return the url of a relative path from base, the path itself
+// when base is empty
+func resolve(base string, rel string) string {
+	if base == "" {
+		return rel
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base + rel
+}
@@ -0,0 +1,150 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipFile return a zip with the files given by name
+func zipFile(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// pngImage return a png of 3x2 pixels
+func pngImage(t *testing.T) string {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// writeLibrary write a directory of publications modified in 2019
+func writeLibrary(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cover := pngImage(t)
+	files := map[string][]byte{
+		"b/moby dick.epub": zipFile(t, map[string]string{
+			"META-INF/container.xml": `<container><rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`,
+			"content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Moby Dick</dc:title>
+    <meta property="dcterms:modified">2020-01-02T00:00:00Z</meta>
+  </metadata>
+  <manifest><item id="c" href="cover.png" media-type="image/png" properties="cover-image"/></manifest>
+</package>`,
+			"cover.png": cover,
+		}),
+		"a.cbz":        zipFile(t, map[string]string{"ComicInfo.xml": `<ComicInfo><Title>Saga</Title></ComicInfo>`, "01.png": cover}),
+		"untitled.cbz": zipFile(t, map[string]string{"01.png": cover}),
+		"broken.epub":  []byte("not a zip"),
+		"notes.txt":    []byte("ignored"),
+	}
+	modified := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(name, modified, modified)
+	}
+	return dir
+}
+
+func TestScan(t *testing.T) {
+	dir := writeLibrary(t)
+
+	tests := []struct {
+		name   string
+		opts   Options
+		hrefs  []string
+		covers string
+	}{
+		{
+			name:   "base url",
+			opts:   Options{BaseURL: "https://example.com/books", CoverDir: filepath.Join(dir, "covers"), CoverURL: "https://example.com/covers/"},
+			hrefs:  []string{"https://example.com/books/a.cbz", "https://example.com/books/b/moby%20dick.epub", "https://example.com/books/untitled.cbz"},
+			covers: "https://example.com/covers/",
+		},
+		{
+			name:   "relative",
+			opts:   Options{CoverDir: filepath.Join(dir, "my covers")},
+			hrefs:  []string{"a.cbz", "b/moby%20dick.epub", "untitled.cbz"},
+			covers: "my%20covers/",
+		},
+		{
+			name:  "without covers",
+			hrefs: []string{"a.cbz", "b/moby%20dick.epub", "untitled.cbz"},
+		},
+	}
+	for _, test := range tests {
+		feed, errs := Scan(dir, test.opts)
+
+		if len(errs) != 1 || !strings.HasSuffix(errs[0].(*FileError).Path, "broken.epub") {
+			t.Errorf("%s: errors %v", test.name, errs)
+		}
+		if feed.Metadata.Title != "Catalog" || feed.Metadata.Modified == nil || !feed.Metadata.Modified.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: feed metadata %+v", test.name, feed.Metadata)
+		}
+		if len(feed.Publications) != len(test.hrefs) {
+			t.Fatalf("%s: %d publications", test.name, len(feed.Publications))
+		}
+
+		for i, title := range []string{"Saga", "Moby Dick", "untitled"} {
+			p := feed.Publications[i]
+			if p.Metadata.Title.String() != title {
+				t.Errorf("%s: title %q, want %q", test.name, p.Metadata.Title.String(), title)
+			}
+			if len(p.Links) != 1 || p.Links[0].Href != test.hrefs[i] || !p.Links[0].HasRel(AcquisitionRel) {
+				t.Errorf("%s: %s: links %+v", test.name, title, p.Links)
+			}
+
+			if test.covers == "" {
+				if p.Images == nil || len(p.Images) != 0 {
+					t.Errorf("%s: %s: images %+v", test.name, title, p.Images)
+				}
+				continue
+			}
+			if len(p.Images) != 1 {
+				t.Errorf("%s: %s: images %+v", test.name, title, p.Images)
+				continue
+			}
+			image := p.Images[0]
+			if !strings.HasPrefix(image.Href, test.covers) || !strings.HasSuffix(image.Href, ".png") ||
+				image.TypeLink != "image/png" || image.Width != 3 || image.Height != 2 {
+				t.Errorf("%s: %s: image %+v", test.name, title, image)
+			}
+			if _, err := os.Stat(filepath.Join(test.opts.CoverDir, image.Href[len(test.covers):])); err != nil {
+				t.Errorf("%s: %s: %v", test.name, title, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package comic read the metadata and the cover of comic book archives,
+// CBZ and CBR, with the ComicInfo.xml written by ComicRack and most comic
+// managers.
+//
+// RAR decompression is not implemented, only the entries stored without
+// compression of a CBR are read, a CBR with compressed entries has no
+// metadata and no cover but its pages are still counted.
+package comic
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// media types of comic book archives
+const (
+	CBZMediaType = "application/vnd.comicbook+zip"
+	CBRMediaType = "application/vnd.comicbook-rar"
+)
+
+// errors of the archives that can not be read
+var (
+	ErrFormat     = errors.New("comic: not a zip or rar archive")
+	ErrCompressed = errors.New("comic: compressed rar entry")
+	ErrEncrypted  = errors.New("comic: encrypted rar archive")
+)
+
+// Comic is the publication read from a comic book archive
+type Comic struct {
+	// Publication has the metadata of ComicInfo.xml, it has no link as the
+	// location of the file is not known
+	Publication opds2.Publication
+	// MediaType is CBZMediaType or CBRMediaType
+	MediaType string
+	// Pages are the paths of the images in the archive in reading order
+	Pages []string
+	// Cover is the front cover, nil when it can not be read
+	Cover *Cover
+}
+
+// Cover is an image of a comic book archive
+type Cover struct {
+	// Path of the image in the archive
+	Path      string
+	MediaType string
+	Data      []byte
+}
+
+// archive is the content of a zip or a rar archive
+type archive interface {
+	names() []string
+	open(name string) ([]byte, error)
+}
+
+// ParseFile read a CBZ or a CBR file, the format is detected from the
+// content of the file rather than its extension as many CBR are zip files
+func ParseFile(name string) (*Comic, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(f, info.Size())
+}
+
+// Parse read a comic book archive of size bytes
+func Parse(r io.ReaderAt, size int64) (*Comic, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte("PK\x03\x04")):
+		return ParseCBZ(r, size)
+	case bytes.Equal(magic, []byte("Rar!")):
+		return ParseCBR(r, size)
+	}
+	return nil, ErrFormat
+}
+
+// ParseCBZ read a zip comic book archive
+func ParseCBZ(r io.ReaderAt, size int64) (*Comic, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return parseArchive(zipArchive{z}, CBZMediaType)
+}
+
+// ParseCBR read a rar comic book archive, RAR 4 and RAR 5 archives are
+// supported
+func ParseCBR(r io.ReaderAt, size int64) (*Comic, error) {
+	entries, err := readRAR(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return parseArchive(&rarArchive{r: r, entries: entries}, CBRMediaType)
+}
+
+func parseArchive(a archive, mediaType string) (*Comic, error) {
+	c := &Comic{MediaType: mediaType}
+
+	var info *comicInfo
+	for _, name := range a.names() {
+		if strings.EqualFold(path.Base(name), "ComicInfo.xml") && !isHidden(name) {
+			if data, err := a.open(name); err == nil {
+				info, _ = parseComicInfo(data)
+			}
+		} else if imageType(name) != "" && !isHidden(name) {
+			c.Pages = append(c.Pages, name)
+		}
+	}
+
+	// pages are named with numbers rarely padded with zeros
+	collator := opds2.NewCollator("")
+	sort.SliceStable(c.Pages, func(i, j int) bool {
+		return collator.Compare(c.Pages[i], c.Pages[j]) < 0
+	})
+
+	cover := 0
+	if info != nil {
+		c.Publication = info.publication()
+		cover = info.frontCover()
+	}
+	if cover >= len(c.Pages) {
+		cover = 0
+	}
+	if len(c.Pages) > 0 {
+		name := c.Pages[cover]
+		if data, err := a.open(name); err == nil {
+			c.Cover = &Cover{Path: name, MediaType: imageType(name), Data: data}
+		}
+	}
+
+	return c, nil
+}
+
+// isHidden tell if an entry is metadata of the archiver like __MACOSX or
+// .DS_Store
+func isHidden(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") || strings.HasPrefix(segment, "__MACOSX") {
+			return true
+		}
+	}
+	return false
+}
+
+// imageType return the media type of an image from its extension, empty
+// when it is not an image
+func imageType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	}
+	return ""
+}
+
+type zipArchive struct {
+	*zip.Reader
+}
+
+func (z zipArchive) names() []string {
+	var names []string
+	for _, f := range z.File {
+		if !f.FileInfo().IsDir() {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// maxFileSize limit the size of the files of a zip read in memory, a
+// larger file is an error rather than a zip bomb filling the memory
+const maxFileSize = 32 << 20
+
+var errTooLarge = errors.New("comic: file too large")
+
+func (z zipArchive) open(name string) ([]byte, error) {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(rc, maxFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxFileSize {
+			return nil, errTooLarge
+		}
+		return data, nil
+	}
+	return nil, os.ErrNotExist
+}
@@ -0,0 +1,157 @@
+package comic
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// comicInfo is the ComicInfo.xml of the Anansi Project schema
+type comicInfo struct {
+	Title       string `xml:"Title"`
+	Series      string `xml:"Series"`
+	Number      string `xml:"Number"`
+	Volume      int    `xml:"Volume"`
+	Summary     string `xml:"Summary"`
+	Year        int    `xml:"Year"`
+	Month       int    `xml:"Month"`
+	Day         int    `xml:"Day"`
+	Writer      string `xml:"Writer"`
+	Penciller   string `xml:"Penciller"`
+	Inker       string `xml:"Inker"`
+	Colorist    string `xml:"Colorist"`
+	Letterer    string `xml:"Letterer"`
+	CoverArtist string `xml:"CoverArtist"`
+	Editor      string `xml:"Editor"`
+	Translator  string `xml:"Translator"`
+	Publisher   string `xml:"Publisher"`
+	Imprint     string `xml:"Imprint"`
+	Genre       string `xml:"Genre"`
+	Tags        string `xml:"Tags"`
+	LanguageISO string `xml:"LanguageISO"`
+	GTIN        string `xml:"GTIN"`
+	Pages       []struct {
+		Image int    `xml:"Image,attr"`
+		Type  string `xml:"Type,attr"`
+	} `xml:"Pages>Page"`
+}
+
+func parseComicInfo(data []byte) (*comicInfo, error) {
+	var info comicInfo
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := dec.Decode(&info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// frontCover return the index of the front cover in the pages, the first
+// page when it is not set
+func (info *comicInfo) frontCover() int {
+	for _, p := range info.Pages {
+		if p.Type == "FrontCover" && p.Image >= 0 {
+			return p.Image
+		}
+	}
+	return 0
+}
+
+// publication map ComicInfo.xml to a publication, the issues without
+// title are named after their series and number
+func (info *comicInfo) publication() opds2.Publication {
+	var p opds2.Publication
+	meta := &p.Metadata
+
+	meta.Title.SingleString = strings.TrimSpace(info.Title)
+	series := strings.TrimSpace(info.Series)
+	if meta.Title.SingleString == "" && series != "" {
+		meta.Title.SingleString = series
+		if info.Number != "" {
+			meta.Title.SingleString += " #" + strings.TrimSpace(info.Number)
+		}
+	}
+
+	if series != "" {
+		c := opds2.Collection{Name: series}
+		if n, err := strconv.ParseFloat(strings.TrimSpace(info.Number), 32); err == nil {
+			c.Position = float32(n)
+		} else if info.Volume > 0 {
+			c.Position = float32(info.Volume)
+		}
+		meta.BelongsTo = &opds2.BelongsTo{Series: []opds2.Collection{c}}
+	}
+
+	meta.Description = strings.TrimSpace(info.Summary)
+	if info.Year > 0 {
+		month, day := info.Month, info.Day
+		if month < 1 || month > 12 {
+			month = 1
+		}
+		if day < 1 || day > 31 {
+			day = 1
+		}
+		t := time.Date(info.Year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		meta.PublicationDate = &t
+	}
+
+	meta.Author = contributors(info.Writer)
+	meta.Penciler = contributors(info.Penciller)
+	meta.Inker = contributors(info.Inker)
+	meta.Colorist = contributors(info.Colorist)
+	meta.Letterer = contributors(info.Letterer)
+	meta.Artist = contributors(info.CoverArtist)
+	meta.Editor = contributors(info.Editor)
+	meta.Translator = contributors(info.Translator)
+	meta.Publisher = contributors(info.Publisher)
+	meta.Imprint = contributors(info.Imprint)
+
+	seen := make(map[string]bool)
+	for _, s := range append(splitList(info.Genre), splitList(info.Tags)...) {
+		if !seen[strings.ToLower(s)] {
+			seen[strings.ToLower(s)] = true
+			meta.Subject = append(meta.Subject, opds2.Subject{Name: s})
+		}
+	}
+
+	if l := strings.TrimSpace(info.LanguageISO); l != "" {
+		meta.Language = opds2.StringOrArray{l}
+	}
+
+	gtin := strings.Replace(strings.TrimSpace(info.GTIN), "-", "", -1)
+	if len(gtin) == 13 && (strings.HasPrefix(gtin, "978") || strings.HasPrefix(gtin, "979")) {
+		meta.Identifier = "urn:isbn:" + gtin
+	} else {
+		meta.Identifier = gtin
+	}
+
+	return p
+}
+
+// contributors return the contributors of a comma separated list of names
+func contributors(names string) []opds2.Contributor {
+	var list []opds2.Contributor
+	for _, name := range splitList(names) {
+		list = append(list, opds2.Contributor{Name: opds2.MultiLanguage{SingleString: name}})
+	}
+	return list
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,316 @@
+package comic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// signatures of the RAR formats
+var (
+	rar4Signature = []byte("Rar!\x1a\x07\x00")
+	rar5Signature = []byte("Rar!\x1a\x07\x01\x00")
+)
+
+var errCorrupt = errors.New("comic: corrupt rar archive")
+
+// rar5MaxHeadSize is the largest header size allowed by RAR 5
+const rar5MaxHeadSize = 2 << 20
+
+// rarEntry is a file of a rar archive, its data is at offset when it is
+// stored
+type rarEntry struct {
+	name   string
+	offset int64
+	size   int64
+	stored bool
+}
+
+type rarArchive struct {
+	r       io.ReaderAt
+	entries []rarEntry
+}
+
+func (a *rarArchive) names() []string {
+	var names []string
+	for _, e := range a.entries {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+func (a *rarArchive) open(name string) ([]byte, error) {
+	for _, e := range a.entries {
+		if e.name != name {
+			continue
+		}
+		if !e.stored {
+			return nil, ErrCompressed
+		}
+		data := make([]byte, e.size)
+		if _, err := a.r.ReadAt(data, e.offset); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// readRAR list the files of a rar archive from their headers
+func readRAR(r io.ReaderAt, size int64) ([]rarEntry, error) {
+	signature := make([]byte, len(rar5Signature))
+	if _, err := r.ReadAt(signature, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(signature, rar5Signature):
+		return readRAR5(r, size, int64(len(rar5Signature)))
+	case bytes.HasPrefix(signature, rar4Signature):
+		return readRAR4(r, size, int64(len(rar4Signature)))
+	}
+	return nil, ErrFormat
+}
+
+// RAR 4 block types and flags
+const (
+	rar4MainHead    = 0x73
+	rar4FileHead    = 0x74
+	rar4EndArchive  = 0x7b
+	rar4LongBlock   = 0x8000
+	rar4HeadEncrypt = 0x0080
+	rar4Encrypted   = 0x0004
+	rar4LargeFile   = 0x0100
+	rar4Directory   = 0x00e0
+	rar4Store       = 0x30
+)
+
+// readRAR4 read the blocks of a RAR 4 archive starting at pos, each has a
+// 7 bytes header: crc, type, flags and size
+func readRAR4(r io.ReaderAt, size int64, pos int64) ([]rarEntry, error) {
+	var entries []rarEntry
+
+	for pos+7 <= size {
+		header := make([]byte, 7)
+		if _, err := r.ReadAt(header, pos); err != nil {
+			return nil, err
+		}
+		headType := header[2]
+		flags := binary.LittleEndian.Uint16(header[3:])
+		headSize := int64(binary.LittleEndian.Uint16(header[5:]))
+		if headSize < 7 || pos+headSize > size {
+			return nil, errCorrupt
+		}
+
+		var dataSize int64
+		switch headType {
+		case rar4MainHead:
+			if flags&rar4HeadEncrypt != 0 {
+				return nil, ErrEncrypted
+			}
+		case rar4FileHead:
+			h := make([]byte, headSize)
+			if _, err := r.ReadAt(h, pos); err != nil {
+				return nil, err
+			}
+			if len(h) < 32 {
+				return nil, errCorrupt
+			}
+			dataSize = int64(binary.LittleEndian.Uint32(h[7:]))
+			method := h[25]
+			nameSize := int(binary.LittleEndian.Uint16(h[26:]))
+			nameStart := 32
+			if flags&rar4LargeFile != 0 {
+				if len(h) < 40 {
+					return nil, errCorrupt
+				}
+				dataSize |= int64(binary.LittleEndian.Uint32(h[32:])) << 32
+				nameStart = 40
+			}
+			if nameStart+nameSize > len(h) {
+				return nil, errCorrupt
+			}
+			// unicode names have an ascii version first
+			name := h[nameStart : nameStart+nameSize]
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+			if dataSize < 0 || dataSize > size-pos-headSize {
+				return nil, errCorrupt
+			}
+			if flags&rar4Directory != rar4Directory {
+				entries = append(entries, rarEntry{
+					name:   strings.Replace(string(name), "\\", "/", -1),
+					offset: pos + headSize,
+					size:   dataSize,
+					stored: method == rar4Store && flags&rar4Encrypted == 0,
+				})
+			}
+		case rar4EndArchive:
+			return entries, nil
+		default:
+			if flags&rar4LongBlock != 0 {
+				add := make([]byte, 4)
+				if _, err := r.ReadAt(add, pos+7); err != nil {
+					return nil, err
+				}
+				dataSize = int64(binary.LittleEndian.Uint32(add))
+			}
+		}
+
+		pos += headSize + dataSize
+	}
+
+	// archives of old versions may end without an end of archive block
+	if pos != size {
+		return nil, errCorrupt
+	}
+	return entries, nil
+}
+
+// RAR 5 header types and flags
+const (
+	rar5FileHeader       = 2
+	rar5EncryptionHeader = 4
+	rar5EndHeader        = 5
+	rar5ExtraArea        = 0x01
+	rar5DataArea         = 0x02
+	rar5Directory        = 0x01
+	rar5HasTime          = 0x02
+	rar5HasCRC           = 0x04
+	rar5ExtraEncryption  = 1
+)
+
+// vintReader read the variable length integers of RAR 5 headers, ok is
+// false after reading past the end
+type vintReader struct {
+	b   []byte
+	off int
+	ok  bool
+}
+
+func (v *vintReader) next() uint64 {
+	var n uint64
+	for i := 0; v.off < len(v.b) && i < 10; i++ {
+		c := v.b[v.off]
+		v.off++
+		n |= uint64(c&0x7f) << (7 * uint(i))
+		if c&0x80 == 0 {
+			return n
+		}
+	}
+	v.ok = false
+	return 0
+}
+
+func (v *vintReader) skip(n int) {
+	v.off += n
+	if v.off > len(v.b) {
+		v.ok = false
+	}
+}
+
+// readRAR5 read the headers of a RAR 5 archive starting at pos, each
+// starts with a crc and its size
+func readRAR5(r io.ReaderAt, size int64, pos int64) ([]rarEntry, error) {
+	var entries []rarEntry
+
+	for pos+5 <= size {
+		prefix := make([]byte, 14)
+		if size-pos < int64(len(prefix)) {
+			prefix = prefix[:size-pos]
+		}
+		if _, err := r.ReadAt(prefix, pos); err != nil {
+			return nil, err
+		}
+		v := vintReader{b: prefix[4:], ok: true}
+		headSize := v.next()
+		start := pos + 4 + int64(v.off)
+		if !v.ok || headSize == 0 || headSize > rar5MaxHeadSize || start+int64(headSize) > size {
+			return nil, errCorrupt
+		}
+
+		h := make([]byte, headSize)
+		if _, err := r.ReadAt(h, start); err != nil {
+			return nil, err
+		}
+		v = vintReader{b: h, ok: true}
+		headType := v.next()
+		flags := v.next()
+		var extraSize, dataSize uint64
+		if flags&rar5ExtraArea != 0 {
+			extraSize = v.next()
+		}
+		if flags&rar5DataArea != 0 {
+			dataSize = v.next()
+		}
+		if dataSize > uint64(size-start-int64(headSize)) {
+			return nil, errCorrupt
+		}
+
+		switch headType {
+		case rar5FileHeader:
+			fileFlags := v.next()
+			v.next() // unpacked size
+			v.next() // attributes
+			if fileFlags&rar5HasTime != 0 {
+				v.skip(4)
+			}
+			if fileFlags&rar5HasCRC != 0 {
+				v.skip(4)
+			}
+			compression := v.next()
+			v.next() // host os
+			nameSize := v.next()
+			if nameSize > uint64(len(h)) {
+				return nil, errCorrupt
+			}
+			v.skip(int(nameSize))
+			if !v.ok || extraSize > uint64(len(h)) {
+				return nil, errCorrupt
+			}
+			name := string(h[v.off-int(nameSize) : v.off])
+			if fileFlags&rar5Directory == 0 {
+				entries = append(entries, rarEntry{
+					name:   name,
+					offset: start + int64(headSize),
+					size:   int64(dataSize),
+					stored: (compression>>7)&7 == 0 && !rar5Encrypted(h[len(h)-int(extraSize):]),
+				})
+			}
+		case rar5EncryptionHeader:
+			return nil, ErrEncrypted
+		case rar5EndHeader:
+			return entries, nil
+		}
+		if !v.ok {
+			return nil, errCorrupt
+		}
+
+		pos = start + int64(headSize) + int64(dataSize)
+	}
+
+	// the end of archive header is required
+	return nil, errCorrupt
+}
+
+// rar5Encrypted tell if the extra area of a file header has an encryption
+// record
+func rar5Encrypted(extra []byte) bool {
+	v := vintReader{b: extra, ok: true}
+	for v.ok && v.off < len(extra) {
+		size := v.next()
+		if size == 0 || size > uint64(len(extra)-v.off) {
+			break
+		}
+		end := v.off + int(size)
+		if v.next() == rar5ExtraEncryption {
+			return true
+		}
+		v.off = end
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package comic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// vint encode a variable length integer of RAR 5
+func vint(n uint64) []byte {
+	var b []byte
+	for n >= 0x80 {
+		b = append(b, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(b, byte(n))
+}
+
+// rar5Header return a RAR 5 header with a zero crc
+func rar5Header(fields ...[]byte) []byte {
+	body := bytes.Join(fields, nil)
+	h := append([]byte{0, 0, 0, 0}, vint(uint64(len(body)))...)
+	return append(h, body...)
+}
+
+// rar5File return the header of a stored file followed by its data
+func rar5File(name string, data []byte) []byte {
+	h := rar5Header(vint(rar5FileHeader), vint(rar5DataArea), vint(uint64(len(data))),
+		vint(0), vint(uint64(len(data))), vint(0), vint(0), vint(0),
+		vint(uint64(len(name))), []byte(name))
+	return append(h, data...)
+}
+
+func rar5End() []byte {
+	return rar5Header(vint(rar5EndHeader), vint(0), vint(0))
+}
+
+func rar5Archive(parts ...[]byte) []byte {
+	return bytes.Join(append([][]byte{rar5Signature}, parts...), nil)
+}
+
+func TestReadRAR5(t *testing.T) {
+	data := rar5Archive(rar5File("1.jpg", []byte("page")), rar5End())
+	c, err := Parse(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Pages) != 1 || c.Pages[0] != "1.jpg" {
+		t.Errorf("pages = %v", c.Pages)
+	}
+	if c.Cover == nil || string(c.Cover.Data) != "page" {
+		t.Errorf("cover = %v", c.Cover)
+	}
+}
+
+func TestReadRARMalformed(t *testing.T) {
+	file := rar5File("1.jpg", []byte("page"))
+
+	// a file header announcing more data than the archive has
+	tooLarge := rar5Header(vint(rar5FileHeader), vint(rar5DataArea), vint(1<<62),
+		vint(0), vint(0), vint(0), vint(0), vint(0), vint(5), []byte("1.jpg"))
+
+	// a file header with a name longer than the header
+	longName := rar5Header(vint(rar5FileHeader), vint(0),
+		vint(0), vint(0), vint(0), vint(0), vint(0), vint(1<<40), []byte("1.jpg"))
+
+	rar4 := append([]byte{}, rar4Signature...)
+	h := make([]byte, 32+5)
+	h[2] = rar4FileHead
+	binary.LittleEndian.PutUint16(h[3:], rar4LargeFile)
+	binary.LittleEndian.PutUint16(h[5:], uint16(len(h)+8))
+	binary.LittleEndian.PutUint32(h[7:], 0xffffffff)
+	binary.LittleEndian.PutUint16(h[26:], 5)
+	rar4 = append(rar4, h...)
+	rar4 = append(rar4, []byte{0, 0, 0, 0xff, 0, 0, 0, 0}...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"rar5 head size overflow", rar5Archive([]byte{0, 0, 0, 0}, vint(1<<63))},
+		{"rar5 head size over 2 MB", rar5Archive([]byte{0, 0, 0, 0}, vint(3<<20), make([]byte, 3<<20))},
+		{"rar5 data past the end", rar5Archive(tooLarge, rar5End())},
+		{"rar5 name past the end", rar5Archive(longName, rar5End())},
+		{"rar5 truncated data", rar5Archive(file[:len(file)-2])},
+		{"rar5 no end header", rar5Archive(file)},
+		{"rar4 truncated header", rar4[:len(rar4)-4]},
+		{"rar4 large data size", rar4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader(test.data), int64(len(test.data)))
+			if err != errCorrupt {
+				t.Errorf("err = %v, want %v", err, errCorrupt)
+			}
+		})
+	}
+}
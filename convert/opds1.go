@@ -0,0 +1,221 @@
+package convert
+
+import (
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds1"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// media types of OPDS 1.x feeds
+const (
+	typeNavigationFeed  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	typeAcquisitionFeed = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// ToOPDS1 is the reverse of ToOPDS2, groups are flattened in entries
+// with a collection link as defined in OPDS 1.2, entries without
+// modification date are updated with the feed
+func ToOPDS1(feed *opds2.Feed) opds1.Feed {
+	var opds1feed opds1.Feed
+
+	opds1feed.Title = feed.Metadata.Title
+	if feed.Metadata.Modified != nil {
+		opds1feed.Updated = *feed.Metadata.Modified
+	} else {
+		opds1feed.Updated = time.Now()
+	}
+	opds1feed.TotalResults = feed.Metadata.NumberOfItems
+	opds1feed.ItemsPerPage = feed.Metadata.ItemsPerPage
+
+	for _, l := range feed.Links {
+		opds1feed.Links = append(opds1feed.Links, fillOPDS1Link(l))
+		if opds1feed.ID == "" && l.HasRel("self") {
+			opds1feed.ID = l.Href
+		}
+	}
+	if opds1feed.ID == "" {
+		opds1feed.ID = feed.Metadata.Title
+	}
+
+	for _, f := range feed.Facets {
+		for _, l := range f.Links {
+			link := fillOPDS1Link(l)
+			link.Rel = "http://opds-spec.org/facet"
+			link.FacetGroup = f.Metadata.Title
+			link.ActiveFacet = l.HasRel("self")
+			opds1feed.Links = append(opds1feed.Links, link)
+		}
+	}
+
+	for _, l := range feed.Navigation {
+		opds1feed.Entries = append(opds1feed.Entries, fillOPDS1Navigation(l, opds1feed.Updated))
+	}
+
+	for _, p := range feed.Publications {
+		opds1feed.Entries = append(opds1feed.Entries, fillOPDS1Entry(p, opds1feed.Updated))
+	}
+
+	for _, g := range feed.Groups {
+		collLink := opds1.Link{Rel: "collection", Title: g.Metadata.Title, Count: g.Metadata.NumberOfItems}
+		for _, l := range g.Links {
+			if l.HasRel("self") || collLink.Href == "" {
+				collLink.Href = l.Href
+			}
+		}
+
+		for _, l := range g.Navigation {
+			entry := fillOPDS1Navigation(l, opds1feed.Updated)
+			if collLink.Href != "" {
+				entry.Links = append(entry.Links, collLink)
+			}
+			opds1feed.Entries = append(opds1feed.Entries, entry)
+		}
+		for _, p := range g.Publications {
+			entry := fillOPDS1Entry(p, opds1feed.Updated)
+			if collLink.Href != "" {
+				entry.Links = append(entry.Links, collLink)
+			}
+			opds1feed.Entries = append(opds1feed.Entries, entry)
+		}
+	}
+
+	return opds1feed
+}
+
+// ToOPDS1Entry convert a publication in an OPDS 1.x entry, as served in a
+// complete entry document, updated is the date of a publication without
+// modification date
+func ToOPDS1Entry(publication *opds2.Publication, updated time.Time) opds1.Entry {
+	return fillOPDS1Entry(*publication, updated)
+}
+
+func fillOPDS1Navigation(l opds2.Link, updated time.Time) opds1.Entry {
+	var entry opds1.Entry
+
+	entry.Title = l.Title
+	entry.ID = l.Href
+	entry.Updated = &updated
+	if l.Properties != nil {
+		if l.Properties.Modified != nil {
+			entry.Updated = l.Properties.Modified
+		}
+		if l.Properties.Description != "" {
+			entry.Content = opds1.Content{Content: l.Properties.Description, ContentType: "text"}
+		}
+	}
+
+	link := fillOPDS1Link(l)
+	if link.Rel == "" {
+		link.Rel = "subsection"
+	}
+	entry.Links = append(entry.Links, link)
+
+	return entry
+}
+
+func fillOPDS1Entry(p opds2.Publication, updated time.Time) opds1.Entry {
+	var entry opds1.Entry
+
+	entry.Title = p.Metadata.Title.String()
+	entry.ID = p.Metadata.Identifier
+	if strings.HasPrefix(p.Metadata.Identifier, "urn:isbn:") {
+		entry.Identifier = p.Metadata.Identifier
+	}
+	entry.Updated = p.Metadata.Modified
+	if entry.Updated == nil {
+		entry.Updated = &updated
+	}
+	entry.Published = p.Metadata.PublicationDate
+	entry.Rights = p.Metadata.Rights
+	if len(p.Metadata.Language) > 0 {
+		entry.Language = p.Metadata.Language[0]
+	}
+	if len(p.Metadata.Publisher) > 0 {
+		entry.Publisher = p.Metadata.Publisher[0].Name.String()
+	}
+
+	for _, a := range p.Metadata.Author {
+		author := opds1.Author{Name: a.Name.String(), URI: a.Identifier}
+		if author.URI == "" && len(a.Links) > 0 {
+			author.URI = a.Links[0].Href
+		}
+		entry.Author = append(entry.Author, author)
+	}
+
+	for _, s := range p.Metadata.Subject {
+		entry.Category = append(entry.Category, opds1.Category{Scheme: s.Scheme, Term: s.Code, Label: s.Name})
+	}
+
+	if p.Metadata.BelongsTo != nil {
+		for _, s := range p.Metadata.BelongsTo.Series {
+			serie := opds1.Serie{Name: s.Name, Position: s.Position}
+			if len(s.Links) > 0 {
+				serie.URL = s.Links[0].Href
+			}
+			entry.Series = append(entry.Series, serie)
+		}
+	}
+
+	if p.Metadata.Description != "" {
+		entry.Content = opds1.Content{Content: p.Metadata.Description, ContentType: "html"}
+	}
+
+	for _, l := range p.Links {
+		entry.Links = append(entry.Links, fillOPDS1Link(l))
+	}
+	for i, img := range p.Images {
+		link := fillOPDS1Link(img)
+		if link.Rel == "http://opds-spec.org/image" || link.Rel == "http://opds-spec.org/image/thumbnail" {
+		} else if i == 0 {
+			link.Rel = "http://opds-spec.org/image"
+		} else {
+			link.Rel = "http://opds-spec.org/image/thumbnail"
+		}
+		entry.Links = append(entry.Links, link)
+	}
+
+	return entry
+}
+
+func fillOPDS1Link(l opds2.Link) opds1.Link {
+	var link opds1.Link
+
+	link.Href = l.Href
+	link.TypeLink = l.TypeLink
+	link.Title = l.Title
+	if len(l.Rel) > 0 {
+		link.Rel = l.Rel[0]
+	}
+	if l.TypeLink == "application/opds+json" {
+		link.TypeLink = typeAcquisitionFeed
+		if len(l.Rel) > 0 && (l.Rel[0] == "subsection" || l.Rel[0] == "start") {
+			link.TypeLink = typeNavigationFeed
+		}
+	}
+
+	if l.Properties != nil {
+		link.Count = l.Properties.NumberOfItems
+		if l.Properties.Price != nil {
+			link.Price.CurrencyCode = l.Properties.Price.Currency
+			link.Price.Value = l.Properties.Price.Value
+		}
+		link.IndirectAcquisition = fillOPDS1IndirectAcquisition(l.Properties.IndirectAcquisition)
+	}
+
+	return link
+}
+
+func fillOPDS1IndirectAcquisition(indirects []opds2.IndirectAcquisition) []opds1.IndirectAcquisition {
+	var result []opds1.IndirectAcquisition
+
+	for _, ia := range indirects {
+		result = append(result, opds1.IndirectAcquisition{
+			TypeAcquisition:     ia.TypeAcquisition,
+			IndirectAcquisition: fillOPDS1IndirectAcquisition(ia.Child),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,342 @@
+// Package convert transform feeds between OPDS 1.x and OPDS 2.0
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds1"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Diagnostic report an entry of an OPDS 1.x feed that could not be
+// converted, or the feed itself when its href could not be resolved
+type Diagnostic struct {
+	EntryID string
+	Title   string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return "entry " + d.EntryID + " (" + d.Title + "): " + d.Message
+}
+
+// ToOPDS2 convert an OPDS 1.x feed in an OPDS 2.0 feed, relative href are
+// resolved against url when it is not empty
+func ToOPDS2(feed *opds1.Feed, url string) opds2.Feed {
+	opds2feed, _ := ToOPDS2WithDiagnostics(feed, url)
+	return opds2feed
+}
+
+// ToOPDS2WithDiagnostics is ToOPDS2 also returning the entries skipped
+// during the conversion and the failure to resolve href
+func ToOPDS2WithDiagnostics(feed *opds1.Feed, url string) (opds2.Feed, []Diagnostic) {
+	var opds2feed opds2.Feed
+	var diagnostics []Diagnostic
+
+	// If acquisition link check if rel='collection' than mean it is a group, if there no rel it is a publication
+
+	opds2feed.Metadata.Title = feed.Title
+	opds2feed.Metadata.Modified = &feed.Updated
+	if feed.TotalResults != 0 {
+		opds2feed.Metadata.NumberOfItems = feed.TotalResults
+	}
+	if feed.ItemsPerPage != 0 {
+		opds2feed.Metadata.ItemsPerPage = feed.ItemsPerPage
+	}
+
+	for _, entry := range feed.Entries {
+		// Get all entry, if entry has a acquisition puts in publication else it is a navigation link put in in links objetcs to
+		isAnNavigation := true
+		collLink := opds2.Link{}
+
+		for _, l := range entry.Links {
+			if strings.Contains(l.Rel, "http://opds-spec.org/acquisition") {
+				isAnNavigation = false
+			}
+			if l.Rel == "collection" || l.Rel == "http://opds-spec.org/group" {
+				collLink.Rel = []string{"collection"}
+				collLink.Href = l.Href
+				collLink.Title = l.Title
+				if l.Count > 0 {
+					collLink.Properties = &opds2.Properties{NumberOfItems: l.Count}
+				}
+			}
+		}
+
+		if isAnNavigation == false {
+			p := opds2.Publication{}
+			p.Metadata.Title.SingleString = entry.Title
+			if entry.Identifier != "" {
+				p.Metadata.Identifier = entry.Identifier
+			} else {
+				p.Metadata.Identifier = entry.ID
+			}
+			if entry.Language != "" {
+				p.Metadata.Language = []string{entry.Language}
+			}
+			p.Metadata.Modified = entry.Updated
+			p.Metadata.PublicationDate = entry.Published
+			p.Metadata.Rights = entry.Rights
+			if len(entry.Series) > 0 {
+				for _, s := range entry.Series {
+					coll := opds2.Collection{}
+					coll.Name = s.Name
+					coll.Position = s.Position
+					coll.Links = append(coll.Links, opds2.Link{Href: s.URL})
+					if p.Metadata.BelongsTo == nil {
+						p.Metadata.BelongsTo = &opds2.BelongsTo{}
+					}
+					p.Metadata.BelongsTo.Series = append(p.Metadata.BelongsTo.Series, coll)
+				}
+			}
+			if entry.Publisher != "" {
+				c := opds2.Contributor{}
+				c.Name.SingleString = entry.Publisher
+				p.Metadata.Publisher = append(p.Metadata.Publisher, c)
+			}
+
+			for _, cat := range entry.Category {
+				p.Metadata.Subject = append(p.Metadata.Subject, opds2.Subject{Code: cat.Term, Name: cat.Label, Scheme: cat.Scheme})
+			}
+
+			for _, aut := range entry.Author {
+				cont := opds2.Contributor{}
+				cont.Name.SingleString = aut.Name
+				cont.Identifier = aut.URI
+				p.Metadata.Author = append(p.Metadata.Author, cont)
+			}
+
+			// for html resource like description, atom:summary go to description
+			// if atom:content use it in description else use summary
+			if entry.Content.Content != "" {
+				p.Metadata.Description = entry.Content.Content
+			} else if entry.Summary.Content != "" {
+				p.Metadata.Description = entry.Summary.Content
+			}
+
+			for _, link := range entry.Links {
+				l := opds2.Link{}
+				l.Href = link.Href
+				l.TypeLink = link.TypeLink
+				l.Rel = []string{link.Rel}
+				l.Title = link.Title
+
+				if len(link.IndirectAcquisition) > 0 {
+					if l.Properties == nil {
+						l.Properties = &opds2.Properties{}
+					}
+
+					for _, ia := range link.IndirectAcquisition {
+						ind := opds2.IndirectAcquisition{}
+						ind.TypeAcquisition = ia.TypeAcquisition
+						if len(ia.IndirectAcquisition) > 0 {
+							for _, iac := range ia.IndirectAcquisition {
+								cia := opds2.IndirectAcquisition{}
+								cia.TypeAcquisition = iac.TypeAcquisition
+								ind.Child = append(ind.Child, cia)
+							}
+						}
+						l.Properties.IndirectAcquisition = append(l.Properties.IndirectAcquisition, ind)
+					}
+				}
+
+				if link.Price.CurrencyCode != "" {
+					if l.Properties == nil {
+						l.Properties = &opds2.Properties{}
+					}
+					l.Properties.Price = &opds2.Price{}
+					l.Properties.Price.Currency = link.Price.CurrencyCode
+					l.Properties.Price.Value = link.Price.Value
+				}
+
+				if link.Rel == "collection" || link.Rel == "http://opds-spec.org/group" {
+				} else if link.Rel == "http://opds-spec.org/image" || link.Rel == "http://opds-spec.org/image/thumbnail" {
+					p.Images = append(p.Images, l)
+				} else {
+					p.Links = append(p.Links, l)
+				}
+			}
+			// images are required, an entry without any is written with
+			// an empty list rather than null
+			if p.Images == nil {
+				p.Images = []opds2.Link{}
+			}
+
+			if collLink.Href != "" {
+				opds2feed.AddPublicationInGroup(p, collLink)
+			} else {
+				opds2feed.Publications = append(opds2feed.Publications, p)
+			}
+		} else {
+			linkNav, errNav := navigationLink(entry)
+			if errNav != "" {
+				diagnostics = append(diagnostics, Diagnostic{EntryID: entry.ID, Title: entry.Title, Message: errNav})
+				continue
+			}
+
+			if collLink.Href != "" {
+				opds2feed.AddNavigationInGroup(linkNav, collLink)
+			} else {
+				opds2feed.Navigation = append(opds2feed.Navigation, linkNav)
+			}
+		}
+	}
+
+	for _, l := range feed.Links {
+		linkFeed := opds2.Link{}
+		linkFeed.Href = l.Href
+		linkFeed.Rel = []string{l.Rel}
+		linkFeed.TypeLink = l.TypeLink
+		linkFeed.Title = l.Title
+
+		if l.Rel == "http://opds-spec.org/facet" {
+			// OPDS 2.0 facets have no relation, the active one is self
+			linkFeed.Rel = nil
+			if l.ActiveFacet {
+				linkFeed.Rel = []string{"self"}
+			}
+			if l.Count > 0 {
+				linkFeed.Properties = &opds2.Properties{NumberOfItems: l.Count}
+			}
+			opds2feed.AddFacet(linkFeed, l.FacetGroup)
+		} else {
+			opds2feed.Links = append(opds2feed.Links, linkFeed)
+		}
+	}
+
+	// href are usually already absolute when the feed was parsed with
+	// ResolveURLs, this handle the remaining relative ones
+	if url != "" {
+		if err := opds2feed.ResolveURLs(url); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{EntryID: feed.ID, Title: feed.Title, Message: "href not resolved: " + err.Error()})
+		}
+	}
+
+	return opds2feed, diagnostics
+}
+
+// navigationRels are the relations of OPDS 1.x navigation entries by
+// order of preference
+var navigationRels = []string{
+	"subsection",
+	"http://opds-spec.org/sort/new",
+	"http://opds-spec.org/sort/popular",
+	"http://opds-spec.org/featured",
+	"http://opds-spec.org/recommended",
+	"http://opds-spec.org/shelf",
+	"http://opds-spec.org/subscriptions",
+	"start",
+}
+
+// navigationLink convert a navigation entry in a link to the best
+// subsection of the entry, the message is set when no link is usable
+func navigationLink(entry opds1.Entry) (opds2.Link, string) {
+	var best *opds1.Link
+	bestScore := -1
+
+	for i, l := range entry.Links {
+		score := navigationScore(l)
+		if score > bestScore {
+			best = &entry.Links[i]
+			bestScore = score
+		}
+	}
+	if best == nil {
+		return opds2.Link{}, "navigation entry without link"
+	}
+	if bestScore == 0 {
+		return opds2.Link{}, "navigation entry without link to a feed"
+	}
+
+	linkNav := opds2.Link{}
+	linkNav.Title = entry.Title
+	if best.Rel != "" {
+		linkNav.Rel = []string{best.Rel}
+	}
+	linkNav.TypeLink = best.TypeLink
+	linkNav.Href = best.Href
+
+	// for html resource like description, atom:summary go to description
+	// if atom:content use it in description else use summary
+	description := entry.Content.Content
+	if description == "" {
+		description = entry.Summary.Content
+	}
+	if best.Count > 0 || description != "" || entry.Updated != nil {
+		linkNav.Properties = &opds2.Properties{
+			NumberOfItems: best.Count,
+			Description:   strings.TrimSpace(description),
+			Modified:      entry.Updated,
+		}
+	}
+
+	return linkNav, ""
+}
+
+// navigationScore rate how likely a link of a navigation entry lead to
+// the subsection, zero when the link can not be used
+func navigationScore(l opds1.Link) int {
+
+	switch {
+	case l.Rel == "collection" || l.Rel == "http://opds-spec.org/group":
+		return 0
+	case strings.HasPrefix(l.Rel, "http://opds-spec.org/image"):
+		return 0
+	case l.Href == "":
+		return 0
+	}
+
+	score := 0
+	switch {
+	case strings.Contains(l.TypeLink, "profile=opds-catalog") && !strings.Contains(l.TypeLink, "type=entry"):
+		score += 20
+	case strings.Contains(l.TypeLink, "opds+json"):
+		score += 20
+	case strings.Contains(l.TypeLink, "atom+xml") && !strings.Contains(l.TypeLink, "type=entry"):
+		score += 10
+	case l.TypeLink == "":
+		score += 1
+	}
+
+	for i, rel := range navigationRels {
+		if l.Rel == rel {
+			return score + 2*(len(navigationRels)-i) + 1
+		}
+	}
+	if score > 0 && (l.Rel == "" || l.Rel == "alternate" || l.Rel == "related") {
+		return score
+	}
+	if score == 1 {
+		// an untyped link with another relation is not a subsection
+		return 0
+	}
+
+	return score
+}
+
+// ParseBuffer parse an OPDS 1.x or OPDS 2.0 feed and return it in
+// OPDS 2.0, href are resolved against base when it is not empty
+func ParseBuffer(buff []byte, base string) (opds2.Feed, error) {
+
+	trimmed := bytes.TrimLeft(buff, " \t\r\n\xef\xbb\xbf")
+	if len(trimmed) == 0 {
+		return opds2.Feed{}, errors.New("convert: empty feed")
+	}
+
+	if trimmed[0] == '{' {
+		feed, errParse := opds2.ParseBufferWithOptions(trimmed, opds2.ParseOptions{ResolveURLs: base != "", BaseURL: base})
+		if errParse != nil {
+			return opds2.Feed{}, errParse
+		}
+		return *feed, nil
+	}
+
+	feed, errParse := opds1.ParseBufferWithOptions(buff, opds1.ParseOptions{ResolveURLs: base != "", BaseURL: base})
+	if errParse != nil {
+		return opds2.Feed{}, errParse
+	}
+
+	return ToOPDS2(feed, base), nil
+}
@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opds-community/libopds2-go/opds1"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+const catalogType = "application/atom+xml;profile=opds-catalog;kind=navigation"
+
+func TestToOPDS2WithDiagnostics(t *testing.T) {
+	feed := &opds1.Feed{
+		ID:    "urn:catalog",
+		Title: "Catalog",
+		Entries: []opds1.Entry{
+			// entries without links used to make the conversion panic
+			{ID: "urn:empty", Title: "Empty"},
+			{ID: "urn:empty-group", Title: "Empty group", Links: []opds1.Link{{Rel: "collection", Href: "/classics", Title: "Classics"}}},
+			{ID: "urn:cover", Title: "Cover only", Links: []opds1.Link{{Rel: "http://opds-spec.org/image", Href: "/cover.jpg", TypeLink: "image/jpeg"}}},
+			{ID: "urn:new", Title: "New", Links: []opds1.Link{
+				{Rel: "alternate", Href: "/new.html", TypeLink: "text/html"},
+				{Rel: "http://opds-spec.org/sort/new", Href: "/new", TypeLink: catalogType, Count: 12},
+			}},
+			{ID: "urn:moby", Title: "Moby Dick", Links: []opds1.Link{
+				{Rel: "http://opds-spec.org/acquisition/open-access", Href: "/moby.epub", TypeLink: "application/epub+zip"},
+				{Rel: "collection", Href: "/classics", Title: "Classics"},
+			}},
+			{ID: "urn:popular", Title: "Popular", Links: []opds1.Link{
+				{Rel: "subsection", Href: "/classics/popular", TypeLink: catalogType},
+				{Rel: "collection", Href: "/classics", Title: "Classics"},
+			}},
+		},
+	}
+
+	converted, diagnostics := ToOPDS2WithDiagnostics(feed, "https://example.com/catalog")
+
+	want := []Diagnostic{
+		{EntryID: "urn:empty", Title: "Empty", Message: "navigation entry without link"},
+		{EntryID: "urn:empty-group", Title: "Empty group", Message: "navigation entry without link to a feed"},
+		{EntryID: "urn:cover", Title: "Cover only", Message: "navigation entry without link to a feed"},
+	}
+	if !reflect.DeepEqual(diagnostics, want) {
+		t.Errorf("diagnostics = %v, want %v", diagnostics, want)
+	}
+
+	navigation := opds2.Link{Href: "https://example.com/new", TypeLink: catalogType, Rel: []string{"http://opds-spec.org/sort/new"},
+		Title: "New", Properties: &opds2.Properties{NumberOfItems: 12}}
+	if len(converted.Navigation) != 1 || !reflect.DeepEqual(converted.Navigation[0], navigation) {
+		t.Errorf("navigation = %+v", converted.Navigation)
+	}
+	if len(converted.Publications) != 0 || len(converted.Groups) != 1 {
+		t.Fatalf("%d publications, %d groups", len(converted.Publications), len(converted.Groups))
+	}
+	group := converted.Groups[0]
+	if group.Metadata.Title != "Classics" || len(group.Publications) != 1 || len(group.Navigation) != 1 ||
+		group.Publications[0].Images == nil || group.Navigation[0].Href != "https://example.com/classics/popular" {
+		t.Errorf("group = %+v", group)
+	}
+
+	if converted := ToOPDS2(&opds1.Feed{Entries: []opds1.Entry{{ID: "urn:empty"}}}, ""); len(converted.Navigation) != 0 {
+		t.Errorf("navigation = %+v", converted.Navigation)
+	}
+}
@@ -0,0 +1,67 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+	"github.com/opds-community/libopds2-go/opensearch"
+)
+
+// ConvertSearchLinks replace the search links of the feed pointing to an
+// OpenSearch description document by OPDS 2.0 templated search links,
+// client fetch the descriptions with header and is http.DefaultClient
+// when nil, a link is left untouched when its description can not be
+// converted and the last error is returned
+func ConvertSearchLinks(ctx context.Context, feed *opds2.Feed, client *http.Client, header http.Header) error {
+	var lastErr error
+
+	for i, l := range feed.Links {
+		if !IsOpenSearchLink(l) {
+			continue
+		}
+
+		search, err := ConvertSearchLink(ctx, l, client, header)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		feed.Links[i] = search
+	}
+
+	return lastErr
+}
+
+// ConvertSearchLink return the templated search link of the OpenSearch
+// description l point to, its title is kept when it has one
+func ConvertSearchLink(ctx context.Context, l opds2.Link, client *http.Client, header http.Header) (opds2.Link, error) {
+
+	d, err := opensearch.ParseURLContext(ctx, client, header, l.Href)
+	if err != nil {
+		return opds2.Link{}, err
+	}
+	search, errLink := d.SearchLink()
+	if errLink != nil {
+		return opds2.Link{}, errLink
+	}
+	if l.Title != "" {
+		search.Title = l.Title
+	}
+
+	return search, nil
+}
+
+// IsOpenSearchLink check if the link is a search link pointing to an
+// OpenSearch description document
+func IsOpenSearchLink(l opds2.Link) bool {
+	if l.Templated || !strings.HasPrefix(l.TypeLink, "application/opensearchdescription+xml") {
+		return false
+	}
+	for _, r := range l.Rel {
+		if r == "search" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/opds-community/libopds2-go/catalog"
+)
+
+func runCalibre2OPDS(args []string) int {
+	var out outputOptions
+	var opts catalog.Options
+
+	fs := newFlagSet("calibre2opds", "<library>")
+	out.register(fs)
+	fs.StringVar(&opts.Title, "title", "Calibre Library", "title of the catalog")
+	fs.StringVar(&opts.SelfURL, "self", "", "url of the catalog, added as its self link")
+	fs.StringVar(&opts.BaseURL, "base", "", "url of the library, the links are relative paths from it without it")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	feed, errs := catalog.ScanCalibre(fs.Arg(0), opts)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "libopds2-go:", err)
+	}
+
+	result, err := marshalOPDS2(&feed, out)
+	if err != nil {
+		return fail(err)
+	}
+	err = writeOutput(out.output, result)
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(errs) > 0 {
+		return exitError
+	}
+
+	return exitOK
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/opds-community/libopds2-go/linkcheck"
+)
+
+func runCheckLinks(args []string) int {
+	var in inputOptions
+	var workers, perHost int
+	var format string
+	var all, strict, progress bool
+
+	fs := newFlagSet("checklinks", "<url|file|->")
+	in.register(fs)
+	fs.IntVar(&workers, "workers", 8, "number of links checked in parallel")
+	fs.IntVar(&perHost, "per-host", 2, "maximum number of parallel requests to the same host")
+	fs.StringVar(&format, "format", "human", "format of the report: human or json")
+	fs.BoolVar(&all, "all", false, "also print the links without problem")
+	fs.BoolVar(&strict, "strict", false, "fail on redirections and media type mismatches too")
+	fs.BoolVar(&progress, "progress", false, "print the links on stderr as they are checked")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if format != "human" && format != "json" {
+		fmt.Fprintf(os.Stderr, "libopds2-go: unknown report format %q\n", format)
+		return exitUsage
+	}
+
+	buff, base, err := readInput(fs.Arg(0), in)
+	if err != nil {
+		return fail(err)
+	}
+
+	var links []linkcheck.Link
+	if detectFormat(buff) == "opds1" {
+		feed, errParse := parseOPDS1(buff, base)
+		if errParse != nil {
+			return fail(errParse)
+		}
+		links = linkcheck.CollectOPDS1(feed)
+	} else {
+		feed, errParse := parseOPDS2(buff, base)
+		if errParse != nil {
+			return fail(errParse)
+		}
+		links = linkcheck.CollectOPDS2(feed)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := linkcheck.Options{Client: in.client(), Header: http.Header(in.header), Workers: workers, PerHost: perHost}
+	if progress {
+		checked := 0
+		opts.Progress = func(r linkcheck.Result) {
+			checked++
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", checked, len(links), r.Href)
+		}
+	}
+	results := linkcheck.Check(ctx, links, opts)
+
+	failed := false
+	var report []linkcheck.Result
+	for _, r := range results {
+		if r.Broken() || (strict && !r.OK() && !r.Skipped) {
+			failed = true
+		}
+		if all || !r.OK() {
+			report = append(report, r)
+		}
+	}
+
+	if format == "json" {
+		err = writeLinkReport(report)
+	} else {
+		for _, r := range report {
+			fmt.Println(r)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if failed {
+		return exitError
+	}
+
+	return exitOK
+}
+
+type linkReport struct {
+	Href         string   `json:"href"`
+	Type         string   `json:"type,omitempty"`
+	Rel          []string `json:"rel,omitempty"`
+	Location     string   `json:"location,omitempty"`
+	StatusCode   int      `json:"status,omitempty"`
+	ContentType  string   `json:"contentType,omitempty"`
+	Redirects    []string `json:"redirects,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Skipped      bool     `json:"skipped,omitempty"`
+	Broken       bool     `json:"broken"`
+	TypeMismatch bool     `json:"typeMismatch"`
+}
+
+func writeLinkReport(results []linkcheck.Result) error {
+
+	report := []linkReport{}
+	for _, r := range results {
+		l := linkReport{
+			Href:         r.Href,
+			Type:         r.Type,
+			Rel:          r.Rel,
+			Location:     r.Location,
+			StatusCode:   r.StatusCode,
+			ContentType:  r.ContentType,
+			Redirects:    r.Redirects,
+			Skipped:      r.Skipped,
+			Broken:       r.Broken(),
+			TypeMismatch: r.TypeMismatch(),
+		}
+		if r.Err != nil {
+			l.Error = r.Err.Error()
+		}
+		report = append(report, l)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+
+	return enc.Encode(report)
+}
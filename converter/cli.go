@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// exit status of the command line
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	// commands is set in init as the help command refer to it
+	commands = []command{
+		{"convert", "convert a feed between OPDS 1.x and OPDS 2.0 (default)", runConvert},
+		{"crawl", "convert a whole OPDS 1.x catalog starting from its root feed", runCrawl},
+		{"serve", "serve OPDS 1.x catalogs as OPDS 2.0 through an http proxy", runServe},
+		{"validate", "check a feed against the OPDS 2.0 schemas or the OPDS 1.2 rules", runValidate},
+		{"checklinks", "request every link of a feed and report broken ones", runCheckLinks},
+		{"diff", "compare two versions of a feed", runDiff},
+		{"epub2opds", "build a catalog from a directory of EPUB, PDF, comic and audiobook files", runEPUB2OPDS},
+		{"calibre2opds", "build a catalog from a Calibre library", runCalibre2OPDS},
+		{"help", "print this help", runHelp},
+	}
+}
+
+// run dispatch the arguments to a command and return the exit status
+func run(args []string) int {
+
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help":
+		return runHelp(nil)
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+
+	// without a command the arguments are the one of convert as in the
+	// first version of the converter
+	return runConvert(args)
+}
+
+func runHelp(args []string) int {
+	usage(os.Stdout)
+	return exitOK
+}
+
+func usage(w *os.File) {
+	fmt.Fprintln(w, "usage: libopds2-go <command> [flags] <input>")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.description)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "input is an url, a file or - for stdin")
+	fmt.Fprintln(w, "use libopds2-go <command> -h for the flags of a command")
+}
+
+// newFlagSet create the flag set of a command printing errors on stderr
+func newFlagSet(name string, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: libopds2-go %s [flags] %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// parseFlags parse args and return the exit status to use when the
+// command must stop
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitUsage, false
+	}
+
+	return exitOK, true
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "libopds2-go:", err)
+	return exitError
+}
+
+// headerFlag collect repeated -header flags
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var s []string
+	for k, v := range h {
+		s = append(s, k+": "+strings.Join(v, ", "))
+	}
+	return strings.Join(s, "; ")
+}
+
+func (h headerFlag) Set(value string) error {
+	i := strings.Index(value, ":")
+	if i <= 0 {
+		return fmt.Errorf("header %q is not in the form \"Name: value\"", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:]))
+	return nil
+}
+
+// inputOptions are the flags shared by commands reading a feed
+type inputOptions struct {
+	base    string
+	timeout time.Duration
+	header  headerFlag
+}
+
+func (o *inputOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.base, "base", "", "base url used to resolve relative links, default to the input url")
+	o.registerHTTP(fs)
+}
+
+// registerHTTP register only the flags used by http requests
+func (o *inputOptions) registerHTTP(fs *flag.FlagSet) {
+	o.header = headerFlag{}
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "timeout of http requests")
+	fs.Var(o.header, "header", "http header sent with requests, as \"Name: value\", can be repeated")
+}
+
+func (o *inputOptions) client() *http.Client {
+	return &http.Client{Timeout: o.timeout}
+}
+
+// readInput read the input from an url, a file or stdin when location
+// is - and return the content with the base url of the document
+func readInput(location string, opts inputOptions) ([]byte, string, error) {
+
+	if location == "-" {
+		buff, err := ioutil.ReadAll(os.Stdin)
+		return buff, opts.base, err
+	}
+
+	if !isURL(location) {
+		buff, err := ioutil.ReadFile(location)
+		return buff, opts.base, err
+	}
+
+	request, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for k, v := range opts.header {
+		request.Header[k] = v
+	}
+	res, errReq := opts.client().Do(request)
+	if errReq != nil {
+		return nil, "", errReq
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, "", fmt.Errorf("%s: %s", location, res.Status)
+	}
+
+	buff, errRead := ioutil.ReadAll(res.Body)
+	if errRead != nil {
+		return nil, "", errRead
+	}
+
+	base := opts.base
+	if base == "" {
+		base = res.Request.URL.String()
+	}
+
+	return buff, base, nil
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// detectFormat guess if the document is an OPDS 1.x (xml) or
+// OPDS 2.0 (json) feed
+func detectFormat(buff []byte) string {
+	trimmed := bytes.TrimLeft(buff, " \t\r\n\xef\xbb\xbf")
+	if len(trimmed) > 0 && trimmed[0] == '<' {
+		return "opds1"
+	}
+	return "opds2"
+}
+
+// writeOutput write buff in the file output or stdout when empty
+func writeOutput(output string, buff []byte) error {
+	if output == "" || output == "-" {
+		_, err := os.Stdout.Write(buff)
+		return err
+	}
+	return ioutil.WriteFile(output, buff, 0644)
+}
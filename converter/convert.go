@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/opds-community/libopds2-go/convert"
+	"github.com/opds-community/libopds2-go/opds1"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// outputOptions are the flags shared by commands writing a feed
+type outputOptions struct {
+	output  string
+	compact bool
+	indent  string
+}
+
+func (o *outputOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", "", "output file, default to stdout")
+	fs.BoolVar(&o.compact, "compact", false, "write the feed without indentation")
+	fs.StringVar(&o.indent, "indent", " ", "string used to indent the feed")
+}
+
+func runConvert(args []string) int {
+	var in inputOptions
+	var out outputOptions
+	var from, to string
+	var search bool
+
+	fs := newFlagSet("convert", "<url|file|->")
+	in.register(fs)
+	out.register(fs)
+	fs.StringVar(&from, "from", "auto", "format of the input: auto, opds1 or opds2")
+	fs.StringVar(&to, "to", "opds2", "format of the output: opds1 or opds2")
+	fs.BoolVar(&search, "opensearch", true, "fetch OpenSearch descriptions to create templated search links")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if from != "auto" && from != "opds1" && from != "opds2" {
+		fmt.Fprintf(os.Stderr, "libopds2-go: unknown input format %q\n", from)
+		return exitUsage
+	}
+	if to != "opds1" && to != "opds2" {
+		fmt.Fprintf(os.Stderr, "libopds2-go: unknown output format %q\n", to)
+		return exitUsage
+	}
+
+	buff, base, err := readInput(fs.Arg(0), in)
+	if err != nil {
+		return fail(err)
+	}
+	if from == "auto" {
+		from = detectFormat(buff)
+	}
+
+	var result []byte
+	switch {
+	case from == "opds1" && to == "opds2":
+		feed, errParse := parseOPDS1(buff, base)
+		if errParse != nil {
+			return fail(errParse)
+		}
+		opds2feed, diagnostics := convert.ToOPDS2WithDiagnostics(feed, base)
+		for _, d := range diagnostics {
+			fmt.Fprintln(os.Stderr, "libopds2-go: warning:", d)
+		}
+		if search {
+			errSearch := convert.ConvertSearchLinks(context.Background(), &opds2feed, in.client(), http.Header(in.header))
+			if errSearch != nil {
+				fmt.Fprintln(os.Stderr, "libopds2-go: warning:", errSearch)
+			}
+		}
+		result, err = marshalOPDS2(&opds2feed, out)
+	case from == "opds2" && to == "opds2":
+		feed, errParse := parseOPDS2(buff, base)
+		if errParse != nil {
+			return fail(errParse)
+		}
+		result, err = marshalOPDS2(feed, out)
+	case from == "opds2" && to == "opds1":
+		feed, errParse := parseOPDS2(buff, base)
+		if errParse != nil {
+			return fail(errParse)
+		}
+		opds1feed := convert.ToOPDS1(feed)
+		result, err = marshalOPDS1(&opds1feed, out)
+	case from == "opds1" && to == "opds1":
+		feed, errParse := parseOPDS1(buff, base)
+		if errParse != nil {
+			return fail(errParse)
+		}
+		result, err = marshalOPDS1(feed, out)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	err = writeOutput(out.output, result)
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+func parseOPDS1(buff []byte, base string) (*opds1.Feed, error) {
+	return opds1.ParseBufferWithOptions(buff, opds1.ParseOptions{ResolveURLs: true, BaseURL: base})
+}
+
+func parseOPDS2(buff []byte, base string) (*opds2.Feed, error) {
+	return opds2.ParseBufferWithOptions(buff, opds2.ParseOptions{ResolveURLs: true, BaseURL: base})
+}
+
+func marshalOPDS2(feed *opds2.Feed, out outputOptions) ([]byte, error) {
+	j, err := JSONMarshal(feed, true)
+	if err != nil {
+		return nil, err
+	}
+	if out.compact {
+		return append(j, '\n'), nil
+	}
+
+	var identJSON bytes.Buffer
+	err = json.Indent(&identJSON, j, "", out.indent)
+	if err != nil {
+		return nil, err
+	}
+	identJSON.WriteByte('\n')
+
+	return identJSON.Bytes(), nil
+}
+
+func marshalOPDS1(feed *opds1.Feed, out outputOptions) ([]byte, error) {
+	var b []byte
+	var err error
+
+	if out.compact {
+		b, err = opds1.Marshal(feed)
+	} else {
+		b, err = opds1.MarshalIndent(feed, "", out.indent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
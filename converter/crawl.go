@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/opds-community/libopds2-go/crawler"
+)
+
+func runCrawl(args []string) int {
+	var in inputOptions
+	var opts crawler.Options
+	var output string
+	var progress bool
+
+	fs := newFlagSet("crawl", "<root url>")
+	in.registerHTTP(fs)
+	fs.IntVar(&opts.MaxDepth, "depth", 0, "maximum depth of navigation followed from the root, 0 for no limit")
+	fs.IntVar(&opts.MaxPages, "max-pages", 0, "maximum number of pages fetched, 0 for no limit")
+	fs.IntVar(&opts.Workers, "workers", 4, "number of pages fetched in parallel")
+	fs.IntVar(&opts.PerHost, "per-host", 2, "maximum number of parallel requests to the same host, 0 for no limit")
+	fs.BoolVar(&opts.SearchLinks, "opensearch", true, "fetch OpenSearch descriptions to create templated search links")
+	fs.BoolVar(&progress, "progress", false, "print the progress of the crawl on stderr")
+	fs.StringVar(&output, "o", "", "directory where the mirror is written, without it the crawled pages are listed")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 1 || !isURL(fs.Arg(0)) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts.Client = in.client()
+	opts.Header = http.Header(in.header)
+	if progress {
+		opts.Progress = func(p crawler.Progress) {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", p.Fetched, p.Total, p.URL)
+		}
+	}
+
+	// stop the crawl cleanly on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	graph, err := crawler.CrawlContext(ctx, fs.Arg(0), opts)
+	if err != nil {
+		return fail(err)
+	}
+
+	failed := 0
+	for _, u := range graph.URLs() {
+		page := graph.Pages[u]
+		if page.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "libopds2-go: %s: %s\n", u, page.Err)
+		} else if output == "" {
+			fmt.Printf("%d\t%s\t%s\n", page.Depth, u, page.Feed.Metadata.Title)
+		}
+	}
+
+	if output != "" {
+		err = graph.WriteMirror(output)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("%d pages written, root is %s\n", len(graph.Pages)-failed, graph.MirrorPaths()[graph.Root])
+	}
+
+	if failed > 0 {
+		return exitError
+	}
+
+	return exitOK
+}
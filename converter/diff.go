@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/opds-community/libopds2-go/convert"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// exit status of diff, as diff(1) trouble is 2 like usage errors
+const (
+	diffSame      = 0
+	diffDifferent = 1
+	diffTrouble   = 2
+)
+
+func runDiff(args []string) int {
+	var in inputOptions
+	var format string
+
+	fs := newFlagSet("diff", "<old> <new>")
+	in.register(fs)
+	fs.StringVar(&format, "format", "text", "format of the report: text or json")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "libopds2-go: unknown report format %q\n", format)
+		return exitUsage
+	}
+
+	a, err := readFeed(fs.Arg(0), in)
+	if err != nil {
+		return failDiff(err)
+	}
+	b, err := readFeed(fs.Arg(1), in)
+	if err != nil {
+		return failDiff(err)
+	}
+
+	d := opds2.Diff(a, b)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", " ")
+		err = enc.Encode(d)
+	} else {
+		writeTextDiff(d)
+	}
+	if err != nil {
+		return failDiff(err)
+	}
+
+	if !d.Empty() {
+		return diffDifferent
+	}
+
+	return diffSame
+}
+
+// failDiff report err and return the status of diff on trouble
+func failDiff(err error) int {
+	fail(err)
+	return diffTrouble
+}
+
+// readFeed read an OPDS 1.x or OPDS 2.0 feed and return it in OPDS 2.0
+func readFeed(location string, in inputOptions) (*opds2.Feed, error) {
+
+	buff, base, err := readInput(location, in)
+	if err != nil {
+		return nil, err
+	}
+	if detectFormat(buff) == "opds1" {
+		feed, errParse := parseOPDS1(buff, base)
+		if errParse != nil {
+			return nil, errParse
+		}
+		opds2feed := convert.ToOPDS2(feed, base)
+		return &opds2feed, nil
+	}
+
+	return parseOPDS2(buff, base)
+}
+
+func writeTextDiff(d opds2.FeedDiff) {
+
+	for _, c := range d.Metadata {
+		fmt.Println("~ feed " + c.String())
+	}
+	writeTextLinksDiff("feed link", d.Links)
+	writeTextLinksDiff("navigation", d.Navigation)
+	for _, f := range d.Facets {
+		writeTextLinksDiff(fmt.Sprintf("facet %q", f.Group), f.LinksDiff)
+	}
+	for _, g := range d.Groups {
+		for _, c := range g.Metadata {
+			fmt.Printf("~ group %q %s\n", g.Title, c)
+		}
+		for _, k := range g.Added {
+			fmt.Printf("+ group %q %s\n", g.Title, k)
+		}
+		for _, k := range g.Removed {
+			fmt.Printf("- group %q %s\n", g.Title, k)
+		}
+	}
+	for _, p := range d.Removed {
+		fmt.Printf("- publication %s %q\n", p.Key(), p.Metadata.Title.String())
+	}
+	for _, p := range d.Added {
+		fmt.Printf("+ publication %s %q\n", p.Key(), p.Metadata.Title.String())
+	}
+	for _, p := range d.Modified {
+		fmt.Printf("~ publication %s %q\n", p.Key, p.Title)
+		for _, c := range p.Changes {
+			fmt.Println("    " + c.String())
+		}
+	}
+}
+
+func writeTextLinksDiff(location string, d opds2.LinksDiff) {
+
+	for _, l := range d.Removed {
+		fmt.Printf("- %s %s\n", location, l.Href)
+	}
+	for _, l := range d.Added {
+		fmt.Printf("+ %s %s\n", location, l.Href)
+	}
+	for _, m := range d.Modified {
+		fmt.Printf("~ %s %s\n", location, m.Href)
+		for _, c := range m.Changes {
+			fmt.Println("    " + c.String())
+		}
+	}
+}
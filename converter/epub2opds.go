@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/opds-community/libopds2-go/catalog"
+)
+
+func runEPUB2OPDS(args []string) int {
+	var out outputOptions
+	var opts catalog.Options
+
+	fs := newFlagSet("epub2opds", "<dir>")
+	out.register(fs)
+	fs.StringVar(&opts.Title, "title", "Catalog", "title of the catalog")
+	fs.StringVar(&opts.SelfURL, "self", "", "url of the catalog, added as its self link")
+	fs.StringVar(&opts.BaseURL, "base", "", "url of the directory, the links are relative paths from it without it")
+	fs.StringVar(&opts.CoverDir, "covers", "", "directory where the covers are written, the catalog has no cover without it")
+	fs.StringVar(&opts.CoverURL, "cover-url", "", "url of the covers directory, its path from the directory scanned without it")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	feed, errs := catalog.Scan(fs.Arg(0), opts)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "libopds2-go:", err)
+	}
+
+	result, err := marshalOPDS2(&feed, out)
+	if err != nil {
+		return fail(err)
+	}
+	err = writeOutput(out.output, result)
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(errs) > 0 {
+		return exitError
+	}
+
+	return exitOK
+}
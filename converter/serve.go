@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/proxy"
+)
+
+// listFlag collect repeated string flags
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runServe(args []string) int {
+	var in inputOptions
+	var opts proxy.Options
+	var addr string
+	var allow, prefixes listFlag
+
+	fs := newFlagSet("serve", "")
+	in.registerHTTP(fs)
+	fs.StringVar(&addr, "addr", ":8080", "address the proxy listen on")
+	fs.Var(&allow, "allow", "upstream host, *.domain, url prefix or * for every upstream accepted by the proxy, can be repeated, the hosts of -prefix without it")
+	fs.Var(&prefixes, "prefix", "path mapped to an upstream url as /path/=https://upstream/, can be repeated")
+	fs.DurationVar(&opts.CacheTTL, "cache-ttl", 5*time.Minute, "time a converted feed is cached, 0 to disable the cache")
+	fs.BoolVar(&opts.SearchLinks, "opensearch", true, "fetch OpenSearch descriptions to create templated search links")
+	fs.IntVar(&opts.CacheSize, "cache-size", 1000, "maximum number of feeds in cache")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts.Allow = allow
+	opts.Prefixes = make(map[string]string)
+	for _, p := range prefixes {
+		i := strings.Index(p, "=")
+		if i <= 0 || !isURL(p[i+1:]) {
+			fmt.Fprintf(os.Stderr, "libopds2-go: prefix %q is not in the form /path/=https://upstream/\n", p)
+			return exitUsage
+		}
+		opts.Prefixes[p[:i]] = p[i+1:]
+	}
+	if len(opts.Allow) == 0 && len(opts.Prefixes) == 0 {
+		fmt.Fprintln(os.Stderr, "libopds2-go: serve needs -allow or -prefix, -allow '*' accepts every upstream")
+		return exitUsage
+	}
+	opts.Client = in.client()
+	opts.Header = http.Header(in.header)
+
+	fmt.Fprintf(os.Stderr, "libopds2-go: proxy listening on %s\n", addr)
+	err := http.ListenAndServe(addr, proxy.New(opts))
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
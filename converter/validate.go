@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/lint"
+	"github.com/opds-community/libopds2-go/opds2"
+	"github.com/opds-community/libopds2-go/validate"
+)
+
+func runValidate(args []string) int {
+	var in inputOptions
+	var from, format string
+	var strict, lintFeed bool
+	var disabled listFlag
+
+	fs := newFlagSet("validate", "<url|file|->")
+	in.registerHTTP(fs)
+	fs.StringVar(&from, "from", "auto", "format of the input: auto, opds1 or opds2")
+	fs.StringVar(&format, "format", "human", "format of the report: human, json or junit")
+	fs.BoolVar(&strict, "strict", false, "report warnings as errors")
+	fs.BoolVar(&lintFeed, "lint", false, "also run the lint rules on valid OPDS 2.0 feeds")
+	fs.Var(&disabled, "disable", "lint rule to disable, can be repeated")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if from != "auto" && from != "opds1" && from != "opds2" {
+		fmt.Fprintf(os.Stderr, "libopds2-go: unknown input format %q\n", from)
+		return exitUsage
+	}
+	if format != "human" && format != "json" && format != "junit" {
+		fmt.Fprintf(os.Stderr, "libopds2-go: unknown report format %q\n", format)
+		return exitUsage
+	}
+
+	input := fs.Arg(0)
+	buff, _, err := readInput(input, in)
+	if err != nil {
+		return fail(err)
+	}
+	if from == "auto" {
+		from = detectFormat(buff)
+	}
+
+	var violations []validate.Violation
+	if from == "opds1" {
+		violations, err = validate.OPDS1XML(buff)
+	} else {
+		violations, err = validate.FeedJSON(buff)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("%s: %s", input, err))
+	}
+
+	// the rules need a feed that could be parsed, they run on valid feeds
+	if lintFeed && from == "opds2" && !validate.HasErrors(violations) {
+		config := lint.Config{Rules: make(map[string]string)}
+		for _, name := range disabled {
+			config.Rules[name] = "off"
+		}
+		linter, errLint := lint.New(config)
+		if errLint != nil {
+			fmt.Fprintln(os.Stderr, "libopds2-go:", errLint)
+			return exitUsage
+		}
+		feed, errParse := opds2.ParseBuffer(buff)
+		if errParse != nil {
+			return fail(fmt.Errorf("%s: %s", input, errParse))
+		}
+		violations = append(violations, linter.Lint(feed)...)
+	}
+
+	if strict {
+		for i, v := range violations {
+			if v.Severity == validate.Warning {
+				violations[i].Severity = validate.Error
+			}
+		}
+	}
+
+	switch format {
+	case "json":
+		err = writeJSONReport(os.Stdout, input, from, violations)
+	case "junit":
+		err = writeJUnitReport(os.Stdout, input, violations)
+	default:
+		err = writeHumanReport(os.Stdout, input, violations)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if validate.HasErrors(violations) {
+		return exitError
+	}
+
+	return exitOK
+}
+
+func countSeverity(violations []validate.Violation, severity validate.Severity) int {
+	n := 0
+	for _, v := range violations {
+		if v.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func writeHumanReport(w io.Writer, input string, violations []validate.Violation) error {
+
+	for _, v := range violations {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", input, v); err != nil {
+			return err
+		}
+	}
+
+	errors := countSeverity(violations, validate.Error)
+	warnings := countSeverity(violations, validate.Warning)
+	if errors == 0 && warnings == 0 {
+		_, err := fmt.Fprintf(w, "%s: valid\n", input)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s: %d error(s), %d warning(s)\n", input, errors, warnings)
+
+	return err
+}
+
+type jsonReport struct {
+	Input      string               `json:"input"`
+	Format     string               `json:"format"`
+	Valid      bool                 `json:"valid"`
+	Errors     int                  `json:"errors"`
+	Warnings   int                  `json:"warnings"`
+	Violations []validate.Violation `json:"violations"`
+}
+
+func writeJSONReport(w io.Writer, input string, format string, violations []validate.Violation) error {
+
+	report := jsonReport{
+		Input:      input,
+		Format:     format,
+		Valid:      !validate.HasErrors(violations),
+		Errors:     countSeverity(violations, validate.Error),
+		Warnings:   countSeverity(violations, validate.Warning),
+		Violations: violations,
+	}
+	if report.Violations == nil {
+		report.Violations = []validate.Violation{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+
+	return enc.Encode(report)
+}
+
+// junit report, each violation is a test case failing for errors, a
+// document without violation has a single passing test case
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnitReport(w io.Writer, input string, violations []validate.Violation) error {
+
+	suite := junitSuite{Name: input}
+	for _, v := range violations {
+		c := junitCase{Name: v.Rule + " " + v.Pointer, ClassName: input}
+		if v.Severity == validate.Error {
+			c.Failure = &junitFailure{Message: v.Message, Type: v.Severity.String(), Text: v.String()}
+			suite.Failures++
+		} else {
+			c.SystemOut = v.String()
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if len(suite.Cases) == 0 {
+		suite.Cases = append(suite.Cases, junitCase{Name: "valid", ClassName: input})
+	}
+	suite.Tests = len(suite.Cases)
+
+	b, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+strings.TrimSpace(string(b))+"\n")
+
+	return err
+}
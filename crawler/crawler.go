@@ -0,0 +1,403 @@
+// Package crawler walk an OPDS 1.x catalog from its root feed and convert
+// every page in OPDS 2.0, the result can be kept in memory or written as
+// a mirror on the filesystem
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opds-community/libopds2-go/convert"
+	"github.com/opds-community/libopds2-go/internal/hostlimit"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Options change the way a catalog is crawled, zero values mean no limit
+type Options struct {
+	// MaxDepth is the number of navigation and group links followed from
+	// the root feed, next links stay at the depth of the current page
+	MaxDepth int
+	// MaxPages is the maximum number of pages fetched
+	MaxPages int
+	// Client is used for the requests, http.DefaultClient when nil
+	Client *http.Client
+	// Header is sent with every request
+	Header http.Header
+	// Workers is the number of pages fetched in parallel, one when zero
+	Workers int
+	// PerHost is the maximum number of parallel requests to the same host
+	PerHost int
+	// SearchLinks convert the links to OpenSearch descriptions in
+	// templated search links, each description is fetched once
+	SearchLinks bool
+	// Progress is called after each page is fetched, calls are never
+	// concurrent
+	Progress func(p Progress)
+}
+
+// Progress report the state of a crawl after a page is fetched
+type Progress struct {
+	URL string
+	Err error
+	// Fetched is the number of pages fetched so far
+	Fetched int
+	// Total is the number of pages known so far, fetched or not
+	Total int
+}
+
+// Page is a feed of the catalog converted in OPDS 2.0
+type Page struct {
+	// URL is the canonical url of the page
+	URL   string
+	Depth int
+	Feed  opds2.Feed
+	// Links are the canonical urls of the pages linked from this one
+	Links []string
+	// Err is set when the page could not be fetched or parsed
+	Err error
+}
+
+// Graph is the result of a crawl, pages are indexed by canonical url
+type Graph struct {
+	Root  string
+	Pages map[string]*Page
+}
+
+// Crawl fetch the root feed and every feed reachable from it by following
+// navigation, next and group links, each page is fetched once
+func Crawl(root string, opts Options) (*Graph, error) {
+	return CrawlContext(context.Background(), root, opts)
+}
+
+// CrawlContext is Crawl with a context to cancel the crawl, pages are
+// fetched concurrently by waves, links are only followed once a wave is
+// complete in the order they appear so the resulting graph does not
+// depend on the order in which pages are fetched
+func CrawlContext(ctx context.Context, root string, opts Options) (*Graph, error) {
+
+	rootURL, err := Canonical(root)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &crawl{opts: opts, hosts: hostlimit.New(opts.PerHost), searches: make(map[string]*searchResult)}
+	g := &Graph{Root: rootURL, Pages: make(map[string]*Page)}
+	wave := []*Page{{URL: rootURL}}
+	g.Pages[rootURL] = wave[0]
+
+	for len(wave) > 0 {
+		c.fetchAll(ctx, wave, len(g.Pages))
+		if ctx.Err() != nil {
+			return g, ctx.Err()
+		}
+
+		var next []*Page
+		for _, page := range wave {
+			if page.Err != nil {
+				if page.URL == rootURL {
+					return g, page.Err
+				}
+				continue
+			}
+
+			for _, l := range followedLinks(&page.Feed) {
+				linked, errCanonical := Canonical(l.href)
+				if errCanonical != nil {
+					continue
+				}
+				page.Links = append(page.Links, linked)
+
+				if _, seen := g.Pages[linked]; seen {
+					continue
+				}
+				depth := page.Depth
+				if !l.pagination {
+					depth++
+				}
+				if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+					continue
+				}
+				if opts.MaxPages > 0 && len(g.Pages) >= opts.MaxPages {
+					continue
+				}
+
+				linkedPage := &Page{URL: linked, Depth: depth}
+				g.Pages[linked] = linkedPage
+				next = append(next, linkedPage)
+			}
+		}
+		wave = next
+	}
+
+	return g, nil
+}
+
+// crawl hold the state shared by the workers
+type crawl struct {
+	opts    Options
+	mutex   sync.Mutex
+	hosts   *hostlimit.Limiter
+	fetched int
+	// searches cache the search links by description url, an entry is
+	// added before its description is fetched so it is fetched once
+	searches map[string]*searchResult
+}
+
+// searchResult is the search link of a description, done is closed once
+// it is fetched
+type searchResult struct {
+	done chan struct{}
+	link opds2.Link
+	err  error
+}
+
+// fetchAll fetch the pages with the worker pool, total is the number of
+// pages known used for the progress
+func (c *crawl) fetchAll(ctx context.Context, pages []*Page, total int) {
+
+	workers := c.opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan *Page)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				c.fetch(ctx, page, total)
+			}
+		}()
+	}
+
+	for _, page := range pages {
+		select {
+		case jobs <- page:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (c *crawl) fetch(ctx context.Context, page *Page, total int) {
+
+	release, err := c.hosts.Acquire(ctx, page.URL)
+	if err != nil {
+		page.Err = err
+	} else {
+		page.Feed, page.Err = fetchPage(ctx, page.URL, c.opts)
+		// the descriptions may be on the same host
+		release()
+	}
+	if page.Err == nil && c.opts.SearchLinks {
+		c.convertSearchLinks(ctx, &page.Feed)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.fetched++
+	if c.opts.Progress != nil {
+		c.opts.Progress(Progress{URL: page.URL, Err: page.Err, Fetched: c.fetched, Total: total})
+	}
+}
+
+// convertSearchLinks replace the OpenSearch links of the feed, a link is
+// kept when its description can not be converted
+func (c *crawl) convertSearchLinks(ctx context.Context, feed *opds2.Feed) {
+
+	for i, l := range feed.Links {
+		if !convert.IsOpenSearchLink(l) {
+			continue
+		}
+
+		c.mutex.Lock()
+		result, ok := c.searches[l.Href]
+		if !ok {
+			result = &searchResult{done: make(chan struct{})}
+			c.searches[l.Href] = result
+		}
+		c.mutex.Unlock()
+		if !ok {
+			result.link, result.err = c.searchLink(ctx, l)
+			close(result.done)
+		}
+
+		select {
+		case <-result.done:
+		case <-ctx.Done():
+			return
+		}
+		if result.err == nil {
+			feed.Links[i] = result.link
+		}
+	}
+}
+
+// searchLink fetch the description of an OpenSearch link within the
+// limit of its host
+func (c *crawl) searchLink(ctx context.Context, l opds2.Link) (opds2.Link, error) {
+
+	release, err := c.hosts.Acquire(ctx, l.Href)
+	if err != nil {
+		return opds2.Link{}, err
+	}
+	defer release()
+
+	return convert.ConvertSearchLink(ctx, l, c.opts.Client, c.opts.Header)
+}
+
+// URLs return the canonical url of every page sorted
+func (g *Graph) URLs() []string {
+	var urls []string
+
+	for u := range g.Pages {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+// RewriteLinks replace the href of each page pointing to another page of
+// the graph with the value returned by target
+func (g *Graph) RewriteLinks(target func(page *Page, linked *Page) string) error {
+
+	for _, page := range g.Pages {
+		if page.Err != nil {
+			continue
+		}
+		current := page
+		err := page.Feed.RewriteHrefs(func(href string) (string, error) {
+			linked, errCanonical := Canonical(href)
+			if errCanonical != nil {
+				return href, nil
+			}
+			linkedPage, ok := g.Pages[linked]
+			if !ok || linkedPage.Err != nil {
+				return href, nil
+			}
+			return target(current, linkedPage), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Canonical normalize an url to detect pages already crawled, scheme and
+// host are lowercased, default port and fragment removed and query
+// parameters sorted
+func Canonical(rawURL string) (string, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() {
+		return "", fmt.Errorf("crawler: %q is not an absolute url", rawURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) || (u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+
+	return u.String(), nil
+}
+
+type followedLink struct {
+	href       string
+	pagination bool
+}
+
+// followedLinks list the links of a feed leading to other pages of the
+// catalog
+func followedLinks(feed *opds2.Feed) []followedLink {
+	var links []followedLink
+
+	for _, l := range feed.Links {
+		if l.HasRel("next") {
+			links = append(links, followedLink{href: l.Href, pagination: true})
+		}
+	}
+	for _, l := range feed.Navigation {
+		if isFeedType(l.TypeLink) {
+			links = append(links, followedLink{href: l.Href})
+		}
+	}
+	for _, g := range feed.Groups {
+		for _, l := range g.Links {
+			if l.HasRel("self") && isFeedType(l.TypeLink) {
+				links = append(links, followedLink{href: l.Href})
+			}
+		}
+		for _, l := range g.Navigation {
+			if isFeedType(l.TypeLink) {
+				links = append(links, followedLink{href: l.Href})
+			}
+		}
+	}
+
+	return links
+}
+
+func isFeedType(typeLink string) bool {
+	return typeLink == "" || strings.Contains(typeLink, "atom+xml") || strings.Contains(typeLink, "opds+json")
+}
+
+// fetchPage get the feed at pageURL and convert it in OPDS 2.0 when
+// needed, href are resolved against the final url of the feed
+func fetchPage(ctx context.Context, pageURL string, opts Options) (opds2.Feed, error) {
+
+	request, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return opds2.Feed{}, err
+	}
+	for k, v := range opts.Header {
+		request.Header[k] = v
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, errReq := client.Do(request)
+	if errReq != nil {
+		return opds2.Feed{}, errReq
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return opds2.Feed{}, fmt.Errorf("crawler: %s: %s", pageURL, res.Status)
+	}
+
+	buff, errRead := ioutil.ReadAll(res.Body)
+	if errRead != nil {
+		return opds2.Feed{}, errRead
+	}
+
+	return convert.ParseBuffer(buff, res.Request.URL.String())
+}
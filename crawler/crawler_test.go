@@ -0,0 +1,240 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// catalog serve a catalog of feeds answering after a random latency and
+// record the highest number of requests served at once
+type catalog struct {
+	*httptest.Server
+	// others are the servers linked from the root feed
+	others []*catalog
+	feeds  int
+	// search add a link to an OpenSearch description in every feed
+	search bool
+
+	mutex    sync.Mutex
+	inFlight int
+	max      int
+	requests int
+	// descriptions are the values of the X-Test header of the requests
+	// of the description
+	descriptions []string
+}
+
+func newCatalog(feeds int) *catalog {
+	c := &catalog{feeds: feeds}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *catalog) serve(w http.ResponseWriter, r *http.Request) {
+
+	c.mutex.Lock()
+	c.inFlight++
+	c.requests++
+	if c.inFlight > c.max {
+		c.max = c.inFlight
+	}
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		c.inFlight--
+		c.mutex.Unlock()
+	}()
+
+	time.Sleep(time.Duration(1+rand.Intn(10)) * time.Millisecond)
+
+	var links, navigation []map[string]interface{}
+	switch {
+	case r.URL.Path == "/opensearch.xml":
+		c.mutex.Lock()
+		c.descriptions = append(c.descriptions, r.Header.Get("X-Test"))
+		c.mutex.Unlock()
+		w.Write([]byte(`<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <Url type="application/atom+xml;profile=opds-catalog" template="/search?q={searchTerms}"/>
+</OpenSearchDescription>`))
+		return
+	case r.URL.Path == "/":
+		for i := 0; i < c.feeds; i++ {
+			navigation = append(navigation, map[string]interface{}{"href": fmt.Sprintf("/feed/%d", i), "title": fmt.Sprintf("Feed %d", i), "type": "application/opds+json"})
+		}
+		for _, other := range c.others {
+			navigation = append(navigation, map[string]interface{}{"href": other.URL + "/", "title": "Other", "type": "application/opds+json"})
+		}
+	case strings.HasPrefix(r.URL.Path, "/feed/"):
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/feed/%d", &n); err != nil || n >= c.feeds {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("page") == "" {
+			links = append(links, map[string]interface{}{"href": r.URL.Path + "?page=2", "rel": "next", "type": "application/opds+json"})
+		}
+		navigation = append(navigation, map[string]interface{}{"href": fmt.Sprintf("/feed/%d", (n+1)%c.feeds), "title": "Next feed", "type": "application/opds+json"})
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	links = append(links, map[string]interface{}{"href": r.URL.String(), "rel": "self", "type": "application/opds+json"})
+	if c.search {
+		links = append(links, map[string]interface{}{"href": "/opensearch.xml", "rel": "search", "type": "application/opensearchdescription+xml"})
+	}
+
+	w.Header().Set("Content-Type", "application/opds+json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"metadata":   map[string]interface{}{"title": r.URL.String()},
+		"links":      links,
+		"navigation": navigation,
+	})
+}
+
+func (c *catalog) maxInFlight() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.max
+}
+
+func TestCrawl(t *testing.T) {
+	c := newCatalog(3)
+	defer c.Close()
+
+	g, err := Crawl(c.URL+"/", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the root, three feeds and their second pages
+	if len(g.Pages) != 7 || c.requests != 7 {
+		t.Fatalf("%d pages, %d requests: %v", len(g.Pages), c.requests, g.URLs())
+	}
+	for _, u := range g.URLs() {
+		page := g.Pages[u]
+		if page.Err != nil {
+			t.Errorf("%s: %v", u, page.Err)
+		}
+		want := 0
+		if u != g.Root {
+			want = 1
+		}
+		if page.Depth != want {
+			t.Errorf("%s: depth %d, want %d", u, page.Depth, want)
+		}
+	}
+	if c.maxInFlight() != 1 {
+		t.Errorf("%d requests at once without workers", c.maxInFlight())
+	}
+}
+
+func TestCrawlWorkers(t *testing.T) {
+	c := newCatalog(20)
+	defer c.Close()
+
+	g, err := Crawl(c.URL+"/", Options{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Pages) != 41 {
+		t.Errorf("%d pages", len(g.Pages))
+	}
+	if max := c.maxInFlight(); max > 4 || max < 2 {
+		t.Errorf("%d requests at once with 4 workers", max)
+	}
+}
+
+func TestCrawlPerHost(t *testing.T) {
+	a, b := newCatalog(10), newCatalog(10)
+	defer a.Close()
+	defer b.Close()
+	a.others = []*catalog{b}
+
+	g, err := Crawl(a.URL+"/", Options{Workers: 8, PerHost: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Pages) != 42 {
+		t.Errorf("%d pages", len(g.Pages))
+	}
+	for _, c := range []*catalog{a, b} {
+		if max := c.maxInFlight(); max > 2 {
+			t.Errorf("%s: %d requests at once with 2 per host", c.URL, max)
+		}
+	}
+}
+
+func TestCrawlSearchLinks(t *testing.T) {
+	c := newCatalog(10)
+	defer c.Close()
+	c.search = true
+
+	header := http.Header{}
+	header.Set("X-Test", "crawler")
+	g, err := Crawl(c.URL+"/", Options{Workers: 8, PerHost: 1, SearchLinks: true, Header: header})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Pages) != 21 {
+		t.Errorf("%d pages", len(g.Pages))
+	}
+	for _, u := range g.URLs() {
+		var search []string
+		for _, l := range g.Pages[u].Feed.Links {
+			if l.HasRel("search") {
+				search = append(search, l.Href)
+			}
+		}
+		if len(search) != 1 || search[0] != c.URL+"/search?q={query}" {
+			t.Errorf("%s: search links %q", u, search)
+		}
+	}
+	if !reflect.DeepEqual(c.descriptions, []string{"crawler"}) {
+		t.Errorf("description requests = %q", c.descriptions)
+	}
+	if max := c.maxInFlight(); max > 1 {
+		t.Errorf("%d requests at once with 1 per host", max)
+	}
+}
+
+func TestCrawlDeterministic(t *testing.T) {
+	a, b := newCatalog(8), newCatalog(8)
+	defer a.Close()
+	defer b.Close()
+	a.others = []*catalog{b}
+
+	tests := []Options{
+		{Workers: 8},
+		{Workers: 8, PerHost: 3},
+		{Workers: 8, MaxPages: 12},
+		{Workers: 8, MaxDepth: 1},
+	}
+	for _, opts := range tests {
+		var want map[string][]string
+		for i := 0; i < 5; i++ {
+			g, err := Crawl(a.URL+"/", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][]string)
+			for u, page := range g.Pages {
+				got[u] = append([]string{fmt.Sprint(page.Depth)}, page.Links...)
+			}
+			if opts.MaxPages > 0 && len(got) != opts.MaxPages {
+				t.Errorf("%+v: %d pages", opts, len(got))
+			}
+			if want == nil {
+				want = got
+			} else if !reflect.DeepEqual(got, want) {
+				t.Errorf("%+v: crawl %d differ from the first one\n%v\n%v", opts, i, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MirrorPath return the slash separated path of a page in a mirror, it
+// is made of the host and path of the url with a .json extension, a hash
+// of the query is added when there is one, the . and .. segments are
+// dropped so the path stays in the mirror
+func MirrorPath(pageURL string) string {
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return hashString(pageURL) + ".json"
+	}
+
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index"
+	}
+	ext := path.Ext(p)
+	if ext == ".atom" || ext == ".xml" || ext == ".json" {
+		p = strings.TrimSuffix(p, ext)
+	}
+	if u.RawQuery != "" {
+		p += "_" + hashString(u.RawQuery)
+	}
+
+	segments := []string{mirrorSegment(strings.Replace(u.Host, ":", "_", -1))}
+	for _, segment := range strings.Split(p, "/") {
+		if segment != "" && segment != "." && segment != ".." {
+			segments = append(segments, mirrorSegment(segment))
+		}
+	}
+	if len(segments) == 1 {
+		segments = append(segments, "index")
+	}
+
+	return strings.Join(segments, "/") + ".json"
+}
+
+// mirrorSegment make a segment of a mirror path safe on every filesystem
+func mirrorSegment(segment string) string {
+	if segment == "" || segment == "." || segment == ".." {
+		return "_"
+	}
+	return strings.Replace(segment, "\\", "_", -1)
+}
+
+// MirrorPaths return the mirror path of every page of the graph by url,
+// a page whose MirrorPath is the path of a page sorted before it, like
+// /a and /a.json, get a hash of its url added
+func (g *Graph) MirrorPaths() map[string]string {
+	paths := make(map[string]string)
+	// case insensitive filesystems mix paths differing by case
+	used := make(map[string]bool)
+
+	for _, u := range g.URLs() {
+		p := MirrorPath(u)
+		if used[strings.ToLower(p)] {
+			p = strings.TrimSuffix(p, ".json") + "_" + hashString(u) + ".json"
+		}
+		used[strings.ToLower(p)] = true
+		paths[u] = p
+	}
+
+	return paths
+}
+
+func hashString(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// WriteMirror write every page of the graph as an OPDS 2.0 feed in dir
+// using MirrorPaths, links between crawled pages are rewritten in relative
+// paths so the mirror can be browsed offline or served as static files,
+// the feeds of the graph are modified in the process
+func (g *Graph) WriteMirror(dir string) error {
+
+	paths := g.MirrorPaths()
+	err := g.RewriteLinks(func(page *Page, linked *Page) string {
+		return relativeMirrorPath(paths[page.URL], paths[linked.URL])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, u := range g.URLs() {
+		page := g.Pages[u]
+		if page.Err != nil {
+			continue
+		}
+
+		var buff bytes.Buffer
+		enc := json.NewEncoder(&buff)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", " ")
+		errEncode := enc.Encode(page.Feed)
+		if errEncode != nil {
+			return errEncode
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(paths[u]))
+		rel, errRel := filepath.Rel(dir, file)
+		if errRel != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("crawler: %s is outside of the mirror", u)
+		}
+		errDir := os.MkdirAll(filepath.Dir(file), 0755)
+		if errDir != nil {
+			return errDir
+		}
+		errWrite := ioutil.WriteFile(file, buff.Bytes(), 0644)
+		if errWrite != nil {
+			return errWrite
+		}
+	}
+
+	return nil
+}
+
+// relativeMirrorPath compute the path of target relative to the
+// directory of from, both being slash separated mirror paths
+func relativeMirrorPath(from string, target string) string {
+
+	fromDir := strings.Split(path.Dir(from), "/")
+	targetSegs := strings.Split(target, "/")
+
+	common := 0
+	for common < len(fromDir) && common < len(targetSegs)-1 && fromDir[common] == targetSegs[common] {
+		common++
+	}
+
+	var rel []string
+	for i := common; i < len(fromDir); i++ {
+		rel = append(rel, "..")
+	}
+	rel = append(rel, targetSegs[common:]...)
+
+	return strings.Join(rel, "/")
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+func TestMirrorPath(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/", "example.com/index.json"},
+		{"http://example.com", "example.com/index.json"},
+		{"http://example.com:8080/opds/new.atom", "example.com_8080/opds/new.json"},
+		{"http://example.com/opds/", "example.com/opds/index.json"},
+		{"http://example.com/a/../../b", "example.com/a/b.json"},
+		{"http://example.com/%2e%2e/%2e%2e/etc/passwd", "example.com/etc/passwd.json"},
+		{"http://example.com/..", "example.com/index.json"},
+		{"http://example.com/a%5c..%5cb", "example.com/a_.._b.json"},
+		{"http://../a", "_/a.json"},
+	}
+	for _, test := range tests {
+		if got := MirrorPath(test.url); got != test.want {
+			t.Errorf("MirrorPath(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestMirrorPaths(t *testing.T) {
+	g := &Graph{Pages: make(map[string]*Page)}
+	urls := []string{
+		"http://example.com/a",
+		"http://example.com/a.json",
+		"http://example.com/a.atom",
+		"http://example.com/A",
+		"http://example.com/b/",
+		"http://example.com/b/index",
+	}
+	for _, u := range urls {
+		g.Pages[u] = &Page{URL: u}
+	}
+
+	paths := g.MirrorPaths()
+	seen := make(map[string]string)
+	for u, p := range paths {
+		if other, ok := seen[strings.ToLower(p)]; ok {
+			t.Errorf("%s and %s are both written in %s", u, other, p)
+		}
+		seen[strings.ToLower(p)] = u
+	}
+	if paths["http://example.com/A"] != "example.com/A.json" {
+		t.Errorf("first path sorted = %q", paths["http://example.com/A"])
+	}
+}
+
+func TestWriteMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mirror := filepath.Join(dir, "mirror")
+
+	g := &Graph{Root: "http://example.com/", Pages: make(map[string]*Page)}
+	for _, u := range []string{"http://example.com/", "http://example.com/%2e%2e/%2e%2e/escape", "http://example.com/index"} {
+		feed := opds2.New(u)
+		feed.AddLink("http://example.com/", "start", "application/opds+json", false)
+		g.Pages[u] = &Page{URL: u, Feed: feed}
+	}
+	if err := g.WriteMirror(mirror); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(mirror, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if len(files) != 3 {
+		t.Fatalf("files = %v", files)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f, "..") {
+			t.Errorf("%s written outside of the mirror", f)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(mirror, "example.com", "escape.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"href": "index.json"`) {
+		t.Errorf("start link not rewritten: %s", data)
+	}
+}
@@ -0,0 +1,194 @@
+// Package epub read the metadata and the cover of EPUB 2 and EPUB 3 files
+// as OPDS 2.0 publications.
+//
+//	book, err := epub.ParseFile("moby-dick.epub")
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(book.Publication.Metadata.Title)
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// MediaType is the media type of EPUB files
+const MediaType = "application/epub+zip"
+
+// ErrNoPackage is returned for a container without OPF package document
+var ErrNoPackage = errors.New("epub: no package document in container")
+
+// Book is the publication read from an EPUB file
+type Book struct {
+	// Publication has the metadata of the package document, it has no
+	// link as the location of the file is not known
+	Publication opds2.Publication
+	// Version of the package document, like "2.0" or "3.0"
+	Version string
+	// Cover is the cover image, nil when the book has none
+	Cover *Cover
+}
+
+// Cover is an image of an EPUB file
+type Cover struct {
+	// Path of the image in the container
+	Path      string
+	MediaType string
+	Data      []byte
+}
+
+// ParseFile read an EPUB file
+func ParseFile(name string) (*Book, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(f, info.Size())
+}
+
+// Parse read an EPUB file of size bytes
+func Parse(r io.ReaderAt, size int64) (*Book, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	var c container
+	if err := readXML(files, "META-INF/container.xml", &c); err != nil {
+		return nil, err
+	}
+	opfPath := c.packagePath()
+	if opfPath == "" {
+		return nil, ErrNoPackage
+	}
+
+	var p opfPackage
+	if err := readXML(files, opfPath, &p); err != nil {
+		return nil, err
+	}
+
+	book := &Book{Version: p.Version, Publication: p.publication()}
+
+	if item, ok := p.coverItem(); ok {
+		// hrefs are relative to the package document
+		coverPath := path.Join(path.Dir(opfPath), unescapePath(item.Href))
+		if data, err := readFile(files, coverPath); err == nil {
+			book.Cover = &Cover{Path: coverPath, MediaType: item.MediaType, Data: data}
+		}
+	}
+
+	return book, nil
+}
+
+// ParsePackage read a package document alone, like the metadata.opf
+// files of Calibre libraries, the book has no cover as the images are not
+// in a container
+func ParsePackage(data []byte) (*Book, error) {
+	var p opfPackage
+	if err := decodeXML(data, &p); err != nil {
+		return nil, err
+	}
+	return &Book{Version: p.Version, Publication: p.publication()}, nil
+}
+
+// container is META-INF/container.xml
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// packagePath return the path of the first package document
+func (c *container) packagePath() string {
+	for _, r := range c.Rootfiles {
+		if r.MediaType == "application/oebps-package+xml" {
+			return r.FullPath
+		}
+	}
+	if len(c.Rootfiles) > 0 {
+		return c.Rootfiles[0].FullPath
+	}
+	return ""
+}
+
+// maxFileSize limit the size of the files of the archive read in memory,
+// a larger file is an error rather than a zip bomb filling the memory
+const maxFileSize = 32 << 20
+
+var errTooLarge = errors.New("epub: file too large")
+
+func readFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, errTooLarge
+	}
+
+	return data, nil
+}
+
+func readXML(files map[string]*zip.File, name string, v interface{}) error {
+	data, err := readFile(files, name)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return decodeXML(data, v)
+}
+
+func decodeXML(data []byte, v interface{}) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// package documents are nearly always utf-8, the few declaring another
+	// charset are read as utf-8 rather than failing
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return dec.Decode(v)
+}
+
+// unescapePath decode the percent-encoded href of a manifest item
+func unescapePath(href string) string {
+	if i := strings.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
+	}
+	if p, err := url.PathUnescape(href); err == nil {
+		return p
+	}
+	return href
+}
@@ -0,0 +1,325 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+const containerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+// buildEPUB return an EPUB with the package document and the other files
+// given by name
+func buildEPUB(t *testing.T, opf string, files map[string]string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	all := map[string]string{"META-INF/container.xml": containerXML, "OEBPS/content.opf": opf}
+	for name, content := range files {
+		all[name] = content
+	}
+	for name, content := range all {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// packageDocument return a package document of a version with the
+// metadata and the manifest items
+func packageDocument(version string, metadata string, manifest string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="` + version + `" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+` + metadata + `
+  </metadata>
+  <manifest>
+` + manifest + `
+  </manifest>
+</package>`
+}
+
+func parse(t *testing.T, opf string, files map[string]string) *Book {
+	t.Helper()
+	data := buildEPUB(t, opf, files)
+	book, err := Parse(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+func TestTitles(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		metadata string
+		title    opds2.MultiLanguage
+		subtitle string
+		sortAs   string
+	}{
+		{
+			name:    "epub 2",
+			version: "2.0",
+			metadata: `<dc:title>Moby Dick</dc:title>
+				<dc:title>or, The Whale</dc:title>
+				<meta name="calibre:title_sort" content="Moby Dick"/>`,
+			title:  opds2.MultiLanguage{SingleString: "Moby Dick"},
+			sortAs: "Moby Dick",
+		},
+		{
+			name:    "epub 3",
+			version: "3.0",
+			metadata: `<dc:title id="sub">or, The Whale</dc:title>
+				<dc:title id="main">The   Moby Dick</dc:title>
+				<meta refines="#main" property="title-type">main</meta>
+				<meta refines="#main" property="file-as">Moby Dick, The</meta>
+				<meta refines="#sub" property="title-type">subtitle</meta>`,
+			title:    opds2.MultiLanguage{SingleString: "The Moby Dick"},
+			subtitle: "or, The Whale",
+			sortAs:   "Moby Dick, The",
+		},
+		{
+			name:    "alternate script",
+			version: "3.0",
+			metadata: `<dc:title id="main" xml:lang="fr">Les Misérables</dc:title>
+				<meta refines="#main" property="alternate-script" xml:lang="ru">Отверженные</meta>`,
+			title: opds2.MultiLanguage{SingleString: "Les Misérables",
+				MultiString: map[string]string{"fr": "Les Misérables", "ru": "Отверженные"}},
+		},
+	}
+	for _, test := range tests {
+		book := parse(t, packageDocument(test.version, test.metadata, ""), nil)
+		meta := book.Publication.Metadata
+		if book.Version != test.version {
+			t.Errorf("%s: version = %q", test.name, book.Version)
+		}
+		if !reflect.DeepEqual(meta.Title, test.title) {
+			t.Errorf("%s: title = %+v, want %+v", test.name, meta.Title, test.title)
+		}
+		subtitle := ""
+		if meta.Subtitle != nil {
+			subtitle = meta.Subtitle.String()
+		}
+		if subtitle != test.subtitle || meta.SortAs != test.sortAs {
+			t.Errorf("%s: subtitle = %q, sort as = %q", test.name, subtitle, meta.SortAs)
+		}
+	}
+}
+
+func TestContributors(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		want     opds2.PublicationMetadata
+	}{
+		{
+			name: "epub 2",
+			metadata: `<dc:creator opf:role="aut" opf:file-as="Hugo, Victor">Victor Hugo</dc:creator>
+				<dc:creator opf:role="trl">Isabel Hapgood</dc:creator>
+				<dc:contributor opf:role="ill">Émile Bayard</dc:contributor>`,
+			want: opds2.PublicationMetadata{
+				Author:      []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Victor Hugo"}, SortAs: "Hugo, Victor"}},
+				Translator:  []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Isabel Hapgood"}}},
+				Illustrator: []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Émile Bayard"}}},
+			},
+		},
+		{
+			name: "epub 3",
+			metadata: `<dc:creator id="c1">Herman Melville</dc:creator>
+				<meta refines="#c1" property="role" scheme="marc:relators">aut</meta>
+				<meta refines="#c1" property="file-as">Melville, Herman</meta>
+				<dc:creator id="c2">Jean Giono</dc:creator>
+				<meta refines="#c2" property="role" scheme="marc:relators">trl</meta>
+				<dc:contributor id="c3">Rockwell Kent</dc:contributor>
+				<meta refines="#c3" property="role" scheme="marc:relators">ART</meta>`,
+			want: opds2.PublicationMetadata{
+				Author:     []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Herman Melville"}, SortAs: "Melville, Herman"}},
+				Translator: []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Jean Giono"}}},
+				Artist:     []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Rockwell Kent"}}},
+			},
+		},
+		{
+			name: "default and unknown roles",
+			metadata: `<dc:creator>Herman Melville</dc:creator>
+				<dc:contributor>Calibre</dc:contributor>
+				<dc:contributor opf:role="bkp">Someone</dc:contributor>`,
+			want: opds2.PublicationMetadata{
+				Author: []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Herman Melville"}}},
+				Contributor: []opds2.Contributor{
+					{Name: opds2.MultiLanguage{SingleString: "Calibre"}},
+					{Name: opds2.MultiLanguage{SingleString: "Someone"}, Role: "bkp"},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		meta := parse(t, packageDocument("3.0", test.metadata, ""), nil).Publication.Metadata
+		got := opds2.PublicationMetadata{Author: meta.Author, Translator: meta.Translator, Illustrator: meta.Illustrator,
+			Artist: meta.Artist, Contributor: meta.Contributor}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: contributors = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		metadata string
+		want     string
+	}{
+		{`<dc:identifier>other</dc:identifier><dc:identifier id="id">urn:isbn:9780000000001</dc:identifier>`, "urn:isbn:9780000000001"},
+		{`<dc:identifier id="id">isbn: 9780000000001</dc:identifier>`, "urn:isbn:9780000000001"},
+		{`<dc:identifier id="id" opf:scheme="ISBN">123</dc:identifier>`, "urn:isbn:123"},
+		{`<dc:identifier id="id">978-0-00-000000-1</dc:identifier>`, "urn:isbn:978-0-00-000000-1"},
+		{`<dc:identifier id="id">000000000X</dc:identifier>`, "urn:isbn:000000000X"},
+		{`<dc:identifier id="id">123</dc:identifier><meta refines="#id" property="identifier-type" scheme="onix:codelist5">15</meta>`, "urn:isbn:123"},
+		{`<dc:identifier id="id">uuid:2b0d4a6e-0000-4000-8000-000000000000</dc:identifier>`, "urn:uuid:2b0d4a6e-0000-4000-8000-000000000000"},
+		{`<dc:identifier id="id">2B0D4A6E-0000-4000-8000-000000000000</dc:identifier>`, "urn:uuid:2b0d4a6e-0000-4000-8000-000000000000"},
+		{`<dc:identifier id="id">http://example.com/moby</dc:identifier>`, "http://example.com/moby"},
+		{`<dc:identifier>first</dc:identifier><dc:identifier>second</dc:identifier>`, "first"},
+		{``, ""},
+	}
+	for _, test := range tests {
+		book := parse(t, packageDocument("3.0", test.metadata, ""), nil)
+		if got := book.Publication.Metadata.Identifier; got != test.want {
+			t.Errorf("%s: identifier = %q, want %q", test.metadata, got, test.want)
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		want     *opds2.BelongsTo
+	}{
+		{
+			name: "belongs-to-collection",
+			metadata: `<meta property="belongs-to-collection" id="s">The Expanse</meta>
+				<meta refines="#s" property="collection-type">series</meta>
+				<meta refines="#s" property="group-position">2.5</meta>
+				<meta refines="#s" property="file-as">Expanse, The</meta>
+				<meta property="belongs-to-collection" id="c">Science fiction</meta>
+				<meta refines="#c" property="dcterms:identifier">urn:collection:sf</meta>`,
+			want: &opds2.BelongsTo{
+				Series:     []opds2.Collection{{Name: "The Expanse", SortAs: "Expanse, The", Position: 2.5}},
+				Collection: []opds2.Collection{{Name: "Science fiction", Identifier: "urn:collection:sf"}},
+			},
+		},
+		{
+			name: "calibre series",
+			metadata: `<meta name="calibre:series" content="The Expanse"/>
+				<meta name="calibre:series_index" content="3"/>`,
+			want: &opds2.BelongsTo{Series: []opds2.Collection{{Name: "The Expanse", Position: 3}}},
+		},
+		{
+			name: "belongs-to-collection first",
+			metadata: `<meta property="belongs-to-collection" id="s">Leviathan</meta>
+				<meta refines="#s" property="collection-type">series</meta>
+				<meta name="calibre:series" content="The Expanse"/>`,
+			want: &opds2.BelongsTo{Series: []opds2.Collection{{Name: "Leviathan"}}},
+		},
+		{name: "none", metadata: `<dc:title>t</dc:title>`},
+	}
+	for _, test := range tests {
+		book := parse(t, packageDocument("3.0", test.metadata, ""), nil)
+		if got := book.Publication.Metadata.BelongsTo; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: belongs to = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	images := map[string]string{
+		"OEBPS/images/my cover.jpg": "cover",
+		"OEBPS/images/other.png":    "other",
+	}
+	tests := []struct {
+		name     string
+		metadata string
+		manifest string
+		files    map[string]string
+		path     string
+	}{
+		{
+			name: "cover-image",
+			manifest: `<item id="a" href="images/other.png" media-type="image/png"/>
+				<item id="b" href="images/my%20cover.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+			files: images,
+			path:  "OEBPS/images/my cover.jpg",
+		},
+		{
+			name:     "cover meta",
+			metadata: `<meta name="cover" content="b"/>`,
+			manifest: `<item id="a" href="images/my%20cover.jpg" media-type="image/jpeg"/>
+				<item id="b" href="images/other.png" media-type="image/png"/>`,
+			files: images,
+			path:  "OEBPS/images/other.png",
+		},
+		{
+			name:     "named cover",
+			manifest: `<item id="a" href="images/other.png" media-type="image/png"/><item id="b" href="images/my%20cover.jpg" media-type="image/jpeg"/>`,
+			files:    images,
+			path:     "OEBPS/images/my cover.jpg",
+		},
+		{
+			name:     "no image",
+			manifest: `<item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>`,
+			files:    images,
+		},
+		{
+			name:     "missing file",
+			manifest: `<item id="a" href="images/missing.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+			files:    images,
+		},
+		{
+			name:     "too large",
+			manifest: `<item id="a" href="images/large.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+			files:    map[string]string{"OEBPS/images/large.jpg": strings.Repeat("\x00", maxFileSize+1)},
+		},
+	}
+	for _, test := range tests {
+		book := parse(t, packageDocument("3.0", test.metadata, test.manifest), test.files)
+		path := ""
+		if book.Cover != nil {
+			path = book.Cover.Path
+			if string(book.Cover.Data) != test.files[path] {
+				t.Errorf("%s: cover data = %q", test.name, book.Cover.Data)
+			}
+		}
+		if path != test.path {
+			t.Errorf("%s: cover = %q, want %q", test.name, path, test.path)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	noPackage := strings.Replace(containerXML, `full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"`, ``, 1)
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	f, _ := w.Create("META-INF/container.xml")
+	f.Write([]byte(noPackage))
+	w.Close()
+	if _, err := Parse(bytes.NewReader(b.Bytes()), int64(b.Len())); err != ErrNoPackage {
+		t.Errorf("container without package: error %v", err)
+	}
+
+	if _, err := Parse(strings.NewReader("not a zip"), 9); err == nil {
+		t.Error("no error for a file that is not a zip")
+	}
+}
@@ -0,0 +1,468 @@
+package epub
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// namespaces of the package document
+const (
+	namespaceDC  = "http://purl.org/dc/elements/1.1/"
+	namespaceXML = "http://www.w3.org/XML/1998/namespace"
+)
+
+// opfPackage is the OPF package document
+type opfPackage struct {
+	Version          string `xml:"version,attr"`
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		Elements []element `xml:",any"`
+	} `xml:"metadata"`
+	Manifest []item `xml:"manifest>item"`
+}
+
+// element is an element of the metadata, dc elements and meta are read the
+// same way as their attributes differ between EPUB 2 and EPUB 3
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Value    string     `xml:",chardata"`
+	Children []element  `xml:",any"`
+}
+
+type item struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// attr return the value of an attribute whatever its namespace, EPUB 2
+// files use opf:role or role for the same attribute
+func (e *element) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
+}
+
+func (e *element) text() string {
+	return strings.Join(strings.Fields(e.Value), " ")
+}
+
+func (e *element) isDC(name string) bool {
+	return e.XMLName.Space == namespaceDC && e.XMLName.Local == name
+}
+
+func (e *element) lang() string {
+	for _, a := range e.Attrs {
+		if a.Name.Space == namespaceXML && a.Name.Local == "lang" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// metadata is the metadata of a package document with the EPUB 3
+// refinements indexed by the id of the element refined
+type metadata struct {
+	elements []element
+	refines  map[string][]element
+	// metas are the EPUB 2 meta by name
+	metas map[string]string
+}
+
+func (p *opfPackage) metadata() *metadata {
+	m := &metadata{refines: make(map[string][]element), metas: make(map[string]string)}
+
+	var add func(elements []element)
+	add = func(elements []element) {
+		for _, e := range elements {
+			// OEB 1 packages group the metadata in dc-metadata and
+			// x-metadata
+			if e.XMLName.Local == "dc-metadata" || e.XMLName.Local == "x-metadata" {
+				add(e.Children)
+				continue
+			}
+			if e.XMLName.Local == "meta" {
+				if id := strings.TrimPrefix(e.attr("refines"), "#"); id != "" {
+					m.refines[id] = append(m.refines[id], e)
+					continue
+				}
+				if name := e.attr("name"); name != "" {
+					m.metas[name] = e.attr("content")
+				}
+			}
+			m.elements = append(m.elements, e)
+		}
+	}
+	add(p.Metadata.Elements)
+
+	return m
+}
+
+// refinement return the value of the first refinement of an element with
+// a property
+func (m *metadata) refinement(e *element, property string) string {
+	id := e.attr("id")
+	if id == "" {
+		return ""
+	}
+	for _, r := range m.refines[id] {
+		if r.attr("property") == property {
+			return r.text()
+		}
+	}
+	return ""
+}
+
+// dc return the dc elements with a name
+func (m *metadata) dc(name string) []*element {
+	var elements []*element
+	for i := range m.elements {
+		if m.elements[i].isDC(name) && m.elements[i].text() != "" {
+			elements = append(elements, &m.elements[i])
+		}
+	}
+	return elements
+}
+
+// property return the EPUB 3 meta with a property
+func (m *metadata) property(property string) []*element {
+	var elements []*element
+	for i := range m.elements {
+		e := &m.elements[i]
+		if e.XMLName.Local == "meta" && e.attr("property") == property {
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// publication map the metadata of the package to a publication
+func (p *opfPackage) publication() opds2.Publication {
+	var publication opds2.Publication
+	m := p.metadata()
+	meta := &publication.Metadata
+
+	meta.RDFType = "http://schema.org/Book"
+	p.mapTitles(m, meta)
+	meta.Identifier = p.identifier(m)
+
+	for _, e := range m.dc("creator") {
+		m.addContributor(meta, e, "aut")
+	}
+	for _, e := range m.dc("contributor") {
+		m.addContributor(meta, e, "")
+	}
+	for _, e := range m.dc("publisher") {
+		meta.Publisher = append(meta.Publisher, opds2.Contributor{Name: opds2.MultiLanguage{SingleString: e.text()}})
+	}
+
+	for _, e := range m.dc("language") {
+		meta.Language = append(meta.Language, e.text())
+	}
+
+	for _, e := range m.dc("subject") {
+		s := opds2.Subject{Name: e.text()}
+		// EPUB 3 authority and term, EPUB 2 has no standard scheme
+		s.Scheme = m.refinement(e, "authority")
+		s.Code = m.refinement(e, "term")
+		meta.Subject = append(meta.Subject, s)
+	}
+
+	if descriptions := m.dc("description"); len(descriptions) > 0 {
+		meta.Description = strings.TrimSpace(descriptions[0].Value)
+	}
+	if rights := m.dc("rights"); len(rights) > 0 {
+		meta.Rights = rights[0].text()
+	}
+	if sources := m.dc("source"); len(sources) > 0 {
+		meta.Source = sources[0].text()
+	}
+
+	p.mapDates(m, meta)
+	mapCollections(m, meta)
+
+	return publication
+}
+
+// mapTitles set the main title, the subtitle and the sort title, EPUB 3
+// tell them apart with title-type, EPUB 2 has the main title first
+func (p *opfPackage) mapTitles(m *metadata, meta *opds2.PublicationMetadata) {
+	titles := m.dc("title")
+	if len(titles) == 0 {
+		return
+	}
+
+	mainTitle := titles[0]
+	for _, t := range titles {
+		if m.refinement(t, "title-type") == "main" {
+			mainTitle = t
+			break
+		}
+	}
+	meta.Title.SingleString = mainTitle.text()
+
+	// alternate-script refinements are the title in other languages
+	for _, r := range m.refines[mainTitle.attr("id")] {
+		if r.attr("property") == "alternate-script" && r.lang() != "" {
+			if meta.Title.MultiString == nil {
+				meta.Title.MultiString = make(map[string]string)
+				if lang := mainTitle.lang(); lang != "" {
+					meta.Title.MultiString[lang] = mainTitle.text()
+				}
+			}
+			meta.Title.MultiString[r.lang()] = r.text()
+		}
+	}
+
+	meta.SortAs = m.refinement(mainTitle, "file-as")
+	if meta.SortAs == "" {
+		meta.SortAs = m.metas["calibre:title_sort"]
+	}
+
+	for _, t := range titles {
+		if m.refinement(t, "title-type") == "subtitle" {
+			meta.Subtitle = &opds2.MultiLanguage{SingleString: t.text()}
+			break
+		}
+	}
+}
+
+// identifier return the unique identifier of the package as an urn when
+// its scheme is known
+func (p *opfPackage) identifier(m *metadata) string {
+	identifiers := m.dc("identifier")
+	if len(identifiers) == 0 {
+		return ""
+	}
+
+	e := identifiers[0]
+	for _, i := range identifiers {
+		if p.UniqueIdentifier != "" && i.attr("id") == p.UniqueIdentifier {
+			e = i
+			break
+		}
+	}
+
+	value := e.text()
+	scheme := strings.ToLower(e.attr("scheme"))
+	// ONIX code list 5, 02 and 15 are ISBN-10 and ISBN-13
+	switch m.refinement(e, "identifier-type") {
+	case "02", "15":
+		scheme = "isbn"
+	}
+
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(lower, "urn:"):
+		return value
+	case strings.HasPrefix(lower, "isbn:"):
+		return "urn:isbn:" + strings.TrimSpace(value[5:])
+	case strings.HasPrefix(lower, "uuid:"):
+		return "urn:uuid:" + strings.TrimSpace(value[5:])
+	case scheme == "isbn" || isISBN(value):
+		return "urn:isbn:" + value
+	case scheme == "uuid" || isUUID(value):
+		return "urn:uuid:" + lower
+	}
+	return value
+}
+
+// isISBN tell if a value is an ISBN-10 or an ISBN-13 with or without
+// hyphens
+func isISBN(value string) bool {
+	digits := strings.NewReplacer("-", "", " ", "").Replace(value)
+	if len(digits) != 10 && len(digits) != 13 {
+		return false
+	}
+	for i, c := range digits {
+		if (c < '0' || c > '9') && !((c == 'X' || c == 'x') && i == 9 && len(digits) == 10) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID tell if a value is an uuid in its 8-4-4-4-12 form
+func isUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	for i, c := range value {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isHexDigit(c rune) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// addContributor add a creator or a contributor to the list of its role,
+// the role is a MARC relator code, defaultRole is used without role
+func (m *metadata) addContributor(meta *opds2.PublicationMetadata, e *element, defaultRole string) {
+	c := opds2.Contributor{Name: opds2.MultiLanguage{SingleString: e.text()}}
+
+	c.SortAs = e.attr("file-as")
+	if c.SortAs == "" {
+		c.SortAs = m.refinement(e, "file-as")
+	}
+
+	role := e.attr("role")
+	if role == "" {
+		role = m.refinement(e, "role")
+	}
+	if role == "" {
+		role = defaultRole
+	}
+
+	switch strings.ToLower(role) {
+	case "aut":
+		meta.Author = append(meta.Author, c)
+	case "trl":
+		meta.Translator = append(meta.Translator, c)
+	case "edt":
+		meta.Editor = append(meta.Editor, c)
+	case "art":
+		meta.Artist = append(meta.Artist, c)
+	case "ill":
+		meta.Illustrator = append(meta.Illustrator, c)
+	case "clr":
+		meta.Colorist = append(meta.Colorist, c)
+	case "nrt":
+		meta.Narrator = append(meta.Narrator, c)
+	case "pbl":
+		meta.Publisher = append(meta.Publisher, c)
+	default:
+		c.Role = role
+		meta.Contributor = append(meta.Contributor, c)
+	}
+}
+
+// mapDates set the publication and the modification dates, EPUB 2 tell
+// them apart with opf:event, EPUB 3 has dcterms:modified
+func (p *opfPackage) mapDates(m *metadata, meta *opds2.PublicationMetadata) {
+
+	for _, e := range m.dc("date") {
+		t, ok := parseDate(e.text())
+		if !ok {
+			continue
+		}
+		switch e.attr("event") {
+		case "modification":
+			if meta.Modified == nil {
+				meta.Modified = &t
+			}
+		case "", "publication", "original-publication", "issued":
+			if meta.PublicationDate == nil {
+				meta.PublicationDate = &t
+			}
+		}
+	}
+
+	for _, e := range m.property("dcterms:modified") {
+		if t, ok := parseDate(e.text()); ok {
+			meta.Modified = &t
+			break
+		}
+	}
+}
+
+// dateLayouts are the forms of the W3CDTF dates of the package documents
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// mapCollections set the series and the collections from the EPUB 3
+// belongs-to-collection or the calibre series of EPUB 2
+func mapCollections(m *metadata, meta *opds2.PublicationMetadata) {
+	var belongsTo opds2.BelongsTo
+
+	for _, e := range m.property("belongs-to-collection") {
+		c := opds2.Collection{Name: e.text()}
+		c.SortAs = m.refinement(e, "file-as")
+		c.Identifier = m.refinement(e, "dcterms:identifier")
+		if position, err := strconv.ParseFloat(m.refinement(e, "group-position"), 32); err == nil {
+			c.Position = float32(position)
+		}
+		if m.refinement(e, "collection-type") == "series" {
+			belongsTo.Series = append(belongsTo.Series, c)
+		} else {
+			belongsTo.Collection = append(belongsTo.Collection, c)
+		}
+	}
+
+	if name := m.metas["calibre:series"]; name != "" && len(belongsTo.Series) == 0 {
+		c := opds2.Collection{Name: name}
+		if position, err := strconv.ParseFloat(m.metas["calibre:series_index"], 32); err == nil {
+			c.Position = float32(position)
+		}
+		belongsTo.Series = append(belongsTo.Series, c)
+	}
+
+	if len(belongsTo.Series) > 0 || len(belongsTo.Collection) > 0 {
+		meta.BelongsTo = &belongsTo
+	}
+}
+
+// coverItem return the item of the cover image, EPUB 3 has a cover-image
+// property, EPUB 2 a cover meta with the id of the item
+func (p *opfPackage) coverItem() (item, bool) {
+
+	for _, i := range p.Manifest {
+		for _, property := range strings.Fields(i.Properties) {
+			if property == "cover-image" {
+				return i, true
+			}
+		}
+	}
+
+	m := p.metadata()
+	if id := m.metas["cover"]; id != "" {
+		for _, i := range p.Manifest {
+			if i.ID == id && strings.HasPrefix(i.MediaType, "image/") {
+				return i, true
+			}
+		}
+	}
+
+	// some books only name their cover
+	for _, i := range p.Manifest {
+		if strings.HasPrefix(i.MediaType, "image/") && (strings.Contains(strings.ToLower(i.ID), "cover") || strings.Contains(strings.ToLower(i.Href), "cover")) {
+			return i, true
+		}
+	}
+
+	return item{}, false
+}
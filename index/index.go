@@ -0,0 +1,337 @@
+// Package index provide a full-text search index over OPDS 2.0
+// publications, to search catalogs without a server. The index is built in
+// memory, searched with prefix or fuzzy matching and saved to disk with
+// Save and Load.
+//
+//	idx := index.New()
+//	idx.AddFeed(feed)
+//	results := idx.Search(index.Query{Text: "moby dick", Fuzzy: true})
+//	page := results.Feed(index.FeedOptions{Title: "Search"})
+package index
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Field is a part of the publications indexed
+type Field uint8
+
+// fields of the publications indexed
+const (
+	Title Field = iota
+	Subtitle
+	Contributor
+	Subject
+	Description
+	Series
+)
+
+// fieldWeights are the weights of a term found in each field
+var fieldWeights = map[Field]float64{
+	Title:       10,
+	Subtitle:    6,
+	Contributor: 5,
+	Series:      5,
+	Subject:     3,
+	Description: 1,
+}
+
+// formatVersion is the version of the format written by Save
+const formatVersion = 1
+
+// ErrFormat is returned by Load for data that is not an index or an index
+// of another version
+var ErrFormat = errors.New("index: unknown format")
+
+// Index is an inverted index of publications, it is safe for concurrent
+// use
+type Index struct {
+	mutex     sync.RWMutex
+	documents []*document
+	keys      map[string]int
+	postings  map[string][]posting
+	// terms are the terms in order for prefix search, nil when they have
+	// to be sorted again, termsMutex protect them during searches
+	terms      []string
+	termsMutex sync.Mutex
+}
+
+// document is an indexed publication with the values of its facets,
+// Deleted is set when the publication was replaced, it has no posting
+// left and is not saved
+type document struct {
+	Publication opds2.Publication
+	Languages   []string
+	Subjects    []string
+	Publishers  []string
+	Deleted     bool
+}
+
+// posting is the occurrences of a term in a field of a document
+type posting struct {
+	Document int
+	Field    Field
+	Count    int
+}
+
+// New create an empty index
+func New() *Index {
+	return &Index{keys: make(map[string]int), postings: make(map[string][]posting)}
+}
+
+// Len return the number of publications in the index
+func (idx *Index) Len() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return len(idx.keys)
+}
+
+// Add index publications, a publication with the key of one already
+// indexed replace it
+func (idx *Index) Add(publications ...opds2.Publication) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	for _, p := range publications {
+		idx.add(p)
+	}
+	idx.terms = nil
+}
+
+// AddFeed index the publications of the feed and its groups
+func (idx *Index) AddFeed(feed *opds2.Feed) {
+	idx.Add(feed.Publications...)
+	for _, g := range feed.Groups {
+		idx.Add(g.Publications...)
+	}
+}
+
+func (idx *Index) add(p opds2.Publication) {
+
+	key := p.Key()
+	if old, ok := idx.keys[key]; ok {
+		idx.remove(old)
+	}
+
+	d := &document{Publication: p}
+	id := len(idx.documents)
+	idx.documents = append(idx.documents, d)
+	idx.keys[key] = id
+
+	m := &p.Metadata
+	d.Languages = append(d.Languages, m.Language...)
+	for _, s := range m.Subject {
+		d.Subjects = append(d.Subjects, s.Name)
+	}
+	for _, c := range m.Publisher {
+		d.Publishers = append(d.Publishers, c.Name.String())
+	}
+
+	fieldTexts(&p, func(field Field, text string) {
+		idx.indexText(id, field, text)
+	})
+}
+
+// remove drop the postings of a replaced document, its terms are found in
+// its publication
+func (idx *Index) remove(id int) {
+	d := idx.documents[id]
+
+	fieldTexts(&d.Publication, func(field Field, text string) {
+		for _, t := range tokenize(text) {
+			postings := idx.postings[t]
+			kept := postings[:0]
+			for _, p := range postings {
+				if p.Document != id {
+					kept = append(kept, p)
+				}
+			}
+			if len(kept) == 0 {
+				delete(idx.postings, t)
+			} else {
+				idx.postings[t] = kept
+			}
+		}
+	})
+
+	idx.documents[id] = &document{Deleted: true}
+}
+
+// fieldTexts call fn with the text of each field of a publication
+func fieldTexts(p *opds2.Publication, fn func(field Field, text string)) {
+	m := &p.Metadata
+
+	fn(Title, multiLanguageText(m.Title))
+	if m.Subtitle != nil {
+		fn(Subtitle, multiLanguageText(*m.Subtitle))
+	}
+	for _, role := range [][]opds2.Contributor{m.Author, m.Translator, m.Editor, m.Artist, m.Illustrator,
+		m.Letterer, m.Penciler, m.Colorist, m.Inker, m.Narrator, m.Contributor, m.Publisher, m.Imprint} {
+		for _, c := range role {
+			fn(Contributor, multiLanguageText(c.Name))
+		}
+	}
+	for _, s := range m.Subject {
+		fn(Subject, s.Name)
+	}
+	fn(Description, stripTags(m.Description))
+	if m.BelongsTo != nil {
+		for _, s := range m.BelongsTo.Series {
+			fn(Series, s.Name)
+		}
+		for _, c := range m.BelongsTo.Collection {
+			fn(Series, c.Name)
+		}
+	}
+}
+
+func (idx *Index) indexText(id int, field Field, text string) {
+	counts := make(map[string]int)
+	var order []string
+
+	for _, t := range tokenize(text) {
+		if counts[t] == 0 {
+			order = append(order, t)
+		}
+		counts[t]++
+	}
+	for _, t := range order {
+		postings := idx.postings[t]
+		if n := len(postings); n > 0 && postings[n-1].Document == id && postings[n-1].Field == field {
+			postings[n-1].Count += counts[t]
+			continue
+		}
+		idx.postings[t] = append(postings, posting{Document: id, Field: field, Count: counts[t]})
+	}
+}
+
+// multiLanguageText join the single string and every translation
+func multiLanguageText(m opds2.MultiLanguage) string {
+	parts := []string{m.SingleString}
+	for _, s := range m.MultiString {
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// tokenize split text in words without case and accents
+func tokenize(text string) []string {
+	return strings.FieldsFunc(opds2.Fold(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stripTags remove the html tags of a description
+func stripTags(s string) string {
+	if !strings.Contains(s, "<") {
+		return s
+	}
+
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+			b.WriteRune(' ')
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sortedTerms return the terms in order, the caller must hold the read
+// lock
+func (idx *Index) sortedTerms() []string {
+	idx.termsMutex.Lock()
+	defer idx.termsMutex.Unlock()
+
+	if idx.terms == nil {
+		idx.terms = make([]string, 0, len(idx.postings))
+		for t := range idx.postings {
+			idx.terms = append(idx.terms, t)
+		}
+		sort.Strings(idx.terms)
+	}
+	return idx.terms
+}
+
+// snapshot is the content written by Save
+type snapshot struct {
+	Version   int
+	Documents []*document
+	Postings  map[string][]posting
+}
+
+// Save write the index to w, it is read back with Load, the replaced
+// publications are not written
+func (idx *Index) Save(w io.Writer) error {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return gob.NewEncoder(w).Encode(idx.compact())
+}
+
+// compact return the snapshot of the index without the deleted documents,
+// the others are numbered again in the same order
+func (idx *Index) compact() snapshot {
+	s := snapshot{Version: formatVersion, Postings: make(map[string][]posting, len(idx.postings))}
+
+	ids := make([]int, len(idx.documents))
+	for id, d := range idx.documents {
+		ids[id] = -1
+		if !d.Deleted {
+			ids[id] = len(s.Documents)
+			s.Documents = append(s.Documents, d)
+		}
+	}
+	for t, postings := range idx.postings {
+		var kept []posting
+		for _, p := range postings {
+			if ids[p.Document] >= 0 {
+				kept = append(kept, posting{Document: ids[p.Document], Field: p.Field, Count: p.Count})
+			}
+		}
+		if len(kept) > 0 {
+			s.Postings[t] = kept
+		}
+	}
+
+	return s
+}
+
+// Load read an index written by Save
+func Load(r io.Reader) (*Index, error) {
+	var s snapshot
+
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != formatVersion {
+		return nil, ErrFormat
+	}
+
+	idx := New()
+	idx.documents = s.Documents
+	if s.Postings != nil {
+		idx.postings = s.Postings
+	}
+	for id, d := range idx.documents {
+		if !d.Deleted {
+			idx.keys[d.Publication.Key()] = id
+		}
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,168 @@
+package index
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+func testPublication(identifier string, title string, author string, language string, subject string, description string) opds2.Publication {
+	var p opds2.Publication
+	p.Metadata.Identifier = identifier
+	p.Metadata.Title.SingleString = title
+	p.AddAuthor(author, "", "", "", "")
+	p.Metadata.Language = []string{language}
+	p.Metadata.Subject = []opds2.Subject{{Name: subject}}
+	p.Metadata.Description = description
+	return p
+}
+
+func newTestIndex() *Index {
+	idx := New()
+	idx.Add(
+		testPublication("urn:1", "Moby Dick", "Herman Melville", "en", "Sea", "<p>A whale hunt.</p>"),
+		testPublication("urn:2", "Bartleby", "Herman Melville", "en", "Short stories", "A scrivener."),
+		testPublication("urn:3", "Les Travailleurs de la mer", "Victor Hugo", "fr", "Sea", "Gilliatt fight an octopus, not a whale."),
+		testPublication("urn:4", "Whale Songs", "Roger Payne", "en", "Sea", "Recordings."),
+		testPublication("urn:5", "Le Dernier Jour d'un condamné", "Victor Hugo", "fr", "History", "Un condamné."),
+	)
+	return idx
+}
+
+// identifiers return the identifiers of the publications found in order
+func identifiers(r Results) []string {
+	var ids []string
+	for _, h := range r.Hits {
+		ids = append(ids, h.Publication.Metadata.Identifier)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		// a title is worth more than a description, equal scores keep the
+		// order the publications were added
+		{"ranking", Query{Text: "whale"}, []string{"urn:4", "urn:1", "urn:3"}},
+		{"every word", Query{Text: "melville moby"}, []string{"urn:1"}},
+		{"accents and case", Query{Text: "CONDAMNE"}, []string{"urn:5"}},
+		{"html", Query{Text: "p whale"}, nil},
+		{"last word as prefix", Query{Text: "herman mel"}, []string{"urn:1", "urn:2"}},
+		{"first word not a prefix", Query{Text: "her melville"}, nil},
+		{"prefix", Query{Text: "her melville", Prefix: true}, []string{"urn:1", "urn:2"}},
+		{"typo without fuzzy", Query{Text: "melvile herman"}, nil},
+		{"fuzzy", Query{Text: "melvile herman", Fuzzy: true}, []string{"urn:1", "urn:2"}},
+		{"two typos in a long word", Query{Text: "scrivenre herman", Fuzzy: true}, []string{"urn:2"}},
+		{"short words are exact", Query{Text: "sae whale", Fuzzy: true}, nil},
+		{"empty", Query{Text: " ", Subject: "Sea"}, []string{"urn:1", "urn:3", "urn:4"}},
+		{"facets", Query{Text: "whale", Language: "en", Subject: "Sea"}, []string{"urn:4", "urn:1"}},
+		{"page", Query{Text: "whale", Page: 2, ItemsPerPage: 2}, []string{"urn:3"}},
+	}
+	for _, test := range tests {
+		if got := identifiers(idx.Search(test.query)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// an exact match is worth more than a typo
+	results := idx.Search(Query{Text: "sea", Fuzzy: true, Prefix: true})
+	if len(results.Hits) != 3 || results.Hits[0].Score <= 0 {
+		t.Errorf("sea: %+v", results.Hits)
+	}
+	exact := idx.Search(Query{Text: "hugo"}).Hits[0].Score
+	typo := idx.Search(Query{Text: "hugi", Fuzzy: true}).Hits[0].Score
+	if typo >= exact {
+		t.Errorf("typo scored %v, exact match %v", typo, exact)
+	}
+}
+
+func TestFacets(t *testing.T) {
+	results := newTestIndex().Search(Query{Text: "whale"})
+
+	want := map[string][]FacetCount{
+		FacetLanguage:  {{"en", 2}, {"fr", 1}},
+		FacetSubject:   {{"Sea", 3}},
+		FacetPublisher: nil,
+	}
+	if results.Total != 3 || !reflect.DeepEqual(results.Facets, want) {
+		t.Errorf("total %d, facets %+v", results.Total, results.Facets)
+	}
+
+	feed := results.Feed(FeedOptions{
+		Title:    "Search",
+		FacetURL: func(facet string, value string) string { return "/search?" + facet + "=" + value },
+	})
+	if len(feed.Facets) != 2 || feed.Facets[0].Metadata.Title != FacetLanguage || len(feed.Facets[0].Links) != 2 ||
+		feed.Facets[0].Links[0].Properties.NumberOfItems != 2 {
+		t.Errorf("facets = %+v", feed.Facets)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	idx := newTestIndex()
+	for i := 0; i < 10; i++ {
+		idx.Add(testPublication("urn:2", "Bartleby, the Scrivener", "Herman Melville", "en", "Short stories", "A scrivener."))
+	}
+	if idx.Len() != 5 {
+		t.Errorf("%d publications", idx.Len())
+	}
+	if got := identifiers(idx.Search(Query{Text: "bartleby"})); !reflect.DeepEqual(got, []string{"urn:2"}) {
+		t.Errorf("bartleby: %q", got)
+	}
+
+	// the replaced publications are not counted in the scores
+	fresh := newTestIndex()
+	fresh.Add(testPublication("urn:2", "Bartleby, the Scrivener", "Herman Melville", "en", "Short stories", "A scrivener."))
+	for _, text := range []string{"scrivener", "melville", "whale"} {
+		got, want := idx.Search(Query{Text: text}), fresh.Search(Query{Text: text})
+		for i := range got.Hits {
+			if got.Hits[i].Score != want.Hits[i].Score {
+				t.Errorf("%s: score %v, want %v", text, got.Hits[i].Score, want.Hits[i].Score)
+			}
+		}
+	}
+	if len(idx.postings["the"]) != 1 {
+		t.Errorf("postings of the replaced publications: %+v", idx.postings["the"])
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	idx := newTestIndex()
+	idx.Add(testPublication("urn:1", "Moby-Dick; or, The Whale", "Herman Melville", "en", "Sea", "Call me Ishmael."))
+
+	var b bytes.Buffer
+	if err := idx.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != 5 || len(loaded.documents) != 5 {
+		t.Errorf("%d publications, %d documents", loaded.Len(), len(loaded.documents))
+	}
+	for _, q := range []Query{{Text: "whale"}, {Text: "ishmael"}, {Text: "hunt"}, {Text: "melvile", Fuzzy: true}, {Subject: "Sea"}} {
+		want, got := idx.Search(q), loaded.Search(q)
+		if !reflect.DeepEqual(identifiers(got), identifiers(want)) || !reflect.DeepEqual(got.Facets, want.Facets) {
+			t.Errorf("%+v: %q, want %q", q, identifiers(got), identifiers(want))
+		}
+	}
+
+	// the loaded index can still be updated
+	loaded.Add(testPublication("urn:6", "Typee", "Herman Melville", "en", "Sea", ""))
+	if got := identifiers(loaded.Search(Query{Text: "typee"})); !reflect.DeepEqual(got, []string{"urn:6"}) {
+		t.Errorf("typee: %q", got)
+	}
+
+	if _, err := Load(bytes.NewReader([]byte("not an index"))); err == nil {
+		t.Error("no error for data that is not an index")
+	}
+}
@@ -0,0 +1,336 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Query is a search in an index
+type Query struct {
+	// Text is the words searched, every word must be found in a
+	// publication, every publication match an empty text
+	Text string
+	// Prefix match words starting with the words searched, the last word
+	// always match as a prefix so the search work while typing
+	Prefix bool
+	// Fuzzy match words with one typo, two for words of eight letters
+	// or more
+	Fuzzy bool
+	// Language, Subject and Publisher keep only the publications with this
+	// facet value, as returned in Results.Facets
+	Language  string
+	Subject   string
+	Publisher string
+	// Page is the page of results starting at 1, ItemsPerPage is 20 when
+	// zero
+	Page         int
+	ItemsPerPage int
+}
+
+// Hit is a publication found with its score
+type Hit struct {
+	Publication opds2.Publication
+	Score       float64
+}
+
+// FacetCount is the number of publications found with a facet value
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// Results is a page of results
+type Results struct {
+	Query Query
+	// Total is the number of publications found on every page
+	Total int
+	Hits  []Hit
+	// Facets are the values of the facets "language", "subject" and
+	// "publisher" of the publications found, the most used first
+	Facets map[string][]FacetCount
+}
+
+// defaultItemsPerPage is the size of a page when the query does not set it
+const defaultItemsPerPage = 20
+
+// facet names in Results.Facets
+const (
+	FacetLanguage  = "language"
+	FacetSubject   = "subject"
+	FacetPublisher = "publisher"
+)
+
+// Search return the publications matching the query by decreasing score,
+// in the order they were added when the scores are equal
+func (idx *Index) Search(q Query) Results {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.ItemsPerPage < 1 {
+		q.ItemsPerPage = defaultItemsPerPage
+	}
+	results := Results{Query: q, Facets: make(map[string][]FacetCount)}
+
+	scores := idx.match(q)
+	var ids []int
+	for id := range scores {
+		d := idx.documents[id]
+		if d.Deleted || !hasValue(d.Languages, q.Language) || !hasValue(d.Subjects, q.Subject) || !hasValue(d.Publishers, q.Publisher) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	counts := map[string]map[string]int{FacetLanguage: {}, FacetSubject: {}, FacetPublisher: {}}
+	for _, id := range ids {
+		d := idx.documents[id]
+		countValues(counts[FacetLanguage], d.Languages)
+		countValues(counts[FacetSubject], d.Subjects)
+		countValues(counts[FacetPublisher], d.Publishers)
+	}
+	for name, values := range counts {
+		results.Facets[name] = sortCounts(values)
+	}
+
+	results.Total = len(ids)
+	start := (q.Page - 1) * q.ItemsPerPage
+	for i := start; i < len(ids) && i < start+q.ItemsPerPage; i++ {
+		results.Hits = append(results.Hits, Hit{Publication: idx.documents[ids[i]].Publication, Score: scores[ids[i]]})
+	}
+
+	return results
+}
+
+// match return the score of the documents matching every word of the
+// query, every document when there is no word
+func (idx *Index) match(q Query) map[int]float64 {
+
+	words := tokenize(q.Text)
+	if len(words) == 0 {
+		scores := make(map[int]float64)
+		for id := range idx.documents {
+			scores[id] = 0
+		}
+		return scores
+	}
+
+	var scores map[int]float64
+	for i, w := range words {
+		wordScores := make(map[int]float64)
+		for term, weight := range idx.expand(w, q.Prefix || i == len(words)-1, q.Fuzzy) {
+			postings := idx.postings[term]
+			// rare terms are worth more
+			idf := math.Log(1 + float64(len(idx.keys))/float64(len(postings)))
+			for _, p := range postings {
+				wordScores[p.Document] += weight * idf * fieldWeights[p.Field] * (1 + math.Log(float64(p.Count)))
+			}
+		}
+
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := wordScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	return scores
+}
+
+// expand return the terms of the index matching a word with their weight,
+// an exact match is worth more than a prefix or a typo
+func (idx *Index) expand(word string, prefix bool, fuzzy bool) map[string]float64 {
+	terms := make(map[string]float64)
+
+	if _, ok := idx.postings[word]; ok {
+		terms[word] = 1
+	}
+
+	if prefix {
+		sorted := idx.sortedTerms()
+		for i := sort.SearchStrings(sorted, word); i < len(sorted) && strings.HasPrefix(sorted[i], word); i++ {
+			if _, ok := terms[sorted[i]]; !ok {
+				terms[sorted[i]] = 0.7
+			}
+		}
+	}
+
+	if fuzzy {
+		maxDistance := 1
+		if len([]rune(word)) >= 8 {
+			maxDistance = 2
+		}
+		// short words have too many neighbours
+		if len([]rune(word)) >= 4 {
+			for term := range idx.postings {
+				if _, ok := terms[term]; ok {
+					continue
+				}
+				if d := distance(word, term, maxDistance); d <= maxDistance {
+					terms[term] = 0.5 / float64(d)
+				}
+			}
+		}
+	}
+
+	return terms
+}
+
+// distance return the Levenshtein distance between a and b, or max+1 when
+// it is more than max
+func distance(a string, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func hasValue(values []string, value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func countValues(counts map[string]int, values []string) {
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			counts[v]++
+		}
+	}
+}
+
+func sortCounts(counts map[string]int) []FacetCount {
+	var facets []FacetCount
+	for v, c := range counts {
+		facets = append(facets, FacetCount{Value: v, Count: c})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return facets
+}
+
+// FeedOptions change the feed built from results
+type FeedOptions struct {
+	Title string
+	// PageURL return the url of a page of the results, there is no
+	// pagination link when it is nil
+	PageURL func(page int) string
+	// FacetURL return the url of the results with a facet value selected,
+	// there is no facet when it is nil
+	FacetURL func(facet string, value string) string
+}
+
+// Feed return the page of results as an OPDS 2.0 feed with pagination
+// links and facets
+func (r Results) Feed(opts FeedOptions) opds2.Feed {
+	feed := opds2.New(opts.Title)
+
+	for _, h := range r.Hits {
+		feed.Publications = append(feed.Publications, h.Publication)
+	}
+
+	var next, previous, first, last string
+	if opts.PageURL != nil {
+		lastPage := (r.Total + r.Query.ItemsPerPage - 1) / r.Query.ItemsPerPage
+		if lastPage < 1 {
+			lastPage = 1
+		}
+		feed.AddLink(opts.PageURL(r.Query.Page), "self", "application/opds+json", false)
+		if r.Query.Page < lastPage {
+			next = opts.PageURL(r.Query.Page + 1)
+		}
+		if r.Query.Page > 1 {
+			previous = opts.PageURL(r.Query.Page - 1)
+		}
+		first, last = opts.PageURL(1), opts.PageURL(lastPage)
+	}
+	feed.AddPagination(r.Total, r.Query.ItemsPerPage, r.Query.Page, next, previous, first, last)
+
+	if opts.FacetURL != nil {
+		selected := map[string]string{FacetLanguage: r.Query.Language, FacetSubject: r.Query.Subject, FacetPublisher: r.Query.Publisher}
+		for _, name := range []string{FacetLanguage, FacetSubject, FacetPublisher} {
+			for _, c := range r.Facets[name] {
+				l := opds2.Link{Href: opts.FacetURL(name, c.Value), Title: c.Value, TypeLink: "application/opds+json",
+					Properties: &opds2.Properties{NumberOfItems: c.Count}}
+				if selected[name] == c.Value {
+					l.Rel = []string{"self"}
+				}
+				feed.AddFacet(l, name)
+			}
+		}
+	}
+
+	return feed
+}
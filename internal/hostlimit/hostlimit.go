@@ -0,0 +1,63 @@
+// Package hostlimit limit the number of parallel requests sent to the same
+// host by the packages fetching many documents
+package hostlimit
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// Limiter hold a semaphore by host, it is safe for concurrent use
+type Limiter struct {
+	perHost int
+	mutex   sync.Mutex
+	hosts   map[string]chan struct{}
+}
+
+// New create a limiter allowing perHost parallel requests to each host, no
+// limit when perHost is zero
+func New(perHost int) *Limiter {
+	return &Limiter{perHost: perHost, hosts: make(map[string]chan struct{})}
+}
+
+// Acquire wait until a request can be sent to the host of rawURL and
+// return the function to call once it is done, ctx.Err() is returned when
+// the context is done first
+func (l *Limiter) Acquire(ctx context.Context, rawURL string) (func(), error) {
+
+	sem := l.semaphore(rawURL)
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// semaphore return the channel limiting the requests to the host of
+// rawURL, nil when there is no limit
+func (l *Limiter) semaphore(rawURL string) chan struct{} {
+
+	if l.perHost < 1 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sem, ok := l.hosts[u.Host]
+	if !ok {
+		sem = make(chan struct{}, l.perHost)
+		l.hosts[u.Host] = sem
+	}
+
+	return sem
+}
@@ -0,0 +1,136 @@
+// Package pager follow the next links of a paginated feed, it hold the
+// logic shared by the pagers of opds1 and opds2 that only differ by the
+// feeds they read
+package pager
+
+import (
+	"context"
+	"net/url"
+)
+
+// Page is what the pager need to know of a page of a feed
+type Page struct {
+	// Items is the number of items of the page
+	Items int
+	// Next is the href of the next link, empty on the last page
+	Next string
+}
+
+// FetchFunc get the page at url
+type FetchFunc func(ctx context.Context, url string) (Page, error)
+
+// Pager iterate over the items of the pages, the caller keep the feeds
+// and read the item at Index
+type Pager struct {
+	ctx     context.Context
+	fetch   FetchFunc
+	errLoop error
+	items   int
+	pageURL string
+	nextURL string
+	index   int
+	pages   int
+	seen    map[string]bool
+	err     error
+}
+
+// New create a pager without page, errLoop is the error returned when a
+// next link lead to a page already read
+func New(ctx context.Context, fetch FetchFunc, errLoop error) *Pager {
+	return &Pager{ctx: ctx, fetch: fetch, errLoop: errLoop, index: -1, seen: make(map[string]bool)}
+}
+
+// SetPage make page the current page, pageURL is used to resolve its next
+// link
+func (p *Pager) SetPage(page Page, pageURL string) {
+
+	p.items = page.Items
+	p.pageURL = pageURL
+	p.pages++
+	if pageURL != "" {
+		p.seen[pageURL] = true
+	}
+	// index is -1 until the first call to Next
+	p.index = -1
+
+	p.nextURL = page.Next
+	if p.nextURL != "" && pageURL != "" {
+		base, errBase := url.Parse(pageURL)
+		if errBase == nil {
+			next, errNext := url.Parse(p.nextURL)
+			if errNext == nil {
+				p.nextURL = base.ResolveReference(next).String()
+			}
+		}
+	}
+}
+
+// Resume make cursor the next page to fetch
+func (p *Pager) Resume(cursor string) {
+	p.nextURL = cursor
+}
+
+// Next advance to the next item fetching the next page when needed, it
+// return false at the end of the pagination, after maxPages pages when it
+// is not zero, or on error
+func (p *Pager) Next(maxPages int) bool {
+
+	if p.err != nil {
+		return false
+	}
+
+	if p.index+1 < p.items {
+		p.index++
+		return true
+	}
+
+	// skip empty pages until an item is found
+	for {
+		if p.nextURL == "" || (maxPages > 0 && p.pages >= maxPages) {
+			return false
+		}
+		if p.seen[p.nextURL] {
+			p.err = p.errLoop
+			return false
+		}
+		if err := p.ctx.Err(); err != nil {
+			p.err = err
+			return false
+		}
+
+		page, err := p.fetch(p.ctx, p.nextURL)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		p.SetPage(page, p.nextURL)
+		if p.items > 0 {
+			p.index = 0
+			return true
+		}
+	}
+}
+
+// Index return the index of the current item in its page, -1 before the
+// first call to Next
+func (p *Pager) Index() int {
+	return p.index
+}
+
+// Cursor return the url of the page of the current item
+func (p *Pager) Cursor() string {
+	if p.pageURL == "" {
+		return p.nextURL
+	}
+	return p.pageURL
+}
+
+// NextURL return the url of the page after the current one
+func (p *Pager) NextURL() string {
+	return p.nextURL
+}
+
+// Err return the error that stopped the pager
+func (p *Pager) Err() error {
+	return p.err
+}
@@ -0,0 +1,129 @@
+package linkcheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds1"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Link is an href found in a feed
+type Link struct {
+	Href string
+	// Type is the media type declared by the link, compared with the
+	// Content-Type served
+	Type string
+	Rel  []string
+	// Location describe where the link was found, like "feed",
+	// "navigation" or the title of a publication
+	Location string
+	// Image is set for the images of publications
+	Image bool
+	// Templated links are not checked
+	Templated bool
+}
+
+func (l Link) String() string {
+	s := l.Href
+	if l.Image {
+		s += " (image)"
+	} else if len(l.Rel) > 0 {
+		s += " (" + strings.Join(l.Rel, " ") + ")"
+	}
+	if l.Location != "" {
+		s += " in " + l.Location
+	}
+	return s
+}
+
+// CollectOPDS2 return every link of the feed, its navigation, facets,
+// groups and publications with the links of contributors and series
+func CollectOPDS2(feed *opds2.Feed) []Link {
+	var links []Link
+
+	add := func(location string, image bool) func(l *opds2.Link) error {
+		return func(l *opds2.Link) error {
+			links = append(links, Link{Href: l.Href, Type: l.TypeLink, Rel: l.Rel, Location: location, Image: image, Templated: l.Templated})
+			return nil
+		}
+	}
+	addSlice := func(list []opds2.Link, location string) {
+		for i := range list {
+			walkChildren(&list[i], add(location, false))
+		}
+	}
+	addPublications := func(publications []opds2.Publication, location string) {
+		for i := range publications {
+			p := &publications[i]
+			title := location + "publication " + fmt.Sprintf("%q", p.Metadata.Title.String())
+			images := make(map[*opds2.Link]bool)
+			for j := range p.Images {
+				images[&p.Images[j]] = true
+			}
+			p.WalkLinks(func(l *opds2.Link) error {
+				return add(title, images[l])(l)
+			})
+		}
+	}
+
+	addSlice(feed.Links, "feed")
+	addSlice(feed.Navigation, "navigation")
+	for _, f := range feed.Facets {
+		addSlice(f.Links, fmt.Sprintf("facet %q", f.Metadata.Title))
+	}
+	for _, g := range feed.Groups {
+		location := fmt.Sprintf("group %q", g.Metadata.Title)
+		addSlice(g.Links, location)
+		addSlice(g.Navigation, location)
+		addPublications(g.Publications, location+" ")
+	}
+	addPublications(feed.Publications, "")
+
+	return links
+}
+
+func walkChildren(l *opds2.Link, fn func(l *opds2.Link) error) {
+	fn(l)
+	for i := range l.Children {
+		walkChildren(&l.Children[i], fn)
+	}
+}
+
+// CollectOPDS1 return every link of the feed and its entries with the uri
+// of authors and series
+func CollectOPDS1(feed *opds1.Feed) []Link {
+	var links []Link
+
+	addLink := func(l opds1.Link, location string) {
+		image := l.Rel == "http://opds-spec.org/image" || l.Rel == "http://opds-spec.org/image/thumbnail"
+		var rel []string
+		if l.Rel != "" {
+			rel = []string{l.Rel}
+		}
+		links = append(links, Link{Href: l.Href, Type: l.TypeLink, Rel: rel, Location: location, Image: image,
+			Templated: strings.Contains(l.Href, "{")})
+	}
+
+	for _, l := range feed.Links {
+		addLink(l, "feed")
+	}
+	for _, e := range feed.Entries {
+		location := fmt.Sprintf("entry %q", e.Title)
+		for _, l := range e.Links {
+			addLink(l, location)
+		}
+		for _, a := range e.Author {
+			if a.URI != "" {
+				links = append(links, Link{Href: a.URI, Rel: []string{"author"}, Location: location})
+			}
+		}
+		for _, s := range e.Series {
+			if s.URL != "" {
+				links = append(links, Link{Href: s.URL, Rel: []string{"series"}, Location: location})
+			}
+		}
+	}
+
+	return links
+}
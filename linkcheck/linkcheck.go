@@ -0,0 +1,324 @@
+// Package linkcheck check the links of OPDS 1.x and OPDS 2.0 feeds, every
+// href is requested and the broken links, the redirections and the media
+// types different from the one declared by the link are reported
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/opds-community/libopds2-go/internal/hostlimit"
+)
+
+// Options change the way links are checked
+type Options struct {
+	// Client is used for the requests, http.DefaultClient when nil, its
+	// redirection policy is replaced to record the redirections
+	Client *http.Client
+	// Header is sent with every request
+	Header http.Header
+	// Workers is the number of links checked in parallel, 8 when zero
+	Workers int
+	// PerHost is the maximum number of parallel requests to the same
+	// host, no limit when zero
+	PerHost int
+	// Progress is called after each link is checked, calls are never
+	// concurrent
+	Progress func(r Result)
+}
+
+// Result is the outcome of the check of a link
+type Result struct {
+	Link
+	// StatusCode is the status of the last response, zero when the
+	// request failed
+	StatusCode  int
+	ContentType string
+	// Redirects are the urls the link was redirected to, the last one is
+	// the url of the response
+	Redirects []string
+	// Err is set when the request could not be sent
+	Err error
+	// Skipped is set for links that are not checked, templated links or
+	// urls that are not http, with the reason in Err
+	Skipped bool
+}
+
+// Broken check if the link lead to an error
+func (r Result) Broken() bool {
+	return !r.Skipped && (r.Err != nil || r.StatusCode < 200 || r.StatusCode > 299)
+}
+
+// Redirected check if the link is redirected to another url
+func (r Result) Redirected() bool {
+	return len(r.Redirects) > 0
+}
+
+// TypeMismatch check if the media type served is different from the one
+// declared by the link, parameters like profile are ignored
+func (r Result) TypeMismatch() bool {
+	if r.Broken() || r.Skipped || r.Type == "" || r.ContentType == "" {
+		return false
+	}
+	return !sameMediaType(r.Type, r.ContentType)
+}
+
+// OK check if the link has no problem
+func (r Result) OK() bool {
+	return !r.Broken() && !r.Redirected() && !r.TypeMismatch()
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Skipped:
+		return fmt.Sprintf("skipped %s: %s", r.Link, r.Err)
+	case r.Err != nil:
+		return fmt.Sprintf("broken %s: %s", r.Link, r.Err)
+	case r.Broken():
+		return fmt.Sprintf("broken %s: %d %s", r.Link, r.StatusCode, http.StatusText(r.StatusCode))
+	}
+
+	var problems []string
+	if r.Redirected() {
+		problems = append(problems, "redirected to "+r.Redirects[len(r.Redirects)-1])
+	}
+	if r.TypeMismatch() {
+		problems = append(problems, fmt.Sprintf("type %s served as %s", r.Type, r.ContentType))
+	}
+	if len(problems) == 0 {
+		return "ok " + r.Link.String()
+	}
+
+	return "warning " + r.Link.String() + ": " + strings.Join(problems, ", ")
+}
+
+// Check request every link and return the results in the order of the
+// links, an href used by several links is requested once
+func Check(ctx context.Context, links []Link, opts Options) []Result {
+
+	results := make([]Result, len(links))
+	checked := make([]bool, len(links))
+	c := &checker{opts: opts, hosts: hostlimit.New(opts.PerHost), responses: make(map[string]*response)}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 8
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.check(ctx, links[i])
+				checked[i] = true
+				c.progress(results[i])
+			}
+		}()
+	}
+
+	for i := range links {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// links not sent to a worker after a cancellation
+	for i := range results {
+		if !checked[i] {
+			results[i] = Result{Link: links[i], Err: ctx.Err()}
+		}
+	}
+
+	return results
+}
+
+type checker struct {
+	opts      Options
+	mutex     sync.Mutex
+	hosts     *hostlimit.Limiter
+	responses map[string]*response
+}
+
+// response is shared by the links with the same href, done is closed when
+// the request is finished
+type response struct {
+	done        chan struct{}
+	statusCode  int
+	contentType string
+	redirects   []string
+	err         error
+}
+
+func (c *checker) progress(r Result) {
+	if c.opts.Progress == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.opts.Progress(r)
+}
+
+func (c *checker) check(ctx context.Context, l Link) Result {
+	r := Result{Link: l}
+
+	if l.Href == "" {
+		r.Err = fmt.Errorf("empty href")
+		return r
+	}
+	if l.Templated {
+		r.Skipped, r.Err = true, fmt.Errorf("templated link")
+		return r
+	}
+	u, err := url.Parse(l.Href)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		r.Skipped = true
+		if u.Scheme == "" {
+			r.Err = fmt.Errorf("relative link without base url")
+		} else {
+			r.Err = fmt.Errorf("%s links are not checked", u.Scheme)
+		}
+		return r
+	}
+
+	// the fragment is not sent so links to parts of a document share the
+	// request of the document
+	u.Fragment = ""
+	key := u.String()
+
+	c.mutex.Lock()
+	res, ok := c.responses[key]
+	if !ok {
+		res = &response{done: make(chan struct{})}
+		c.responses[key] = res
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		select {
+		case <-res.done:
+		case <-ctx.Done():
+			r.Err = ctx.Err()
+			return r
+		}
+	} else {
+		c.request(ctx, key, res)
+		close(res.done)
+	}
+
+	r.StatusCode, r.ContentType, r.Redirects, r.Err = res.statusCode, res.contentType, res.redirects, res.err
+	return r
+}
+
+// request send a HEAD request, or a GET when the server does not accept
+// HEAD, and fill res
+func (c *checker) request(ctx context.Context, href string, res *response) {
+
+	release, err := c.hosts.Acquire(ctx, href)
+	if err != nil {
+		res.err = err
+		return
+	}
+	defer release()
+
+	res.statusCode, res.contentType, res.redirects, res.err = c.do(ctx, "HEAD", href)
+	switch res.statusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusForbidden, http.StatusNotFound:
+		// some servers only answer to GET, a GET confirm the error
+		res.statusCode, res.contentType, res.redirects, res.err = c.do(ctx, "GET", href)
+	}
+}
+
+func (c *checker) do(ctx context.Context, method string, href string) (int, string, []string, error) {
+	var redirects []string
+
+	request, err := http.NewRequestWithContext(ctx, method, href, nil)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	for k, v := range c.opts.Header {
+		request.Header[k] = v
+	}
+
+	client := http.Client{}
+	if c.opts.Client != nil {
+		client = *c.opts.Client
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		redirects = append(redirects, req.URL.String())
+		return nil
+	}
+
+	res, err := client.Do(request)
+	if err != nil {
+		return 0, "", redirects, err
+	}
+	defer res.Body.Close()
+	if method == "GET" {
+		// the body is not needed, a small part is read so the connection
+		// can be reused for small documents
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	}
+
+	return res.StatusCode, res.Header.Get("Content-Type"), redirects, nil
+}
+
+// mediaTypeAliases are names used for the same media type
+var mediaTypeAliases = map[string]string{
+	"image/jpg":         "image/jpeg",
+	"image/pjpeg":       "image/jpeg",
+	"text/xml":          "application/xml",
+	"application/x-pdf": "application/pdf",
+}
+
+// sameMediaType compare two media types without their parameters, an xml
+// document served as application/xml match any xml type
+func sameMediaType(declared string, served string) bool {
+
+	a := normalizeMediaType(declared)
+	b := normalizeMediaType(served)
+	if a == b {
+		return true
+	}
+	if b == "application/xml" && strings.HasSuffix(a, "+xml") {
+		return true
+	}
+	if b == "application/json" && strings.HasSuffix(a, "+json") {
+		return true
+	}
+
+	return false
+}
+
+func normalizeMediaType(t string) string {
+	mediaType, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(t, ";", 2)[0]))
+	}
+	if alias, ok := mediaTypeAliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
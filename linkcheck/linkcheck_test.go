@@ -0,0 +1,171 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// testServer serve the links checked by the tests and count the requests
+// by method and path
+type testServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests map[string]int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.requests[r.Method+" "+r.URL.Path]++
+		s.mutex.Unlock()
+		if r.Header.Get("X-Test") != "linkcheck" {
+			t.Errorf("%s %s: header %v", r.Method, r.URL, r.Header)
+		}
+
+		switch r.URL.Path {
+		case "/book.epub":
+			w.Header().Set("Content-Type", "application/epub+zip")
+		case "/get-only.jpg":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("\xff\xd8\xff"))
+		case "/cover.jpg":
+			w.Header().Set("Content-Type", "image/png")
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		case "/moved":
+			http.Redirect(w, r, "/moved-again", http.StatusMovedPermanently)
+		case "/moved-again":
+			http.Redirect(w, r, "/book.epub", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCheck(t *testing.T) {
+	server := newTestServer(t)
+	url := server.URL
+
+	links := []Link{
+		{Href: url + "/book.epub", Type: "application/epub+zip"},
+		{Href: url + "/get-only.jpg", Type: "image/jpg", Image: true},
+		{Href: url + "/missing"},
+		{Href: url + "/moved", Type: "application/epub+zip"},
+		{Href: url + "/cover.jpg", Type: "image/jpeg", Image: true},
+		{Href: url + "/feed.xml", Type: "application/atom+xml;profile=opds-catalog;kind=acquisition"},
+		{Href: url + "/book.epub#chapter-2", Type: "application/epub+zip"},
+		{Href: url + "/search{?query}", Templated: true},
+		{Href: "mailto:books@example.com"},
+		{Href: "relative.epub"},
+		{Href: ""},
+	}
+	tests := []struct {
+		status     int
+		redirects  []string
+		broken     bool
+		mismatch   bool
+		skipped    bool
+		requestErr bool
+	}{
+		{status: 200},
+		{status: 200},
+		{status: 404, broken: true},
+		{status: 200, redirects: []string{url + "/moved-again", url + "/book.epub"}},
+		{status: 200, mismatch: true},
+		{status: 200},
+		{status: 200},
+		{skipped: true, requestErr: true},
+		{skipped: true, requestErr: true},
+		{skipped: true, requestErr: true},
+		{broken: true, requestErr: true},
+	}
+
+	var progress int
+	results := Check(context.Background(), links, Options{
+		Header:   http.Header{"X-Test": {"linkcheck"}},
+		Workers:  4,
+		PerHost:  2,
+		Progress: func(r Result) { progress++ },
+	})
+	if len(results) != len(links) || progress != len(links) {
+		t.Fatalf("%d results, %d progress calls", len(results), progress)
+	}
+
+	for i, test := range tests {
+		r := results[i]
+		if r.Link.Href != links[i].Href {
+			t.Errorf("%d: result of %s", i, r.Link.Href)
+		}
+		if r.StatusCode != test.status || !reflect.DeepEqual(r.Redirects, test.redirects) || r.Broken() != test.broken ||
+			r.TypeMismatch() != test.mismatch || r.Skipped != test.skipped || (r.Err != nil) != test.requestErr {
+			t.Errorf("%s", r)
+		}
+		if r.OK() != (!test.broken && !test.mismatch && test.redirects == nil) {
+			t.Errorf("%s: ok %v", r, r.OK())
+		}
+	}
+
+	// a GET confirm the errors, the book is requested once for its two
+	// links and once more at the end of the redirections
+	want := map[string]int{
+		"HEAD /book.epub":    2,
+		"HEAD /get-only.jpg": 1,
+		"GET /get-only.jpg":  1,
+		"HEAD /missing":      1,
+		"GET /missing":       1,
+		"HEAD /moved":        1,
+		"HEAD /moved-again":  1,
+		"HEAD /cover.jpg":    1,
+		"HEAD /feed.xml":     1,
+	}
+	if !reflect.DeepEqual(server.requests, want) {
+		t.Errorf("requests %v, want %v", server.requests, want)
+	}
+}
+
+func TestCheckCanceled(t *testing.T) {
+	server := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := Check(ctx, []Link{{Href: server.URL + "/book.epub"}, {Href: server.URL + "/cover.jpg"}}, Options{Workers: 1})
+	for _, r := range results {
+		if r.Err == nil || !r.Broken() {
+			t.Errorf("%s", r)
+		}
+	}
+}
+
+func TestSameMediaType(t *testing.T) {
+	tests := []struct {
+		declared string
+		served   string
+		same     bool
+	}{
+		{"application/epub+zip", "application/epub+zip", true},
+		{"application/atom+xml;profile=opds-catalog", "application/atom+xml; charset=utf-8", true},
+		{"application/atom+xml;profile=opds-catalog", "text/xml", true},
+		{"application/opds+json", "application/json", true},
+		{"image/JPG", "image/jpeg", true},
+		{"application/pdf", "application/x-pdf", true},
+		{"application/epub+zip", "application/zip", false},
+		{"application/json", "application/opds+json", false},
+		{"image/jpeg", "image/png", false},
+	}
+	for _, test := range tests {
+		if got := sameMediaType(test.declared, test.served); got != test.same {
+			t.Errorf("%s served as %s: %v", test.declared, test.served, got)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package lint check the quality of OPDS 2.0 feeds, a valid feed can still
+// miss covers, languages or sort keys that clients need to present the
+// catalog, each check is a rule that can be configured or disabled and
+// custom rules can be registered next to the builtin ones
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/opds-community/libopds2-go/opds2"
+	"github.com/opds-community/libopds2-go/validate"
+)
+
+// Rule is a check run on a feed
+type Rule struct {
+	// Name identify the rule in the configuration and the violations
+	Name string
+	// Description explain what the rule check
+	Description string
+	// Severity is the severity of the violations unless configured
+	Severity validate.Severity
+	// Check report the problems found in the feed through the context
+	Check func(c *Context)
+}
+
+// Config change the rules run by a linter
+type Config struct {
+	// Rules set the severity of rules by name, "error", "warning", "info"
+	// or "off" to disable the rule, the other rules keep their severity
+	Rules map[string]string
+	// MinCoverWidth and MinCoverHeight are the smallest size of a cover
+	// accepted by the cover-size rule, 300x400 when zero
+	MinCoverWidth  int
+	MinCoverHeight int
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []Rule
+)
+
+// Register add a rule to the ones run by every linter created after, it
+// fail when a rule with the same name exists
+func Register(r Rule) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if r.Name == "" || r.Check == nil {
+		return fmt.Errorf("lint: rule without name or check")
+	}
+	for _, existing := range registry {
+		if existing.Name == r.Name {
+			return fmt.Errorf("lint: rule %q already registered", r.Name)
+		}
+	}
+	registry = append(registry, r)
+
+	return nil
+}
+
+// Rules return the registered rules sorted by name
+func Rules() []Rule {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	rules := append([]Rule(nil), registry...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+
+	return rules
+}
+
+// Linter run the enabled rules on feeds
+type Linter struct {
+	config Config
+	rules  []Rule
+}
+
+// New create a linter running the registered rules with the config, it
+// fail when the config name an unknown rule or severity
+func New(config Config) (*Linter, error) {
+	l := &Linter{config: config}
+
+	if l.config.MinCoverWidth <= 0 {
+		l.config.MinCoverWidth = 300
+	}
+	if l.config.MinCoverHeight <= 0 {
+		l.config.MinCoverHeight = 400
+	}
+
+	rules := Rules()
+	known := make(map[string]bool)
+	for _, r := range rules {
+		known[r.Name] = true
+	}
+	for name := range config.Rules {
+		if !known[name] {
+			return nil, fmt.Errorf("lint: unknown rule %q", name)
+		}
+	}
+
+	for _, r := range rules {
+		enabled, err := l.configure(&r)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			l.rules = append(l.rules, r)
+		}
+	}
+
+	return l, nil
+}
+
+// AddRule add a rule to this linter only, the configuration apply to it
+// as to the registered rules
+func (l *Linter) AddRule(r Rule) error {
+
+	if r.Name == "" || r.Check == nil {
+		return fmt.Errorf("lint: rule without name or check")
+	}
+	for _, existing := range l.rules {
+		if existing.Name == r.Name {
+			return fmt.Errorf("lint: rule %q already used", r.Name)
+		}
+	}
+	enabled, err := l.configure(&r)
+	if err != nil || !enabled {
+		return err
+	}
+	l.rules = append(l.rules, r)
+
+	return nil
+}
+
+// configure apply the severity of the config to the rule and return false
+// when it is disabled
+func (l *Linter) configure(r *Rule) (bool, error) {
+
+	setting, ok := l.config.Rules[r.Name]
+	if !ok {
+		return true, nil
+	}
+	if setting == "off" {
+		return false, nil
+	}
+
+	var severity validate.Severity
+	if err := severity.UnmarshalText([]byte(setting)); err != nil {
+		return false, fmt.Errorf("lint: rule %q: unknown severity %q", r.Name, setting)
+	}
+	r.Severity = severity
+
+	return true, nil
+}
+
+// Lint run the rules on the feed, the violations are sorted by pointer
+func (l *Linter) Lint(feed *opds2.Feed) []validate.Violation {
+	var violations []validate.Violation
+
+	for _, r := range l.rules {
+		c := &Context{Feed: feed, Config: l.config, rule: r, violations: &violations}
+		r.Check(c)
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Pointer < violations[j].Pointer
+	})
+
+	return violations
+}
+
+// Lint run the registered rules with the default configuration
+func Lint(feed *opds2.Feed) []validate.Violation {
+	l, _ := New(Config{})
+	return l.Lint(feed)
+}
+
+// Context is given to the check of a rule to read the feed and report
+// violations
+type Context struct {
+	Feed   *opds2.Feed
+	Config Config
+
+	rule       Rule
+	violations *[]validate.Violation
+}
+
+// Report add a violation of the rule at the JSON pointer of the feed
+func (c *Context) Report(pointer string, format string, args ...interface{}) {
+	*c.violations = append(*c.violations, validate.Violation{
+		Pointer:  pointer,
+		Severity: c.rule.Severity,
+		Rule:     c.rule.Name,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// PublicationRef is a publication of the feed with its JSON pointer
+type PublicationRef struct {
+	Pointer     string
+	Publication *opds2.Publication
+}
+
+// Publications return the publications of the feed and of its groups
+func (c *Context) Publications() []PublicationRef {
+	var refs []PublicationRef
+
+	for i := range c.Feed.Publications {
+		refs = append(refs, PublicationRef{"/publications/" + strconv.Itoa(i), &c.Feed.Publications[i]})
+	}
+	for g := range c.Feed.Groups {
+		group := &c.Feed.Groups[g]
+		for i := range group.Publications {
+			refs = append(refs, PublicationRef{fmt.Sprintf("/groups/%d/publications/%d", g, i), &group.Publications[i]})
+		}
+	}
+
+	return refs
+}
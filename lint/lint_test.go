@@ -0,0 +1,255 @@
+package lint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opds-community/libopds2-go/opds2"
+	"github.com/opds-community/libopds2-go/validate"
+)
+
+// publication return a publication that pass every builtin rule
+func publication(identifier string) opds2.Publication {
+	var p opds2.Publication
+	p.Metadata.Identifier = identifier
+	p.Metadata.Title.SingleString = "Moby Dick"
+	p.Metadata.Language = []string{"en"}
+	p.Metadata.Description = "Call me Ishmael."
+	p.Metadata.Author = []opds2.Contributor{{Name: opds2.MultiLanguage{SingleString: "Herman Melville"}, SortAs: "Melville, Herman"}}
+	p.AddLink("https://example.com/moby.epub", "application/epub+zip", "http://opds-spec.org/acquisition/buy", "")
+	p.Links[0].Properties = &opds2.Properties{Price: &opds2.Price{Currency: "USD", Value: 4.99}}
+	p.AddImage("https://example.com/moby.jpg", "image/jpeg", 900, 600)
+	return p
+}
+
+// feed return a feed of publications that pass every builtin rule, change
+// is applied to it before it is returned
+func feed(change func(f *opds2.Feed)) *opds2.Feed {
+	f := opds2.New("New releases")
+	f.AddLink("https://example.com/new.json", "self", "application/opds+json", false)
+	f.Publications = []opds2.Publication{publication("urn:isbn:9780000000001"), publication("urn:isbn:9780000000002")}
+	f.Groups = []opds2.Group{{
+		Metadata:     opds2.Metadata{Title: "Classics"},
+		Publications: []opds2.Publication{publication("urn:isbn:9780000000003")},
+	}}
+	if change != nil {
+		change(&f)
+	}
+	return &f
+}
+
+// only return a config disabling every rule but the one named
+func only(name string) Config {
+	config := Config{Rules: make(map[string]string)}
+	for _, r := range Rules() {
+		if r.Name != name {
+			config.Rules[r.Name] = "off"
+		}
+	}
+	return config
+}
+
+// pointers return the pointers of the violations of the rule
+func pointers(t *testing.T, name string, violations []validate.Violation) []string {
+	var ps []string
+	for _, v := range violations {
+		if v.Rule != name {
+			t.Errorf("%s: violation of rule %q", name, v.Rule)
+		}
+		ps = append(ps, v.Pointer)
+	}
+	return ps
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		name     string
+		change   func(f *opds2.Feed)
+		pointers []string
+	}{
+		{"cover-missing", "no images", func(f *opds2.Feed) {
+			f.Publications[1].Images = nil
+			f.Groups[0].Publications[0].Images = []opds2.Link{}
+		}, []string{"/groups/0/publications/0/images", "/publications/1/images"}},
+
+		{"cover-size", "largest image too small", func(f *opds2.Feed) {
+			f.Publications[0].Images[0].Width = 200
+			f.Publications[0].AddImage("https://example.com/moby-small.jpg", "image/jpeg", 100, 50)
+		}, []string{"/publications/0/images/0"}},
+		{"cover-size", "a large image is enough", func(f *opds2.Feed) {
+			f.Publications[0].AddImage("https://example.com/moby-small.jpg", "image/jpeg", 100, 50)
+		}, nil},
+		{"cover-size", "images without size", func(f *opds2.Feed) {
+			f.Publications[0].Images[0].Height, f.Publications[0].Images[0].Width = 0, 0
+		}, nil},
+
+		{"description-html", "tags and entities", func(f *opds2.Feed) {
+			f.Publications[0].Metadata.Description = "Call me <i>Ishmael</i>."
+			f.Publications[1].Metadata.Description = "Ahab &amp; the whale"
+			f.Groups[0].Publications[0].Metadata.Description = "1 < 2 & 3 > 2"
+		}, []string{"/publications/0/metadata/description", "/publications/1/metadata/description"}},
+
+		{"duplicate-identifier", "in a group", func(f *opds2.Feed) {
+			f.Groups[0].Publications[0].Metadata.Identifier = "urn:isbn:9780000000001"
+			f.Publications[1].Metadata.Identifier = ""
+			f.Groups[0].Publications = append(f.Groups[0].Publications, publication(""))
+		}, []string{"/groups/0/publications/0/metadata/identifier"}},
+
+		{"identifier-uri", "missing and not a URI", func(f *opds2.Feed) {
+			f.Publications[0].Metadata.Identifier = ""
+			f.Publications[1].Metadata.Identifier = "9780000000002"
+			f.Groups[0].Publications[0].Metadata.Identifier = "https://example.com/moby"
+		}, []string{"/publications/0/metadata/identifier", "/publications/1/metadata/identifier"}},
+
+		{"language-missing", "no language", func(f *opds2.Feed) {
+			f.Groups[0].Publications[0].Metadata.Language = nil
+		}, []string{"/groups/0/publications/0/metadata"}},
+
+		{"author-sort-as", "second author", func(f *opds2.Feed) {
+			f.Publications[0].AddAuthor("Jean Giono", "", "", "", "")
+		}, []string{"/publications/0/metadata/author/1"}},
+
+		{"price-currency", "no currency", func(f *opds2.Feed) {
+			f.Publications[1].Links[0].Properties.Price.Currency = ""
+			f.Publications[1].AddLink("https://example.com/moby.pdf", "application/pdf", "http://opds-spec.org/acquisition/open-access", "")
+		}, []string{"/publications/1/links/0/properties/price"}},
+
+		{"dangling-next", "next to itself", func(f *opds2.Feed) {
+			f.AddLink("https://example.com/new.json", "next", "application/opds+json", false)
+		}, []string{"/links/1"}},
+		{"dangling-next", "empty page", func(f *opds2.Feed) {
+			f.Publications, f.Groups = nil, nil
+			f.AddLink("https://example.com/new.json?page=2", "next", "application/opds+json", false)
+		}, []string{"/links/1"}},
+		{"dangling-next", "last page", func(f *opds2.Feed) {
+			f.Metadata.NumberOfItems, f.Metadata.ItemsPerPage, f.Metadata.CurrentPage = 12, 2, 6
+			f.AddLink("https://example.com/new.json?page=7", "next", "application/opds+json", false)
+		}, []string{"/links/1"}},
+		{"dangling-next", "more pages", func(f *opds2.Feed) {
+			f.Metadata.NumberOfItems, f.Metadata.ItemsPerPage, f.Metadata.CurrentPage = 12, 2, 5
+			f.AddLink("https://example.com/new.json?page=6", "next", "application/opds+json", false)
+		}, nil},
+
+		{"number-of-items", "less than the page", func(f *opds2.Feed) {
+			f.Metadata.NumberOfItems, f.Metadata.ItemsPerPage = 1, 1
+			f.Groups[0].Metadata.NumberOfItems = 1
+			f.Groups[0].Navigation = []opds2.Link{{Href: "https://example.com/classics.json", Title: "More"}}
+		}, []string{"/groups/0/metadata/numberOfItems", "/metadata/itemsPerPage", "/metadata/numberOfItems"}},
+		{"number-of-items", "not paginated", func(f *opds2.Feed) {
+			f.Metadata.NumberOfItems = 3
+		}, []string{"/metadata/numberOfItems"}},
+		{"number-of-items", "paginated", func(f *opds2.Feed) {
+			f.Metadata.NumberOfItems = 30
+			f.AddLink("https://example.com/new.json?page=2", "next", "application/opds+json", false)
+		}, nil},
+	}
+
+	tested := make(map[string]bool)
+	for _, test := range tests {
+		tested[test.rule] = true
+
+		l, err := New(only(test.rule))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pointers(t, test.rule, l.Lint(feed(nil))); got != nil {
+			t.Errorf("%s: violations on a valid feed %q", test.rule, got)
+		}
+		if got := pointers(t, test.rule, l.Lint(feed(test.change))); !reflect.DeepEqual(got, test.pointers) {
+			t.Errorf("%s: %s: %q, want %q", test.rule, test.name, got, test.pointers)
+		}
+	}
+	for _, r := range Rules() {
+		if !tested[r.Name] && !strings.HasPrefix(r.Name, "test-") {
+			t.Errorf("rule %q is not tested", r.Name)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	f := feed(func(f *opds2.Feed) {
+		f.Publications[0].Images[0].Width, f.Publications[0].Images[0].Height = 200, 300
+		f.Publications[1].Metadata.Language = nil
+	})
+
+	if v := Lint(f); len(v) != 2 || v[0].Rule != "cover-size" || v[0].Severity != validate.Warning {
+		t.Errorf("default config: %+v", v)
+	}
+
+	l, err := New(Config{Rules: map[string]string{"cover-size": "error", "language-missing": "off"}, MinCoverWidth: 200, MinCoverHeight: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := l.Lint(f); len(v) != 0 {
+		t.Errorf("smaller covers accepted: %+v", v)
+	}
+
+	l, _ = New(Config{Rules: map[string]string{"cover-size": "error", "language-missing": "off"}})
+	if v := l.Lint(f); len(v) != 1 || v[0].Severity != validate.Error || v[0].Pointer != "/publications/0/images/0" {
+		t.Errorf("cover-size as an error: %+v", v)
+	}
+
+	for _, rules := range []map[string]string{{"unknown": "off"}, {"cover-size": "fatal"}} {
+		if _, err := New(Config{Rules: rules}); err == nil {
+			t.Errorf("%v: no error", rules)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	registered := Rules()
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		registry = registered
+		registryMutex.Unlock()
+	})
+
+	check := func(c *Context) {
+		for _, ref := range c.Publications() {
+			if ref.Publication.Metadata.Subject == nil {
+				c.Report(ref.Pointer+"/metadata", "no subject")
+			}
+		}
+	}
+
+	for _, r := range []Rule{{Name: "", Check: check}, {Name: "test-no-check"}, {Name: "cover-missing", Check: check}} {
+		if err := Register(r); err == nil {
+			t.Errorf("%q: no error", r.Name)
+		}
+	}
+
+	l, err := New(Config{Rules: map[string]string{"test-subject": "info"}})
+	if err == nil {
+		t.Error("rule configured before it is registered")
+	}
+	if err := Register(Rule{Name: "test-subject", Severity: validate.Warning, Check: check}); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = New(Config{Rules: map[string]string{"test-subject": "info"}}); err != nil {
+		t.Fatal(err)
+	}
+	v := l.Lint(feed(nil))
+	if len(v) != 3 || v[0].Rule != "test-subject" || v[0].Severity != validate.Info || v[0].Pointer != "/groups/0/publications/0/metadata" {
+		t.Errorf("registered rule: %+v", v)
+	}
+
+	// a rule added to a linter is not registered
+	config := only("cover-missing")
+	config.Rules["test-local"] = "off"
+	if _, err := New(config); err == nil {
+		t.Error("rule added to a linter is registered")
+	}
+	delete(config.Rules, "test-local")
+	l, _ = New(config)
+	if err := l.AddRule(Rule{Name: "cover-missing", Check: check}); err == nil {
+		t.Error("no error for a rule already used")
+	}
+	if err := l.AddRule(Rule{Name: "test-local", Severity: validate.Error, Check: check}); err != nil {
+		t.Fatal(err)
+	}
+	if v := l.Lint(feed(nil)); len(v) != 3 || v[0].Rule != "test-local" {
+		t.Errorf("added rule: %+v", v)
+	}
+}
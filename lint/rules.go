@@ -0,0 +1,199 @@
+package lint
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/opds-community/libopds2-go/opds2"
+	"github.com/opds-community/libopds2-go/validate"
+)
+
+func init() {
+	for _, r := range []Rule{
+		{"cover-missing", "publications should have a cover image", validate.Warning, checkCoverMissing},
+		{"cover-size", "covers should be large enough to be displayed", validate.Warning, checkCoverSize},
+		{"description-html", "descriptions should not contain raw html", validate.Warning, checkDescriptionHTML},
+		{"duplicate-identifier", "publications must have distinct identifiers", validate.Error, checkDuplicateIdentifier},
+		{"identifier-uri", "identifiers should be URIs", validate.Warning, checkIdentifierURI},
+		{"language-missing", "publications should have a language", validate.Warning, checkLanguageMissing},
+		{"author-sort-as", "authors should have a sort key", validate.Info, checkAuthorSortAs},
+		{"price-currency", "prices must have a currency", validate.Error, checkPriceCurrency},
+		{"dangling-next", "next links should lead to another page of results", validate.Warning, checkDanglingNext},
+		{"number-of-items", "numberOfItems should match the publications", validate.Warning, checkNumberOfItems},
+	} {
+		if err := Register(r); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func checkCoverMissing(c *Context) {
+	for _, ref := range c.Publications() {
+		if len(ref.Publication.Images) == 0 {
+			c.Report(ref.Pointer+"/images", "publication %q has no cover", ref.Publication.Metadata.Title.String())
+		}
+	}
+}
+
+// checkCoverSize check the largest image of a publication, images without
+// size are not reported
+func checkCoverSize(c *Context) {
+	for _, ref := range c.Publications() {
+		largest := -1
+		for i, image := range ref.Publication.Images {
+			if image.Width == 0 && image.Height == 0 {
+				continue
+			}
+			if largest < 0 || image.Width*image.Height > ref.Publication.Images[largest].Width*ref.Publication.Images[largest].Height {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			continue
+		}
+		image := ref.Publication.Images[largest]
+		if (image.Width > 0 && image.Width < c.Config.MinCoverWidth) || (image.Height > 0 && image.Height < c.Config.MinCoverHeight) {
+			c.Report(ref.Pointer+"/images/"+strconv.Itoa(largest), "cover of %dx%d smaller than %dx%d",
+				image.Width, image.Height, c.Config.MinCoverWidth, c.Config.MinCoverHeight)
+		}
+	}
+}
+
+var htmlTag = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9]*(\s[^<>]*)?/?>|&(#[0-9]+|#x[0-9a-fA-F]+|[a-zA-Z]+);`)
+
+func checkDescriptionHTML(c *Context) {
+	for _, ref := range c.Publications() {
+		if m := htmlTag.FindString(ref.Publication.Metadata.Description); m != "" {
+			c.Report(ref.Pointer+"/metadata/description", "description contains html %q", m)
+		}
+	}
+}
+
+func checkDuplicateIdentifier(c *Context) {
+	first := make(map[string]string)
+
+	for _, ref := range c.Publications() {
+		id := ref.Publication.Metadata.Identifier
+		if id == "" {
+			continue
+		}
+		if pointer, ok := first[id]; ok {
+			c.Report(ref.Pointer+"/metadata/identifier", "identifier %q already used by %s", id, pointer)
+			continue
+		}
+		first[id] = ref.Pointer
+	}
+}
+
+func checkIdentifierURI(c *Context) {
+	for _, ref := range c.Publications() {
+		id := ref.Publication.Metadata.Identifier
+		if id == "" {
+			c.Report(ref.Pointer+"/metadata/identifier", "publication %q has no identifier", ref.Publication.Metadata.Title.String())
+			continue
+		}
+		u, err := url.Parse(id)
+		if err != nil || u.Scheme == "" {
+			c.Report(ref.Pointer+"/metadata/identifier", "identifier %q is not an URI, use urn:isbn: or urn:uuid: for example", id)
+		}
+	}
+}
+
+func checkLanguageMissing(c *Context) {
+	for _, ref := range c.Publications() {
+		if len(ref.Publication.Metadata.Language) == 0 {
+			c.Report(ref.Pointer+"/metadata", "publication %q has no language", ref.Publication.Metadata.Title.String())
+		}
+	}
+}
+
+func checkAuthorSortAs(c *Context) {
+	for _, ref := range c.Publications() {
+		for i, a := range ref.Publication.Metadata.Author {
+			if a.SortAs == "" {
+				c.Report(ref.Pointer+"/metadata/author/"+strconv.Itoa(i), "author %q has no sort_as", a.Name.String())
+			}
+		}
+	}
+}
+
+func checkPriceCurrency(c *Context) {
+	for _, ref := range c.Publications() {
+		for i, l := range ref.Publication.Links {
+			if l.Properties != nil && l.Properties.Price != nil && l.Properties.Price.Currency == "" {
+				c.Report(ref.Pointer+"/links/"+strconv.Itoa(i)+"/properties/price", "price of %s has no currency", l.Href)
+			}
+		}
+	}
+}
+
+// checkDanglingNext report next links that can not lead to more results,
+// the next page itself is not fetched
+func checkDanglingNext(c *Context) {
+	feed := c.Feed
+
+	for i, l := range feed.Links {
+		if !l.HasRel("next") {
+			continue
+		}
+		pointer := "/links/" + strconv.Itoa(i)
+		m := feed.Metadata
+
+		switch {
+		case l.Href == "":
+			c.Report(pointer, "next link without href")
+		case l.Href == selfHref(feed):
+			c.Report(pointer, "next link to the page itself")
+		case len(feed.Publications) == 0 && len(feed.Navigation) == 0 && len(feed.Groups) == 0:
+			c.Report(pointer, "next link on an empty page")
+		case m.NumberOfItems > 0 && m.ItemsPerPage > 0 && m.CurrentPage > 0 && m.CurrentPage*m.ItemsPerPage >= m.NumberOfItems:
+			c.Report(pointer, "next link on the last page, page %d of %d items by %d", m.CurrentPage, m.NumberOfItems, m.ItemsPerPage)
+		}
+	}
+}
+
+// checkNumberOfItems compare numberOfItems with the publications of the
+// feed and its groups, on a paginated feed it is the total of all pages
+func checkNumberOfItems(c *Context) {
+	feed := c.Feed
+	m := feed.Metadata
+	n := len(feed.Publications)
+
+	paginated := m.ItemsPerPage > 0 || hasLink(feed.Links, "next") || hasLink(feed.Links, "previous")
+	switch {
+	case m.NumberOfItems > 0 && m.NumberOfItems < n:
+		c.Report("/metadata/numberOfItems", "numberOfItems is %d but the page has %d publications", m.NumberOfItems, n)
+	case m.NumberOfItems > 0 && !paginated && m.NumberOfItems != n:
+		c.Report("/metadata/numberOfItems", "numberOfItems is %d but the feed has %d publications and no pagination", m.NumberOfItems, n)
+	}
+	if m.ItemsPerPage > 0 && n > m.ItemsPerPage {
+		c.Report("/metadata/itemsPerPage", "itemsPerPage is %d but the page has %d publications", m.ItemsPerPage, n)
+	}
+
+	for i, g := range feed.Groups {
+		count := len(g.Publications) + len(g.Navigation)
+		if g.Metadata.NumberOfItems > 0 && g.Metadata.NumberOfItems < count {
+			c.Report("/groups/"+strconv.Itoa(i)+"/metadata/numberOfItems", "numberOfItems of group %q is %d but it has %d items",
+				g.Metadata.Title, g.Metadata.NumberOfItems, count)
+		}
+	}
+}
+
+func hasLink(links []opds2.Link, rel string) bool {
+	for _, l := range links {
+		if l.HasRel(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func selfHref(feed *opds2.Feed) string {
+	for _, l := range feed.Links {
+		if l.HasRel("self") {
+			return l.Href
+		}
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package opds1
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+)
+
+// Namespaces used when generating an OPDS 1.x feed
+const (
+	NamespaceAtom       = "http://www.w3.org/2005/Atom"
+	NamespaceDC         = "http://purl.org/dc/terms/"
+	NamespaceOPDS       = "http://opds-spec.org/2010/catalog"
+	NamespaceOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
+	NamespaceThread     = "http://purl.org/syndication/thread/1.0"
+	NamespaceSchema     = "http://schema.org/"
+)
+
+// the xml structures below mirror the feed with prefixed names, the
+// parsing structures are kept namespace agnostic to accept any feed
+
+type feedXML struct {
+	XMLName      xml.Name   `xml:"feed"`
+	XMLNS        string     `xml:"xmlns,attr"`
+	XMLNSDC      string     `xml:"xmlns:dc,attr"`
+	XMLNSOPDS    string     `xml:"xmlns:opds,attr"`
+	XMLNSSearch  string     `xml:"xmlns:opensearch,attr"`
+	XMLNSThread  string     `xml:"xmlns:thr,attr"`
+	XMLNSSchema  string     `xml:"xmlns:schema,attr"`
+	XMLBase      string     `xml:"xml:base,attr,omitempty"`
+	ID           string     `xml:"id"`
+	Title        string     `xml:"title"`
+	Updated      time.Time  `xml:"updated"`
+	TotalResults int        `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int        `xml:"opensearch:itemsPerPage,omitempty"`
+	Links        []linkXML  `xml:"link"`
+	Entries      []entryXML `xml:"entry"`
+}
+
+type linkXML struct {
+	Rel                 string                   `xml:"rel,attr,omitempty"`
+	Href                string                   `xml:"href,attr"`
+	TypeLink            string                   `xml:"type,attr,omitempty"`
+	Title               string                   `xml:"title,attr,omitempty"`
+	FacetGroup          string                   `xml:"opds:facetGroup,attr,omitempty"`
+	ActiveFacet         bool                     `xml:"opds:activeFacet,attr,omitempty"`
+	Count               int                      `xml:"thr:count,attr,omitempty"`
+	Price               *priceXML                `xml:"opds:price"`
+	IndirectAcquisition []indirectAcquisitionXML `xml:"opds:indirectAcquisition"`
+}
+
+type priceXML struct {
+	CurrencyCode string `xml:"currencycode,attr"`
+	Value        string `xml:",chardata"`
+}
+
+type indirectAcquisitionXML struct {
+	TypeAcquisition     string                   `xml:"type,attr"`
+	IndirectAcquisition []indirectAcquisitionXML `xml:"opds:indirectAcquisition"`
+}
+
+type entryXML struct {
+	Title      string        `xml:"title"`
+	ID         string        `xml:"id"`
+	Identifier string        `xml:"dc:identifier,omitempty"`
+	Updated    *time.Time    `xml:"updated"`
+	Published  *time.Time    `xml:"published"`
+	Rights     string        `xml:"rights,omitempty"`
+	Publisher  string        `xml:"dc:publisher,omitempty"`
+	Language   string        `xml:"dc:language,omitempty"`
+	Issued     string        `xml:"dc:issued,omitempty"`
+	Author     []authorXML   `xml:"author"`
+	Category   []categoryXML `xml:"category"`
+	Series     []serieXML    `xml:"schema:Series"`
+	Summary    *contentXML   `xml:"summary"`
+	Content    *contentXML   `xml:"content"`
+	Links      []linkXML     `xml:"link"`
+}
+
+// entryDocumentXML is a complete entry served on its own
+type entryDocumentXML struct {
+	XMLName     xml.Name `xml:"entry"`
+	XMLNS       string   `xml:"xmlns,attr"`
+	XMLNSDC     string   `xml:"xmlns:dc,attr"`
+	XMLNSOPDS   string   `xml:"xmlns:opds,attr"`
+	XMLNSThread string   `xml:"xmlns:thr,attr"`
+	XMLNSSchema string   `xml:"xmlns:schema,attr"`
+	entryXML
+}
+
+type authorXML struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type categoryXML struct {
+	Scheme string `xml:"scheme,attr,omitempty"`
+	Term   string `xml:"term,attr"`
+	Label  string `xml:"label,attr,omitempty"`
+}
+
+type serieXML struct {
+	Name     string `xml:"name,attr"`
+	URL      string `xml:"url,attr,omitempty"`
+	Position string `xml:"position,attr,omitempty"`
+}
+
+type contentXML struct {
+	ContentType string `xml:"type,attr,omitempty"`
+	Content     string `xml:",chardata"`
+}
+
+// Marshal generate the atom representation of the feed
+func Marshal(feed *Feed) ([]byte, error) {
+	b, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// MarshalIndent generate the atom representation of the feed with each
+// element on a new line starting with prefix and indented with indent
+func MarshalIndent(feed *Feed, prefix string, indent string) ([]byte, error) {
+	b, err := xml.MarshalIndent(feed, prefix, indent)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// MarshalEntry generate the atom representation of a complete entry, as
+// served with the type application/atom+xml;type=entry;profile=opds-catalog
+func MarshalEntry(entry *Entry) ([]byte, error) {
+	doc := entryDocumentXML{
+		XMLNS:       NamespaceAtom,
+		XMLNSDC:     NamespaceDC,
+		XMLNSOPDS:   NamespaceOPDS,
+		XMLNSThread: NamespaceThread,
+		XMLNSSchema: NamespaceSchema,
+		entryXML:    generateEntry(*entry),
+	}
+	b, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// MarshalXML generate the feed with the namespaces used by OPDS 1.x
+func (feed Feed) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	var f feedXML
+
+	f.XMLNS = NamespaceAtom
+	f.XMLNSDC = NamespaceDC
+	f.XMLNSOPDS = NamespaceOPDS
+	f.XMLNSSearch = NamespaceOpenSearch
+	f.XMLNSThread = NamespaceThread
+	f.XMLNSSchema = NamespaceSchema
+	f.XMLBase = feed.XMLBase
+	f.ID = feed.ID
+	f.Title = feed.Title
+	f.Updated = feed.Updated
+	f.TotalResults = feed.TotalResults
+	f.ItemsPerPage = feed.ItemsPerPage
+
+	for _, l := range feed.Links {
+		f.Links = append(f.Links, generateLink(l))
+	}
+
+	for _, entry := range feed.Entries {
+		f.Entries = append(f.Entries, generateEntry(entry))
+	}
+
+	return e.Encode(f)
+}
+
+func generateEntry(entry Entry) entryXML {
+	en := entryXML{}
+	en.Title = entry.Title
+	en.ID = entry.ID
+	en.Identifier = entry.Identifier
+	en.Updated = entry.Updated
+	en.Published = entry.Published
+	en.Rights = entry.Rights
+	en.Publisher = entry.Publisher
+	en.Language = entry.Language
+	en.Issued = entry.Issued
+	for _, a := range entry.Author {
+		en.Author = append(en.Author, authorXML{Name: a.Name, URI: a.URI})
+	}
+	for _, c := range entry.Category {
+		en.Category = append(en.Category, categoryXML{Scheme: c.Scheme, Term: c.Term, Label: c.Label})
+	}
+	for _, s := range entry.Series {
+		serie := serieXML{Name: s.Name, URL: s.URL}
+		if s.Position != 0 {
+			serie.Position = strconv.FormatFloat(float64(s.Position), 'f', -1, 32)
+		}
+		en.Series = append(en.Series, serie)
+	}
+	if entry.Summary.Content != "" {
+		en.Summary = &contentXML{ContentType: entry.Summary.ContentType, Content: entry.Summary.Content}
+	}
+	if entry.Content.Content != "" {
+		en.Content = &contentXML{ContentType: entry.Content.ContentType, Content: entry.Content.Content}
+	}
+	for _, l := range entry.Links {
+		en.Links = append(en.Links, generateLink(l))
+	}
+
+	return en
+}
+
+func generateLink(l Link) linkXML {
+	var link linkXML
+
+	link.Rel = l.Rel
+	link.Href = l.Href
+	link.TypeLink = l.TypeLink
+	link.Title = l.Title
+	link.FacetGroup = l.FacetGroup
+	link.ActiveFacet = l.ActiveFacet
+	link.Count = l.Count
+	if l.Price.CurrencyCode != "" {
+		link.Price = &priceXML{
+			CurrencyCode: l.Price.CurrencyCode,
+			Value:        strconv.FormatFloat(l.Price.Value, 'f', -1, 64),
+		}
+	}
+	link.IndirectAcquisition = generateIndirectAcquisition(l.IndirectAcquisition)
+
+	return link
+}
+
+func generateIndirectAcquisition(indirects []IndirectAcquisition) []indirectAcquisitionXML {
+	var result []indirectAcquisitionXML
+
+	for _, ia := range indirects {
+		result = append(result, indirectAcquisitionXML{
+			TypeAcquisition:     ia.TypeAcquisition,
+			IndirectAcquisition: generateIndirectAcquisition(ia.IndirectAcquisition),
+		})
+	}
+
+	return result
+}
@@ -11,6 +11,7 @@ import (
 
 // Feed root element for acquisition or navigation feed
 type Feed struct {
+	XMLBase      string    `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 	ID           string    `xml:"id"`
 	Title        string    `xml:"title"`
 	Updated      time.Time `xml:"updated"`
@@ -22,11 +23,13 @@ type Feed struct {
 
 // Link link to different resources
 type Link struct {
+	XMLBase             string                `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 	Rel                 string                `xml:"rel,attr"`
 	Href                string                `xml:"href,attr"`
 	TypeLink            string                `xml:"type,attr"`
 	Title               string                `xml:"title,attr"`
 	FacetGroup          string                `xml:"facetGroup,attr"`
+	ActiveFacet         bool                  `xml:"activeFacet,attr"`
 	Count               int                   `xml:"count,attr"`
 	Price               Price                 `xml:"price"`
 	IndirectAcquisition []IndirectAcquisition `xml:"indirectAcquisition"`
@@ -40,6 +43,7 @@ type Author struct {
 
 // Entry an atom entry in the feed
 type Entry struct {
+	XMLBase    string     `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 	Title      string     `xml:"title"`
 	ID         string     `xml:"id"`
 	Identifier string     `xml:"identifier"`
@@ -91,9 +95,23 @@ type Serie struct {
 	Position float32 `xml:"position,attr"`
 }
 
+// ParseOptions change the way a feed is parsed
+type ParseOptions struct {
+	// ResolveURLs make every href of the feed absolute
+	ResolveURLs bool
+	// BaseURL is used instead of the feed url to resolve relative href,
+	// xml:base attributes found in the feed still apply on top of it
+	BaseURL string
+}
+
 // ParseURL take a url in entry and parse the feed
 func ParseURL(url string) (*Feed, error) {
-	var feed Feed
+	return ParseURLWithOptions(url, ParseOptions{})
+}
+
+// ParseURLWithOptions take a url in entry and parse the feed, relative href
+// are resolved against the feed url when asked in options
+func ParseURLWithOptions(url string, opts ParseOptions) (*Feed, error) {
 
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -103,13 +121,43 @@ func ParseURL(url string) (*Feed, error) {
 	if errReq != nil {
 		return nil, errReq
 	}
+	defer res.Body.Close()
 
 	buff, errRead := ioutil.ReadAll(res.Body)
 	if errRead != nil {
 		return nil, errRead
 	}
 
-	xml.Unmarshal(buff, &feed)
+	if opts.BaseURL == "" {
+		// follow redirection to get the real location of the feed
+		opts.BaseURL = res.Request.URL.String()
+	}
+
+	return ParseBufferWithOptions(buff, opts)
+}
+
+// ParseBuffer parse opds1 feed from a buffer of byte usually get
+// from a file or url
+func ParseBuffer(buff []byte) (*Feed, error) {
+	return ParseBufferWithOptions(buff, ParseOptions{})
+}
+
+// ParseBufferWithOptions parse opds1 feed from a buffer of byte, relative
+// href are resolved against opts.BaseURL when asked in options
+func ParseBufferWithOptions(buff []byte, opts ParseOptions) (*Feed, error) {
+	var feed Feed
+
+	errParse := xml.Unmarshal(buff, &feed)
+	if errParse != nil {
+		return &feed, errParse
+	}
+
+	if opts.ResolveURLs {
+		errResolve := feed.ResolveURLs(opts.BaseURL)
+		if errResolve != nil {
+			return &feed, errResolve
+		}
+	}
 
 	return &feed, nil
 }
@@ -0,0 +1,118 @@
+package opds1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagerTestServer serve the feeds by path and query, the entries are named
+// by their id and next is the href of the next link
+func pagerTestServer(t *testing.T, pages map[string][]string, next map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "pager" {
+			t.Errorf("%s: header %v", r.URL, r.Header)
+		}
+		page := r.URL.RequestURI()
+		ids, ok := pages[page]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		feed := Feed{ID: page, Title: page, Updated: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		feed.Links = append(feed.Links, Link{Rel: "self", Href: page, TypeLink: "application/atom+xml;profile=opds-catalog;kind=acquisition"})
+		if next[page] != "" {
+			feed.Links = append(feed.Links, Link{Rel: "next", Href: next[page], TypeLink: "application/atom+xml;profile=opds-catalog;kind=acquisition"})
+		}
+		for _, id := range ids {
+			feed.Entries = append(feed.Entries, Entry{ID: id, Title: id})
+		}
+		data, err := Marshal(&feed)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readPager return the ids of the entries read by the pager
+func readPager(pager *Pager) []string {
+	var ids []string
+	for pager.Next() {
+		ids = append(ids, pager.Entry().ID)
+	}
+	return ids
+}
+
+func TestPager(t *testing.T) {
+	server := pagerTestServer(t,
+		map[string][]string{
+			"/1":     {"a", "b"},
+			"/2":     {},
+			"/3?x=1": {"c"},
+			"/loop":  {"d"},
+			"/error": {"e"},
+		},
+		map[string]string{
+			"/1":     "2",
+			"/2":     "/3?x=1",
+			"/loop":  "loop",
+			"/error": "missing",
+		})
+	ctx := context.Background()
+	fetcher := HTTPFetcher{Header: http.Header{"X-Test": {"pager"}}}
+
+	first, err := fetcher.Fetch(ctx, server.URL+"/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the self link is resolved by the fetcher and used as the url of the
+	// first page
+	pager := NewPager(ctx, fetcher, first, "")
+	if pager.Entry().ID != "" {
+		t.Errorf("entry before Next %+v", pager.Entry())
+	}
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"a", "b", "c"}) || pager.Err() != nil {
+		t.Errorf("entries %q, error %v", ids, pager.Err())
+	}
+	if pager.Cursor() != server.URL+"/3?x=1" || pager.NextURL() != "" || pager.Page().Title != "/3?x=1" {
+		t.Errorf("cursor %q, next %q", pager.Cursor(), pager.NextURL())
+	}
+
+	// resume after MaxPages
+	pager = ResumePager(ctx, fetcher, server.URL+"/1")
+	pager.MaxPages = 1
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"a", "b"}) || pager.NextURL() != server.URL+"/2" {
+		t.Errorf("entries %q, next %q", ids, pager.NextURL())
+	}
+	pager = ResumePager(ctx, fetcher, pager.NextURL())
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"c"}) || pager.Err() != nil {
+		t.Errorf("resumed: entries %q, error %v", ids, pager.Err())
+	}
+
+	pager = ResumePager(ctx, fetcher, server.URL+"/loop")
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"d"}) || pager.Err() != ErrPagerLoop {
+		t.Errorf("loop: entries %q, error %v", ids, pager.Err())
+	}
+
+	pager = ResumePager(ctx, fetcher, server.URL+"/error")
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"e"}) || pager.Err() == nil || !strings.Contains(pager.Err().Error(), "404") {
+		t.Errorf("error: entries %q, error %v", ids, pager.Err())
+	}
+	if pager.Cursor() != server.URL+"/error" || pager.NextURL() != server.URL+"/missing" {
+		t.Errorf("error: cursor %q, next %q", pager.Cursor(), pager.NextURL())
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	pager = ResumePager(canceled, fetcher, server.URL+"/1")
+	if pager.Next() || pager.Err() != context.Canceled {
+		t.Errorf("canceled: error %v", pager.Err())
+	}
+}
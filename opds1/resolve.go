@@ -0,0 +1,114 @@
+package opds1
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ResolveURLs make every href of the feed absolute, links are resolved
+// against base and the xml:base of the feed, entry and link
+func (feed *Feed) ResolveURLs(base string) error {
+
+	baseFeed, err := resolveBase(nil, base)
+	if err != nil {
+		return err
+	}
+	baseFeed, err = resolveBase(baseFeed, feed.XMLBase)
+	if err != nil {
+		return err
+	}
+
+	err = resolveLinks(baseFeed, feed.Links)
+	if err != nil {
+		return err
+	}
+
+	for i := range feed.Entries {
+		entry := &feed.Entries[i]
+
+		baseEntry, errBase := resolveBase(baseFeed, entry.XMLBase)
+		if errBase != nil {
+			return errBase
+		}
+
+		errLinks := resolveLinks(baseEntry, entry.Links)
+		if errLinks != nil {
+			return errLinks
+		}
+
+		for j := range entry.Author {
+			entry.Author[j].URI, err = resolveHref(baseEntry, entry.Author[j].URI)
+			if err != nil {
+				return err
+			}
+		}
+
+		for j := range entry.Series {
+			entry.Series[j].URL, err = resolveHref(baseEntry, entry.Series[j].URL)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func resolveLinks(base *url.URL, links []Link) error {
+
+	for i := range links {
+		baseLink, err := resolveBase(base, links[i].XMLBase)
+		if err != nil {
+			return err
+		}
+		links[i].Href, err = resolveHref(baseLink, links[i].Href)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveBase return the base url to use for the children of an element
+// having the xml:base attribute xmlBase
+func resolveBase(base *url.URL, xmlBase string) (*url.URL, error) {
+
+	if xmlBase == "" {
+		return base, nil
+	}
+
+	u, err := url.Parse(xmlBase)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		return u, nil
+	}
+
+	return base.ResolveReference(u), nil
+}
+
+func resolveHref(base *url.URL, href string) (string, error) {
+
+	if base == nil || href == "" {
+		return href, nil
+	}
+
+	// keep uri template expression out of the resolution, only the
+	// part before the first expression is a real url
+	template := ""
+	if i := strings.Index(href, "{"); i >= 0 {
+		if i == 0 {
+			return href, nil
+		}
+		href, template = href[:i], href[i:]
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(u).String() + template, nil
+}
@@ -0,0 +1,88 @@
+package opds1
+
+import "testing"
+
+func TestResolveURLs(t *testing.T) {
+	feed := Feed{
+		Links: []Link{
+			{Rel: "self", Href: "feed.xml"},
+			{Rel: "search", Href: "search{?searchTerms}"},
+			{Rel: "search", Href: "{+base}/search"},
+			{Rel: "start", Href: "/", XMLBase: "https://other.example.com/opds/"},
+		},
+		Entries: []Entry{
+			{
+				XMLBase: "books/",
+				Links: []Link{
+					{Rel: "http://opds-spec.org/acquisition", Href: "moby.epub"},
+					{Rel: "http://opds-spec.org/image", Href: "covers/moby.jpg", XMLBase: "../"},
+					{Rel: "alternate", Href: "moby?format={format}"},
+					{Rel: "related", Href: "mailto:books@example.com"},
+				},
+				Author: []Author{{Name: "Herman Melville", URI: "../authors/melville"}, {Name: "Anonymous"}},
+				Series: []Serie{{Name: "Classics", URL: "/series/classics"}},
+			},
+			{
+				XMLBase: "https://cdn.example.com/",
+				Links:   []Link{{Rel: "http://opds-spec.org/acquisition", Href: "moby.pdf"}},
+			},
+		},
+	}
+
+	if err := feed.ResolveURLs("https://example.com/catalog/"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"feed link", feed.Links[0].Href, "https://example.com/catalog/feed.xml"},
+		// only the part before the first expression of a template is
+		// resolved, the expressions are left untouched
+		{"template", feed.Links[1].Href, "https://example.com/catalog/search{?searchTerms}"},
+		{"template expression first", feed.Links[2].Href, "{+base}/search"},
+		{"link base", feed.Links[3].Href, "https://other.example.com/"},
+		{"entry base", feed.Entries[0].Links[0].Href, "https://example.com/catalog/books/moby.epub"},
+		{"entry and link base", feed.Entries[0].Links[1].Href, "https://example.com/catalog/covers/moby.jpg"},
+		{"entry template", feed.Entries[0].Links[2].Href, "https://example.com/catalog/books/moby?format={format}"},
+		{"other scheme", feed.Entries[0].Links[3].Href, "mailto:books@example.com"},
+		{"author", feed.Entries[0].Author[0].URI, "https://example.com/catalog/authors/melville"},
+		{"author without uri", feed.Entries[0].Author[1].URI, ""},
+		{"series", feed.Entries[0].Series[0].URL, "https://example.com/series/classics"},
+		{"absolute entry base", feed.Entries[1].Links[0].Href, "https://cdn.example.com/moby.pdf"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: %q, want %q", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestResolveURLsFeedBase(t *testing.T) {
+	// the xml:base of the feed is used without base url
+	feed := Feed{XMLBase: "https://example.com/opds/", Links: []Link{{Href: "feed.xml"}}, Entries: []Entry{{Links: []Link{{Href: "/moby.epub"}}}}}
+	if err := feed.ResolveURLs(""); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Links[0].Href != "https://example.com/opds/feed.xml" || feed.Entries[0].Links[0].Href != "https://example.com/moby.epub" {
+		t.Errorf("hrefs %q and %q", feed.Links[0].Href, feed.Entries[0].Links[0].Href)
+	}
+
+	// without any base the href are kept
+	feed = Feed{Links: []Link{{Href: "feed.xml"}}}
+	if err := feed.ResolveURLs(""); err != nil || feed.Links[0].Href != "feed.xml" {
+		t.Errorf("href %q, error %v", feed.Links[0].Href, err)
+	}
+
+	for _, feed := range []Feed{
+		{XMLBase: "https://example.com/%zz"},
+		{Links: []Link{{Href: "%zz"}}},
+		{Entries: []Entry{{Author: []Author{{URI: "%zz"}}}}},
+	} {
+		if err := feed.ResolveURLs("https://example.com/"); err == nil {
+			t.Errorf("%+v: no error", feed)
+		}
+	}
+}
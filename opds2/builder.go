@@ -0,0 +1,618 @@
+package opds2
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// acquisition relations defined by OPDS
+const (
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelOpenAccess  = "http://opds-spec.org/acquisition/open-access"
+	RelBorrow      = "http://opds-spec.org/acquisition/borrow"
+	RelBuy         = "http://opds-spec.org/acquisition/buy"
+	RelSample      = "http://opds-spec.org/acquisition/sample"
+	RelSubscribe   = "http://opds-spec.org/acquisition/subscribe"
+)
+
+// PublicationBuilder build a publication with chained calls, the
+// publication is validated by Build
+//
+//	p, err := opds2.NewPublication().
+//		Title("Moby Dick").
+//		Identifier("urn:isbn:9780000000000").
+//		Author(opds2.Contributor{Name: opds2.MultiLanguage{SingleString: "Herman Melville"}, SortAs: "Melville, Herman"}).
+//		AcquisitionLink(opds2.RelBuy, "https://example.com/moby.epub", "application/epub+zip", &opds2.Price{Currency: "USD", Value: 4.99}).
+//		Cover("https://example.com/moby.jpg", "image/jpeg", 900, 600).
+//		Build()
+type PublicationBuilder struct {
+	publication Publication
+	// lastAcquisition is the index of the last acquisition link, -1 when
+	// none was added
+	lastAcquisition int
+}
+
+// NewPublication create a publication builder
+func NewPublication() *PublicationBuilder {
+	return &PublicationBuilder{lastAcquisition: -1}
+}
+
+// Type set the @type of the publication
+func (b *PublicationBuilder) Type(rdfType string) *PublicationBuilder {
+	b.publication.Metadata.RDFType = rdfType
+	return b
+}
+
+// Title set the title of the publication
+func (b *PublicationBuilder) Title(title string) *PublicationBuilder {
+	b.publication.Metadata.Title.SingleString = title
+	return b
+}
+
+// Subtitle set the subtitle
+func (b *PublicationBuilder) Subtitle(subtitle string) *PublicationBuilder {
+	b.publication.Metadata.Subtitle = &MultiLanguage{SingleString: subtitle}
+	return b
+}
+
+// SortAs set the string used to sort the publication by title
+func (b *PublicationBuilder) SortAs(sortAs string) *PublicationBuilder {
+	b.publication.Metadata.SortAs = sortAs
+	return b
+}
+
+// TitleLanguage add a translation of the title, the first one added is
+// used as the single string title when none is set
+func (b *PublicationBuilder) TitleLanguage(language string, title string) *PublicationBuilder {
+	t := &b.publication.Metadata.Title
+	if t.MultiString == nil {
+		t.MultiString = make(map[string]string)
+	}
+	t.MultiString[language] = title
+	if t.SingleString == "" {
+		t.SingleString = title
+	}
+	return b
+}
+
+// Identifier set the identifier of the publication, an URI
+func (b *PublicationBuilder) Identifier(identifier string) *PublicationBuilder {
+	b.publication.Metadata.Identifier = identifier
+	return b
+}
+
+// Author add authors
+func (b *PublicationBuilder) Author(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Author = append(b.publication.Metadata.Author, c...)
+	return b
+}
+
+// Translator add translators
+func (b *PublicationBuilder) Translator(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Translator = append(b.publication.Metadata.Translator, c...)
+	return b
+}
+
+// Editor add editors
+func (b *PublicationBuilder) Editor(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Editor = append(b.publication.Metadata.Editor, c...)
+	return b
+}
+
+// Artist add artists
+func (b *PublicationBuilder) Artist(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Artist = append(b.publication.Metadata.Artist, c...)
+	return b
+}
+
+// Illustrator add illustrators
+func (b *PublicationBuilder) Illustrator(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Illustrator = append(b.publication.Metadata.Illustrator, c...)
+	return b
+}
+
+// Letterer add letterers
+func (b *PublicationBuilder) Letterer(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Letterer = append(b.publication.Metadata.Letterer, c...)
+	return b
+}
+
+// Penciler add pencilers
+func (b *PublicationBuilder) Penciler(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Penciler = append(b.publication.Metadata.Penciler, c...)
+	return b
+}
+
+// Colorist add colorists
+func (b *PublicationBuilder) Colorist(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Colorist = append(b.publication.Metadata.Colorist, c...)
+	return b
+}
+
+// Inker add inkers
+func (b *PublicationBuilder) Inker(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Inker = append(b.publication.Metadata.Inker, c...)
+	return b
+}
+
+// Narrator add narrators
+func (b *PublicationBuilder) Narrator(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Narrator = append(b.publication.Metadata.Narrator, c...)
+	return b
+}
+
+// Contributor add contributors with no specific role, the role can be
+// given in the Role field of the contributor
+func (b *PublicationBuilder) Contributor(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Contributor = append(b.publication.Metadata.Contributor, c...)
+	return b
+}
+
+// Publisher add publishers
+func (b *PublicationBuilder) Publisher(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Publisher = append(b.publication.Metadata.Publisher, c...)
+	return b
+}
+
+// Imprint add imprints
+func (b *PublicationBuilder) Imprint(c ...Contributor) *PublicationBuilder {
+	b.publication.Metadata.Imprint = append(b.publication.Metadata.Imprint, c...)
+	return b
+}
+
+// Language add BCP 47 language tags
+func (b *PublicationBuilder) Language(languages ...string) *PublicationBuilder {
+	b.publication.Metadata.Language = append(b.publication.Metadata.Language, languages...)
+	return b
+}
+
+// Modified set the last modification date
+func (b *PublicationBuilder) Modified(t time.Time) *PublicationBuilder {
+	b.publication.Metadata.Modified = &t
+	return b
+}
+
+// Published set the publication date
+func (b *PublicationBuilder) Published(t time.Time) *PublicationBuilder {
+	b.publication.Metadata.PublicationDate = &t
+	return b
+}
+
+// Description set the description
+func (b *PublicationBuilder) Description(description string) *PublicationBuilder {
+	b.publication.Metadata.Description = description
+	return b
+}
+
+// Source set the source
+func (b *PublicationBuilder) Source(source string) *PublicationBuilder {
+	b.publication.Metadata.Source = source
+	return b
+}
+
+// Rights set the rights
+func (b *PublicationBuilder) Rights(rights string) *PublicationBuilder {
+	b.publication.Metadata.Rights = rights
+	return b
+}
+
+// Duration set the duration in seconds of an audiobook
+func (b *PublicationBuilder) Duration(seconds int) *PublicationBuilder {
+	b.publication.Metadata.Duration = seconds
+	return b
+}
+
+// Subject add subjects
+func (b *PublicationBuilder) Subject(s ...Subject) *PublicationBuilder {
+	b.publication.Metadata.Subject = append(b.publication.Metadata.Subject, s...)
+	return b
+}
+
+// Series add the series the publication belongs to with its position
+func (b *PublicationBuilder) Series(name string, position float32, links ...Link) *PublicationBuilder {
+	return b.SeriesCollection(Collection{Name: name, Position: position, Links: links})
+}
+
+// SeriesCollection add a series when more than its name and position are
+// known
+func (b *PublicationBuilder) SeriesCollection(c Collection) *PublicationBuilder {
+	if b.publication.Metadata.BelongsTo == nil {
+		b.publication.Metadata.BelongsTo = &BelongsTo{}
+	}
+	b.publication.Metadata.BelongsTo.Series = append(b.publication.Metadata.BelongsTo.Series, c)
+	return b
+}
+
+// Collection add a collection the publication belongs to
+func (b *PublicationBuilder) Collection(c Collection) *PublicationBuilder {
+	if b.publication.Metadata.BelongsTo == nil {
+		b.publication.Metadata.BelongsTo = &BelongsTo{}
+	}
+	b.publication.Metadata.BelongsTo.Collection = append(b.publication.Metadata.BelongsTo.Collection, c)
+	return b
+}
+
+// Link add a link to the publication
+func (b *PublicationBuilder) Link(l Link) *PublicationBuilder {
+	if isAcquisitionLink(l) {
+		b.lastAcquisition = len(b.publication.Links)
+	}
+	b.publication.Links = append(b.publication.Links, l)
+	return b
+}
+
+// SelfLink add the link to the OPDS publication document
+func (b *PublicationBuilder) SelfLink(href string) *PublicationBuilder {
+	return b.Link(Link{Href: href, TypeLink: "application/opds-publication+json", Rel: []string{"self"}})
+}
+
+// AcquisitionLink add an acquisition link, rel is one of the acquisition
+// relations and price is optional
+func (b *PublicationBuilder) AcquisitionLink(rel string, href string, typeLink string, price *Price) *PublicationBuilder {
+	l := Link{Href: href, TypeLink: typeLink, Rel: []string{rel}}
+	if price != nil {
+		l.Properties = &Properties{Price: price}
+	}
+	return b.Link(l)
+}
+
+// IndirectAcquisition describe the media types obtained by following the
+// last acquisition link, each type is the child of the previous one like
+// an epub (last) in a LCP license (first)
+func (b *PublicationBuilder) IndirectAcquisition(types ...string) *PublicationBuilder {
+	if b.lastAcquisition < 0 || len(types) == 0 {
+		return b
+	}
+
+	var indirect IndirectAcquisition
+	for i := len(types) - 1; i >= 0; i-- {
+		if i == len(types)-1 {
+			indirect = IndirectAcquisition{TypeAcquisition: types[i]}
+			continue
+		}
+		indirect = IndirectAcquisition{TypeAcquisition: types[i], Child: []IndirectAcquisition{indirect}}
+	}
+
+	l := &b.publication.Links[b.lastAcquisition]
+	if l.Properties == nil {
+		l.Properties = &Properties{}
+	}
+	l.Properties.IndirectAcquisition = append(l.Properties.IndirectAcquisition, indirect)
+	return b
+}
+
+// Image add an image, height and width are ignored when zero and given in
+// the order of AddImage
+func (b *PublicationBuilder) Image(href string, typeImage string, height int, width int) *PublicationBuilder {
+	b.publication.AddImage(href, typeImage, height, width)
+	return b
+}
+
+// Cover add an image as the first one of the publication, the one used as
+// its cover
+func (b *PublicationBuilder) Cover(href string, typeImage string, height int, width int) *PublicationBuilder {
+	b.publication.AddImage(href, typeImage, height, width)
+	images := b.publication.Images
+	cover := images[len(images)-1]
+	copy(images[1:], images[:len(images)-1])
+	images[0] = cover
+	return b
+}
+
+// Build validate and return a copy of the publication, the builder can
+// keep changing without affecting it, a publication without images has an
+// empty list written as an array rather than null
+func (b *PublicationBuilder) Build() (Publication, error) {
+
+	p := deepCopy(reflect.ValueOf(b.publication)).Interface().(Publication)
+	if p.Images == nil {
+		p.Images = []Link{}
+	}
+
+	errs := p.validate()
+	if len(errs) > 0 {
+		return p, &BuildError{Problems: errs}
+	}
+
+	return p, nil
+}
+
+// MustBuild is Build panicking when the publication is invalid
+func (b *PublicationBuilder) MustBuild() Publication {
+	p, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// BuildError list the problems found when building a publication or a
+// feed
+type BuildError struct {
+	Problems []string
+}
+
+func (e *BuildError) Error() string {
+	return "opds2: invalid: " + strings.Join(e.Problems, "; ")
+}
+
+// validate return the problems making the publication invalid
+func (publication *Publication) validate() []string {
+	var errs []string
+	m := publication.Metadata
+
+	if m.Title.String() == "" {
+		errs = append(errs, "missing title")
+	}
+
+	acquisition := false
+	for _, l := range publication.Links {
+		if isAcquisitionLink(l) {
+			acquisition = true
+		}
+		for _, r := range l.Rel {
+			if strings.HasPrefix(r, RelAcquisition) && !isAcquisitionLink(Link{Rel: []string{r}}) {
+				errs = append(errs, fmt.Sprintf("unknown acquisition relation %q", r))
+			}
+		}
+		errs = append(errs, validateLink("link", l)...)
+		if l.Properties != nil && l.Properties.Price != nil {
+			price := l.Properties.Price
+			if len(price.Currency) != 3 || strings.ToUpper(price.Currency) != price.Currency {
+				errs = append(errs, fmt.Sprintf("price of %s: invalid currency %q", l.Href, price.Currency))
+			}
+			if price.Value < 0 {
+				errs = append(errs, fmt.Sprintf("price of %s: negative value", l.Href))
+			}
+		}
+	}
+	if !acquisition {
+		errs = append(errs, "missing acquisition link")
+	}
+
+	for _, i := range publication.Images {
+		errs = append(errs, validateLink("image", i)...)
+		if i.TypeLink != "" && !strings.HasPrefix(i.TypeLink, "image/") {
+			errs = append(errs, fmt.Sprintf("image %s: type %q is not an image", i.Href, i.TypeLink))
+		}
+		if i.Width < 0 || i.Height < 0 {
+			errs = append(errs, fmt.Sprintf("image %s: negative size", i.Href))
+		}
+	}
+
+	roles := []struct {
+		name         string
+		contributors []Contributor
+	}{
+		{"author", m.Author}, {"translator", m.Translator}, {"editor", m.Editor},
+		{"artist", m.Artist}, {"illustrator", m.Illustrator}, {"letterer", m.Letterer},
+		{"penciler", m.Penciler}, {"colorist", m.Colorist}, {"inker", m.Inker},
+		{"narrator", m.Narrator}, {"contributor", m.Contributor}, {"publisher", m.Publisher},
+		{"imprint", m.Imprint},
+	}
+	for _, role := range roles {
+		for _, c := range role.contributors {
+			if c.Name.String() == "" {
+				errs = append(errs, role.name+" without name")
+			}
+		}
+	}
+
+	for _, s := range m.Subject {
+		if s.Name == "" {
+			errs = append(errs, "subject without name")
+		}
+	}
+	if m.BelongsTo != nil {
+		for _, c := range m.BelongsTo.Series {
+			if c.Name == "" {
+				errs = append(errs, "series without name")
+			}
+			if c.Position < 0 {
+				errs = append(errs, fmt.Sprintf("series %s: negative position", c.Name))
+			}
+		}
+		for _, c := range m.BelongsTo.Collection {
+			if c.Name == "" {
+				errs = append(errs, "collection without name")
+			}
+		}
+	}
+	for _, l := range m.Language {
+		if l == "" {
+			errs = append(errs, "empty language")
+		}
+	}
+	if m.Duration < 0 {
+		errs = append(errs, "negative duration")
+	}
+
+	return errs
+}
+
+func validateLink(kind string, l Link) []string {
+	var errs []string
+
+	if l.Href == "" {
+		errs = append(errs, kind+" without href")
+	}
+	if l.Templated {
+		if _, err := l.Expand(nil); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %s", kind, l.Href, err))
+		}
+	}
+
+	return errs
+}
+
+// isAcquisitionLink check if the link has one of the acquisition relations
+func isAcquisitionLink(l Link) bool {
+	for _, r := range l.Rel {
+		switch r {
+		case RelAcquisition, RelOpenAccess, RelBorrow, RelBuy, RelSample, RelSubscribe:
+			return true
+		}
+	}
+	return false
+}
+
+// FeedBuilder build a feed with chained calls, the feed and all its
+// publications are validated by Build
+type FeedBuilder struct {
+	feed Feed
+}
+
+// Pagination describe the position of a page in a paginated feed, the
+// links are optional
+type Pagination struct {
+	NumberOfItems int
+	ItemsPerPage  int
+	CurrentPage   int
+	Next          string
+	Previous      string
+	First         string
+	Last          string
+}
+
+// NewFeed create a feed builder, the feed is modified now
+func NewFeed(title string) *FeedBuilder {
+	return &FeedBuilder{feed: New(title)}
+}
+
+// Modified set the last modification date
+func (b *FeedBuilder) Modified(t time.Time) *FeedBuilder {
+	b.feed.Metadata.Modified = &t
+	return b
+}
+
+// Link add a link to the feed
+func (b *FeedBuilder) Link(l Link) *FeedBuilder {
+	b.feed.Links = append(b.feed.Links, l)
+	return b
+}
+
+// SelfLink add the link to the feed itself
+func (b *FeedBuilder) SelfLink(href string) *FeedBuilder {
+	return b.Link(Link{Href: href, TypeLink: "application/opds+json", Rel: []string{"self"}})
+}
+
+// SearchLink add a templated search link
+func (b *FeedBuilder) SearchLink(href string) *FeedBuilder {
+	return b.Link(Link{Href: href, TypeLink: "application/opds+json", Rel: []string{"search"}, Templated: true})
+}
+
+// Pagination set the pagination metadata and links
+func (b *FeedBuilder) Pagination(p Pagination) *FeedBuilder {
+	b.feed.AddPagination(p.NumberOfItems, p.ItemsPerPage, p.CurrentPage, p.Next, p.Previous, p.First, p.Last)
+	return b
+}
+
+// Navigation add a navigation link
+func (b *FeedBuilder) Navigation(l Link) *FeedBuilder {
+	b.feed.Navigation = append(b.feed.Navigation, l)
+	return b
+}
+
+// Facet add a facet link in the facet group
+func (b *FeedBuilder) Facet(group string, l Link) *FeedBuilder {
+	b.feed.AddFacet(l, group)
+	return b
+}
+
+// Publication add publications
+func (b *FeedBuilder) Publication(p ...Publication) *FeedBuilder {
+	b.feed.Publications = append(b.feed.Publications, p...)
+	return b
+}
+
+// PublicationFrom add a copy of the publication of the builder to the
+// feed, it is validated with the feed
+func (b *FeedBuilder) PublicationFrom(pb *PublicationBuilder) *FeedBuilder {
+	b.feed.Publications = append(b.feed.Publications, deepCopy(reflect.ValueOf(pb.publication)).Interface().(Publication))
+	return b
+}
+
+// Group add a publication to the group whose collection link is collLink
+func (b *FeedBuilder) Group(collLink Link, p ...Publication) *FeedBuilder {
+	for _, publication := range p {
+		b.feed.AddPublicationInGroup(publication, collLink)
+	}
+	return b
+}
+
+// GroupNavigation add navigation links to the group whose collection link
+// is collLink
+func (b *FeedBuilder) GroupNavigation(collLink Link, l ...Link) *FeedBuilder {
+	for _, link := range l {
+		b.feed.AddNavigationInGroup(link, collLink)
+	}
+	return b
+}
+
+// Build validate and return a copy of the feed, the builder can keep
+// changing without affecting it
+func (b *FeedBuilder) Build() (Feed, error) {
+	var errs []string
+
+	if b.feed.Metadata.Title == "" {
+		errs = append(errs, "missing title")
+	}
+	if findLinkByRel(b.feed.Links, "self").Href == "" {
+		errs = append(errs, "missing self link")
+	}
+	for _, l := range b.feed.Links {
+		errs = append(errs, validateLink("link", l)...)
+	}
+	for _, l := range b.feed.Navigation {
+		errs = append(errs, validateLink("navigation", l)...)
+		if l.Title == "" {
+			errs = append(errs, fmt.Sprintf("navigation %s: missing title", l.Href))
+		}
+	}
+	for _, f := range b.feed.Facets {
+		for _, l := range f.Links {
+			errs = append(errs, validateLink("facet", l)...)
+		}
+	}
+	errs = append(errs, validatePublications("", b.feed.Publications)...)
+	for _, g := range b.feed.Groups {
+		if g.Metadata.Title == "" {
+			errs = append(errs, "group without title")
+		}
+		prefix := fmt.Sprintf("group %q: ", g.Metadata.Title)
+		for _, l := range g.Links {
+			errs = append(errs, validateLink(prefix+"link", l)...)
+		}
+		for _, l := range g.Navigation {
+			errs = append(errs, validateLink(prefix+"navigation", l)...)
+			if l.Title == "" {
+				errs = append(errs, fmt.Sprintf("%snavigation %s: missing title", prefix, l.Href))
+			}
+		}
+		errs = append(errs, validatePublications(prefix, g.Publications)...)
+	}
+
+	feed := deepCopy(reflect.ValueOf(b.feed)).Interface().(Feed)
+	if len(errs) > 0 {
+		return feed, &BuildError{Problems: errs}
+	}
+
+	return feed, nil
+}
+
+// validatePublications return the problems of the publications prefixed
+// by prefix and their title
+func validatePublications(prefix string, publications []Publication) []string {
+	var errs []string
+
+	for i := range publications {
+		p := &publications[i]
+		for _, problem := range p.validate() {
+			errs = append(errs, fmt.Sprintf("%spublication %q: %s", prefix, p.Metadata.Title.String(), problem))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,106 @@
+package opds2
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFeedBuilderValidatePublications(t *testing.T) {
+	invalid := NewPublication().Title("No acquisition")
+	group := Link{Href: "https://example.com/classics.json", Title: "Classics", TypeLink: "application/opds+json"}
+
+	tests := []struct {
+		name    string
+		builder *FeedBuilder
+		want    string
+	}{
+		{"publication", NewFeed("t").Publication(invalid.publication), `publication "No acquisition": missing acquisition link`},
+		{"publication from", NewFeed("t").PublicationFrom(invalid), `publication "No acquisition": missing acquisition link`},
+		{"group", NewFeed("t").Group(group, invalid.publication), `group "Classics": publication "No acquisition": missing acquisition link`},
+	}
+	for _, test := range tests {
+		_, err := test.builder.SelfLink("https://example.com/").Build()
+		var buildErr *BuildError
+		if !errors.As(err, &buildErr) {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if len(buildErr.Problems) != 1 || buildErr.Problems[0] != test.want {
+			t.Errorf("%s: problems = %q, want %q", test.name, buildErr.Problems, test.want)
+		}
+	}
+}
+
+func TestPublicationBuilderImages(t *testing.T) {
+	p := NewPublication().
+		Title("Moby Dick").
+		AcquisitionLink(RelOpenAccess, "https://example.com/moby.epub", "application/epub+zip", nil).
+		Image("https://example.com/small.jpg", "image/jpeg", 90, 60).
+		Cover("https://example.com/cover.jpg", "image/jpeg", 900, 600).
+		MustBuild()
+
+	var q Publication
+	q.AddImage("https://example.com/cover.jpg", "image/jpeg", 900, 600)
+	if len(p.Images) != 2 || !reflect.DeepEqual(p.Images[0], q.Images[0]) {
+		t.Fatalf("images = %+v", p.Images)
+	}
+	if p.Images[1].Height != 90 || p.Images[1].Width != 60 || !strings.HasSuffix(p.Images[1].Href, "small.jpg") {
+		t.Errorf("image = %+v", p.Images[1])
+	}
+}
+
+func TestFeedBuilderValidateGroupNavigation(t *testing.T) {
+	group := Link{Href: "https://example.com/classics.json", Title: "Classics", TypeLink: "application/opds+json"}
+
+	_, err := NewFeed("t").SelfLink("https://example.com/").
+		GroupNavigation(group,
+			Link{Href: "https://example.com/classics/new.json", Title: "New"},
+			Link{Href: "https://example.com/classics/old.json"},
+			Link{Title: "Empty"},
+			Link{Href: "https://example.com/classics{?page", Title: "Template", Templated: true}).
+		Build()
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("error %v", err)
+	}
+	want := []string{
+		`group "Classics": navigation https://example.com/classics/old.json: missing title`,
+		`group "Classics": navigation without href`,
+	}
+	if len(buildErr.Problems) != 3 || !reflect.DeepEqual(buildErr.Problems[:2], want) ||
+		!strings.HasPrefix(buildErr.Problems[2], `group "Classics": navigation https://example.com/classics{?page: `) {
+		t.Errorf("problems = %q", buildErr.Problems)
+	}
+}
+
+func TestBuildCopy(t *testing.T) {
+	pb := NewPublication().
+		Title("Moby Dick").
+		AcquisitionLink(RelOpenAccess, "https://example.com/moby.epub", "application/epub+zip", nil)
+	p := pb.MustBuild()
+	if p.Images == nil || len(p.Images) != 0 {
+		t.Errorf("images = %#v", p.Images)
+	}
+
+	fb := NewFeed("t").SelfLink("https://example.com/").PublicationFrom(pb)
+	feed, err := fb.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pb.Cover("https://example.com/cover.jpg", "image/jpeg", 900, 600).
+		AcquisitionLink(RelOpenAccess, "https://example.com/moby.pdf", "application/pdf", nil)
+	pb.publication.Links[0].Rel[0] = RelBuy
+	fb.Link(Link{Href: "https://example.com/next.json", Rel: []string{"next"}})
+	fb.feed.Links[0].Href = "https://example.com/changed"
+
+	if len(p.Links) != 1 || p.Links[0].Rel[0] != RelOpenAccess || len(p.Images) != 0 {
+		t.Errorf("built publication changed: %+v", p)
+	}
+	if len(feed.Links) != 1 || feed.Links[0].Href != "https://example.com/" ||
+		len(feed.Publications[0].Links) != 1 || feed.Publications[0].Links[0].Rel[0] != RelOpenAccess {
+		t.Errorf("built feed changed: %+v", feed)
+	}
+}
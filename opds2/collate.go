@@ -0,0 +1,174 @@
+package opds2
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Collator compare strings in the alphabetical order of a language,
+// letters are compared without their case and accents except the letters
+// the language sort apart, like å, ä and ö after z in Swedish, and numbers
+// are compared by value
+type Collator struct {
+	tailoring map[rune]int
+}
+
+// foldings are the letters with accents sorted with their base letters
+var foldings = map[string]string{
+	"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđð", "e": "èéêëēĕėęě",
+	"g": "ĝğġģ", "h": "ĥħ", "i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ",
+	"l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő", "r": "ŕŗř",
+	"s": "śŝşšſ", "t": "ţťŧ", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ",
+	"z": "źżž", "ae": "æ", "oe": "œ", "ss": "ß", "th": "þ",
+}
+
+var foldingTable = make(map[rune]string)
+
+func init() {
+	for base, letters := range foldings {
+		for _, r := range letters {
+			foldingTable[r] = base
+		}
+	}
+	tailorings["no"] = tailorings["nb"]
+	tailorings["nn"] = tailorings["nb"]
+}
+
+// weights are multiplied by weightScale so tailored letters can be placed
+// between two letters
+const weightScale = 4
+
+// tailorings place letters of some languages, letters after z are the
+// ones with a weight after the one of z
+var tailorings = map[string]map[rune]int{
+	"sv": {'å': 'z'*weightScale + 1, 'ä': 'z'*weightScale + 2, 'æ': 'z'*weightScale + 2, 'ö': 'z'*weightScale + 3, 'ø': 'z'*weightScale + 3},
+	"fi": {'å': 'z'*weightScale + 1, 'ä': 'z'*weightScale + 2, 'æ': 'z'*weightScale + 2, 'ö': 'z'*weightScale + 3, 'ø': 'z'*weightScale + 3},
+	"da": {'æ': 'z'*weightScale + 1, 'ä': 'z'*weightScale + 1, 'ø': 'z'*weightScale + 2, 'ö': 'z'*weightScale + 2, 'å': 'z'*weightScale + 3},
+	"nb": {'æ': 'z'*weightScale + 1, 'ä': 'z'*weightScale + 1, 'ø': 'z'*weightScale + 2, 'ö': 'z'*weightScale + 2, 'å': 'z'*weightScale + 3},
+	"es": {'ñ': 'n'*weightScale + 1},
+}
+
+// NewCollator create a collator for a BCP 47 language tag like "sv" or
+// "es-MX", the default order is used for other languages
+func NewCollator(locale string) *Collator {
+	language := strings.ToLower(strings.SplitN(strings.Replace(locale, "_", "-", -1), "-", 2)[0])
+	return &Collator{tailoring: tailorings[language]}
+}
+
+// Compare return -1, 0 or 1 when a is before, equal or after b, strings
+// only different by case or accents are ordered by their code points
+func (c *Collator) Compare(a, b string) int {
+
+	ka, kb := c.key(a), c.key(b)
+	for i := 0; i < len(ka) && i < len(kb); i++ {
+		if ka[i] != kb[i] {
+			if ka[i] < kb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(ka) < len(kb):
+		return -1
+	case len(ka) > len(kb):
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+// digitWeight start a number in a key, it is followed by the number of
+// digits and the digits so shorter numbers come first
+const digitWeight = '0' * weightScale
+
+// key return the weights of the letters and digits of s, punctuation is
+// ignored and spaces separate words
+func (c *Collator) key(s string) []int {
+	var key []int
+	var digits []int
+
+	flushDigits := func() {
+		if len(digits) == 0 {
+			return
+		}
+		// leading zeros do not change the value
+		for len(digits) > 1 && digits[0] == 0 {
+			digits = digits[1:]
+		}
+		key = append(key, digitWeight, len(digits))
+		key = append(key, digits...)
+		digits = nil
+	}
+
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if r >= '0' && r <= '9' {
+			if space {
+				key = append(key, ' '*weightScale)
+				space = false
+			}
+			digits = append(digits, int(r-'0'))
+			continue
+		}
+		flushDigits()
+
+		if unicode.IsSpace(r) || (!unicode.IsLetter(r) && !unicode.IsDigit(r)) {
+			// a space between words but not at the beginning or repeated
+			if unicode.IsSpace(r) && len(key) > 0 {
+				space = true
+			}
+			continue
+		}
+		if space {
+			key = append(key, ' '*weightScale)
+			space = false
+		}
+
+		if w, ok := c.tailoring[r]; ok {
+			key = append(key, w)
+			continue
+		}
+		if base, ok := foldingTable[r]; ok {
+			for _, b := range base {
+				key = append(key, int(b)*weightScale)
+			}
+			continue
+		}
+		key = append(key, int(r)*weightScale)
+	}
+	flushDigits()
+
+	return key
+}
+
+// Fold lowercase s and remove the accents of its letters, the result is
+// the string compared by collators of the default order
+func Fold(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if base, ok := foldingTable[r]; ok {
+			b.WriteString(base)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// equal compare strings without case, accents and punctuation
+func (c *Collator) equal(a string, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	ka, kb := c.key(a), c.key(b)
+	if len(ka) != len(kb) {
+		return false
+	}
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package opds2
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollatorCompare(t *testing.T) {
+	tests := []struct {
+		locale string
+		a      string
+		b      string
+		want   int
+	}{
+		{"", "apple", "Banana", -1},
+		{"", "Émile", "Ernest", -1},
+		{"", "émile", "Emile", 1},
+		{"", "Emile", "Emile", 0},
+		{"", "Œuvres", "Odyssée", 1},
+		{"", "Straße", "Strasse", 1},
+		{"", "Strasse", "Strassen", -1},
+		{"", "L'Étranger", "Lettres", -1},
+		{"", "  Moby Dick", "Moby-Dick", -1},
+		{"", "Chapter 9", "Chapter 10", -1},
+		{"", "Chapter 010", "Chapter 9", 1},
+		{"", "Chapter 007", "Chapter 7", -1},
+		{"", "Chapter 7", "Chapter 7b", -1},
+
+		// å, ä and ö after z in Swedish and Finnish, with æ and ø as ä and ö
+		{"sv", "Åsa", "Zorn", 1},
+		{"sv", "Åsa", "Ärlig", -1},
+		{"sv", "Ärlig", "Örn", -1},
+		{"sv-SE", "Æble", "Ärlig", -1},
+		{"sv", "Øre", "Örn", -1},
+		{"fi", "Öljy", "Zeta", 1},
+		{"fi_FI", "Åland", "Äiti", -1},
+		{"", "Åsa", "Zorn", -1},
+
+		// æ, ø and å after z in Danish and Norwegian
+		{"da", "Æble", "Zebra", 1},
+		{"da", "Æble", "Øl", -1},
+		{"da", "Øl", "Ål", -1},
+		{"da", "Ärlig", "Æble", 1},
+		{"nb", "Ål", "Øl", 1},
+		{"no", "Ål", "Zebra", 1},
+		{"nn-NO", "Øl", "Zebra", 1},
+		{"de", "Øl", "Zebra", -1},
+
+		// ñ between n and o in Spanish
+		{"es", "ñandú", "nube", 1},
+		{"es", "ñandú", "oso", -1},
+		{"es-MX", "caña", "canto", 1},
+		{"", "caña", "canto", -1},
+	}
+	for _, test := range tests {
+		c := NewCollator(test.locale)
+		if got := c.Compare(test.a, test.b); got != test.want {
+			t.Errorf("%q: compare(%q, %q) = %d, want %d", test.locale, test.a, test.b, got, test.want)
+		}
+		if got := c.Compare(test.b, test.a); got != -test.want {
+			t.Errorf("%q: compare(%q, %q) = %d, want %d", test.locale, test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestCollatorSort(t *testing.T) {
+	words := []string{"Zorn", "Ölund", "Ångström", "Ärlig", "Anders", "Øre", "Æble"}
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"", []string{"Æble", "Anders", "Ångström", "Ärlig", "Ölund", "Øre", "Zorn"}},
+		{"sv", []string{"Anders", "Zorn", "Ångström", "Æble", "Ärlig", "Ölund", "Øre"}},
+		{"da", []string{"Anders", "Zorn", "Æble", "Ärlig", "Ölund", "Øre", "Ångström"}},
+	}
+	for _, test := range tests {
+		c := NewCollator(test.locale)
+		got := append([]string(nil), words...)
+		sort.Slice(got, func(i, j int) bool { return c.Compare(got[i], got[j]) < 0 })
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: %q, want %q", test.locale, got, test.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := map[string]string{
+		"Émile Zola":   "emile zola",
+		"Straße":       "strasse",
+		"Œuvres":       "oeuvres",
+		"Þór":          "thor",
+		"Ñandú":        "nandu",
+		"東京":           "東京",
+		"Hello, World": "hello, world",
+	}
+	for s, want := range tests {
+		if got := Fold(s); got != want {
+			t.Errorf("Fold(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,578 @@
+package opds2
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeedDiff list the changes between two versions of a feed
+type FeedDiff struct {
+	// Metadata are the changes of the feed metadata
+	Metadata   []Change    `json:"metadata,omitempty"`
+	Links      LinksDiff   `json:"links"`
+	Navigation LinksDiff   `json:"navigation"`
+	Facets     []FacetDiff `json:"facets,omitempty"`
+	Groups     []GroupDiff `json:"groups,omitempty"`
+	// Added, Removed and Modified are the publications of the feed and its
+	// groups, a publication moved to another group is not modified
+	Added    []Publication     `json:"added,omitempty"`
+	Removed  []Publication     `json:"removed,omitempty"`
+	Modified []PublicationDiff `json:"modified,omitempty"`
+}
+
+// Change is the change of a field, values are written as text
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %q", c.Field, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %q", c.Field, c.Old)
+	}
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// LinksDiff list the changes of a list of links matched by href
+type LinksDiff struct {
+	Added    []Link     `json:"added,omitempty"`
+	Removed  []Link     `json:"removed,omitempty"`
+	Modified []LinkDiff `json:"modified,omitempty"`
+}
+
+// LinkDiff is the changes of a link
+type LinkDiff struct {
+	Href    string   `json:"href"`
+	Changes []Change `json:"changes"`
+}
+
+// FacetDiff is the changes of the links of a facet group
+type FacetDiff struct {
+	Group string `json:"group"`
+	LinksDiff
+}
+
+// GroupDiff is the changes of a group matched by title, Added and Removed
+// are the keys of publications and the href of navigation links
+type GroupDiff struct {
+	Title    string   `json:"title"`
+	Metadata []Change `json:"metadata,omitempty"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// PublicationDiff is the changes of a publication
+type PublicationDiff struct {
+	// Key is the identifier or the acquisition href matching the two
+	// versions
+	Key     string   `json:"key"`
+	Title   string   `json:"title"`
+	Changes []Change `json:"changes"`
+}
+
+// Empty check if the feeds are the same
+func (d FeedDiff) Empty() bool {
+	return len(d.Metadata) == 0 && d.Links.empty() && d.Navigation.empty() && len(d.Facets) == 0 &&
+		len(d.Groups) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+func (d LinksDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Diff compare the feed a with its new version b, publications are
+// matched by identifier or by the href of their first acquisition link
+// when they have none
+func Diff(a, b *Feed) FeedDiff {
+	var d FeedDiff
+
+	d.Metadata = diffMetadata(a.Metadata, b.Metadata)
+	d.Links = diffLinks(a.Links, b.Links)
+	d.Navigation = diffLinks(a.Navigation, b.Navigation)
+	d.Facets = diffFacets(a.Facets, b.Facets)
+	d.Groups = diffGroups(a.Groups, b.Groups)
+
+	oldPublications, oldKeys := indexPublications(a)
+	newPublications, newKeys := indexPublications(b)
+	for _, key := range oldKeys {
+		if _, ok := newPublications[key]; !ok {
+			d.Removed = append(d.Removed, *oldPublications[key])
+		}
+	}
+	for _, key := range newKeys {
+		newP := newPublications[key]
+		oldP, ok := oldPublications[key]
+		if !ok {
+			d.Added = append(d.Added, *newP)
+			continue
+		}
+		if changes := diffPublication(oldP, newP); len(changes) > 0 {
+			d.Modified = append(d.Modified, PublicationDiff{Key: key, Title: newP.Metadata.Title.String(), Changes: changes})
+		}
+	}
+
+	return d
+}
+
+// Key return the key matching the versions of a publication, its
+// identifier, the href of its first acquisition link or its self link
+func (publication *Publication) Key() string {
+
+	if publication.Metadata.Identifier != "" {
+		return publication.Metadata.Identifier
+	}
+	for _, l := range publication.Links {
+		for _, r := range l.Rel {
+			if strings.HasPrefix(r, RelAcquisition) {
+				return l.Href
+			}
+		}
+	}
+	if self := publication.findFirstLinkByRel("self"); self.Href != "" {
+		return self.Href
+	}
+
+	return "title:" + publication.Metadata.Title.String()
+}
+
+// indexPublications index the publications of the feed and its groups by
+// key, the first one is kept when a key is used twice
+func indexPublications(feed *Feed) (map[string]*Publication, []string) {
+	index := make(map[string]*Publication)
+	var keys []string
+
+	add := func(p *Publication) {
+		key := p.Key()
+		if _, ok := index[key]; ok {
+			return
+		}
+		index[key] = p
+		keys = append(keys, key)
+	}
+	for i := range feed.Publications {
+		add(&feed.Publications[i])
+	}
+	for g := range feed.Groups {
+		for i := range feed.Groups[g].Publications {
+			add(&feed.Groups[g].Publications[i])
+		}
+	}
+
+	return index, keys
+}
+
+func diffMetadata(a, b Metadata) []Change {
+	var changes []Change
+
+	changes = appendChange(changes, "title", a.Title, b.Title)
+	changes = appendChange(changes, "@type", a.RDFType, b.RDFType)
+	changes = appendChange(changes, "numberOfItems", formatInt(a.NumberOfItems), formatInt(b.NumberOfItems))
+	changes = appendChange(changes, "itemsPerPage", formatInt(a.ItemsPerPage), formatInt(b.ItemsPerPage))
+	changes = appendChange(changes, "currentPage", formatInt(a.CurrentPage), formatInt(b.CurrentPage))
+	changes = appendChange(changes, "modified", formatTime(a.Modified), formatTime(b.Modified))
+
+	return changes
+}
+
+func diffPublication(a, b *Publication) []Change {
+	var changes []Change
+	ma, mb := &a.Metadata, &b.Metadata
+
+	changes = appendChange(changes, "title", formatMultiLanguage(ma.Title), formatMultiLanguage(mb.Title))
+	changes = appendChange(changes, "sort_as", ma.SortAs, mb.SortAs)
+	changes = appendChange(changes, "subtitle", formatSubtitle(ma.Subtitle), formatSubtitle(mb.Subtitle))
+	changes = appendChange(changes, "identifier", ma.Identifier, mb.Identifier)
+	changes = appendChange(changes, "@type", ma.RDFType, mb.RDFType)
+
+	roles := []struct {
+		name string
+		a, b []Contributor
+	}{
+		{"author", ma.Author, mb.Author}, {"translator", ma.Translator, mb.Translator},
+		{"editor", ma.Editor, mb.Editor}, {"artist", ma.Artist, mb.Artist},
+		{"illustrator", ma.Illustrator, mb.Illustrator}, {"letterer", ma.Letterer, mb.Letterer},
+		{"penciler", ma.Penciler, mb.Penciler}, {"colorist", ma.Colorist, mb.Colorist},
+		{"inker", ma.Inker, mb.Inker}, {"narrator", ma.Narrator, mb.Narrator},
+		{"contributor", ma.Contributor, mb.Contributor}, {"publisher", ma.Publisher, mb.Publisher},
+		{"imprint", ma.Imprint, mb.Imprint},
+	}
+	for _, role := range roles {
+		changes = appendChange(changes, role.name, formatContributors(role.a), formatContributors(role.b))
+	}
+
+	changes = appendChange(changes, "language", strings.Join(ma.Language, ", "), strings.Join(mb.Language, ", "))
+	changes = appendChange(changes, "modified", formatTime(ma.Modified), formatTime(mb.Modified))
+	changes = appendChange(changes, "published", formatTime(ma.PublicationDate), formatTime(mb.PublicationDate))
+	changes = appendChange(changes, "description", ma.Description, mb.Description)
+	changes = appendChange(changes, "source", ma.Source, mb.Source)
+	changes = appendChange(changes, "rights", ma.Rights, mb.Rights)
+	changes = appendChange(changes, "subject", formatSubjects(ma.Subject), formatSubjects(mb.Subject))
+	changes = appendChange(changes, "series", formatSeries(ma.BelongsTo, true), formatSeries(mb.BelongsTo, true))
+	changes = appendChange(changes, "collection", formatSeries(ma.BelongsTo, false), formatSeries(mb.BelongsTo, false))
+	changes = appendChange(changes, "duration", formatInt(ma.Duration), formatInt(mb.Duration))
+
+	// formats are the media types of the acquisition links, the one of the
+	// acquired resource for indirect acquisitions
+	changes = appendChange(changes, "formats", strings.Join(acquisitionFormats(a), ", "), strings.Join(acquisitionFormats(b), ", "))
+
+	changes = append(changes, diffLinksChanges("links", a.Links, b.Links)...)
+	changes = append(changes, diffLinksChanges("images", a.Images, b.Images)...)
+
+	return changes
+}
+
+// diffLinksChanges report the changes of links as changes of fields named
+// prefix[href]
+func diffLinksChanges(prefix string, a, b []Link) []Change {
+	var changes []Change
+
+	d := diffLinks(a, b)
+	for _, l := range d.Removed {
+		changes = append(changes, Change{Field: prefix + "[" + l.Href + "]", Old: formatLink(l)})
+	}
+	for _, l := range d.Added {
+		changes = append(changes, Change{Field: prefix + "[" + l.Href + "]", New: formatLink(l)})
+	}
+	for _, m := range d.Modified {
+		for _, c := range m.Changes {
+			c.Field = prefix + "[" + m.Href + "]." + c.Field
+			changes = append(changes, c)
+		}
+	}
+
+	return changes
+}
+
+// diffLinks match links by href, the first link is used when an href is
+// used twice
+func diffLinks(a, b []Link) LinksDiff {
+	var d LinksDiff
+
+	oldLinks := make(map[string]Link)
+	for _, l := range a {
+		if _, ok := oldLinks[l.Href]; !ok {
+			oldLinks[l.Href] = l
+		}
+	}
+	newLinks := make(map[string]Link)
+	for _, l := range b {
+		if _, ok := newLinks[l.Href]; !ok {
+			newLinks[l.Href] = l
+		}
+	}
+
+	for _, l := range a {
+		if _, ok := newLinks[l.Href]; !ok {
+			d.Removed = append(d.Removed, l)
+			// an href used twice is reported once
+			newLinks[l.Href] = l
+		}
+	}
+	for _, l := range b {
+		old, ok := oldLinks[l.Href]
+		if !ok {
+			d.Added = append(d.Added, l)
+			oldLinks[l.Href] = l
+			continue
+		}
+		if changes := diffLink(old, l); len(changes) > 0 {
+			d.Modified = append(d.Modified, LinkDiff{Href: l.Href, Changes: changes})
+			oldLinks[l.Href] = l
+		}
+	}
+
+	return d
+}
+
+func diffLink(a, b Link) []Change {
+	var changes []Change
+
+	changes = appendChange(changes, "type", a.TypeLink, b.TypeLink)
+	changes = appendChange(changes, "rel", strings.Join(a.Rel, " "), strings.Join(b.Rel, " "))
+	changes = appendChange(changes, "title", a.Title, b.Title)
+	changes = appendChange(changes, "templated", strconv.FormatBool(a.Templated), strconv.FormatBool(b.Templated))
+	changes = appendChange(changes, "width", formatInt(a.Width), formatInt(b.Width))
+	changes = appendChange(changes, "height", formatInt(a.Height), formatInt(b.Height))
+
+	pa, pb := a.Properties, b.Properties
+	if pa == nil {
+		pa = &Properties{}
+	}
+	if pb == nil {
+		pb = &Properties{}
+	}
+	changes = appendChange(changes, "numberOfItems", formatInt(pa.NumberOfItems), formatInt(pb.NumberOfItems))
+	changes = appendChange(changes, "price", formatPrice(pa.Price), formatPrice(pb.Price))
+	changes = appendChange(changes, "indirectAcquisition", formatIndirect(pa.IndirectAcquisition), formatIndirect(pb.IndirectAcquisition))
+
+	return changes
+}
+
+func diffFacets(a, b []Facet) []FacetDiff {
+	var diffs []FacetDiff
+
+	oldFacets := make(map[string]Facet)
+	for _, f := range a {
+		oldFacets[f.Metadata.Title] = f
+	}
+	newFacets := make(map[string]bool)
+	for _, f := range b {
+		newFacets[f.Metadata.Title] = true
+		d := diffLinks(oldFacets[f.Metadata.Title].Links, f.Links)
+		if !d.empty() {
+			diffs = append(diffs, FacetDiff{Group: f.Metadata.Title, LinksDiff: d})
+		}
+	}
+	for _, f := range a {
+		if !newFacets[f.Metadata.Title] {
+			diffs = append(diffs, FacetDiff{Group: f.Metadata.Title, LinksDiff: LinksDiff{Removed: f.Links}})
+		}
+	}
+
+	return diffs
+}
+
+func diffGroups(a, b []Group) []GroupDiff {
+	var diffs []GroupDiff
+
+	oldGroups := make(map[string]*Group)
+	for i := range a {
+		oldGroups[a[i].Metadata.Title] = &a[i]
+	}
+	newGroups := make(map[string]bool)
+	for i := range b {
+		g := &b[i]
+		newGroups[g.Metadata.Title] = true
+		old, ok := oldGroups[g.Metadata.Title]
+		if !ok {
+			old = &Group{}
+		}
+
+		d := GroupDiff{Title: g.Metadata.Title}
+		if ok {
+			d.Metadata = diffMetadata(old.Metadata, g.Metadata)
+		}
+		d.Added, d.Removed = diffKeys(groupKeys(old), groupKeys(g))
+		if len(d.Metadata) > 0 || len(d.Added) > 0 || len(d.Removed) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	for i := range a {
+		if !newGroups[a[i].Metadata.Title] {
+			diffs = append(diffs, GroupDiff{Title: a[i].Metadata.Title, Removed: groupKeys(&a[i])})
+		}
+	}
+
+	return diffs
+}
+
+// groupKeys return the keys of the publications and the href of the
+// navigation links of a group
+func groupKeys(g *Group) []string {
+	var keys []string
+	for i := range g.Publications {
+		keys = append(keys, g.Publications[i].Key())
+	}
+	for _, l := range g.Navigation {
+		keys = append(keys, l.Href)
+	}
+	return keys
+}
+
+// diffKeys return the keys only in b and the keys only in a
+func diffKeys(a, b []string) ([]string, []string) {
+	var added, removed []string
+
+	inA := make(map[string]bool)
+	for _, k := range a {
+		inA[k] = true
+	}
+	inB := make(map[string]bool)
+	for _, k := range b {
+		inB[k] = true
+		if !inA[k] {
+			added = append(added, k)
+		}
+	}
+	for _, k := range a {
+		if !inB[k] {
+			removed = append(removed, k)
+		}
+	}
+
+	return added, removed
+}
+
+func acquisitionFormats(p *Publication) []string {
+	var formats []string
+	seen := make(map[string]bool)
+
+	add := func(t string) {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			formats = append(formats, t)
+		}
+	}
+	for _, l := range p.Links {
+		acquisition := false
+		for _, r := range l.Rel {
+			if strings.HasPrefix(r, RelAcquisition) {
+				acquisition = true
+			}
+		}
+		if !acquisition {
+			continue
+		}
+		if l.Properties != nil && len(l.Properties.IndirectAcquisition) > 0 {
+			for _, ia := range l.Properties.IndirectAcquisition {
+				for _, t := range finalTypes(ia) {
+					add(t)
+				}
+			}
+			continue
+		}
+		add(l.TypeLink)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// finalTypes return the types at the end of an indirect acquisition chain
+func finalTypes(ia IndirectAcquisition) []string {
+	if len(ia.Child) == 0 {
+		return []string{ia.TypeAcquisition}
+	}
+	var types []string
+	for _, c := range ia.Child {
+		types = append(types, finalTypes(c)...)
+	}
+	return types
+}
+
+func appendChange(changes []Change, field string, a, b string) []Change {
+	if a == b {
+		return changes
+	}
+	return append(changes, Change{Field: field, Old: a, New: b})
+}
+
+func formatInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatMultiLanguage(m MultiLanguage) string {
+	if len(m.MultiString) == 0 {
+		return m.SingleString
+	}
+	var languages []string
+	for l := range m.MultiString {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+	var parts []string
+	for _, l := range languages {
+		parts = append(parts, l+": "+m.MultiString[l])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatSubtitle(m *MultiLanguage) string {
+	if m == nil {
+		return ""
+	}
+	return formatMultiLanguage(*m)
+}
+
+func formatContributors(contributors []Contributor) string {
+	var names []string
+	for _, c := range contributors {
+		name := formatMultiLanguage(c.Name)
+		if c.SortAs != "" {
+			name += " (" + c.SortAs + ")"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func formatSubjects(subjects []Subject) string {
+	var names []string
+	for _, s := range subjects {
+		name := s.Name
+		if s.Code != "" {
+			name += " [" + s.Scheme + " " + s.Code + "]"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func formatSeries(b *BelongsTo, series bool) string {
+	if b == nil {
+		return ""
+	}
+	collections := b.Collection
+	if series {
+		collections = b.Series
+	}
+	var names []string
+	for _, c := range collections {
+		name := c.Name
+		if c.Position != 0 {
+			name += " #" + strconv.FormatFloat(float64(c.Position), 'f', -1, 32)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func formatPrice(p *Price) string {
+	if p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(p.Value, 'f', -1, 64) + " " + p.Currency
+}
+
+func formatIndirect(indirect []IndirectAcquisition) string {
+	var parts []string
+	for _, ia := range indirect {
+		s := ia.TypeAcquisition
+		if len(ia.Child) > 0 {
+			s += " > " + formatIndirect(ia.Child)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatLink(l Link) string {
+	s := l.TypeLink
+	if len(l.Rel) > 0 {
+		s = strings.TrimSpace(s + " " + strings.Join(l.Rel, " "))
+	}
+	if l.Properties != nil && l.Properties.Price != nil {
+		s += " " + formatPrice(l.Properties.Price)
+	}
+	if s == "" {
+		return l.Href
+	}
+	return s
+}
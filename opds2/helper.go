@@ -1,5 +1,7 @@
 package opds2
 
+import "strings"
+
 // AddLink add a new link in feed information
 // at minimum the self link
 func (feed *Feed) AddLink(href string, rel string, typeLink string, templated bool) {
@@ -187,6 +189,9 @@ func (feed *Feed) AddPublicationInGroup(publication Publication, collLink Link)
 	}
 
 	group.Metadata.Title = collLink.Title
+	if collLink.Properties != nil {
+		group.Metadata.NumberOfItems = collLink.Properties.NumberOfItems
+	}
 	group.Publications = append(group.Publications, publication)
 	group.Links = append(group.Links, Link{Rel: []string{"self"}, Title: collLink.Title, Href: collLink.Href})
 	feed.Groups = append(feed.Groups, group)
@@ -206,7 +211,120 @@ func (feed *Feed) AddNavigationInGroup(link Link, collLink Link) {
 	}
 
 	group.Metadata.Title = collLink.Title
+	if collLink.Properties != nil {
+		group.Metadata.NumberOfItems = collLink.Properties.NumberOfItems
+	}
 	group.Navigation = append(group.Navigation, link)
 	group.Links = append(group.Links, Link{Rel: []string{"self"}, Title: collLink.Title, Href: collLink.Href})
 	feed.Groups = append(feed.Groups, group)
 }
+
+// FacetGroup return the facet group with the title group
+func (feed *Feed) FacetGroup(group string) (*Facet, bool) {
+
+	for i, f := range feed.Facets {
+		if f.Metadata.Title == group {
+			return &feed.Facets[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// FacetGroups return the title of every facet group
+func (feed *Feed) FacetGroups() []string {
+	var groups []string
+
+	for _, f := range feed.Facets {
+		groups = append(groups, f.Metadata.Title)
+	}
+
+	return groups
+}
+
+// ActiveFacet return the link of the facet group marked with the self
+// relation
+func (feed *Feed) ActiveFacet(group string) (Link, bool) {
+
+	f, ok := feed.FacetGroup(group)
+	if !ok {
+		return Link{}, false
+	}
+	for _, l := range f.Links {
+		if l.HasRel("self") {
+			return l, true
+		}
+	}
+
+	return Link{}, false
+}
+
+// SetActiveFacet mark the link of the facet group with href as the active
+// one using the self relation, the relation is removed from the other
+// links of the group, it return false when no link match
+func (feed *Feed) SetActiveFacet(group string, href string) bool {
+
+	f, ok := feed.FacetGroup(group)
+	if !ok {
+		return false
+	}
+
+	found := false
+	for _, l := range f.Links {
+		if l.Href == href {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+
+	for i, l := range f.Links {
+		var rels StringOrArray
+		for _, r := range l.Rel {
+			if r != "self" {
+				rels = append(rels, r)
+			}
+		}
+		if l.Href == href {
+			rels = append(StringOrArray{"self"}, rels...)
+		}
+		f.Links[i].Rel = rels
+	}
+
+	return true
+}
+
+// AddFacetFromTemplate add a facet link whose href is the expansion of
+// the template with vars, numberOfItems is set in the link properties
+// when positive
+func (feed *Feed) AddFacetFromTemplate(template Link, vars map[string]interface{}, title string, group string, numberOfItems int) error {
+	var l Link
+
+	href, err := template.Expand(vars)
+	if err != nil {
+		return err
+	}
+
+	l.Href = href
+	l.TypeLink = template.TypeLink
+	l.Title = title
+	if numberOfItems > 0 {
+		l.Properties = &Properties{NumberOfItems: numberOfItems}
+	}
+	feed.AddFacet(l, group)
+
+	return nil
+}
+
+// HasRel tell if rel is one of the relations of the link, relations are
+// compared case insensitively as RFC 8288 require for registered and
+// extension relation types
+func (l Link) HasRel(rel string) bool {
+	for _, r := range l.Rel {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package opds2
+
+import "testing"
+
+func TestLinkHasRel(t *testing.T) {
+	l := Link{Href: "/new", Rel: []string{"Next", "http://opds-spec.org/Acquisition"}}
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"next", true},
+		{"NEXT", true},
+		{"http://opds-spec.org/acquisition", true},
+		{"previous", false},
+		{"nex", false},
+	}
+	for _, test := range tests {
+		if got := l.HasRel(test.rel); got != test.want {
+			t.Errorf("HasRel(%q) = %v, want %v", test.rel, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package opds2
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ConflictPolicy choose the value kept when merged publications have
+// different values for a field
+type ConflictPolicy int
+
+const (
+	// PreferNewest keep the value of the publication modified last, the
+	// order of the feeds break ties and publications without date come last
+	PreferNewest ConflictPolicy = iota
+	// PreferSource keep the value of the preferred source, then follow the
+	// order of the feeds
+	PreferSource
+)
+
+// MergeOptions change the way feeds are merged
+type MergeOptions struct {
+	// Title of the merged feed, the title of the first feed when empty
+	Title  string
+	Policy ConflictPolicy
+	// Sources name the feeds in the provenance, by default the href of
+	// their self link or "feed 1", "feed 2"...
+	Sources []string
+	// PreferredSource is the name of the source used first with
+	// PreferSource
+	PreferredSource string
+}
+
+// Provenance give for the key of each merged publication the source of
+// its fields, the publications of a group have their key after
+// groups[title]/, fields are named like in JSON, links, images and
+// subjects are named links[href], images[href] and subject[name]
+type Provenance map[string]map[string]string
+
+// Merge aggregate feeds in one, publications with the same identifier or
+// ISBN are merged, as well as publications with the same title and first
+// author when one of them has no identifier: metadata fields are chosen
+// with the conflict policy while links, images and subjects are unioned. Groups,
+// facets and navigation are unioned by title and href. The merged feed
+// share nothing with the feeds.
+func Merge(opts MergeOptions, feeds ...*Feed) (Feed, Provenance) {
+	var feed Feed
+	provenance := make(Provenance)
+
+	sources := make([]string, len(feeds))
+	for i, f := range feeds {
+		switch {
+		case i < len(opts.Sources) && opts.Sources[i] != "":
+			sources[i] = opts.Sources[i]
+		case findLinkByRel(f.Links, "self").Href != "":
+			sources[i] = findLinkByRel(f.Links, "self").Href
+		default:
+			sources[i] = "feed " + strconv.Itoa(i+1)
+		}
+	}
+	m := merger{opts: opts, sources: sources, provenance: provenance}
+
+	feed.Metadata.Title = opts.Title
+	for i, f := range feeds {
+		if feed.Metadata.Title == "" {
+			feed.Metadata.Title = f.Metadata.Title
+		}
+		feed.Metadata.Modified = newest(feed.Metadata.Modified, f.Metadata.Modified)
+		if i == 0 {
+			feed.Context = f.Context
+			feed.Links = append(feed.Links, f.Links...)
+			continue
+		}
+		// the self and pagination links of the other feeds are not the
+		// one of the merged feed
+		for _, l := range f.Links {
+			if l.HasRel("self") || l.HasRel("next") || l.HasRel("previous") || l.HasRel("prev") || l.HasRel("first") || l.HasRel("last") {
+				continue
+			}
+			feed.Links = unionLinks(feed.Links, l)
+		}
+	}
+
+	var publications []sourcedPublication
+	for i, f := range feeds {
+		for j := range f.Publications {
+			publications = append(publications, sourcedPublication{&f.Publications[j], i})
+		}
+		for _, l := range f.Navigation {
+			feed.Navigation = unionLinks(feed.Navigation, l)
+		}
+		for _, facet := range f.Facets {
+			for _, l := range facet.Links {
+				if i > 0 {
+					// only the first feed tell which facet is active
+					l.Rel = removeRel(l.Rel, "self")
+				}
+				addFacetLink(&feed, facet.Metadata.Title, l)
+			}
+		}
+	}
+	feed.Publications = m.merge(publications, "")
+
+	var groups [][]sourcedPublication
+	for i, f := range feeds {
+		for _, g := range f.Groups {
+			index := -1
+			for k := range feed.Groups {
+				if feed.Groups[k].Metadata.Title == g.Metadata.Title {
+					index = k
+				}
+			}
+			if index < 0 {
+				feed.Groups = append(feed.Groups, Group{Metadata: Metadata{Title: g.Metadata.Title}})
+				groups = append(groups, nil)
+				index = len(feed.Groups) - 1
+			}
+			for _, l := range g.Links {
+				feed.Groups[index].Links = unionLinks(feed.Groups[index].Links, l)
+			}
+			for _, l := range g.Navigation {
+				feed.Groups[index].Navigation = unionLinks(feed.Groups[index].Navigation, l)
+			}
+			for j := range g.Publications {
+				groups[index] = append(groups[index], sourcedPublication{&g.Publications[j], i})
+			}
+		}
+	}
+	for k := range feed.Groups {
+		feed.Groups[k].Publications = m.merge(groups[k], "groups["+feed.Groups[k].Metadata.Title+"]/")
+	}
+
+	// links and metadata are copied from the feeds with their pointers,
+	// slices and maps
+	feed = deepCopy(reflect.ValueOf(feed)).Interface().(Feed)
+
+	return feed, provenance
+}
+
+type sourcedPublication struct {
+	publication *Publication
+	source      int
+}
+
+type merger struct {
+	opts       MergeOptions
+	sources    []string
+	provenance Provenance
+}
+
+// merge group the duplicated publications and merge each group, the
+// publications stay in the order of their first occurrence, prefix is
+// added to their key in the provenance
+func (m *merger) merge(publications []sourcedPublication, prefix string) []Publication {
+
+	// publications sharing a key are in the same set, the sets of a
+	// publication sharing keys with both are joined so A=B by ISBN and
+	// B=C by title put A, B and C together, the root of a set is its
+	// first publication
+	parent := make([]int, len(publications))
+	// identified tell if a publication of the set has an identifier
+	identified := make([]bool, len(publications))
+	for i, p := range publications {
+		parent[i] = i
+		identified[i] = p.publication.Metadata.Identifier != ""
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	union := func(i int, j int) {
+		ri, rj := find(i), find(j)
+		if ri > rj {
+			ri, rj = rj, ri
+		}
+		parent[rj] = ri
+		identified[ri] = identified[ri] || identified[rj]
+	}
+
+	first := make(map[string]int)
+	for i, p := range publications {
+		for _, k := range identifierKeys(p.publication) {
+			if j, ok := first[k]; ok {
+				union(i, j)
+			} else {
+				first[k] = i
+			}
+		}
+	}
+	// the title only join publications when one of them has no
+	// identifier, different identifiers are different publications
+	for i, p := range publications {
+		k := titleKey(p.publication)
+		if k == "" {
+			continue
+		}
+		j, ok := first[k]
+		if !ok {
+			first[k] = i
+			continue
+		}
+		ri, rj := find(i), find(j)
+		if ri != rj && !(identified[ri] && identified[rj]) {
+			union(i, j)
+		}
+	}
+
+	var duplicates [][]sourcedPublication
+	sets := make(map[int]int)
+	for i, p := range publications {
+		root := find(i)
+		k, ok := sets[root]
+		if !ok {
+			duplicates = append(duplicates, nil)
+			k = len(duplicates) - 1
+			sets[root] = k
+		}
+		duplicates[k] = append(duplicates[k], p)
+	}
+
+	var merged []Publication
+	for _, d := range duplicates {
+		merged = append(merged, m.mergePublication(d, prefix))
+	}
+
+	return merged
+}
+
+// mergePublication merge the versions of a publication, the metadata
+// fields are taken from the first version having them in the order of the
+// conflict policy
+func (m *merger) mergePublication(versions []sourcedPublication, prefix string) Publication {
+	var p Publication
+	fields := make(map[string]string)
+
+	m.order(versions)
+
+	merged := reflect.ValueOf(&p.Metadata).Elem()
+	metadataType := merged.Type()
+	for i := 0; i < metadataType.NumField(); i++ {
+		name := strings.Split(metadataType.Field(i).Tag.Get("json"), ",")[0]
+		if name == "subject" {
+			continue
+		}
+		for _, v := range versions {
+			value := reflect.ValueOf(&v.publication.Metadata).Elem().Field(i)
+			if !value.IsZero() {
+				merged.Field(i).Set(value)
+				fields[name] = m.sources[v.source]
+				break
+			}
+		}
+	}
+
+	subjects := make(map[string]bool)
+	for _, v := range versions {
+		for _, l := range v.publication.Links {
+			if l.HasRel("self") && findLinkByRel(p.Links, "self").Href != "" {
+				continue
+			}
+			if !hasHref(p.Links, l.Href) {
+				p.Links = append(p.Links, l)
+				fields["links["+l.Href+"]"] = m.sources[v.source]
+			}
+		}
+		for _, l := range v.publication.Images {
+			if !hasHref(p.Images, l.Href) {
+				p.Images = append(p.Images, l)
+				fields["images["+l.Href+"]"] = m.sources[v.source]
+			}
+		}
+		for _, s := range v.publication.Metadata.Subject {
+			key := strings.ToLower(s.Scheme + " " + s.Code)
+			if s.Code == "" {
+				key = strings.ToLower(s.Name)
+			}
+			if subjects[key] {
+				continue
+			}
+			subjects[key] = true
+			p.Metadata.Subject = append(p.Metadata.Subject, s)
+			fields["subject["+s.Name+"]"] = m.sources[v.source]
+		}
+	}
+
+	m.provenance[prefix+p.Key()] = fields
+
+	return p
+}
+
+// order sort the versions by preference
+func (m *merger) order(versions []sourcedPublication) {
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		if m.opts.Policy == PreferSource {
+			pi := m.sources[versions[i].source] == m.opts.PreferredSource
+			pj := m.sources[versions[j].source] == m.opts.PreferredSource
+			if pi != pj {
+				return pi
+			}
+			return versions[i].source < versions[j].source
+		}
+		mi, mj := versions[i].publication.Metadata.Modified, versions[j].publication.Metadata.Modified
+		if mi != nil && mj != nil && !mi.Equal(*mj) {
+			return mi.After(*mj)
+		}
+		if (mi == nil) != (mj == nil) {
+			return mi != nil
+		}
+		return versions[i].source < versions[j].source
+	})
+}
+
+// identifierKeys return the keys of the identifier of a publication, its
+// ISBN is also a key so the versions of an ISBN share one
+func identifierKeys(p *Publication) []string {
+	var keys []string
+
+	if p.Metadata.Identifier != "" {
+		keys = append(keys, "id:"+p.Metadata.Identifier)
+		if isbn := normalizeISBN(p.Metadata.Identifier); isbn != "" {
+			keys = append(keys, "isbn:"+isbn)
+		}
+	}
+
+	return keys
+}
+
+// titleKey return the key of the title and first author of a publication,
+// empty when it has no title or no author
+func titleKey(p *Publication) string {
+
+	title := normalizeText(p.Metadata.Title.String())
+	if title == "" || len(p.Metadata.Author) == 0 {
+		return ""
+	}
+	author := normalizeText(p.Metadata.Author[0].Name.String())
+	if author == "" {
+		return ""
+	}
+
+	return "title:" + title + "/" + author
+}
+
+// normalizeISBN return the ISBN-13 of an identifier like urn:isbn:,
+// isbn: or a bare ISBN-10 or ISBN-13, empty when it is not an ISBN
+func normalizeISBN(identifier string) string {
+
+	s := strings.ToLower(identifier)
+	s = strings.TrimPrefix(s, "urn:")
+	s = strings.TrimPrefix(s, "isbn:")
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+
+	for i, c := range s {
+		if (c < '0' || c > '9') && !(c == 'x' && i == 9 && len(s) == 10) {
+			return ""
+		}
+	}
+
+	switch len(s) {
+	case 13:
+		return s
+	case 10:
+		s = "978" + s[:9]
+		sum := 0
+		for i, c := range s {
+			d := int(c - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return s + strconv.Itoa((10-sum%10)%10)
+	}
+
+	return ""
+}
+
+// normalizeText lowercase s and keep its letters and digits separated by
+// single spaces
+func normalizeText(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// unionLinks add l to links when no link has its href
+func unionLinks(links []Link, l Link) []Link {
+	if hasHref(links, l.Href) {
+		return links
+	}
+	return append(links, l)
+}
+
+func hasHref(links []Link, href string) bool {
+	for _, l := range links {
+		if l.Href == href {
+			return true
+		}
+	}
+	return false
+}
+
+func removeRel(rels StringOrArray, rel string) StringOrArray {
+	var kept StringOrArray
+	for _, r := range rels {
+		if r != rel {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func addFacetLink(feed *Feed, group string, l Link) {
+	if facet, ok := feed.FacetGroup(group); ok && hasHref(facet.Links, l.Href) {
+		return
+	}
+	feed.AddFacet(l, group)
+}
+
+// deepCopy return a copy of v sharing no pointer, slice or map with it,
+// unexported fields like the ones of time.Time are copied as they are
+func deepCopy(v reflect.Value) reflect.Value {
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	}
+
+	return v
+}
+
+// newest return the latest of two dates, nil when both are nil
+func newest(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,125 @@
+package opds2
+
+import (
+	"testing"
+	"time"
+)
+
+func mergeTestPublication(identifier string, title string, author string, href string) Publication {
+	var p Publication
+	p.Metadata.Identifier = identifier
+	p.Metadata.Title.SingleString = title
+	if author != "" {
+		p.AddAuthor(author, "", "", "", "")
+	}
+	p.AddLink(href, "application/epub+zip", RelAcquisition, "")
+	return p
+}
+
+func TestMergeTransitive(t *testing.T) {
+	// a and b share an ISBN, b and c a title and author, a and c nothing
+	a := mergeTestPublication("urn:isbn:9780000000002", "Moby-Dick; or, The Whale", "Herman Melville", "http://a/moby.epub")
+	b := mergeTestPublication("0000000000", "Moby Dick", "Herman Melville", "http://b/moby.epub")
+	b.Metadata.Identifier = "978-0-00-000000-2"
+	c := mergeTestPublication("", "Moby dick", "HERMAN MELVILLE", "http://c/moby.epub")
+	other := mergeTestPublication("urn:isbn:9780000000019", "Typee", "Herman Melville", "http://a/typee.epub")
+
+	feeds := []Feed{New("a"), New("b"), New("c")}
+	feeds[0].Publications = []Publication{a, other}
+	feeds[1].Publications = []Publication{c}
+	feeds[2].Publications = []Publication{b}
+
+	merged, _ := Merge(MergeOptions{}, &feeds[0], &feeds[1], &feeds[2])
+	if len(merged.Publications) != 2 {
+		t.Fatalf("%d publications", len(merged.Publications))
+	}
+	if len(merged.Publications[0].Links) != 3 || merged.Publications[1].Metadata.Title.String() != "Typee" {
+		t.Errorf("publications = %+v", merged.Publications)
+	}
+}
+
+func TestMergeDifferentIdentifiers(t *testing.T) {
+	tests := []struct {
+		name         string
+		publications []Publication
+		want         int
+		identifier   string
+	}{
+		{"same title without author", []Publication{
+			mergeTestPublication("urn:isbn:9780140424393", "Poems", "", "http://a/poems.epub"),
+			mergeTestPublication("urn:isbn:9780375711497", "Poems", "", "http://b/poems.epub"),
+		}, 2, "urn:isbn:9780140424393"},
+		{"same title and author", []Publication{
+			mergeTestPublication("urn:isbn:9780140424393", "Poems", "Emily Dickinson", "http://a/poems.epub"),
+			mergeTestPublication("urn:isbn:9780375711497", "Poems", "Emily Dickinson", "http://b/poems.epub"),
+		}, 2, "urn:isbn:9780140424393"},
+		{"without identifier and author", []Publication{
+			mergeTestPublication("", "Poems", "", "http://a/poems.epub"),
+			mergeTestPublication("", "Poems", "", "http://b/poems.epub"),
+		}, 2, ""},
+		{"joined through a publication without identifier", []Publication{
+			mergeTestPublication("urn:isbn:9780140424393", "Poems", "Emily Dickinson", "http://a/poems.epub"),
+			mergeTestPublication("", "Poems", "Emily Dickinson", "http://c/poems.epub"),
+			mergeTestPublication("urn:isbn:9780375711497", "Poems", "Emily Dickinson", "http://b/poems.epub"),
+		}, 2, "urn:isbn:9780140424393"},
+	}
+	for _, test := range tests {
+		feed := New("a")
+		feed.Publications = test.publications
+		merged, _ := Merge(MergeOptions{}, &feed)
+		if len(merged.Publications) != test.want {
+			t.Errorf("%s: %d publications, want %d", test.name, len(merged.Publications), test.want)
+			continue
+		}
+		if merged.Publications[0].Metadata.Identifier != test.identifier {
+			t.Errorf("%s: identifier %q", test.name, merged.Publications[0].Metadata.Identifier)
+		}
+	}
+}
+
+func TestMergeCopy(t *testing.T) {
+	modified := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := mergeTestPublication("urn:isbn:9780000000002", "Moby Dick", "Herman Melville", "http://a/moby.epub")
+	p.Metadata.Modified = &modified
+	p.Links[0].Properties = &Properties{Price: &Price{Currency: "USD", Value: 1}}
+	p.Metadata.Title.MultiString = map[string]string{"en": "Moby Dick"}
+	feed := New("a")
+	feed.Publications = []Publication{p}
+	feed.AddLink("http://a/", "self", "application/opds+json", false)
+
+	merged, _ := Merge(MergeOptions{}, &feed)
+	m := &merged.Publications[0]
+	m.Links[0].Properties.Price.Value = 2
+	m.Links[0].Rel[0] = "changed"
+	m.Metadata.Author[0].Name.SingleString = "changed"
+	m.Metadata.Title.MultiString["en"] = "changed"
+	*m.Metadata.Modified = time.Time{}
+	merged.Links[0].Href = "changed"
+
+	source := feed.Publications[0]
+	if source.Links[0].Properties.Price.Value != 1 || source.Links[0].Rel[0] != RelAcquisition ||
+		source.Metadata.Author[0].Name.String() != "Herman Melville" || source.Metadata.Title.MultiString["en"] != "Moby Dick" ||
+		!source.Metadata.Modified.Equal(modified) || feed.Links[0].Href != "http://a/" {
+		t.Errorf("the source feed was modified: %+v", source)
+	}
+}
+
+func TestMergeProvenance(t *testing.T) {
+	a := mergeTestPublication("urn:isbn:9780000000002", "Moby Dick", "Herman Melville", "http://a/moby.epub")
+	b := mergeTestPublication("urn:isbn:9780000000002", "Moby Dick", "Herman Melville", "http://b/moby.epub")
+	b.Metadata.Description = "Call me Ishmael."
+
+	feedA, feedB := New("a"), New("b")
+	feedA.Publications = []Publication{a}
+	feedB.AddPublicationInGroup(b, Link{Href: "http://b/new", Title: "New"})
+
+	_, provenance := Merge(MergeOptions{Sources: []string{"a", "b"}}, &feedA, &feedB)
+	top := provenance["urn:isbn:9780000000002"]
+	group := provenance["groups[New]/urn:isbn:9780000000002"]
+	if top["title"] != "a" || top["links[http://a/moby.epub]"] != "a" || top["description"] != "" {
+		t.Errorf("provenance of the publication = %v", top)
+	}
+	if group["title"] != "b" || group["description"] != "b" {
+		t.Errorf("provenance of the publication in the group = %v", group)
+	}
+}
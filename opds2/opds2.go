@@ -4,6 +4,7 @@ package opds2
 
 import (
 	"encoding/json"
+	"sort"
 	"time"
 )
 
@@ -68,6 +69,8 @@ type Link struct {
 // Use also in Rendition for fxl
 type Properties struct {
 	NumberOfItems       int                   `json:"numberOfItems,omitempty"`
+	Description         string                `json:"description,omitempty"`
+	Modified            *time.Time            `json:"modified,omitempty"`
 	Price               *Price                `json:"price,omitempty"`
 	IndirectAcquisition []IndirectAcquisition `json:"indirectAcquisition,omitempty"`
 }
@@ -86,31 +89,36 @@ type Price struct {
 
 // PublicationMetadata for the default context in WebPub
 type PublicationMetadata struct {
-	RDFType         string        `json:"@type,omitempty"` //Defaults to schema.org for EBook
-	Title           MultiLanguage `json:"title"`
-	Identifier      string        `json:"identifier"`
-	Author          []Contributor `json:"author,omitempty"`
-	Translator      []Contributor `json:"translator,omitempty"`
-	Editor          []Contributor `json:"editor,omitempty"`
-	Artist          []Contributor `json:"artist,omitempty"`
-	Illustrator     []Contributor `json:"illustrator,omitempty"`
-	Letterer        []Contributor `json:"letterer,omitempty"`
-	Penciler        []Contributor `json:"penciler,omitempty"`
-	Colorist        []Contributor `json:"colorist,omitempty"`
-	Inker           []Contributor `json:"inker,omitempty"`
-	Narrator        []Contributor `json:"narrator,omitempty"`
-	Contributor     []Contributor `json:"contributor,omitempty"`
-	Publisher       []Contributor `json:"publisher,omitempty"`
-	Imprint         []Contributor `json:"imprint,omitempty"`
-	Language        StringOrArray `json:"language,omitempty"`
-	Modified        *time.Time    `json:"modified,omitempty"`
-	PublicationDate *time.Time    `json:"published,omitempty"`
-	Description     string        `json:"description,omitempty"`
-	Source          string        `json:"source,omitempty"`
-	Rights          string        `json:"rights,omitempty"`
-	Subject         []Subject     `json:"subject,omitempty"`
-	BelongsTo       *BelongsTo    `json:"belongs_to,omitempty"`
-	Duration        int           `json:"duration,omitempty"`
+	RDFType         string         `json:"@type,omitempty"` //Defaults to schema.org for EBook
+	Title           MultiLanguage  `json:"title"`
+	SortAs          string         `json:"sort_as,omitempty"`
+	Subtitle        *MultiLanguage `json:"subtitle,omitempty"`
+	Identifier      string         `json:"identifier"`
+	AltIdentifier   []string       `json:"altIdentifier,omitempty"`
+	Author          []Contributor  `json:"author,omitempty"`
+	Translator      []Contributor  `json:"translator,omitempty"`
+	Editor          []Contributor  `json:"editor,omitempty"`
+	Artist          []Contributor  `json:"artist,omitempty"`
+	Illustrator     []Contributor  `json:"illustrator,omitempty"`
+	Letterer        []Contributor  `json:"letterer,omitempty"`
+	Penciler        []Contributor  `json:"penciler,omitempty"`
+	Colorist        []Contributor  `json:"colorist,omitempty"`
+	Inker           []Contributor  `json:"inker,omitempty"`
+	Narrator        []Contributor  `json:"narrator,omitempty"`
+	Contributor     []Contributor  `json:"contributor,omitempty"`
+	Publisher       []Contributor  `json:"publisher,omitempty"`
+	Imprint         []Contributor  `json:"imprint,omitempty"`
+	Language        StringOrArray  `json:"language,omitempty"`
+	Modified        *time.Time     `json:"modified,omitempty"`
+	PublicationDate *time.Time     `json:"published,omitempty"`
+	Description     string         `json:"description,omitempty"`
+	Source          string         `json:"source,omitempty"`
+	Rights          string         `json:"rights,omitempty"`
+	Subject         []Subject      `json:"subject,omitempty"`
+	BelongsTo       *BelongsTo     `json:"belongs_to,omitempty"`
+	Duration        int            `json:"duration,omitempty"`
+	// Rating from 0 to 5, it is not defined by OPDS 2.0
+	Rating float64 `json:"rating,omitempty"`
 }
 
 // Contributor construct used internally for all contributors
@@ -166,11 +174,16 @@ func (m MultiLanguage) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m.SingleString)
 }
 
+// String return the single string or the translation in the first
+// language by alphabetical order so the result does not change
 func (m MultiLanguage) String() string {
 	if len(m.MultiString) > 0 {
-		for _, s := range m.MultiString {
-			return s
+		var languages []string
+		for l := range m.MultiString {
+			languages = append(languages, l)
 		}
+		sort.Strings(languages)
+		return m.MultiString[languages[0]]
 	}
 	return m.SingleString
 }
@@ -180,7 +193,7 @@ func (r StringOrArray) MarshalJSON() ([]byte, error) {
 	if len(r) == 1 {
 		return json.Marshal(r[0])
 	}
-	return json.Marshal(r)
+	return json.Marshal([]string(r))
 }
 
 func (publication *Publication) findFirstLinkByRel(rel string) Link {
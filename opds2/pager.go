@@ -0,0 +1,202 @@
+package opds2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/opds-community/libopds2-go/internal/pager"
+)
+
+// ErrPagerLoop is returned by a pager when a next link lead to a page
+// already read
+var ErrPagerLoop = errors.New("opds2: pagination loop")
+
+// Fetcher get the feed at an url
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Feed, error)
+}
+
+// FetcherFunc is a function used as a Fetcher
+type FetcherFunc func(ctx context.Context, url string) (*Feed, error)
+
+// Fetch call f
+func (f FetcherFunc) Fetch(ctx context.Context, url string) (*Feed, error) {
+	return f(ctx, url)
+}
+
+// HTTPFetcher fetch feeds over http, href are resolved against the url of
+// the feed
+type HTTPFetcher struct {
+	// Client is used for the requests, http.DefaultClient when nil
+	Client *http.Client
+	// Header is sent with every request
+	Header http.Header
+}
+
+// Fetch get and parse the feed at url
+func (f HTTPFetcher) Fetch(ctx context.Context, url string) (*Feed, error) {
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range f.Header {
+		request.Header[k] = v
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, errReq := client.Do(request)
+	if errReq != nil {
+		return nil, errReq
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("opds2: %s: %s", url, res.Status)
+	}
+
+	buff, errRead := ioutil.ReadAll(res.Body)
+	if errRead != nil {
+		return nil, errRead
+	}
+
+	return ParseBufferWithOptions(buff, ParseOptions{ResolveURLs: true, BaseURL: res.Request.URL.String()})
+}
+
+// Pager iterate over the publications of a paginated feed, the ones of
+// its groups come after the publications of each page, pages are fetched
+// when the publications of the previous one are consumed by following
+// their next link
+//
+//	pager := opds2.NewPager(ctx, opds2.HTTPFetcher{}, feed, feedURL)
+//	for pager.Next() {
+//		p := pager.Publication()
+//	}
+//	if pager.Err() != nil {
+//		// handle error, pager.Cursor() can be saved to resume later
+//	}
+type Pager struct {
+	// MaxPages is the maximum number of pages read, no limit when zero
+	MaxPages int
+
+	fetcher      Fetcher
+	page         *Feed
+	publications []Publication
+	pager        *pager.Pager
+}
+
+// NewPager create a pager starting at feed, pageURL is the url of the feed
+// used to resolve its next link, the self link is used when it is empty
+func NewPager(ctx context.Context, fetcher Fetcher, feed *Feed, pageURL string) *Pager {
+	p := newPager(ctx, fetcher)
+
+	if pageURL == "" {
+		pageURL = findLinkByRel(feed.Links, "self").Href
+	}
+	p.pager.SetPage(p.setPage(feed), pageURL)
+
+	return p
+}
+
+// ResumePager create a pager starting at the page cursor, usually saved
+// from Cursor, the page is fetched on the first call to Next
+func ResumePager(ctx context.Context, fetcher Fetcher, cursor string) *Pager {
+	p := newPager(ctx, fetcher)
+	p.pager.Resume(cursor)
+	return p
+}
+
+func newPager(ctx context.Context, fetcher Fetcher) *Pager {
+	p := &Pager{fetcher: fetcher}
+	p.pager = pager.New(ctx, p.fetch, ErrPagerLoop)
+	return p
+}
+
+// fetch get the page at url and make it the current page
+func (p *Pager) fetch(ctx context.Context, url string) (pager.Page, error) {
+	feed, err := p.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return pager.Page{}, err
+	}
+	return p.setPage(feed), nil
+}
+
+func (p *Pager) setPage(feed *Feed) pager.Page {
+	p.page = feed
+	p.publications = publications(feed)
+	return pager.Page{Items: len(p.publications), Next: findLinkByRel(feed.Links, "next").Href}
+}
+
+// publications return the publications of the feed followed by the ones
+// of its groups
+func publications(feed *Feed) []Publication {
+	if len(feed.Groups) == 0 {
+		return feed.Publications
+	}
+	all := append([]Publication(nil), feed.Publications...)
+	for _, g := range feed.Groups {
+		all = append(all, g.Publications...)
+	}
+	return all
+}
+
+// Next advance to the next publication fetching the next page when needed,
+// it return false at the end of the pagination or on error
+func (p *Pager) Next() bool {
+	return p.pager.Next(p.MaxPages)
+}
+
+// Publication return the current publication
+func (p *Pager) Publication() Publication {
+	i := p.pager.Index()
+	if i < 0 || i >= len(p.publications) {
+		return Publication{}
+	}
+	return p.publications[i]
+}
+
+// inGroup tell if the current publication is one of the groups of the page
+func (p *Pager) inGroup() bool {
+	return p.page != nil && p.pager.Index() >= len(p.page.Publications)
+}
+
+// Page return the page of the current publication
+func (p *Pager) Page() *Feed {
+	return p.page
+}
+
+// Cursor return the url of the page of the current publication, a pager
+// created with ResumePager and this cursor restart at the beginning of
+// the page
+func (p *Pager) Cursor() string {
+	return p.pager.Cursor()
+}
+
+// NextURL return the url of the page after the current one, empty at the
+// end of the pagination, it is the cursor to use to continue after the
+// MaxPages limit
+func (p *Pager) NextURL() string {
+	return p.pager.NextURL()
+}
+
+// Err return the error that stopped the pager
+func (p *Pager) Err() error {
+	return p.pager.Err()
+}
+
+func findLinkByRel(links []Link, rel string) Link {
+	for _, l := range links {
+		for _, r := range l.Rel {
+			if r == rel {
+				return l
+			}
+		}
+	}
+	return Link{}
+}
@@ -0,0 +1,128 @@
+package opds2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagerTestServer serve the feeds by path and query, the publications are
+// named by their identifier and next is the href of the next link
+func pagerTestServer(t *testing.T, pages map[string][]string, groups map[string][]string, next map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "pager" {
+			t.Errorf("%s: header %v", r.URL, r.Header)
+		}
+		page := r.URL.RequestURI()
+		identifiers, ok := pages[page]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		feed := New(page)
+		feed.AddLink(page, "self", "application/opds+json", false)
+		if next[page] != "" {
+			feed.AddLink(next[page], "next", "application/opds+json", false)
+		}
+		for _, id := range identifiers {
+			feed.Publications = append(feed.Publications, syncTestPublication(id, day(1)))
+		}
+		if len(groups[page]) > 0 {
+			group := Group{Metadata: Metadata{Title: "Featured"}}
+			for _, id := range groups[page] {
+				group.Publications = append(group.Publications, syncTestPublication(id, day(1)))
+			}
+			feed.Groups = append(feed.Groups, group)
+		}
+		json.NewEncoder(w).Encode(feed)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// day return a day of january 2020
+func day(d int) time.Time {
+	return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+// readPager return the identifiers of the publications read by the pager
+func readPager(pager *Pager) []string {
+	var ids []string
+	for pager.Next() {
+		ids = append(ids, pager.Publication().Metadata.Identifier)
+	}
+	return ids
+}
+
+func TestPager(t *testing.T) {
+	server := pagerTestServer(t,
+		map[string][]string{
+			"/1":     {"a", "b"},
+			"/2":     {},
+			"/3?x=1": {"c"},
+			"/loop":  {"d"},
+			"/error": {"e"},
+		},
+		map[string][]string{"/1": {"featured"}, "/2": {}},
+		map[string]string{
+			"/1":     "2",
+			"/2":     "/3?x=1",
+			"/loop":  "loop",
+			"/error": "missing",
+		})
+	ctx := context.Background()
+	fetcher := HTTPFetcher{Header: http.Header{"X-Test": {"pager"}}}
+
+	first, err := fetcher.Fetch(ctx, server.URL+"/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the self link is resolved by the fetcher and used as the url of the
+	// first page
+	pager := NewPager(ctx, fetcher, first, "")
+	if pager.Publication().Metadata.Identifier != "" {
+		t.Errorf("publication before Next %+v", pager.Publication())
+	}
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"a", "b", "featured", "c"}) || pager.Err() != nil {
+		t.Errorf("publications %q, error %v", ids, pager.Err())
+	}
+	if pager.Cursor() != server.URL+"/3?x=1" || pager.NextURL() != "" || pager.Page().Metadata.Title != "/3?x=1" {
+		t.Errorf("cursor %q, next %q", pager.Cursor(), pager.NextURL())
+	}
+
+	// resume after MaxPages
+	pager = ResumePager(ctx, fetcher, server.URL+"/1")
+	pager.MaxPages = 1
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"a", "b", "featured"}) || pager.NextURL() != server.URL+"/2" {
+		t.Errorf("publications %q, next %q", ids, pager.NextURL())
+	}
+	pager = ResumePager(ctx, fetcher, pager.NextURL())
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"c"}) || pager.Err() != nil {
+		t.Errorf("resumed: publications %q, error %v", ids, pager.Err())
+	}
+
+	pager = ResumePager(ctx, fetcher, server.URL+"/loop")
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"d"}) || pager.Err() != ErrPagerLoop {
+		t.Errorf("loop: publications %q, error %v", ids, pager.Err())
+	}
+
+	pager = ResumePager(ctx, fetcher, server.URL+"/error")
+	if ids := readPager(pager); !reflect.DeepEqual(ids, []string{"e"}) || pager.Err() == nil || !strings.Contains(pager.Err().Error(), "404") {
+		t.Errorf("error: publications %q, error %v", ids, pager.Err())
+	}
+	if pager.Cursor() != server.URL+"/error" || pager.NextURL() != server.URL+"/missing" {
+		t.Errorf("error: cursor %q, next %q", pager.Cursor(), pager.NextURL())
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	pager = ResumePager(canceled, fetcher, server.URL+"/1")
+	if pager.Next() || pager.Err() != context.Canceled {
+		t.Errorf("canceled: error %v", pager.Err())
+	}
+}
@@ -2,7 +2,6 @@ package opds2
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -10,8 +9,22 @@ import (
 	"time"
 )
 
+// ParseOptions change the way a feed is parsed
+type ParseOptions struct {
+	// ResolveURLs make every href of the feed absolute
+	ResolveURLs bool
+	// BaseURL is used instead of the feed url to resolve relative href
+	BaseURL string
+}
+
 // ParseURL parse the opds2 feed from an url
 func ParseURL(url string) (*Feed, error) {
+	return ParseURLWithOptions(url, ParseOptions{})
+}
+
+// ParseURLWithOptions parse the opds2 feed from an url, relative href
+// are resolved against the feed url when asked in options
+func ParseURLWithOptions(url string, opts ParseOptions) (*Feed, error) {
 
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -21,13 +34,19 @@ func ParseURL(url string) (*Feed, error) {
 	if errReq != nil {
 		return nil, errReq
 	}
+	defer res.Body.Close()
 
 	buff, errRead := ioutil.ReadAll(res.Body)
 	if errRead != nil {
 		return nil, errRead
 	}
 
-	feed, errParse := ParseBuffer(buff)
+	if opts.BaseURL == "" {
+		// follow redirection to get the real location of the feed
+		opts.BaseURL = res.Request.URL.String()
+	}
+
+	feed, errParse := ParseBufferWithOptions(buff, opts)
 	if errParse != nil {
 		return &Feed{}, errParse
 	}
@@ -58,31 +77,60 @@ func ParseFile(filePath string) (*Feed, error) {
 // ParseBuffer parse opds2 feed from a buffer of byte usually get
 // from a file or url
 func ParseBuffer(buff []byte) (*Feed, error) {
+	return ParseBufferWithOptions(buff, ParseOptions{})
+}
+
+// ParseBufferWithOptions parse opds2 feed from a buffer of byte, relative
+// href are resolved against opts.BaseURL when asked in options
+func ParseBufferWithOptions(buff []byte, opts ParseOptions) (*Feed, error) {
 	var feed Feed
 
 	errParse := json.Unmarshal(buff, &feed)
-
 	if errParse != nil {
-		fmt.Println(errParse)
+		return &feed, errParse
+	}
+
+	if opts.ResolveURLs {
+		errResolve := feed.ResolveURLs(opts.BaseURL)
+		if errResolve != nil {
+			return &feed, errResolve
+		}
 	}
 
 	return &feed, nil
 }
 
+// ParsePublicationBuffer parse a publication alone, like an OPDS 2.0
+// publication document or a Readium Web Publication Manifest, the reading
+// order and the resources of a manifest are ignored
+func ParsePublicationBuffer(buff []byte) (*Publication, error) {
+	var info map[string]interface{}
+
+	errParse := json.Unmarshal(buff, &info)
+	if errParse != nil {
+		return &Publication{}, errParse
+	}
+
+	p := parsePublication(info)
+	return &p, nil
+}
+
 // UnmarshalJSON make all unmarshalling by hand to handle all case
 func (feed *Feed) UnmarshalJSON(data []byte) error {
 	var info map[string]interface{}
 
-	json.Unmarshal(data, &info)
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
 
 	for k, v := range info {
 		switch k {
 		case "@context":
-			switch v.(type) {
+			switch context := v.(type) {
 			case string:
-				feed.Context = append(feed.Context, v.(string))
+				feed.Context = append(feed.Context, context)
 			case []string:
-				feed.Context = v.([]string)
+				feed.Context = context
 			}
 		case "metadata":
 			parseMetadata(&feed.Metadata, v)
@@ -104,30 +152,37 @@ func (feed *Feed) UnmarshalJSON(data []byte) error {
 
 func parseMetadata(m *Metadata, data interface{}) {
 
-	info := data.(map[string]interface{})
+	info, _ := data.(map[string]interface{})
 	for k, v := range info {
 		switch k {
 		case "title":
-			m.Title = v.(string)
+			m.Title, _ = v.(string)
 		case "numberOfItems":
-			m.NumberOfItems = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				m.NumberOfItems = int(n)
+			}
 		case "itemsPerPage":
-			m.ItemsPerPage = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				m.ItemsPerPage = int(n)
+			}
 		case "modified":
-			t, err := time.Parse(time.RFC3339, v.(string))
+			s, _ := v.(string)
+			t, err := time.Parse(time.RFC3339, s)
 			if err == nil {
 				m.Modified = &t
 			}
 		case "type":
-			m.RDFType = v.(string)
+			m.RDFType, _ = v.(string)
 		case "currentPage":
-			m.CurrentPage = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				m.CurrentPage = int(n)
+			}
 		}
 	}
 }
 
 func parseLinks(feed *Feed, data interface{}) {
-	infoA := data.([]interface{})
+	infoA, _ := data.([]interface{})
 	for _, vA := range infoA {
 		l := parseLink(vA)
 		feed.Links = append(feed.Links, l)
@@ -135,55 +190,73 @@ func parseLinks(feed *Feed, data interface{}) {
 }
 
 func parseLink(data interface{}) Link {
-	info := data.(map[string]interface{})
+	info, _ := data.(map[string]interface{})
 	l := Link{}
 	for k, v := range info {
 		switch k {
 		case "title":
-			l.Title = v.(string)
+			l.Title, _ = v.(string)
 		case "href":
-			l.Href = v.(string)
+			l.Href, _ = v.(string)
 		case "type":
-			l.TypeLink = v.(string)
+			l.TypeLink, _ = v.(string)
 		case "rel":
-			switch v.(type) {
+			switch rel := v.(type) {
 			case string:
-				l.Rel = append(l.Rel, v.(string))
+				l.Rel = append(l.Rel, rel)
 			case []string:
-				l.Rel = v.([]string)
+				l.Rel = rel
 			}
 		case "height":
-			l.Height = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				l.Height = int(n)
+			}
 		case "width":
-			l.Width = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				l.Width = int(n)
+			}
 		case "bitrate":
-			l.Bitrate = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				l.Bitrate = int(n)
+			}
 		case "duration":
-			l.Duration = strconv.FormatFloat(v.(float64), 'f', -1, 64)
+			if n, ok := v.(float64); ok {
+				l.Duration = strconv.FormatFloat(n, 'f', -1, 64)
+			}
 		case "templated":
-			l.Templated = v.(bool)
+			l.Templated, _ = v.(bool)
 		case "properties":
 			p := Properties{}
-			infoProp := v.(map[string]interface{})
+			infoProp, _ := v.(map[string]interface{})
 			for kp, vp := range infoProp {
 				switch kp {
 				case "numberOfItems":
-					p.NumberOfItems = int(vp.(float64))
+					if n, ok := vp.(float64); ok {
+						p.NumberOfItems = int(n)
+					}
+				case "description":
+					p.Description, _ = vp.(string)
+				case "modified":
+					s, _ := vp.(string)
+					t, err := time.Parse(time.RFC3339, s)
+					if err == nil {
+						p.Modified = &t
+					}
 				case "indirectAcquisition":
-					infoIndir := vp.([]interface{})
+					infoIndir, _ := vp.([]interface{})
 					for _, in := range infoIndir {
 						indir := parseIndirectAcquisition(in)
 						p.IndirectAcquisition = append(p.IndirectAcquisition, indir)
 					}
 				case "price":
 					pr := Price{}
-					infoPrice := vp.(map[string]interface{})
+					infoPrice, _ := vp.(map[string]interface{})
 					for kpr, vpr := range infoPrice {
 						switch kpr {
 						case "currency":
-							pr.Currency = vpr.(string)
+							pr.Currency, _ = vpr.(string)
 						case "value":
-							pr.Value = vpr.(float64)
+							pr.Value, _ = vpr.(float64)
 						}
 					}
 					p.Price = &pr
@@ -202,13 +275,13 @@ func parseLink(data interface{}) Link {
 func parseIndirectAcquisition(data interface{}) IndirectAcquisition {
 	var i IndirectAcquisition
 
-	info := data.(map[string]interface{})
+	info, _ := data.(map[string]interface{})
 	for k, v := range info {
 		switch k {
 		case "type":
-			i.TypeAcquisition = v.(string)
+			i.TypeAcquisition, _ = v.(string)
 		case "child":
-			infoA := v.([]interface{})
+			infoA, _ := v.([]interface{})
 			for _, in := range infoA {
 				indirect := parseIndirectAcquisition(in)
 				i.Child = append(i.Child, indirect)
@@ -220,16 +293,16 @@ func parseIndirectAcquisition(data interface{}) IndirectAcquisition {
 }
 
 func parseFacets(feed *Feed, data interface{}) {
-	info := data.([]interface{})
-	f := Facet{}
+	info, _ := data.([]interface{})
 	for _, fa := range info {
-		infoA := fa.(map[string]interface{})
+		f := Facet{}
+		infoA, _ := fa.(map[string]interface{})
 		for k, v := range infoA {
 			switch k {
 			case "metadata":
 				parseMetadata(&f.Metadata, v)
 			case "links":
-				infoAL := v.([]interface{})
+				infoAL, _ := v.([]interface{})
 				for _, vA := range infoAL {
 					l := parseLink(vA)
 					f.Links = append(f.Links, l)
@@ -241,28 +314,28 @@ func parseFacets(feed *Feed, data interface{}) {
 }
 
 func parseGroups(feed *Feed, data interface{}) {
-	info := data.([]interface{})
+	info, _ := data.([]interface{})
 	for _, ga := range info {
 		g := Group{}
-		infoA := ga.(map[string]interface{})
+		infoA, _ := ga.(map[string]interface{})
 		for k, v := range infoA {
 			switch k {
 			case "metadata":
 				parseMetadata(&g.Metadata, v)
 			case "links":
-				infoAL := v.([]interface{})
+				infoAL, _ := v.([]interface{})
 				for _, vA := range infoAL {
 					l := parseLink(vA)
 					g.Links = append(g.Links, l)
 				}
 			case "navigation":
-				infoAN := v.([]interface{})
+				infoAN, _ := v.([]interface{})
 				for _, vAN := range infoAN {
 					l := parseLink(vAN)
 					g.Navigation = append(g.Navigation, l)
 				}
 			case "publications":
-				infoP := v.([]interface{})
+				infoP, _ := v.([]interface{})
 				for _, vP := range infoP {
 					p := parsePublication(vP)
 					g.Publications = append(g.Publications, p)
@@ -274,7 +347,7 @@ func parseGroups(feed *Feed, data interface{}) {
 }
 
 func parsePublications(feed *Feed, data interface{}) {
-	info := data.([]interface{})
+	info, _ := data.([]interface{})
 	for _, fa := range info {
 		p := parsePublication(fa)
 		feed.Publications = append(feed.Publications, p)
@@ -284,19 +357,20 @@ func parsePublications(feed *Feed, data interface{}) {
 func parsePublication(data interface{}) Publication {
 	var p Publication
 
-	infoA := data.(map[string]interface{})
+	infoA, _ := data.(map[string]interface{})
 	for k, v := range infoA {
 		switch k {
 		case "metadata":
 			parsePublicationMetadata(&p.Metadata, v)
 		case "links":
-			infoAL := v.([]interface{})
+			infoAL, _ := v.([]interface{})
 			for _, vA := range infoAL {
 				l := parseLink(vA)
 				p.Links = append(p.Links, l)
 			}
 		case "images":
-			infoAL := v.([]interface{})
+			// images is null in publications marshalled without image
+			infoAL, _ := v.([]interface{})
 			for _, vA := range infoAL {
 				l := parseLink(vA)
 				p.Images = append(p.Images, l)
@@ -308,22 +382,28 @@ func parsePublication(data interface{}) Publication {
 }
 
 func parsePublicationMetadata(metadata *PublicationMetadata, data interface{}) {
-	info := data.(map[string]interface{})
+	info, _ := data.(map[string]interface{})
 	for k, v := range info {
 		switch k {
 		case "title": // handle multistring
-			metadata.Title.SingleString = v.(string)
+			metadata.Title = parseMultiLanguage(v)
+		case "subtitle":
+			subtitle := parseMultiLanguage(v)
+			metadata.Subtitle = &subtitle
+		case "sort_as":
+			metadata.SortAs, _ = v.(string)
 		case "identifier":
-			metadata.Identifier = v.(string)
+			metadata.Identifier, _ = v.(string)
 		case "@type":
-			metadata.RDFType = v.(string)
+			metadata.RDFType, _ = v.(string)
 		case "modified":
-			t, err := time.Parse(time.RFC3339, v.(string))
+			s, _ := v.(string)
+			t, err := time.Parse(time.RFC3339, s)
 			if err == nil {
 				metadata.Modified = &t
 			}
 		case "type":
-			metadata.RDFType = v.(string)
+			metadata.RDFType, _ = v.(string)
 		case "author":
 			c := parseContributors(v)
 			for _, cont := range c {
@@ -390,47 +470,58 @@ func parsePublicationMetadata(metadata *PublicationMetadata, data interface{}) {
 				metadata.Imprint = append(metadata.Imprint, cont)
 			}
 		case "language":
+			switch lang := v.(type) {
+			case string:
+				metadata.Language = append(metadata.Language, lang)
+			case []interface{}:
+				for _, l := range lang {
+					if s, ok := l.(string); ok {
+						metadata.Language = append(metadata.Language, s)
+					}
+				}
+			}
 		case "published":
-			t, err := time.Parse(time.RFC3339, v.(string))
+			s, _ := v.(string)
+			t, err := time.Parse(time.RFC3339, s)
 			if err == nil {
 				metadata.PublicationDate = &t
 			}
 		case "description":
-			metadata.Description = v.(string)
+			metadata.Description, _ = v.(string)
 		case "source":
-			metadata.Source = v.(string)
+			metadata.Source, _ = v.(string)
 		case "rights":
-			metadata.Rights = v.(string)
+			metadata.Rights, _ = v.(string)
 		case "subject":
-			infoS := v.([]interface{})
+			infoS, _ := v.([]interface{})
 			for _, sub := range infoS {
 				s := Subject{}
-				subject := sub.(map[string]interface{})
+				subject, _ := sub.(map[string]interface{})
 				for ks, vs := range subject {
 					switch ks {
 					case "name":
-						s.Name = vs.(string)
+						s.Name, _ = vs.(string)
 					case "sort_as":
-						s.SortAs = vs.(string)
+						s.SortAs, _ = vs.(string)
 					case "scheme":
-						s.Scheme = vs.(string)
+						s.Scheme, _ = vs.(string)
 					case "code":
-						s.Code = vs.(string)
+						s.Code, _ = vs.(string)
 					}
 				}
 				metadata.Subject = append(metadata.Subject, s)
 			}
 		case "belongs_to":
 			belong := BelongsTo{}
-			infoB := v.(map[string]interface{})
+			infoB, _ := v.(map[string]interface{})
 			for kb, vb := range infoB {
 				switch kb {
 				case "series":
-					switch vb.(type) {
+					switch collections := vb.(type) {
 					case string:
-						belong.Series = append(belong.Series, Collection{Name: vb.(string)})
+						belong.Series = append(belong.Series, Collection{Name: collections})
 					case []interface{}:
-						for _, colls := range vb.([]interface{}) {
+						for _, colls := range collections {
 							coll := parseCollection(colls)
 							belong.Series = append(belong.Series, coll)
 						}
@@ -439,11 +530,11 @@ func parsePublicationMetadata(metadata *PublicationMetadata, data interface{}) {
 						belong.Series = append(belong.Series, coll)
 					}
 				case "collection":
-					switch vb.(type) {
+					switch collections := vb.(type) {
 					case string:
-						belong.Collection = append(belong.Collection, Collection{Name: vb.(string)})
+						belong.Collection = append(belong.Collection, Collection{Name: collections})
 					case []interface{}:
-						for _, colls := range vb.([]interface{}) {
+						for _, colls := range collections {
 							coll := parseCollection(colls)
 							belong.Collection = append(belong.Collection, coll)
 						}
@@ -455,7 +546,24 @@ func parsePublicationMetadata(metadata *PublicationMetadata, data interface{}) {
 			}
 			metadata.BelongsTo = &belong
 		case "duration":
-			metadata.Duration = int(v.(float64))
+			if n, ok := v.(float64); ok {
+				metadata.Duration = int(n)
+			}
+		case "altIdentifier":
+			switch identifiers := v.(type) {
+			case string:
+				metadata.AltIdentifier = append(metadata.AltIdentifier, identifiers)
+			case []interface{}:
+				for _, i := range identifiers {
+					if s, ok := i.(string); ok {
+						metadata.AltIdentifier = append(metadata.AltIdentifier, s)
+					}
+				}
+			}
+		case "rating":
+			if n, ok := v.(float64); ok {
+				metadata.Rating = n
+			}
 		}
 	}
 }
@@ -463,19 +571,21 @@ func parsePublicationMetadata(metadata *PublicationMetadata, data interface{}) {
 func parseCollection(data interface{}) Collection {
 	var collection Collection
 
-	info := data.(map[string]interface{})
+	info, _ := data.(map[string]interface{})
 	for k, v := range info {
 		switch k {
 		case "name":
-			collection.Name = v.(string)
+			collection.Name, _ = v.(string)
 		case "sort_as":
-			collection.SortAs = v.(string)
+			collection.SortAs, _ = v.(string)
 		case "identifier":
-			collection.Identifier = v.(string)
+			collection.Identifier, _ = v.(string)
 		case "position":
-			collection.Position = float32(v.(float64))
+			if n, ok := v.(float64); ok {
+				collection.Position = float32(n)
+			}
 		case "links":
-			infoL := v.([]interface{})
+			infoL, _ := v.([]interface{})
 			for _, l := range infoL {
 				link := parseLink(l)
 				collection.Links = append(collection.Links, link)
@@ -486,17 +596,41 @@ func parseCollection(data interface{}) Collection {
 	return collection
 }
 
+// parseMultiLanguage parse a string or an object of strings by language
+func parseMultiLanguage(data interface{}) MultiLanguage {
+	var m MultiLanguage
+
+	switch v := data.(type) {
+	case string:
+		m.SingleString = v
+	case map[string]interface{}:
+		m.MultiString = make(map[string]string)
+		for language, s := range v {
+			if str, ok := s.(string); ok {
+				m.MultiString[language] = str
+			}
+		}
+	}
+
+	return m
+}
+
 func parseContributors(data interface{}) []Contributor {
 	var c []Contributor
 
-	switch data.(type) {
+	switch contributors := data.(type) {
 	case string:
 		cont := Contributor{}
-		cont.Name.SingleString = data.(string)
+		cont.Name.SingleString = contributors
 		c = append(c, cont)
 	case []interface{}:
-		infoA := data.([]interface{})
-		for _, i := range infoA {
+		for _, i := range contributors {
+			if name, ok := i.(string); ok {
+				cont := Contributor{}
+				cont.Name.SingleString = name
+				c = append(c, cont)
+				continue
+			}
 			cont := parseContributor(i)
 			c = append(c, cont)
 		}
@@ -510,29 +644,26 @@ func parseContributors(data interface{}) []Contributor {
 func parseContributor(data interface{}) Contributor {
 	var c Contributor
 
-	info := data.(map[string]interface{})
+	info, _ := data.(map[string]interface{})
 	for k, v := range info {
 		switch k {
 		case "name":
-			switch v.(type) {
-			case string:
-				c.Name.SingleString = v.(string)
-			case map[string]interface{}:
-				infoN := v.(map[string]interface{})
-				c.Name.MultiString = make(map[string]string)
-				for kn, vn := range infoN {
-					c.Name.MultiString[kn] = vn.(string)
-				}
-			}
+			c.Name = parseMultiLanguage(v)
 		case "identifier":
-			c.Identifier = v.(string)
+			c.Identifier, _ = v.(string)
 		case "sort_as":
-			c.SortAs = v.(string)
+			c.SortAs, _ = v.(string)
 		case "role":
-			c.Role = v.(string)
+			c.Role, _ = v.(string)
 		case "links":
-			l := parseLink(v)
-			c.Links = append(c.Links, l)
+			switch links := v.(type) {
+			case []interface{}:
+				for _, l := range links {
+					c.Links = append(c.Links, parseLink(l))
+				}
+			case map[string]interface{}:
+				c.Links = append(c.Links, parseLink(v))
+			}
 		}
 	}
 
@@ -540,7 +671,7 @@ func parseContributor(data interface{}) Contributor {
 }
 
 func parseNavigation(feed *Feed, data interface{}) {
-	infoA := data.([]interface{})
+	infoA, _ := data.([]interface{})
 	for _, vA := range infoA {
 		l := parseLink(vA)
 		feed.Navigation = append(feed.Navigation, l)
@@ -0,0 +1,99 @@
+package opds2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// values of the wrong type are skipped like missing values
+func TestParseBufferWrongTypes(t *testing.T) {
+	tests := []string{
+		`{"metadata":{"title":1}}`,
+		`{"metadata":"x"}`,
+		`{"metadata":{"title":"t"},"links":[{"href":1}]}`,
+		`{"metadata":{"title":"t"},"publications":[{"metadata":{"identifier":123}}]}`,
+		`{"metadata":{"title":"t"},"publications":[{"metadata":{"title":"p","duration":"PT1H"}}]}`,
+		`{"metadata":{"title":"t"},"groups":[{"metadata":{"title":2}}]}`,
+		`{"metadata":{"title":"t"},"facets":"x"}`,
+		`{"metadata":{"title":"t"},"publications":[1,{"metadata":{"author":[1,{"name":2}],"belongs_to":{"series":[1]},"subject":[1]}}]}`,
+		`{"metadata":{"title":"t"},"links":[1,{"properties":{"price":{"value":"1"},"indirectAcquisition":[1]}}]}`,
+	}
+	for _, test := range tests {
+		if _, err := ParseBuffer([]byte(test)); err != nil {
+			t.Errorf("%s: %v", test, err)
+		}
+	}
+
+	feed, err := ParseBuffer([]byte(`{"metadata":{"title":"t","numberOfItems":"2"},"links":[{"href":1,"rel":"self","type":"application/opds+json"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Metadata.Title != "t" || feed.Metadata.NumberOfItems != 0 {
+		t.Errorf("metadata = %+v", feed.Metadata)
+	}
+	if len(feed.Links) != 1 || feed.Links[0].Href != "" || !feed.Links[0].HasRel("self") || feed.Links[0].TypeLink != "application/opds+json" {
+		t.Errorf("links = %+v", feed.Links)
+	}
+
+	if _, err := ParseBuffer([]byte(`[]`)); err == nil {
+		t.Error("an array is not a feed")
+	}
+}
+
+func TestParsePublicationBufferWrongTypes(t *testing.T) {
+	p, err := ParsePublicationBuffer([]byte(`{"metadata":{"title":"t","identifier":123,"duration":"PT1H","language":["en",2]},"images":[1,{"href":"c.jpg","width":"1"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Metadata.Title.String() != "t" || p.Metadata.Identifier != "" || p.Metadata.Duration != 0 || len(p.Metadata.Language) != 1 {
+		t.Errorf("metadata = %+v", p.Metadata)
+	}
+	if len(p.Images) != 2 || p.Images[1].Href != "c.jpg" || p.Images[1].Width != 0 {
+		t.Errorf("images = %+v", p.Images)
+	}
+
+	if _, err := ParsePublicationBuffer([]byte(`"x"`)); err == nil {
+		t.Error("a string is not a publication")
+	}
+}
+
+func TestParseFacets(t *testing.T) {
+	feed, err := ParseBuffer([]byte(`{"metadata":{"title":"t"},"links":[],"facets":[
+		{"metadata":{"title":"Language"},"links":[{"href":"/en","title":"English"},{"href":"/fr","title":"French"}]},
+		{"metadata":{"title":"Sort"},"links":[{"href":"/new","title":"New"}]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Facets) != 2 || len(feed.Facets[0].Links) != 2 || len(feed.Facets[1].Links) != 1 {
+		t.Errorf("facets = %+v", feed.Facets)
+	}
+}
+
+func TestParseAltIdentifierAndRating(t *testing.T) {
+	var p Publication
+	p.Metadata.Title.SingleString = "Moby Dick"
+	p.Metadata.AltIdentifier = []string{"goodreads:153747", "urn:uuid:2b0d4a6e-0000-4000-8000-000000000001"}
+	p.Metadata.Rating = 4.5
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParsePublicationBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.Metadata.AltIdentifier, p.Metadata.AltIdentifier) || parsed.Metadata.Rating != 4.5 {
+		t.Errorf("%s: metadata = %+v", data, parsed.Metadata)
+	}
+
+	parsed, err = ParsePublicationBuffer([]byte(`{"metadata":{"title":"t","altIdentifier":"isbn:1","rating":"5"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.Metadata.AltIdentifier, []string{"isbn:1"}) || parsed.Metadata.Rating != 0 {
+		t.Errorf("metadata = %+v", parsed.Metadata)
+	}
+}
@@ -0,0 +1,335 @@
+package opds2
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// PublicationFilter tell if a publication is kept by a query
+type PublicationFilter func(p *Publication) bool
+
+// PublicationOrder compare two publications, it is negative when a is
+// before b, zero when they are equal and positive when a is after b
+type PublicationOrder func(a, b *Publication) int
+
+// FilterPublications return the publications kept by every filter
+func FilterPublications(publications []Publication, filters ...PublicationFilter) []Publication {
+	var kept []Publication
+
+	for i := range publications {
+		keep := true
+		for _, filter := range filters {
+			if !filter(&publications[i]) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, publications[i])
+		}
+	}
+
+	return kept
+}
+
+// SortPublications sort publications by the first order, the following
+// ones are used when publications are equal, the sort is stable
+func SortPublications(publications []Publication, orders ...PublicationOrder) {
+	sort.SliceStable(publications, func(i, j int) bool {
+		for _, order := range orders {
+			if c := order(&publications[i], &publications[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// FilterPublications return the publications of the feed kept by every
+// filter, the publications of the groups are not included
+func (feed *Feed) FilterPublications(filters ...PublicationFilter) []Publication {
+	return FilterPublications(feed.Publications, filters...)
+}
+
+// SortPublications sort the publications of the feed
+func (feed *Feed) SortPublications(orders ...PublicationOrder) {
+	SortPublications(feed.Publications, orders...)
+}
+
+// FilterPublications return the publications of the group kept by every
+// filter
+func (group *Group) FilterPublications(filters ...PublicationFilter) []Publication {
+	return FilterPublications(group.Publications, filters...)
+}
+
+// SortPublications sort the publications of the group
+func (group *Group) SortPublications(orders ...PublicationOrder) {
+	SortPublications(group.Publications, orders...)
+}
+
+// HasLanguage keep the publications in one of the languages, "en" match
+// "en-US" but "en-US" does not match "en"
+func HasLanguage(languages ...string) PublicationFilter {
+	return func(p *Publication) bool {
+		for _, l := range p.Metadata.Language {
+			l = strings.ToLower(l)
+			for _, language := range languages {
+				language = strings.ToLower(language)
+				if l == language || strings.HasPrefix(l, language+"-") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// HasSubject keep the publications with a subject of the scheme and code,
+// any scheme match when scheme is empty
+func HasSubject(scheme string, code string) PublicationFilter {
+	return func(p *Publication) bool {
+		for _, s := range p.Metadata.Subject {
+			if (scheme == "" || s.Scheme == scheme) && s.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HasAuthor keep the publications with an author of this name, sort_as or
+// identifier, names are compared without case and accents
+func HasAuthor(name string) PublicationFilter {
+	return func(p *Publication) bool {
+		return hasContributor(p.Metadata.Author, name)
+	}
+}
+
+// HasPublisher keep the publications with a publisher of this name or
+// identifier
+func HasPublisher(name string) PublicationFilter {
+	return func(p *Publication) bool {
+		return hasContributor(p.Metadata.Publisher, name)
+	}
+}
+
+func hasContributor(contributors []Contributor, name string) bool {
+	c := NewCollator("")
+	for _, contributor := range contributors {
+		if contributor.Identifier != "" && contributor.Identifier == name {
+			return true
+		}
+		if c.equal(contributor.SortAs, name) || c.equal(contributor.Name.SingleString, name) {
+			return true
+		}
+		for _, n := range contributor.Name.MultiString {
+			if c.equal(n, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InSeries keep the publications of the series with this name or
+// identifier
+func InSeries(name string) PublicationFilter {
+	c := NewCollator("")
+	return func(p *Publication) bool {
+		if p.Metadata.BelongsTo == nil {
+			return false
+		}
+		for _, s := range p.Metadata.BelongsTo.Series {
+			if (s.Identifier != "" && s.Identifier == name) || c.equal(s.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PriceBetween keep the publications with an acquisition link priced
+// between min and max included in the currency, any currency match when it
+// is empty
+func PriceBetween(min float64, max float64, currency string) PublicationFilter {
+	return func(p *Publication) bool {
+		for _, l := range p.Links {
+			if l.Properties == nil || l.Properties.Price == nil || !isAcquisitionLink(l) {
+				continue
+			}
+			price := l.Properties.Price
+			if currency != "" && !strings.EqualFold(price.Currency, currency) {
+				continue
+			}
+			if price.Value >= min && price.Value <= max {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HasMediaType keep the publications with an acquisition link to one of
+// the media types, directly or through an indirect acquisition
+func HasMediaType(types ...string) PublicationFilter {
+	return func(p *Publication) bool {
+		for _, format := range acquisitionFormats(p) {
+			for _, t := range types {
+				if strings.EqualFold(strings.SplitN(format, ";", 2)[0], strings.SplitN(t, ";", 2)[0]) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// PublishedBetween keep the publications published between from and to
+// included, a zero time leave the range open
+func PublishedBetween(from time.Time, to time.Time) PublicationFilter {
+	return func(p *Publication) bool {
+		return inRange(p.Metadata.PublicationDate, from, to)
+	}
+}
+
+// ModifiedBetween keep the publications modified between from and to
+// included, a zero time leave the range open
+func ModifiedBetween(from time.Time, to time.Time) PublicationFilter {
+	return func(p *Publication) bool {
+		return inRange(p.Metadata.Modified, from, to)
+	}
+}
+
+func inRange(t *time.Time, from time.Time, to time.Time) bool {
+	if t == nil {
+		return false
+	}
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+// ByTitle order publications by their sort_as or their title in the
+// language of the collator locale when the title has translations
+func ByTitle(locale string) PublicationOrder {
+	c := NewCollator(locale)
+	return func(a, b *Publication) int {
+		return c.Compare(titleSortKey(a, locale), titleSortKey(b, locale))
+	}
+}
+
+func titleSortKey(p *Publication, locale string) string {
+	if p.Metadata.SortAs != "" {
+		return p.Metadata.SortAs
+	}
+	if title, ok := p.Metadata.Title.MultiString[locale]; ok {
+		return title
+	}
+	if p.Metadata.Title.SingleString != "" {
+		return p.Metadata.Title.SingleString
+	}
+	return p.Metadata.Title.String()
+}
+
+// ByAuthor order publications by the sort_as or the name of their first
+// author, publications without author come last
+func ByAuthor(locale string) PublicationOrder {
+	c := NewCollator(locale)
+	return func(a, b *Publication) int {
+		ka, kb := authorSortKey(a), authorSortKey(b)
+		switch {
+		case ka == kb:
+			return 0
+		case ka == "":
+			return 1
+		case kb == "":
+			return -1
+		}
+		return c.Compare(ka, kb)
+	}
+}
+
+func authorSortKey(p *Publication) string {
+	if len(p.Metadata.Author) == 0 {
+		return ""
+	}
+	if p.Metadata.Author[0].SortAs != "" {
+		return p.Metadata.Author[0].SortAs
+	}
+	return p.Metadata.Author[0].Name.String()
+}
+
+// ByPublished order publications from the oldest to the newest, the
+// publications without date come last
+func ByPublished(a, b *Publication) int {
+	return compareTimes(a.Metadata.PublicationDate, b.Metadata.PublicationDate)
+}
+
+// ByModified order publications from the oldest to the newest
+// modification, the publications without date come last
+func ByModified(a, b *Publication) int {
+	return compareTimes(a.Metadata.Modified, b.Metadata.Modified)
+}
+
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
+
+// BySeries order publications by the name of their first series then by
+// their position in it, publications without series come last
+func BySeries(locale string) PublicationOrder {
+	c := NewCollator(locale)
+	return func(a, b *Publication) int {
+		sa, sb := firstSeries(a), firstSeries(b)
+		switch {
+		case sa == nil && sb == nil:
+			return 0
+		case sa == nil:
+			return 1
+		case sb == nil:
+			return -1
+		}
+		na, nb := sa.Name, sb.Name
+		if sa.SortAs != "" {
+			na = sa.SortAs
+		}
+		if sb.SortAs != "" {
+			nb = sb.SortAs
+		}
+		if n := c.Compare(na, nb); n != 0 {
+			return n
+		}
+		switch {
+		case sa.Position < sb.Position:
+			return -1
+		case sa.Position > sb.Position:
+			return 1
+		}
+		return 0
+	}
+}
+
+func firstSeries(p *Publication) *Collection {
+	if p.Metadata.BelongsTo == nil || len(p.Metadata.BelongsTo.Series) == 0 {
+		return nil
+	}
+	return &p.Metadata.BelongsTo.Series[0]
+}
+
+// Reverse invert an order
+func Reverse(order PublicationOrder) PublicationOrder {
+	return func(a, b *Publication) int {
+		return order(b, a)
+	}
+}
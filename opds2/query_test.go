@@ -0,0 +1,137 @@
+package opds2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// queryTestPublication return a publication with a title, an author and a
+// publication year, an empty author leave the publication without author
+func queryTestPublication(identifier string, title string, author string, sortAs string, year int) Publication {
+	var p Publication
+	p.Metadata.Identifier = identifier
+	p.Metadata.Title.SingleString = title
+	if author != "" {
+		p.AddAuthor(author, "", sortAs, "", "")
+	}
+	if year > 0 {
+		published := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		p.Metadata.PublicationDate = &published
+	}
+	return p
+}
+
+func queryIdentifiers(publications []Publication) []string {
+	var ids []string
+	for _, p := range publications {
+		ids = append(ids, p.Metadata.Identifier)
+	}
+	return ids
+}
+
+func TestSortPublications(t *testing.T) {
+	publications := []Publication{
+		queryTestPublication("1", "Zazie dans le métro", "Raymond Queneau", "Queneau, Raymond", 1959),
+		queryTestPublication("2", "Émile", "Jean-Jacques Rousseau", "Rousseau, Jean-Jacques", 1762),
+		queryTestPublication("3", "Emile", "Anonymous", "", 0),
+		queryTestPublication("4", "Åkerbär", "", "", 1900),
+		queryTestPublication("5", "Candide", "Voltaire", "", 1759),
+		queryTestPublication("6", "Candide", "Anonymous", "", 1800),
+		queryTestPublication("7", "Ärlig", "Voltaire", "", 0),
+	}
+	sortAs := queryTestPublication("8", "The Castle", "Franz Kafka", "Kafka, Franz", 1926)
+	sortAs.Metadata.SortAs = "Castle, The"
+	publications = append(publications, sortAs)
+
+	tests := []struct {
+		name   string
+		orders []PublicationOrder
+		want   []string
+	}{
+		// titles equal but for their accents are ordered by code points,
+		// the same titles keep their order
+		{"title", []PublicationOrder{ByTitle("")}, []string{"4", "7", "5", "6", "8", "3", "2", "1"}},
+		{"swedish title", []PublicationOrder{ByTitle("sv")}, []string{"5", "6", "8", "3", "2", "1", "4", "7"}},
+		{"title then author", []PublicationOrder{ByTitle(""), ByAuthor("")}, []string{"4", "7", "6", "5", "8", "3", "2", "1"}},
+
+		// the same authors keep their order, no author come last
+		{"author", []PublicationOrder{ByAuthor("")}, []string{"3", "6", "8", "1", "2", "5", "7", "4"}},
+		{"author then title", []PublicationOrder{ByAuthor(""), ByTitle("sv")}, []string{"6", "3", "8", "1", "2", "5", "7", "4"}},
+		{"author then published", []PublicationOrder{ByAuthor(""), ByPublished}, []string{"6", "3", "8", "1", "2", "5", "7", "4"}},
+		{"reversed author", []PublicationOrder{Reverse(ByAuthor(""))}, []string{"4", "5", "7", "2", "1", "8", "3", "6"}},
+
+		{"published", []PublicationOrder{ByPublished}, []string{"5", "2", "6", "4", "8", "1", "3", "7"}},
+	}
+	for _, test := range tests {
+		sorted := append([]Publication(nil), publications...)
+		SortPublications(sorted, test.orders...)
+		if got := queryIdentifiers(sorted); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBySeries(t *testing.T) {
+	series := func(identifier string, name string, sortAs string, position float32) Publication {
+		p := queryTestPublication(identifier, identifier, "", "", 0)
+		if name != "" {
+			p.AddSerie(name, position, "", "")
+			p.Metadata.BelongsTo.Series[0].SortAs = sortAs
+		}
+		return p
+	}
+	publications := []Publication{
+		series("1", "The Sea", "Sea, The", 2),
+		series("2", "", "", 0),
+		series("3", "Rougon-Macquart", "", 10),
+		series("4", "Sea, The", "", 1),
+		series("5", "Rougon-Macquart", "", 2),
+	}
+	SortPublications(publications, BySeries(""))
+	if got, want := queryIdentifiers(publications), []string{"5", "3", "4", "1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
+
+func TestFilterPublications(t *testing.T) {
+	price := func(p Publication, rel string, value float64, currency string) Publication {
+		p.AddLink("https://example.com/"+p.Metadata.Identifier+".epub", "application/epub+zip", rel, "")
+		p.Links[len(p.Links)-1].Properties = &Properties{Price: &Price{Currency: currency, Value: value}}
+		return p
+	}
+	withLanguage := func(p Publication, languages ...string) Publication {
+		p.Metadata.Language = languages
+		return p
+	}
+	publications := []Publication{
+		price(withLanguage(queryTestPublication("1", "Émile", "Jean-Jacques Rousseau", "Rousseau, Jean-Jacques", 1762), "fr"), RelBuy, 4.99, "EUR"),
+		price(withLanguage(queryTestPublication("2", "Moby Dick", "Herman Melville", "", 1851), "en-US"), RelBuy, 9.99, "USD"),
+		price(withLanguage(queryTestPublication("3", "Zazie", "Raymond Queneau", "", 1959), "fr-CA", "en"), RelSample, 1, "EUR"),
+		withLanguage(queryTestPublication("4", "Untitled", "", "", 0), "en"),
+	}
+
+	tests := []struct {
+		name    string
+		filters []PublicationFilter
+		want    []string
+	}{
+		{"language prefix", []PublicationFilter{HasLanguage("EN")}, []string{"2", "3", "4"}},
+		{"language region", []PublicationFilter{HasLanguage("en-us")}, []string{"2"}},
+		{"languages", []PublicationFilter{HasLanguage("fr", "de")}, []string{"1", "3"}},
+		{"author name", []PublicationFilter{HasAuthor("JEAN-JACQUES ROUSSEAU")}, []string{"1"}},
+		{"author sort as", []PublicationFilter{HasAuthor("Rousseau, Jean-Jacques")}, []string{"1"}},
+		{"author accents", []PublicationFilter{HasAuthor("Raymond Quéneau")}, []string{"3"}},
+		{"price", []PublicationFilter{PriceBetween(0, 5, "")}, []string{"1", "3"}},
+		{"price range", []PublicationFilter{PriceBetween(2, 5, "")}, []string{"1"}},
+		{"price currency", []PublicationFilter{PriceBetween(0, 10, "usd")}, []string{"2"}},
+		{"published", []PublicationFilter{PublishedBetween(time.Date(1800, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{})}, []string{"2", "3"}},
+		{"every filter", []PublicationFilter{HasLanguage("en"), PublishedBetween(time.Time{}, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC))}, []string{"2"}},
+		{"none", []PublicationFilter{HasAuthor("Voltaire")}, nil},
+	}
+	for _, test := range tests {
+		if got := queryIdentifiers(FilterPublications(publications, test.filters...)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package opds2
+
+import (
+	"net/url"
+	"strings"
+)
+
+// WalkLinks call fn on every link of the feed (links, images, contributor
+// and collection links, facets, groups and navigation), the link can be
+// modified in place and walking stop at the first error
+func (feed *Feed) WalkLinks(fn func(l *Link) error) error {
+
+	err := walkLinks(feed.Links, fn)
+	if err != nil {
+		return err
+	}
+	err = walkLinks(feed.Navigation, fn)
+	if err != nil {
+		return err
+	}
+
+	for i := range feed.Facets {
+		err = walkLinks(feed.Facets[i].Links, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range feed.Groups {
+		g := &feed.Groups[i]
+		err = walkLinks(g.Links, fn)
+		if err != nil {
+			return err
+		}
+		err = walkLinks(g.Navigation, fn)
+		if err != nil {
+			return err
+		}
+		for j := range g.Publications {
+			err = g.Publications[j].WalkLinks(fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range feed.Publications {
+		err = feed.Publications[i].WalkLinks(fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkLinks call fn on every link of the publication
+func (publication *Publication) WalkLinks(fn func(l *Link) error) error {
+
+	err := walkLinks(publication.Links, fn)
+	if err != nil {
+		return err
+	}
+	err = walkLinks(publication.Images, fn)
+	if err != nil {
+		return err
+	}
+
+	m := &publication.Metadata
+	contributors := [][]Contributor{m.Author, m.Translator, m.Editor, m.Artist,
+		m.Illustrator, m.Letterer, m.Penciler, m.Colorist, m.Inker, m.Narrator,
+		m.Contributor, m.Publisher, m.Imprint}
+	for _, cs := range contributors {
+		for i := range cs {
+			err = walkLinks(cs[i].Links, fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.BelongsTo != nil {
+		for _, colls := range [][]Collection{m.BelongsTo.Series, m.BelongsTo.Collection} {
+			for i := range colls {
+				err = walkLinks(colls[i].Links, fn)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func walkLinks(links []Link, fn func(l *Link) error) error {
+
+	for i := range links {
+		err := fn(&links[i])
+		if err != nil {
+			return err
+		}
+
+		err = walkLinks(links[i].Children, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RewriteHrefs call rewrite on every href of the feed and replace it
+// with the returned value
+func (feed *Feed) RewriteHrefs(rewrite func(href string) (string, error)) error {
+	return feed.WalkLinks(rewriteHref(rewrite))
+}
+
+// RewriteHrefs call rewrite on every href of the publication and replace
+// it with the returned value
+func (publication *Publication) RewriteHrefs(rewrite func(href string) (string, error)) error {
+	return publication.WalkLinks(rewriteHref(rewrite))
+}
+
+func rewriteHref(rewrite func(href string) (string, error)) func(l *Link) error {
+	return func(l *Link) error {
+		href, err := rewrite(l.Href)
+		if err != nil {
+			return err
+		}
+		l.Href = href
+		return nil
+	}
+}
+
+// ResolveURLs make every relative href of the feed absolute using base
+func (feed *Feed) ResolveURLs(base string) error {
+
+	if base == "" {
+		return nil
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+
+	return feed.RewriteHrefs(func(href string) (string, error) {
+		return resolveHref(baseURL, href)
+	})
+}
+
+// RelativizeURLs make href relative to base when they share the same
+// scheme and host, it is the reverse of ResolveURLs and is useful
+// before publishing a feed at the location base
+func (feed *Feed) RelativizeURLs(base string) error {
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+
+	return feed.RewriteHrefs(func(href string) (string, error) {
+		return relativizeHref(baseURL, href)
+	})
+}
+
+func resolveHref(base *url.URL, href string) (string, error) {
+
+	if href == "" {
+		return href, nil
+	}
+
+	// keep uri template expression out of the resolution, only the
+	// part before the first expression is a real url
+	template := ""
+	if i := strings.Index(href, "{"); i >= 0 {
+		if i == 0 {
+			return href, nil
+		}
+		href, template = href[:i], href[i:]
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(u).String() + template, nil
+}
+
+func relativizeHref(base *url.URL, href string) (string, error) {
+
+	template := ""
+	if i := strings.Index(href, "{"); i >= 0 {
+		href, template = href[:i], href[i:]
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() || u.Scheme != base.Scheme || u.Host != base.Host || u.User.String() != base.User.String() {
+		return href + template, nil
+	}
+
+	rel := relativePath(base.EscapedPath(), u.EscapedPath())
+	if rel == "" {
+		// an empty reference would point to base itself, not its directory
+		rel = "./"
+	}
+	if u.RawQuery != "" {
+		rel += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		rel += "#" + u.EscapedFragment()
+	}
+
+	return rel + template, nil
+}
+
+// relativePath compute the path of target relative to the directory
+// of base
+func relativePath(base string, target string) string {
+
+	if base == "" {
+		base = "/"
+	}
+	if target == "" {
+		target = "/"
+	}
+
+	baseDir := strings.Split(base[:strings.LastIndex(base, "/")+1], "/")
+	targetSegs := strings.Split(target, "/")
+
+	// baseDir always end with an empty segment after the last slash
+	baseDir = baseDir[:len(baseDir)-1]
+
+	common := 0
+	for common < len(baseDir) && common < len(targetSegs)-1 && baseDir[common] == targetSegs[common] {
+		common++
+	}
+
+	var rel []string
+	for i := common; i < len(baseDir); i++ {
+		rel = append(rel, "..")
+	}
+	rel = append(rel, targetSegs[common:]...)
+
+	result := strings.Join(rel, "/")
+	if strings.Contains(strings.SplitN(result, "/", 2)[0], ":") {
+		// a first segment with a colon would be read as a scheme
+		result = "./" + result
+	}
+
+	return result
+}
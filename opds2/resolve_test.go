@@ -0,0 +1,134 @@
+package opds2
+
+import (
+	"reflect"
+	"testing"
+)
+
+// resolveTestFeed return a feed with href at every place a link can be
+func resolveTestFeed(href string) Feed {
+	feed := New("feed")
+	feed.AddLink(href, "self", "application/opds+json", false)
+	feed.AddNavigation("navigation", href, "", "")
+	feed.AddFacet(Link{Href: href, Title: "facet"}, "facets")
+
+	var p Publication
+	p.AddLink(href, "application/epub+zip", RelOpenAccess, "")
+	p.Links[0].Children = []Link{{Href: href}}
+	p.AddImage(href, "image/jpeg", 0, 0)
+	p.AddAuthor("author", "", "", href, "")
+	p.AddSerie("series", 1, href, "")
+	feed.Publications = append(feed.Publications, p)
+	feed.AddPublicationInGroup(p, Link{Href: href, Title: "group"})
+
+	return feed
+}
+
+// resolveTestHrefs return the href of every link of the feed
+func resolveTestHrefs(feed *Feed) []string {
+	var hrefs []string
+	feed.WalkLinks(func(l *Link) error {
+		hrefs = append(hrefs, l.Href)
+		return nil
+	})
+	return hrefs
+}
+
+func TestResolveURLs(t *testing.T) {
+	base := "https://example.com/catalog/feed.json?page=2"
+	tests := []struct {
+		href string
+		want string
+	}{
+		{"", ""},
+		{"new.json", "https://example.com/catalog/new.json"},
+		{"../covers/moby.jpg", "https://example.com/covers/moby.jpg"},
+		{"/search", "https://example.com/search"},
+		{"?page=3", "https://example.com/catalog/feed.json?page=3"},
+		{"#top", "https://example.com/catalog/feed.json?page=2#top"},
+		{"//cdn.example.com/moby.epub", "https://cdn.example.com/moby.epub"},
+		{"http://other.example.com/feed.json", "http://other.example.com/feed.json"},
+		{"mailto:books@example.com", "mailto:books@example.com"},
+		// only the part before the first expression of a template is
+		// resolved, the expressions are left untouched
+		{"search{?query,page}", "https://example.com/catalog/search{?query,page}"},
+		{"../search?lang=en{&query}", "https://example.com/search?lang=en{&query}"},
+		{"/books/{id}/{+path}", "https://example.com/books/{id}/{+path}"},
+		{"{+base}/search", "{+base}/search"},
+	}
+	for _, test := range tests {
+		feed := resolveTestFeed(test.href)
+		n := len(resolveTestHrefs(&feed))
+		if err := feed.ResolveURLs(base); err != nil {
+			t.Errorf("%q: %v", test.href, err)
+			continue
+		}
+		hrefs := resolveTestHrefs(&feed)
+		for i, href := range hrefs {
+			if href != test.want {
+				t.Errorf("%q: link %d resolved as %q, want %q", test.href, i, href, test.want)
+				break
+			}
+		}
+		if len(hrefs) != n {
+			t.Errorf("%q: %d links, want %d", test.href, len(hrefs), n)
+		}
+	}
+
+	feed := resolveTestFeed("new.json")
+	if err := feed.ResolveURLs(""); err != nil || feed.Links[0].Href != "new.json" {
+		t.Errorf("empty base: %q, %v", feed.Links[0].Href, err)
+	}
+	if err := feed.ResolveURLs("https://example.com/%zz"); err == nil {
+		t.Error("no error for an invalid base")
+	}
+	feed = resolveTestFeed("https://example.com/%zz")
+	if err := feed.ResolveURLs(base); err == nil {
+		t.Error("no error for an invalid href")
+	}
+}
+
+func TestRelativizeURLs(t *testing.T) {
+	base := "https://example.com/catalog/feed.json"
+	tests := []struct {
+		href string
+		want string
+	}{
+		{"https://example.com/catalog/new.json", "new.json"},
+		{"https://example.com/catalog/", "./"},
+		{"https://example.com/catalog/feed.json?page=2#top", "feed.json?page=2#top"},
+		{"https://example.com/covers/moby%20dick.jpg", "../covers/moby%20dick.jpg"},
+		{"https://example.com/", "../"},
+		{"https://example.com/catalog/sub/feed.json", "sub/feed.json"},
+		{"http://example.com/catalog/new.json", "http://example.com/catalog/new.json"},
+		{"https://cdn.example.com/catalog/new.json", "https://cdn.example.com/catalog/new.json"},
+		{"new.json", "new.json"},
+		{"mailto:books@example.com", "mailto:books@example.com"},
+		// the expressions of a template are left untouched
+		{"https://example.com/catalog/search{?query}", "search{?query}"},
+		{"https://example.com/search?lang=en{&query}", "../search?lang=en{&query}"},
+		{"{+base}/search", "{+base}/search"},
+	}
+	for _, test := range tests {
+		feed := resolveTestFeed(test.href)
+		if err := feed.RelativizeURLs(base); err != nil {
+			t.Errorf("%q: %v", test.href, err)
+			continue
+		}
+		hrefs := resolveTestHrefs(&feed)
+		for i, href := range hrefs {
+			if href != test.want {
+				t.Errorf("%q: link %d relativized as %q, want %q", test.href, i, href, test.want)
+				break
+			}
+		}
+
+		// resolving a relativized href give back the href resolved
+		original := Feed{Links: []Link{{Href: test.href}}}
+		original.ResolveURLs(base)
+		resolved := Feed{Links: []Link{{Href: hrefs[0]}}}
+		if err := resolved.ResolveURLs(base); err != nil || !reflect.DeepEqual(resolved.Links, original.Links) {
+			t.Errorf("%q: resolved back as %q, %v", test.href, resolved.Links[0].Href, err)
+		}
+	}
+}
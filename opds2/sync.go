@@ -0,0 +1,152 @@
+package opds2
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// SyncState is the state of a synchronization saved between two runs, the
+// zero value synchronize the whole feed
+type SyncState struct {
+	// FeedModified is the modification date of the feed at the last
+	// synchronization, the feed is not read again until it change
+	FeedModified time.Time `json:"feedModified"`
+	// LastModified is the latest modification date of the publications, the
+	// dates of the server are used to not depend on the clocks
+	LastModified time.Time `json:"lastModified"`
+	// Known are the keys of the publications already synchronized with
+	// their modification date, zero when they have none
+	Known map[string]time.Time `json:"known"`
+}
+
+// SyncEventType is the kind of change of a publication
+type SyncEventType int
+
+const (
+	// SyncAdd is sent for a publication not known yet
+	SyncAdd SyncEventType = iota
+	// SyncUpdate is sent for a known publication modified since the
+	// previous synchronization
+	SyncUpdate
+	// SyncDelete is sent for a known publication no longer in the feed
+	SyncDelete
+)
+
+func (t SyncEventType) String() string {
+	switch t {
+	case SyncAdd:
+		return "add"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// SyncEvent is a change of a publication, Publication is empty for
+// deletions
+type SyncEvent struct {
+	Type        SyncEventType
+	Key         string
+	Publication Publication
+}
+
+// SyncOptions change the way a feed is synchronized
+type SyncOptions struct {
+	// SortedByModified tell that the feed list the publications modified
+	// last first, the synchronization stop at the first publication older
+	// than the checkpoint instead of reading every page
+	SortedByModified bool
+	// MaxPages is the maximum number of pages read, no limit when zero
+	MaxPages int
+}
+
+// Sync walk the paginated feed at url and call emit for each publication
+// added or modified since the state was saved, the new state is returned
+// and should be saved when there is no error.
+//
+// The feed is not read when its modification date is not after the one
+// saved in the state. Deletions are only known when every page is read, they are
+// not sent when the synchronization stop early with SortedByModified or
+// MaxPages. An error returned by emit stop the synchronization.
+func Sync(ctx context.Context, fetcher Fetcher, url string, state SyncState, opts SyncOptions, emit func(e SyncEvent) error) (SyncState, error) {
+
+	feed, err := fetcher.Fetch(ctx, url)
+	if err != nil {
+		return state, err
+	}
+	if len(state.Known) > 0 && feed.Metadata.Modified != nil && !feed.Metadata.Modified.After(state.FeedModified) {
+		return state, nil
+	}
+
+	next := SyncState{FeedModified: state.FeedModified, LastModified: state.LastModified, Known: make(map[string]time.Time)}
+	if feed.Metadata.Modified != nil {
+		next.FeedModified = *feed.Metadata.Modified
+	}
+
+	pager := NewPager(ctx, fetcher, feed, url)
+	pager.MaxPages = opts.MaxPages
+	complete := true
+	for pager.Next() {
+		p := pager.Publication()
+		key := p.Key()
+		if _, ok := next.Known[key]; ok {
+			// a publication moved to a later page while walking the feed
+			continue
+		}
+
+		var modified time.Time
+		if p.Metadata.Modified != nil {
+			modified = *p.Metadata.Modified
+		}
+		// the publications of the groups are not in the order of the feed
+		if opts.SortedByModified && !pager.inGroup() && !state.LastModified.IsZero() && !modified.IsZero() && modified.Before(state.LastModified) {
+			complete = false
+			break
+		}
+		next.Known[key] = modified
+		if modified.After(next.LastModified) {
+			next.LastModified = modified
+		}
+
+		known, ok := state.Known[key]
+		switch {
+		case !ok:
+			err = emit(SyncEvent{Type: SyncAdd, Key: key, Publication: p})
+		case modified.After(known):
+			err = emit(SyncEvent{Type: SyncUpdate, Key: key, Publication: p})
+		}
+		if err != nil {
+			return state, err
+		}
+	}
+	if pager.Err() != nil {
+		return state, pager.Err()
+	}
+	if pager.NextURL() != "" {
+		// stopped by MaxPages
+		complete = false
+	}
+
+	var deleted []string
+	for key, modified := range state.Known {
+		if _, ok := next.Known[key]; ok {
+			continue
+		}
+		if complete {
+			deleted = append(deleted, key)
+		} else {
+			next.Known[key] = modified
+		}
+	}
+	sort.Strings(deleted)
+	for _, key := range deleted {
+		if err := emit(SyncEvent{Type: SyncDelete, Key: key}); err != nil {
+			return state, err
+		}
+	}
+
+	return next, nil
+}
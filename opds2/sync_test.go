@@ -0,0 +1,121 @@
+package opds2
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func syncTestFeed(modified time.Time, publications ...Publication) *Feed {
+	feed := New("feed")
+	feed.Metadata.Modified = &modified
+	feed.Publications = publications
+	return &feed
+}
+
+func syncTestPublication(identifier string, modified time.Time) Publication {
+	var p Publication
+	p.Metadata.Identifier = identifier
+	p.Metadata.Title.SingleString = identifier
+	p.Metadata.Modified = &modified
+	return p
+}
+
+func TestSync(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	// the feed is dated after its publications
+	feeds := []*Feed{
+		syncTestFeed(day(10), syncTestPublication("b", day(5)), syncTestPublication("a", day(1))),
+		syncTestFeed(day(10), syncTestPublication("b", day(5)), syncTestPublication("a", day(1))),
+		syncTestFeed(day(11), syncTestPublication("c", day(7)), syncTestPublication("b", day(5))),
+	}
+	tests := [][]string{
+		{"add b", "add a"},
+		{},
+		{"add c", "delete a"},
+	}
+
+	var state SyncState
+	for i, feed := range feeds {
+		fetcher := FetcherFunc(func(ctx context.Context, url string) (*Feed, error) { return feed, nil })
+		var events []string
+		next, err := Sync(context.Background(), fetcher, "http://example.com/", state, SyncOptions{}, func(e SyncEvent) error {
+			events = append(events, e.Type.String()+" "+e.Key)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != len(tests[i]) {
+			t.Fatalf("sync %d: events = %v, want %v", i, events, tests[i])
+		}
+		for j := range events {
+			if events[j] != tests[i][j] {
+				t.Errorf("sync %d: events = %v, want %v", i, events, tests[i])
+			}
+		}
+		state = next
+	}
+	if !state.FeedModified.Equal(day(11)) || !state.LastModified.Equal(day(7)) {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+func TestSyncSortedByModified(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	state := SyncState{
+		FeedModified: day(10),
+		LastModified: day(5),
+		Known:        map[string]time.Time{"b": day(5), "a": day(1)},
+	}
+	feed := syncTestFeed(day(11), syncTestPublication("c", day(7)), syncTestPublication("b", day(5)), syncTestPublication("a", day(1)))
+	fetcher := FetcherFunc(func(ctx context.Context, url string) (*Feed, error) { return feed, nil })
+
+	var events []string
+	next, err := Sync(context.Background(), fetcher, "http://example.com/", state, SyncOptions{SortedByModified: true}, func(e SyncEvent) error {
+		events = append(events, e.Type.String()+" "+e.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0] != "add c" {
+		t.Errorf("events = %v", events)
+	}
+	if len(next.Known) != 3 || !next.LastModified.Equal(day(7)) {
+		t.Errorf("state = %+v", next)
+	}
+}
+
+func TestSyncSortedByModifiedGroups(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	state := SyncState{
+		FeedModified: day(10),
+		LastModified: day(5),
+		Known:        map[string]time.Time{"b": day(5)},
+	}
+	// the publications of a group are not sorted with the ones of the feed
+	first := syncTestFeed(day(11), syncTestPublication("c", day(7)))
+	first.AddLink("http://example.com/2", "next", "application/opds+json", false)
+	first.Groups = []Group{{Metadata: Metadata{Title: "Featured"}, Publications: []Publication{syncTestPublication("old", day(1))}}}
+	second := syncTestFeed(day(11), syncTestPublication("d", day(6)), syncTestPublication("b", day(5)), syncTestPublication("a", day(1)))
+	fetcher := FetcherFunc(func(ctx context.Context, url string) (*Feed, error) {
+		if url == "http://example.com/2" {
+			return second, nil
+		}
+		return first, nil
+	})
+
+	var events []string
+	_, err := Sync(context.Background(), fetcher, "http://example.com/", state, SyncOptions{SortedByModified: true}, func(e SyncEvent) error {
+		events = append(events, e.Type.String()+" "+e.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"add c", "add old", "add d"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
@@ -0,0 +1,357 @@
+package opds2
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// templateOperator hold the expansion rules of an operator of RFC 6570
+// as described in its appendix A
+type templateOperator struct {
+	first    string
+	sep      string
+	named    bool
+	ifEmpty  string
+	reserved bool
+}
+
+var templateOperators = map[byte]templateOperator{
+	'+': {"", ",", false, "", true},
+	'#': {"#", ",", false, "", true},
+	'.': {".", ".", false, "", false},
+	'/': {"/", "/", false, "", false},
+	';': {";", ";", true, "", false},
+	'?': {"?", "&", true, "=", false},
+	'&': {"&", "&", true, "=", false},
+}
+
+type templateVariable struct {
+	name    string
+	prefix  int
+	explode bool
+}
+
+type templateExpression struct {
+	op        templateOperator
+	variables []templateVariable
+}
+
+// Expand build the url of a templated link from the values of vars
+// following RFC 6570 up to level 4, values are strings, numbers, booleans,
+// lists ([]string or []interface{}) or associative arrays (map[string]string
+// or map[string]interface{}) whose keys are sorted, missing, nil and empty
+// lists or maps are undefined
+func (l Link) Expand(vars map[string]interface{}) (string, error) {
+	var result strings.Builder
+
+	err := parseTemplate(l.Href, func(literal string) {
+		result.WriteString(encodeTemplateValue(literal, true))
+	}, func(e templateExpression) error {
+		s, errExpand := e.expand(vars)
+		result.WriteString(s)
+		return errExpand
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+// TemplateVariables list the name of the variables used in the href of a
+// templated link in the order they appear
+func (l Link) TemplateVariables() []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	parseTemplate(l.Href, func(string) {}, func(e templateExpression) error {
+		for _, v := range e.variables {
+			if !seen[v.name] {
+				seen[v.name] = true
+				names = append(names, v.name)
+			}
+		}
+		return nil
+	})
+
+	return names
+}
+
+// parseTemplate split the template in literals and expressions
+func parseTemplate(template string, literal func(string), expression func(templateExpression) error) error {
+
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			if strings.IndexByte(template, '}') >= 0 {
+				return errors.New("template: unexpected }")
+			}
+			literal(template)
+			return nil
+		}
+		if strings.IndexByte(template[:start], '}') >= 0 {
+			return errors.New("template: unexpected }")
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return errors.New("template: unclosed expression")
+		}
+		end += start
+
+		literal(template[:start])
+		e, err := parseTemplateExpression(template[start+1 : end])
+		if err != nil {
+			return err
+		}
+		err = expression(e)
+		if err != nil {
+			return err
+		}
+		template = template[end+1:]
+	}
+
+	return nil
+}
+
+func parseTemplateExpression(expression string) (templateExpression, error) {
+	var e templateExpression
+
+	if expression == "" {
+		return e, errors.New("template: empty expression")
+	}
+	if op, ok := templateOperators[expression[0]]; ok {
+		e.op = op
+		expression = expression[1:]
+	} else if strings.ContainsRune("=,!@|", rune(expression[0])) {
+		return e, fmt.Errorf("template: reserved operator %q", expression[0])
+	} else {
+		e.op = templateOperator{"", ",", false, "", false}
+	}
+
+	for _, spec := range strings.Split(expression, ",") {
+		var v templateVariable
+
+		if strings.HasSuffix(spec, "*") {
+			v.explode = true
+			spec = spec[:len(spec)-1]
+		} else if i := strings.IndexByte(spec, ':'); i >= 0 {
+			prefix, err := strconv.Atoi(spec[i+1:])
+			if err != nil || prefix <= 0 || prefix >= 10000 || spec[i+1] == '0' {
+				return e, fmt.Errorf("template: invalid prefix in %q", spec)
+			}
+			v.prefix = prefix
+			spec = spec[:i]
+		}
+		if !validVariableName(spec) {
+			return e, fmt.Errorf("template: invalid variable name %q", spec)
+		}
+		v.name = spec
+		e.variables = append(e.variables, v)
+	}
+
+	return e, nil
+}
+
+func validVariableName(name string) bool {
+
+	if name == "" || name[0] == '.' || name[len(name)-1] == '.' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.':
+		case c == '%':
+			if i+2 >= len(name) || !isHex(name[i+1]) || !isHex(name[i+2]) {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e templateExpression) expand(vars map[string]interface{}) (string, error) {
+	var parts []string
+
+	for _, v := range e.variables {
+		part, defined, err := e.expandVariable(v, vars[v.name])
+		if err != nil {
+			return "", err
+		}
+		if defined {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	return e.op.first + strings.Join(parts, e.op.sep), nil
+}
+
+// expandVariable expand one variable, defined is false when the value is
+// undefined and the variable must be skipped
+func (e templateExpression) expandVariable(v templateVariable, value interface{}) (string, bool, error) {
+	op := e.op
+
+	switch value := value.(type) {
+	case nil:
+		return "", false, nil
+	case []string, []interface{}:
+		items := toStrings(value)
+		if len(items) == 0 {
+			return "", false, nil
+		}
+		if v.prefix > 0 {
+			return "", false, fmt.Errorf("template: prefix used on list %q", v.name)
+		}
+		var encoded []string
+		for _, item := range items {
+			s := encodeTemplateValue(item, op.reserved)
+			if op.named && v.explode {
+				s = namedValue(v.name, s, op)
+			}
+			encoded = append(encoded, s)
+		}
+		if v.explode {
+			return strings.Join(encoded, op.sep), true, nil
+		}
+		if op.named {
+			return v.name + "=" + strings.Join(encoded, ","), true, nil
+		}
+		return strings.Join(encoded, ","), true, nil
+	case map[string]string, map[string]interface{}:
+		keys, values := toPairs(value)
+		if len(keys) == 0 {
+			return "", false, nil
+		}
+		if v.prefix > 0 {
+			return "", false, fmt.Errorf("template: prefix used on associative array %q", v.name)
+		}
+		var encoded []string
+		for i, k := range keys {
+			key := encodeTemplateValue(k, op.reserved)
+			val := encodeTemplateValue(values[i], op.reserved)
+			if v.explode {
+				encoded = append(encoded, namedValue(key, val, op))
+			} else {
+				encoded = append(encoded, key, val)
+			}
+		}
+		if v.explode {
+			return strings.Join(encoded, op.sep), true, nil
+		}
+		if op.named {
+			return v.name + "=" + strings.Join(encoded, ","), true, nil
+		}
+		return strings.Join(encoded, ","), true, nil
+	}
+
+	s := toString(value)
+	if v.prefix > 0 && utf8.RuneCountInString(s) > v.prefix {
+		runes := []rune(s)
+		s = string(runes[:v.prefix])
+	}
+	s = encodeTemplateValue(s, op.reserved)
+	if op.named {
+		return namedValue(v.name, s, op), true, nil
+	}
+
+	return s, true, nil
+}
+
+func namedValue(name string, value string, op templateOperator) string {
+	if value == "" {
+		return name + op.ifEmpty
+	}
+	return name + "=" + value
+}
+
+func toString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case fmt.Stringer:
+		return value.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func toStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case []string:
+		return value
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			items = append(items, toString(item))
+		}
+		return items
+	}
+	return nil
+}
+
+// toPairs return the keys of an associative array sorted with their values
+func toPairs(value interface{}) ([]string, []string) {
+	var keys, values []string
+
+	switch value := value.(type) {
+	case map[string]string:
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, value[k])
+		}
+	case map[string]interface{}:
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, toString(value[k]))
+		}
+	}
+
+	return keys, values
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// encodeTemplateValue percent encode s, unreserved characters are kept
+// and reserved ones and percent encoded triplets too when reserved is set
+func encodeTemplateValue(s string, reserved bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("-._~", c) >= 0:
+			b.WriteByte(c)
+		case reserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", c) >= 0:
+			b.WriteByte(c)
+		case reserved && c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteString(s[i : i+3])
+			i += 2
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,245 @@
+// Package opensearch parse OpenSearch description documents used by OPDS 1.x
+// feeds to advertise their search and convert them in OPDS 2.0 templated
+// search links
+// https://github.com/dewitt/opensearch/blob/master/opensearch-1-1-draft-6.md
+package opensearch
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Description is an OpenSearch description document
+type Description struct {
+	ShortName   string `xml:"ShortName"`
+	Description string `xml:"Description"`
+	URLs        []URL  `xml:"Url"`
+}
+
+// URL describe an interface to request search results
+type URL struct {
+	Template    string `xml:"template,attr"`
+	TypeLink    string `xml:"type,attr"`
+	Rel         string `xml:"rel,attr"`
+	IndexOffset string `xml:"indexOffset,attr"`
+	PageOffset  string `xml:"pageOffset,attr"`
+}
+
+// ParseURL fetch and parse the description document at url, relative
+// templates are resolved against the url of the document
+func ParseURL(url string) (*Description, error) {
+	return ParseURLWithClient(http.DefaultClient, url)
+}
+
+// ParseURLWithClient is ParseURL using client for the request
+func ParseURLWithClient(client *http.Client, url string) (*Description, error) {
+	return ParseURLContext(context.Background(), client, nil, url)
+}
+
+// ParseURLContext is ParseURLWithClient with a context to cancel the
+// request and header sent with it, client is http.DefaultClient when nil
+func ParseURLContext(ctx context.Context, client *http.Client, header http.Header, url string) (*Description, error) {
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		request.Header[k] = v
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, errReq := client.Do(request)
+	if errReq != nil {
+		return nil, errReq
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("opensearch: %s: %s", url, res.Status)
+	}
+
+	buff, errRead := ioutil.ReadAll(res.Body)
+	if errRead != nil {
+		return nil, errRead
+	}
+
+	d, errParse := ParseBuffer(buff)
+	if errParse != nil {
+		return nil, errParse
+	}
+
+	base := res.Request.URL
+	for i, u := range d.URLs {
+		d.URLs[i].Template = resolveTemplate(base, u.Template)
+	}
+
+	return d, nil
+}
+
+// ParseBuffer parse a description document from a buffer of byte
+func ParseBuffer(buff []byte) (*Description, error) {
+	var d Description
+
+	err := xml.Unmarshal(buff, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// FindURL return the first url of the description returning results of
+// one of the types, the types are prefixes of the media type so
+// "application/atom+xml" match the OPDS profiles
+func (d *Description) FindURL(types ...string) (URL, bool) {
+
+	for _, t := range types {
+		for _, u := range d.URLs {
+			if u.Rel != "" && u.Rel != "results" {
+				continue
+			}
+			if strings.HasPrefix(u.TypeLink, t) {
+				return u, true
+			}
+		}
+	}
+
+	return URL{}, false
+}
+
+// SearchLink return an OPDS 2.0 templated search link from the url
+// returning OPDS or atom results
+func (d *Description) SearchLink() (opds2.Link, error) {
+	var l opds2.Link
+
+	u, ok := d.FindURL("application/atom+xml;profile=opds-catalog", "application/opds+json", "application/atom+xml")
+	if !ok {
+		return l, errors.New("opensearch: no url returning atom results")
+	}
+
+	l.Href = u.ToTemplate()
+	l.TypeLink = u.TypeLink
+	l.Rel = []string{"search"}
+	l.Title = d.ShortName
+	l.Templated = true
+
+	return l, nil
+}
+
+var parameterRegexp = regexp.MustCompile(`\{([^{}?]+)(\??)\}`)
+
+// ToTemplate convert the OpenSearch template in a RFC 6570 template, the
+// search terms become the query variable used by OPDS 2.0, optional
+// parameters are removed and the others get their default value
+func (u URL) ToTemplate() string {
+
+	template := u.Template
+	query := ""
+	if i := queryIndex(template); i >= 0 {
+		template, query = template[:i], template[i+1:]
+	}
+
+	template = parameterRegexp.ReplaceAllStringFunc(template, u.replaceParameter)
+
+	var params []string
+	for _, p := range strings.Split(query, "&") {
+		if p == "" {
+			continue
+		}
+		if m := parameterRegexp.FindStringSubmatch(p); m != nil && m[2] == "?" && m[1] != "searchTerms" {
+			continue
+		}
+		params = append(params, parameterRegexp.ReplaceAllStringFunc(p, u.replaceParameter))
+	}
+	if len(params) > 0 {
+		template += "?" + strings.Join(params, "&")
+	}
+
+	return template
+}
+
+// queryIndex return the index of the ? starting the query, the ones
+// marking optional parameters are skipped
+func queryIndex(template string) int {
+	depth := 0
+	for i, c := range template {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '?':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (u URL) replaceParameter(parameter string) string {
+
+	m := parameterRegexp.FindStringSubmatch(parameter)
+	name := m[1]
+	optional := m[2] == "?"
+
+	switch name {
+	case "searchTerms":
+		return "{query}"
+	case "startIndex":
+		return u.offset(u.IndexOffset)
+	case "startPage":
+		return u.offset(u.PageOffset)
+	case "count":
+		if optional {
+			return ""
+		}
+		return "20"
+	case "language":
+		return "*"
+	case "inputEncoding", "outputEncoding":
+		return "UTF-8"
+	}
+
+	return ""
+}
+
+// offset return the first index or page, 1 when not specified
+func (u URL) offset(value string) string {
+	if _, err := strconv.Atoi(value); err == nil {
+		return value
+	}
+	return "1"
+}
+
+// resolveTemplate resolve the part of the template before the first
+// parameter against base
+func resolveTemplate(base *url.URL, template string) string {
+
+	prefix, rest := template, ""
+	if i := strings.Index(template, "{"); i >= 0 {
+		prefix, rest = template[:i], template[i:]
+	}
+	if prefix == "" {
+		return template
+	}
+
+	u, err := url.Parse(prefix)
+	if err != nil {
+		return template
+	}
+
+	return base.ResolveReference(u).String() + rest
+}
@@ -0,0 +1,575 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+// ErrFormat is returned for a file that is not a PDF
+var ErrFormat = errors.New("pdf: not a pdf file")
+
+// ErrEncrypted is returned for an encrypted file, its strings can not be
+// read without decrypting them
+var ErrEncrypted = errors.New("pdf: encrypted file")
+
+// errFilter is returned for a stream compressed with a filter that is not
+// implemented
+var errFilter = errors.New("pdf: unsupported stream filter")
+
+// limits of the parse, a larger object is considered broken
+const (
+	initialWindow = 4 * 1024
+	maxWindow     = 16 * 1024 * 1024
+	maxStream     = 64 * 1024 * 1024
+)
+
+// xrefEntry is the location of an object, directly in the file or in an
+// object stream
+type xrefEntry struct {
+	offset     int64
+	compressed bool
+	stream     int
+	index      int
+}
+
+// file is a PDF file with its cross-reference table, objects are read when
+// they are resolved
+type file struct {
+	r       io.ReaderAt
+	size    int64
+	xref    map[int]xrefEntry
+	trailer dict
+	objects map[int]interface{}
+	// objectStreams are the decoded object streams by number
+	objectStreams map[int][]byte
+	resolving     map[int]bool
+}
+
+func openFile(r io.ReaderAt, size int64) (*file, error) {
+	f := &file{
+		r:             r,
+		size:          size,
+		xref:          make(map[int]xrefEntry),
+		trailer:       dict{},
+		objects:       make(map[int]interface{}),
+		objectStreams: make(map[int][]byte),
+		resolving:     make(map[int]bool),
+	}
+
+	header := f.readAt(0, 1024)
+	if !bytes.Contains(header, []byte("%PDF-")) {
+		return nil, ErrFormat
+	}
+
+	if err := f.readXref(); err != nil || f.trailer["Root"] == nil {
+		// damaged files are read by looking for their objects
+		f.xref = make(map[int]xrefEntry)
+		f.trailer = dict{}
+		if err := f.scanObjects(); err != nil {
+			return nil, err
+		}
+	}
+	if f.trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+
+	return f, nil
+}
+
+// readAt return at most n bytes at offset
+func (f *file) readAt(offset int64, n int64) []byte {
+	if offset < 0 || offset >= f.size {
+		return nil
+	}
+	if offset+n > f.size {
+		n = f.size - offset
+	}
+	b := make([]byte, n)
+	read, _ := f.r.ReadAt(b, offset)
+	return b[:read]
+}
+
+// parseAt parse objects at offset with parse, reading more of the file
+// while the objects are truncated
+func (f *file) parseAt(offset int64, parse func(l *lexer) error) error {
+	for window := int64(initialWindow); ; window *= 4 {
+		data := f.readAt(offset, window)
+		eof := offset+int64(len(data)) >= f.size
+		if eof {
+			// white spaces let the lexer look after the last object
+			data = append(data, "\n\n\n\n\n\n\n\n\n\n"...)
+		}
+		err := parse(&lexer{b: data})
+		if err != errTruncated || eof || window >= maxWindow {
+			return err
+		}
+	}
+}
+
+// startXref return the offset of the last cross-reference section
+func (f *file) startXref() (int64, error) {
+	tail := f.readAt(f.size-1024, 1024)
+	if f.size < 1024 {
+		tail = f.readAt(0, f.size)
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return 0, ErrFormat
+	}
+	l := lexer{b: append(tail[i+len("startxref"):], '\n')}
+	l.skipSpace()
+	return strconv.ParseInt(l.word(), 10, 64)
+}
+
+// readXref read the cross-reference sections from the last one, the
+// entries of the newest sections are kept
+func (f *file) readXref() error {
+	offset, err := f.startXref()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int64]bool)
+	for !seen[offset] {
+		seen[offset] = true
+
+		var trailer dict
+		var errSection error
+		head := f.readAt(offset, 4)
+		if bytes.Equal(head, []byte("xref")) {
+			trailer, errSection = f.readXrefTable(offset + 4)
+			// hybrid files have their compressed objects in a stream
+			if stm, ok := trailer["XRefStm"].(int64); ok && !seen[stm] {
+				seen[stm] = true
+				if _, err := f.readXrefStream(stm); err != nil {
+					return err
+				}
+			}
+		} else {
+			trailer, errSection = f.readXrefStream(offset)
+		}
+		if errSection != nil {
+			return errSection
+		}
+
+		for k, v := range trailer {
+			if _, ok := f.trailer[k]; !ok {
+				f.trailer[k] = v
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+
+	return nil
+}
+
+// readXrefTable read a classic cross-reference table and its trailer
+func (f *file) readXrefTable(offset int64) (dict, error) {
+	var trailer dict
+	entries := make(map[int]xrefEntry)
+
+	err := f.parseAt(offset, func(l *lexer) error {
+		for {
+			o, err := l.object()
+			if err != nil {
+				return err
+			}
+			if o == keyword("trailer") {
+				t, err := l.object()
+				if err != nil {
+					return err
+				}
+				trailer, _ = t.(dict)
+				return nil
+			}
+			start, ok1 := o.(int64)
+			o, err = l.object()
+			count, ok2 := o.(int64)
+			if err != nil {
+				return err
+			}
+			if !ok1 || !ok2 {
+				return errSyntax
+			}
+			for i := int64(0); i < count; i++ {
+				entryOffset, err1 := l.object()
+				_, err2 := l.object()
+				kind, err3 := l.object()
+				for _, err := range []error{err1, err2, err3} {
+					if err != nil {
+						return err
+					}
+				}
+				n, ok := entryOffset.(int64)
+				if kind == keyword("n") && ok {
+					entries[int(start+i)] = xrefEntry{offset: n}
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if trailer == nil {
+		return nil, errSyntax
+	}
+
+	f.addEntries(entries)
+	return trailer, nil
+}
+
+// readXrefStream read a cross-reference stream of PDF 1.5, its dictionary
+// is the trailer
+func (f *file) readXrefStream(offset int64) (dict, error) {
+	o, err := f.objectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(*stream)
+	if !ok || s.dict["Type"] != name("XRef") {
+		return nil, errSyntax
+	}
+	data, err := f.streamData(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var widths []int
+	w, _ := s.dict["W"].(array)
+	for _, v := range w {
+		n, _ := v.(int64)
+		// fields are at most 8 bytes integers
+		if n < 0 || n > 8 {
+			return nil, errSyntax
+		}
+		widths = append(widths, int(n))
+	}
+	if len(widths) != 3 {
+		return nil, errSyntax
+	}
+	index, _ := s.dict["Index"].(array)
+	if index == nil {
+		index = array{int64(0), s.dict["Size"]}
+	}
+
+	entries := make(map[int]xrefEntry)
+	entrySize := widths[0] + widths[1] + widths[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for n := int64(0); n < count && pos+entrySize <= len(data); n++ {
+			fields := [3]int64{1, 0, 0}
+			for j, width := range widths {
+				if width == 0 {
+					continue
+				}
+				fields[j] = 0
+				for k := 0; k < width; k++ {
+					fields[j] = fields[j]<<8 | int64(data[pos])
+					pos++
+				}
+			}
+			switch fields[0] {
+			case 1:
+				entries[int(start+n)] = xrefEntry{offset: fields[1]}
+			case 2:
+				entries[int(start+n)] = xrefEntry{compressed: true, stream: int(fields[1]), index: int(fields[2])}
+			}
+		}
+	}
+
+	f.addEntries(entries)
+	return s.dict, nil
+}
+
+// addEntries add the entries of an older section, the objects already
+// known are newer
+func (f *file) addEntries(entries map[int]xrefEntry) {
+	for num, e := range entries {
+		if _, ok := f.xref[num]; !ok {
+			f.xref[num] = e
+		}
+	}
+}
+
+// objectPattern match the start of an object in a damaged file
+var objectPattern = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// scanObjects build the cross-reference table of a damaged file by
+// looking for the objects, the trailer is the last one found or the
+// dictionary of the last cross-reference stream
+func (f *file) scanObjects() error {
+	if f.size > maxStream {
+		return ErrFormat
+	}
+	data := f.readAt(0, f.size)
+
+	for _, m := range objectPattern.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err == nil {
+			f.xref[num] = xrefEntry{offset: int64(m[0])}
+		}
+	}
+
+	if i := bytes.LastIndex(data, []byte("trailer")); i >= 0 {
+		l := lexer{b: append(data[i+len("trailer"):], "\n\n\n\n\n\n\n\n\n\n"...)}
+		if t, err := l.object(); err == nil {
+			if d, ok := t.(dict); ok {
+				f.trailer = d
+			}
+		}
+	}
+	if f.trailer["Root"] == nil {
+		for _, e := range f.xref {
+			o, err := f.objectAt(e.offset)
+			if s, ok := o.(*stream); err == nil && ok && s.dict["Type"] == name("XRef") {
+				f.trailer = s.dict
+			}
+		}
+	}
+	if f.trailer["Root"] == nil {
+		return ErrFormat
+	}
+
+	return nil
+}
+
+// objectAt parse the object "num gen obj" at offset
+func (f *file) objectAt(offset int64) (interface{}, error) {
+	var o interface{}
+
+	err := f.parseAt(offset, func(l *lexer) error {
+		num, err1 := l.object()
+		gen, err2 := l.object()
+		obj, err3 := l.object()
+		for _, err := range []error{err1, err2, err3} {
+			if err != nil {
+				return err
+			}
+		}
+		_, isNum := num.(int64)
+		_, isGen := gen.(int64)
+		if !isNum || !isGen || obj != keyword("obj") {
+			return errSyntax
+		}
+
+		var err error
+		o, err = l.object()
+		if s, ok := o.(*stream); ok {
+			s.offset += offset
+		}
+		return err
+	})
+
+	return o, err
+}
+
+// resolve return the object referenced, or the object itself when it is
+// not a reference, a missing object is null
+func (f *file) resolve(o interface{}) interface{} {
+	r, ok := o.(ref)
+	if !ok {
+		return o
+	}
+	if o, ok := f.objects[r.num]; ok {
+		return o
+	}
+	// broken files can have references in a loop
+	if f.resolving[r.num] {
+		return nil
+	}
+	f.resolving[r.num] = true
+	defer delete(f.resolving, r.num)
+
+	var object interface{}
+	if e, ok := f.xref[r.num]; ok {
+		if e.compressed {
+			object = f.compressedObject(e)
+		} else if o, err := f.objectAt(e.offset); err == nil {
+			object = o
+		}
+	}
+	f.objects[r.num] = object
+
+	return object
+}
+
+// compressedObject read an object of an object stream
+func (f *file) compressedObject(e xrefEntry) interface{} {
+	data, ok := f.objectStreams[e.stream]
+	s, isStream := f.resolve(ref{num: e.stream}).(*stream)
+	if !ok && isStream {
+		data, _ = f.streamData(s)
+		f.objectStreams[e.stream] = data
+	}
+	if data == nil || !isStream {
+		return nil
+	}
+
+	first, _ := s.dict["First"].(int64)
+	n, _ := s.dict["N"].(int64)
+	if e.index >= int(n) {
+		return nil
+	}
+
+	l := lexer{b: data}
+	var offset int64
+	for i := 0; i <= e.index; i++ {
+		_, err1 := l.object()
+		o, err2 := l.object()
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		offset, _ = o.(int64)
+	}
+	if first < 0 || offset < 0 || first+offset >= int64(len(data)) {
+		return nil
+	}
+
+	// the objects of a stream have no endobj keyword ending them
+	l = lexer{b: append(data[first+offset:len(data):len(data)], "\nendobj\n\n\n"...)}
+	o, err := l.object()
+	if err != nil {
+		return nil
+	}
+	return o
+}
+
+// rawStream return the data of a stream without decoding it
+func (f *file) rawStream(s *stream) ([]byte, error) {
+	length, ok := f.resolve(s.dict["Length"]).(int64)
+	if !ok || length < 0 {
+		// look for the end of the stream
+		data := f.readAt(s.offset, maxStream)
+		i := bytes.Index(data, []byte("endstream"))
+		if i < 0 {
+			return nil, errSyntax
+		}
+		return bytes.TrimRight(data[:i], "\r\n"), nil
+	}
+	if length > maxStream {
+		return nil, errSyntax
+	}
+	return f.readAt(s.offset, length), nil
+}
+
+// streamData return the data of a stream decoded, only the Flate filter is
+// implemented
+func (f *file) streamData(s *stream) ([]byte, error) {
+	data, err := f.rawStream(s)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := f.resolve(s.dict["Filter"])
+	params := f.resolve(s.dict["DecodeParms"])
+	if filter, ok := filters.(name); ok {
+		filters = array{filter}
+		params = array{params}
+	}
+	filterList, _ := filters.(array)
+	paramList, _ := params.(array)
+
+	for i, filter := range filterList {
+		if f.resolve(filter) != name("FlateDecode") {
+			return nil, errFilter
+		}
+		rc, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(io.LimitReader(rc, maxStream))
+		rc.Close()
+		// truncated streams are common, the data read is kept
+		if err != nil && len(data) == 0 {
+			return nil, err
+		}
+
+		var p dict
+		if i < len(paramList) {
+			p, _ = f.resolve(paramList[i]).(dict)
+		}
+		if predictor, _ := p["Predictor"].(int64); predictor >= 10 {
+			columns, ok := p["Columns"].(int64)
+			if !ok {
+				columns = 1
+			}
+			colors, ok := p["Colors"].(int64)
+			if !ok {
+				colors = 1
+			}
+			bits, ok := p["BitsPerComponent"].(int64)
+			if !ok {
+				bits = 8
+			}
+			data = pngUnpredict(data, int((colors*bits+7)/8), int((columns*colors*bits+7)/8))
+		}
+	}
+
+	return data, nil
+}
+
+// pngUnpredict reverse the PNG predictors, each row starts with the
+// predictor used for it
+func pngUnpredict(data []byte, bpp int, rowSize int) []byte {
+	var out []byte
+	prev := make([]byte, rowSize)
+
+	for len(data) >= rowSize+1 {
+		predictor := data[0]
+		row := make([]byte, rowSize)
+		copy(row, data[1:rowSize+1])
+		data = data[rowSize+1:]
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch predictor {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+
+	return out
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
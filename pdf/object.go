@@ -0,0 +1,337 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// objects of a PDF file are nil, bool, int64, float64, pdfString, name,
+// array, dict, ref, keyword and *stream
+type (
+	name      string
+	keyword   string
+	pdfString string
+	array     []interface{}
+	dict      map[string]interface{}
+)
+
+// ref is an indirect reference to an object
+type ref struct {
+	num int
+	gen int
+}
+
+// stream is a dictionary with data, the data starts at offset in the file
+type stream struct {
+	dict   dict
+	offset int64
+}
+
+// errTruncated is returned when an object continue after the data parsed,
+// the parse is done again with more data
+var errTruncated = errors.New("pdf: truncated object")
+
+var errSyntax = errors.New("pdf: syntax error")
+
+// maxDepth limit the nesting of arrays and dictionaries
+const maxDepth = 64
+
+// lexer parse the objects of a part of a file
+type lexer struct {
+	b     []byte
+	pos   int
+	depth int
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skip the white spaces and the comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		if c == '%' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// word read a regular word, a number or a keyword
+func (l *lexer) word() string {
+	start := l.pos
+	for l.pos < len(l.b) && !isSpace(l.b[l.pos]) && !isDelimiter(l.b[l.pos]) {
+		l.pos++
+	}
+	return string(l.b[start:l.pos])
+}
+
+// object parse the next object, an integer followed by a generation and R
+// is a reference
+func (l *lexer) object() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, errTruncated
+	}
+
+	switch c := l.b[l.pos]; {
+	case c == '/':
+		l.pos++
+		return l.name(), nil
+	case c == '(':
+		l.pos++
+		return l.literalString()
+	case c == '<':
+		if l.pos+1 >= len(l.b) {
+			return nil, errTruncated
+		}
+		if l.b[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dict()
+		}
+		l.pos++
+		return l.hexString()
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		return nil, errSyntax
+	}
+
+	w := l.word()
+	if l.pos >= len(l.b) {
+		// a number or a keyword may continue after the data
+		return nil, errTruncated
+	}
+	switch w {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(w, 10, 64); err == nil {
+		// look for "gen R" without consuming it when it is not a reference
+		save := l.pos
+		l.skipSpace()
+		if gen, err := strconv.Atoi(l.word()); err == nil {
+			l.skipSpace()
+			if l.pos >= len(l.b) {
+				return nil, errTruncated
+			}
+			if l.word() == "R" {
+				return ref{num: int(n), gen: gen}, nil
+			}
+		} else if l.pos >= len(l.b) {
+			return nil, errTruncated
+		}
+		l.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(w, 64); err == nil {
+		return f, nil
+	}
+	if w == "" {
+		return nil, errSyntax
+	}
+	return keyword(w), nil
+}
+
+// name read a name after its slash, #xx are escaped bytes
+func (l *lexer) name() name {
+	w := []byte(l.word())
+	var b []byte
+	for i := 0; i < len(w); i++ {
+		if w[i] == '#' && i+2 < len(w) {
+			if v, err := strconv.ParseUint(string(w[i+1:i+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, w[i])
+	}
+	return name(b)
+}
+
+func (l *lexer) literalString() (interface{}, error) {
+	var b []byte
+	nesting := 1
+
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			nesting++
+		case ')':
+			nesting--
+			if nesting == 0 {
+				return pdfString(b), nil
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				return nil, errTruncated
+			}
+			c = l.b[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// line continuation
+				if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+
+	return nil, errTruncated
+}
+
+func (l *lexer) hexString() (interface{}, error) {
+	end := bytes.IndexByte(l.b[l.pos:], '>')
+	if end < 0 {
+		return nil, errTruncated
+	}
+
+	var digits []byte
+	for _, c := range l.b[l.pos : l.pos+end] {
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, errSyntax
+		}
+		b[i] = byte(v)
+	}
+	return pdfString(b), nil
+}
+
+func (l *lexer) array() (interface{}, error) {
+	if l.depth++; l.depth > maxDepth {
+		return nil, errSyntax
+	}
+	defer func() { l.depth-- }()
+
+	a := array{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.b) {
+			return nil, errTruncated
+		}
+		if l.b[l.pos] == ']' {
+			l.pos++
+			return a, nil
+		}
+		o, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, o)
+	}
+}
+
+// dict parse a dictionary, followed by the data of a stream when the
+// stream keyword follow it
+func (l *lexer) dict() (interface{}, error) {
+	if l.depth++; l.depth > maxDepth {
+		return nil, errSyntax
+	}
+	defer func() { l.depth-- }()
+
+	d := dict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 >= len(l.b) {
+			return nil, errTruncated
+		}
+		if l.b[l.pos] == '>' && l.b[l.pos+1] == '>' {
+			l.pos += 2
+			break
+		}
+		if l.b[l.pos] != '/' {
+			return nil, errSyntax
+		}
+		l.pos++
+		key := l.name()
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		d[string(key)] = value
+	}
+
+	// a dictionary can end the data read
+	save := l.pos
+	l.skipSpace()
+	if len(l.b)-l.pos < len("stream")+2 {
+		return nil, errTruncated
+	}
+	if !bytes.HasPrefix(l.b[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d, nil
+	}
+	l.pos += len("stream")
+	// the data start after an end of line
+	if l.b[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.b[l.pos] == '\n' {
+		l.pos++
+	}
+	return &stream{dict: d, offset: int64(l.pos)}, nil
+}
@@ -0,0 +1,255 @@
+// Package pdf read the metadata of PDF files as OPDS 2.0 publications,
+// from the document information dictionary and the XMP metadata stream.
+//
+// Pages are not rendered, the cover is the largest JPEG image drawn on the
+// first page, as found in scanned books and comics, other files have no
+// cover. Encrypted files are not read.
+package pdf
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// MediaType is the media type of PDF files
+const MediaType = "application/pdf"
+
+// Document is the publication read from a PDF file
+type Document struct {
+	// Publication has the metadata of the file, XMP metadata are preferred
+	// to the information dictionary, it has no link as the location of the
+	// file is not known
+	Publication opds2.Publication
+	// Pages is the number of pages
+	Pages int
+	// Cover is the image of the first page, nil when there is none
+	Cover *Cover
+}
+
+// Cover is an image of a PDF file
+type Cover struct {
+	MediaType string
+	Data      []byte
+	Width     int
+	Height    int
+}
+
+// ParseFile read a PDF file
+func ParseFile(name string) (*Document, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(f, info.Size())
+}
+
+// Parse read a PDF file of size bytes
+func Parse(r io.ReaderAt, size int64) (*Document, error) {
+	f, err := openFile(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	meta := &doc.Publication.Metadata
+
+	if info, ok := f.resolve(f.trailer["Info"]).(dict); ok {
+		f.mapInfo(info, meta)
+	}
+
+	root, _ := f.resolve(f.trailer["Root"]).(dict)
+	if lang := f.text(root["Lang"]); lang != "" {
+		meta.Language = opds2.StringOrArray{lang}
+	}
+	if s, ok := f.resolve(root["Metadata"]).(*stream); ok {
+		if data, err := f.streamData(s); err == nil {
+			parseXMP(data).mapMetadata(meta)
+		}
+	}
+
+	if pages, ok := f.resolve(root["Pages"]).(dict); ok {
+		count, _ := f.resolve(pages["Count"]).(int64)
+		doc.Pages = int(count)
+		doc.Cover = f.firstPageImage(pages)
+	}
+
+	return doc, nil
+}
+
+// mapInfo map the document information dictionary, the subject is a
+// description and the keywords are subjects
+func (f *file) mapInfo(info dict, meta *opds2.PublicationMetadata) {
+
+	meta.Title.SingleString = f.text(info["Title"])
+	for _, author := range splitList(f.text(info["Author"]), ";") {
+		meta.Author = append(meta.Author, opds2.Contributor{Name: opds2.MultiLanguage{SingleString: author}})
+	}
+	meta.Description = f.text(info["Subject"])
+	for _, keyword := range splitList(f.text(info["Keywords"]), ",;") {
+		meta.Subject = append(meta.Subject, opds2.Subject{Name: keyword})
+	}
+	if t, ok := parseDate(f.text(info["CreationDate"])); ok {
+		meta.PublicationDate = &t
+	}
+	if t, ok := parseDate(f.text(info["ModDate"])); ok {
+		meta.Modified = &t
+	}
+}
+
+// text return a text string decoded from UTF-16, UTF-8 or PDFDocEncoding
+func (f *file) text(o interface{}) string {
+	s, ok := f.resolve(o).(pdfString)
+	if !ok {
+		return ""
+	}
+	b := []byte(s)
+
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		var u []uint16
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return strings.TrimSpace(string(utf16.Decode(u)))
+	case len(b) >= 3 && b[0] == 0xef && b[1] == 0xbb && b[2] == 0xbf && utf8.Valid(b[3:]):
+		return strings.TrimSpace(string(b[3:]))
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+		if r, ok := pdfDocEncoding[c]; ok {
+			runes[i] = r
+		}
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// pdfDocEncoding are the characters of PDFDocEncoding that differ from
+// latin-1
+var pdfDocEncoding = map[byte]rune{
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…', 0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8a: '−', 0x8b: '‰', 0x8c: '„', 0x8d: '“', 0x8e: '”', 0x8f: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ', 0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9a: 'ı', 0x9b: 'ł', 0x9c: 'œ', 0x9d: 'š', 0x9e: 'ž', 0xa0: '€',
+}
+
+// parseDate parse a date like D:20060102150405+01'00', the parts after
+// the year are optional
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	if len(s) < 4 {
+		return time.Time{}, false
+	}
+
+	digits := s
+	zone := ""
+	if i := strings.IndexAny(s, "Zz+-"); i >= 0 {
+		digits, zone = s[:i], s[i:]
+	}
+	// complete the missing parts with the first month, day and hour
+	const defaults = "00000101000000"
+	if len(digits) > len(defaults) {
+		return time.Time{}, false
+	}
+	digits += defaults[len(digits):]
+
+	t, err := time.Parse("20060102150405", digits)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	zone = strings.Replace(zone, "'", "", -1)
+	if len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		if z, err := time.Parse("-0700", (zone + "00")[:5]); err == nil {
+			_, offset := z.Zone()
+			t = t.Add(-time.Duration(offset) * time.Second)
+		}
+	}
+
+	return t, true
+}
+
+func splitList(s string, separators string) []string {
+	var values []string
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune(separators, r) }) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// firstPageImage return the largest JPEG image of the first page, the
+// resources are inherited from the page tree
+func (f *file) firstPageImage(node dict) *Cover {
+	resources := f.resolve(node["Resources"])
+
+	for depth := 0; depth < maxDepth; depth++ {
+		kids, ok := f.resolve(node["Kids"]).(array)
+		if !ok || len(kids) == 0 {
+			break
+		}
+		node, ok = f.resolve(kids[0]).(dict)
+		if !ok {
+			return nil
+		}
+		if r := f.resolve(node["Resources"]); r != nil {
+			resources = r
+		}
+	}
+
+	r, _ := resources.(dict)
+	xobjects, _ := f.resolve(r["XObject"]).(dict)
+	var keys []string
+	for k := range xobjects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var cover *Cover
+	for _, k := range keys {
+		s, ok := f.resolve(xobjects[k]).(*stream)
+		if !ok || s.dict["Subtype"] != name("Image") || !f.isJPEG(s) {
+			continue
+		}
+		width, _ := f.resolve(s.dict["Width"]).(int64)
+		height, _ := f.resolve(s.dict["Height"]).(int64)
+		if cover != nil && int(width*height) <= cover.Width*cover.Height {
+			continue
+		}
+		data, err := f.rawStream(s)
+		if err != nil {
+			continue
+		}
+		cover = &Cover{MediaType: "image/jpeg", Data: data, Width: int(width), Height: int(height)}
+	}
+
+	return cover
+}
+
+// isJPEG tell if an image stream is a JPEG file, its only filter is
+// DCTDecode
+func (f *file) isJPEG(s *stream) bool {
+	switch filter := f.resolve(s.dict["Filter"]).(type) {
+	case name:
+		return filter == "DCTDecode"
+	case array:
+		return len(filter) == 1 && f.resolve(filter[0]) == name("DCTDecode")
+	}
+	return false
+}
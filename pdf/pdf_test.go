@@ -0,0 +1,123 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// buildPDF return a PDF file with the objects numbered from 1, a
+// cross-reference table and trailer
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	var offsets []int
+	for i, o := range objects {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, xref)
+	return b.Bytes()
+}
+
+// buildXrefStreamPDF return a PDF file whose cross-reference stream has
+// the dictionary and data given
+func buildXrefStreamPDF(xrefDict string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	xref := b.Len()
+	fmt.Fprintf(&b, "1 0 obj\n%s\nstream\n%s\nendstream\nendobj\n", xrefDict, data)
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xref)
+	return b.Bytes()
+}
+
+// buildObjStmPDF return a PDF file whose catalog is the object 3 stored in
+// the object stream 1 starting at first
+func buildObjStmPDF(first int) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	objStm := b.Len()
+	fmt.Fprintf(&b, "1 0 obj\n<< /Type /ObjStm /N 1 /First %d /Length 28 >>\nstream\n3 0 << /Type /Catalog >>\nendstream\nendobj\n", first)
+	xref := b.Len()
+	data := []byte{0, 0, 0, 0, 1, 0, byte(objStm), 0, 0, 0, 0, 0, 2, 0, 1, 0}
+	fmt.Fprintf(&b, "2 0 obj\n<< /Type /XRef /W [1 2 1] /Size 4 /Root 3 0 R /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(data), data)
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xref)
+	return b.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	data := buildPDF("<< /Root 1 0 R /Info 3 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R /Lang (fr) >>",
+		"<< /Type /Pages /Kids [] /Count 12 >>",
+		"<< /Title (Le Horla) /Author (Guy de Maupassant) >>")
+
+	doc, err := Parse(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := doc.Publication.Metadata
+	if meta.Title.String() != "Le Horla" {
+		t.Errorf("title = %q", meta.Title)
+	}
+	if len(meta.Author) != 1 || meta.Author[0].Name.String() != "Guy de Maupassant" {
+		t.Errorf("author = %v", meta.Author)
+	}
+	if len(meta.Language) != 1 || meta.Language[0] != "fr" {
+		t.Errorf("language = %v", meta.Language)
+	}
+	if doc.Pages != 12 {
+		t.Errorf("pages = %d", doc.Pages)
+	}
+}
+
+func TestParseObjectStream(t *testing.T) {
+	data := buildObjStmPDF(4)
+	f, err := openFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := f.resolve(f.trailer["Root"]).(dict)
+	if root["Type"] != name("Catalog") {
+		t.Errorf("root = %v", root)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	valid := buildPDF("<< /Root 1 0 R >>", "<< /Type /Catalog >>")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)/2]},
+		{"startxref past the end", bytes.Replace(valid, []byte("startxref\n"), []byte("startxref\n9999999"), 1)},
+		{"negative startxref", bytes.Replace(valid, []byte("startxref\n"), []byte("startxref\n-"), 1)},
+		{"huge xref count", bytes.Replace(valid, []byte("xref\n0 2"), []byte("xref\n0 99999999999"), 1)},
+		{"reference loop", buildPDF("<< /Root 1 0 R /Info 2 0 R >>", "2 0 R", "1 0 R")},
+		{"page tree loop", buildPDF("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [2 0 R] /Count 1 >>")},
+		{"nested arrays", buildPDF("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Lang "+string(bytes.Repeat([]byte("["), 10000))+" >>")},
+		{"huge stream length", buildPDF("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Metadata 2 0 R >>",
+			"<< /Length 99999999999 >>\nstream\nxmp\nendstream")},
+		{"negative object stream offset", buildObjStmPDF(-100)},
+		{"negative xref stream widths", buildXrefStreamPDF(
+			"<< /Type /XRef /W [8 -7 1] /Size 2 /Length 4 >>", []byte{1, 2, 3, 4})},
+		{"huge xref stream widths", buildXrefStreamPDF(
+			"<< /Type /XRef /W [1 99 1] /Size 2 /Length 4 >>", []byte{1, 2, 3, 4})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// damaged files either fail or are read partially
+			Parse(bytes.NewReader(test.data), int64(len(test.data)))
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// namespaces of the XMP properties read, by prefix
+var xmpNamespaces = map[string]string{
+	"http://purl.org/dc/elements/1.1/": "dc",
+	"http://ns.adobe.com/xap/1.0/":     "xmp",
+	"http://ns.adobe.com/pdf/1.3/":     "pdf",
+}
+
+const (
+	namespaceRDF   = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	namespaceXML   = "http://www.w3.org/XML/1998/namespace"
+	namespacePRISM = "http://prismstandard.org/namespaces/"
+)
+
+// xmp are the values of the XMP properties like "dc:title", the items of
+// the rdf:Alt in the default language come first
+type xmp map[string][]string
+
+func prefix(space string) string {
+	if p, ok := xmpNamespaces[space]; ok {
+		return p
+	}
+	// every version of prism has the same properties
+	if strings.HasPrefix(space, namespacePRISM) {
+		return "prism"
+	}
+	return ""
+}
+
+// parseXMP read the properties of an XMP packet, as elements or as
+// attributes of rdf:Description, broken packets return the properties
+// read before the error
+func parseXMP(data []byte) xmp {
+	x := make(xmp)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var stack []xml.StartElement
+	property := ""
+	defaultLanguage := false
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return x
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Space == namespaceRDF && t.Name.Local == "Description" {
+				for _, a := range t.Attr {
+					if p := prefix(a.Name.Space); p != "" && strings.TrimSpace(a.Value) != "" {
+						x.add(p+":"+a.Name.Local, a.Value, false)
+					}
+				}
+			} else if n := len(stack); n > 0 && stack[n-1].Name.Space == namespaceRDF && stack[n-1].Name.Local == "Description" {
+				if p := prefix(t.Name.Space); p != "" {
+					property = p + ":" + t.Name.Local
+				}
+			}
+			defaultLanguage = false
+			for _, a := range t.Attr {
+				if a.Name.Space == namespaceXML && a.Name.Local == "lang" && a.Value == "x-default" {
+					defaultLanguage = true
+				}
+			}
+			stack = append(stack, t)
+		case xml.CharData:
+			n := len(stack)
+			if property == "" || n == 0 {
+				continue
+			}
+			top := stack[n-1].Name
+			if top.Space == namespaceRDF && top.Local != "li" {
+				continue
+			}
+			if value := strings.TrimSpace(string(t)); value != "" {
+				x.add(property, value, defaultLanguage)
+			}
+		case xml.EndElement:
+			if n := len(stack); n > 0 {
+				if prefix(stack[n-1].Name.Space)+":"+stack[n-1].Name.Local == property {
+					property = ""
+				}
+				stack = stack[:n-1]
+			}
+		}
+	}
+}
+
+func (x xmp) add(property string, value string, first bool) {
+	if first {
+		x[property] = append([]string{value}, x[property]...)
+		return
+	}
+	x[property] = append(x[property], value)
+}
+
+func (x xmp) first(property string) string {
+	if values := x[property]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// mapMetadata replace the metadata of the information dictionary with the
+// XMP properties found
+func (x xmp) mapMetadata(meta *opds2.PublicationMetadata) {
+
+	if title := x.first("dc:title"); title != "" {
+		meta.Title.SingleString = title
+	}
+	if creators := x["dc:creator"]; len(creators) > 0 {
+		meta.Author = nil
+		for _, c := range creators {
+			meta.Author = append(meta.Author, opds2.Contributor{Name: opds2.MultiLanguage{SingleString: c}})
+		}
+	}
+	if description := x.first("dc:description"); description != "" {
+		meta.Description = description
+	}
+	if subjects := x["dc:subject"]; len(subjects) > 0 {
+		meta.Subject = nil
+		for _, s := range subjects {
+			meta.Subject = append(meta.Subject, opds2.Subject{Name: s})
+		}
+	}
+	if languages := x["dc:language"]; len(languages) > 0 {
+		meta.Language = languages
+	}
+	for _, p := range x["dc:publisher"] {
+		meta.Publisher = append(meta.Publisher, opds2.Contributor{Name: opds2.MultiLanguage{SingleString: p}})
+	}
+	meta.Rights = x.first("dc:rights")
+
+	for _, property := range []string{"dc:date", "prism:publicationDate", "xmp:CreateDate"} {
+		if t, ok := parseXMPDate(x.first(property)); ok {
+			meta.PublicationDate = &t
+			break
+		}
+	}
+	if t, ok := parseXMPDate(x.first("xmp:ModifyDate")); ok {
+		meta.Modified = &t
+	}
+
+	switch {
+	case x.first("prism:isbn") != "":
+		meta.Identifier = "urn:isbn:" + x.first("prism:isbn")
+	case x.first("dc:identifier") != "":
+		meta.Identifier = x.first("dc:identifier")
+	case x.first("prism:doi") != "":
+		meta.Identifier = "https://doi.org/" + x.first("prism:doi")
+	}
+}
+
+// xmpDateLayouts are the forms of the ISO 8601 dates of XMP
+var xmpDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseXMPDate(s string) (time.Time, bool) {
+	for _, layout := range xmpDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
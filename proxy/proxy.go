@@ -0,0 +1,456 @@
+// Package proxy serve OPDS 1.x catalogs as OPDS 2.0 feeds, every feed is
+// fetched from the upstream catalog, converted and its links rewritten so
+// a client only speaking OPDS 2.0 can browse the catalog through the proxy
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opds-community/libopds2-go/convert"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Options configure the proxy
+type Options struct {
+	// Allow list the upstream feeds accepted by the proxy, an entry is
+	// either a host, a host starting with *. to accept its subdomains, an
+	// url prefix or * to accept every upstream, the hosts of the upstream
+	// urls of Prefixes are accepted when the list is empty
+	Allow []string
+	// Prefixes map a path of the proxy to an upstream url, with
+	// "/feedbooks/" => "https://catalog.feedbooks.com/" the feed
+	// https://catalog.feedbooks.com/recent.atom is at /feedbooks/recent.atom
+	Prefixes map[string]string
+	// CacheTTL is the time a converted feed is kept, no cache when zero
+	CacheTTL time.Duration
+	// CacheSize is the maximum number of feeds in cache, 1000 when zero
+	CacheSize int
+	// SearchLinks convert the links to OpenSearch descriptions in
+	// templated search links served by the proxy
+	SearchLinks bool
+	// Client is used for upstream requests, http.DefaultClient when nil
+	Client *http.Client
+	// Header is sent with every upstream request
+	Header http.Header
+}
+
+// Handler is the http.Handler of the proxy
+type Handler struct {
+	opts     Options
+	allow    []string
+	prefixes []string
+	// targets are the upstream urls of the prefixes parsed
+	targets map[string]*url.URL
+	cache   *cache
+}
+
+// New create a proxy handler
+func New(opts Options) *Handler {
+	h := &Handler{opts: opts, allow: opts.Allow, targets: make(map[string]*url.URL)}
+
+	for p, target := range opts.Prefixes {
+		u, err := url.Parse(target)
+		if err != nil || !u.IsAbs() {
+			continue
+		}
+		h.prefixes = append(h.prefixes, p)
+		h.targets[p] = u
+		if len(opts.Allow) == 0 {
+			h.allow = append(h.allow, u.Hostname())
+		}
+	}
+	// longest prefixes first so the most specific mapping win
+	sort.Slice(h.prefixes, func(i, j int) bool {
+		if len(h.prefixes[i]) != len(h.prefixes[j]) {
+			return len(h.prefixes[i]) > len(h.prefixes[j])
+		}
+		return h.prefixes[i] < h.prefixes[j]
+	})
+
+	if opts.CacheTTL > 0 {
+		size := opts.CacheSize
+		if size <= 0 {
+			size = 1000
+		}
+		h.cache = newCache(opts.CacheTTL, size)
+	}
+
+	return h
+}
+
+// ServeHTTP fetch the upstream feed of the request and write it in
+// OPDS 2.0
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upstream, status := h.upstreamURL(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if !h.Allowed(upstream) {
+		http.Error(w, "upstream not allowed", http.StatusForbidden)
+		return
+	}
+
+	base := proxyBase(r)
+	key := base + " " + upstream
+	body, ok := h.cache.get(key)
+	if !ok {
+		var err error
+		body, err = h.convert(r, upstream, base)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		h.cache.set(key, body)
+	}
+
+	w.Header().Set("Content-Type", "application/opds+json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if h.opts.CacheTTL > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(h.opts.CacheTTL.Seconds())))
+	}
+	if r.Method == "GET" {
+		w.Write(body)
+	}
+}
+
+// upstreamURL find the upstream feed from the url parameter, the search
+// template expanded with the other parameters or a prefix
+func (h *Handler) upstreamURL(r *http.Request) (string, int) {
+
+	if r.URL.Path == "/" {
+		query := r.URL.Query()
+		upstream := query.Get("url")
+		if template := query.Get("search"); template != "" {
+			l := opds2.Link{Href: template, Templated: true}
+			vars := make(map[string]interface{})
+			for _, name := range l.TemplateVariables() {
+				if _, ok := query[name]; ok {
+					vars[name] = query.Get(name)
+				}
+			}
+			var err error
+			upstream, err = l.Expand(vars)
+			if err != nil {
+				return "", http.StatusBadRequest
+			}
+		}
+		if upstream == "" {
+			return "", http.StatusBadRequest
+		}
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", http.StatusBadRequest
+		}
+		return upstream, http.StatusOK
+	}
+
+	for _, p := range h.prefixes {
+		if strings.HasPrefix(r.URL.EscapedPath(), p) {
+			rest := strings.TrimLeft(strings.TrimPrefix(r.URL.EscapedPath(), p), "/")
+			return h.resolvePrefix(h.targets[p], rest, r.URL.RawQuery)
+		}
+	}
+
+	return "", http.StatusNotFound
+}
+
+// resolvePrefix resolve the rest of a path after a prefix against its
+// upstream url, the path is relative so it can not change the host and
+// must stay under the upstream url
+func (h *Handler) resolvePrefix(target *url.URL, rest string, query string) (string, int) {
+
+	if rest == "" && query == "" {
+		return target.String(), http.StatusOK
+	}
+
+	base := *target
+	if rest != "" && !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+	ref, err := url.Parse("./" + rest)
+	if err != nil {
+		return "", http.StatusBadRequest
+	}
+	ref.RawQuery = query
+	ref.ForceQuery = query != ""
+
+	u := base.ResolveReference(ref)
+	if u.Host != base.Host || !strings.HasPrefix(u.Path, base.Path) {
+		return "", http.StatusNotFound
+	}
+
+	return u.String(), http.StatusOK
+}
+
+// Allowed check if the proxy accept to fetch the upstream url
+func (h *Handler) Allowed(upstream string) bool {
+
+	u, err := url.Parse(upstream)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, a := range h.allow {
+		switch {
+		case a == "*":
+			return true
+		case strings.Contains(a, "://"):
+			// the prefix must end on a path boundary so https://a.org
+			// does not accept https://a.org.example.com
+			if strings.HasPrefix(upstream, a) && (strings.HasSuffix(a, "/") ||
+				len(upstream) == len(a) || strings.ContainsRune("/?#", rune(upstream[len(a)]))) {
+				return true
+			}
+		case strings.HasPrefix(a, "*."):
+			if strings.HasSuffix(host, strings.ToLower(a[1:])) {
+				return true
+			}
+		default:
+			if host == strings.ToLower(a) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// convert fetch the upstream feed and return the OPDS 2.0 feed with the
+// links rewritten to the proxy
+func (h *Handler) convert(r *http.Request, upstream string, base string) ([]byte, error) {
+
+	request, err := http.NewRequestWithContext(r.Context(), "GET", upstream, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.opts.Header {
+		request.Header[k] = v
+	}
+
+	client := h.client()
+	res, errReq := client.Do(request)
+	if errReq != nil {
+		return nil, errReq
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("upstream %s: %s", upstream, res.Status)
+	}
+
+	buff, errRead := ioutil.ReadAll(res.Body)
+	if errRead != nil {
+		return nil, errRead
+	}
+
+	feed, errParse := convert.ParseBuffer(buff, res.Request.URL.String())
+	if errParse != nil {
+		return nil, errParse
+	}
+
+	if h.opts.SearchLinks {
+		// a description that can not be fetched leave the original link
+		convert.ConvertSearchLinks(r.Context(), &feed, client, h.opts.Header)
+	}
+
+	feed.WalkLinks(func(l *opds2.Link) error {
+		switch {
+		case isSearchLink(*l):
+			if href, ok := h.ProxySearchURL(base, l.Href); ok {
+				l.Href = href
+				l.TypeLink = "application/opds+json"
+			}
+		case isFeedLink(*l) && h.Allowed(l.Href):
+			l.Href = h.ProxyURL(base, l.Href)
+			l.TypeLink = "application/opds+json"
+		}
+		return nil
+	})
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	errEncode := enc.Encode(feed)
+	if errEncode != nil {
+		return nil, errEncode
+	}
+
+	return body.Bytes(), nil
+}
+
+// client return the client of the options checking that every redirect
+// lead to an allowed upstream
+func (h *Handler) client() *http.Client {
+
+	client := http.Client{}
+	if h.opts.Client != nil {
+		client = *h.opts.Client
+	}
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !h.Allowed(req.URL.String()) {
+			return fmt.Errorf("redirect to %s not allowed", req.URL)
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	return &client
+}
+
+// ProxyURL return the url of the proxy serving the upstream feed, base is
+// the scheme and host of the proxy
+func (h *Handler) ProxyURL(base string, upstream string) string {
+
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return base + "/?url=" + url.QueryEscape(upstream)
+	}
+
+	for _, p := range h.prefixes {
+		target := h.targets[p]
+		if u.Scheme != target.Scheme || !strings.EqualFold(u.Host, target.Host) || u.User != nil {
+			continue
+		}
+		// the path must continue the upstream path on a segment boundary
+		targetPath := target.EscapedPath()
+		path := u.EscapedPath()
+		if !strings.HasPrefix(path, targetPath) {
+			continue
+		}
+		rest := path[len(targetPath):]
+		if rest != "" && !strings.HasSuffix(targetPath, "/") && rest[0] != '/' {
+			continue
+		}
+		rest = strings.TrimLeft(rest, "/")
+
+		proxied := base + p
+		if rest != "" && !strings.HasSuffix(p, "/") {
+			proxied += "/"
+		}
+		proxied += rest
+		if u.RawQuery != "" {
+			proxied += "?" + u.RawQuery
+		}
+		if u.Fragment != "" {
+			proxied += "#" + u.EscapedFragment()
+		}
+		return proxied
+	}
+
+	return base + "/?url=" + url.QueryEscape(upstream)
+}
+
+// ProxySearchURL return the template of the proxy serving the results of
+// an upstream search template, the part before the first expression is
+// mapped like ProxyURL when a prefix match it, otherwise the template is
+// sent in the search parameter and expanded by the proxy
+func (h *Handler) ProxySearchURL(base string, template string) (string, bool) {
+
+	i := strings.Index(template, "{")
+	if i < 0 || !h.Allowed(template[:i]) {
+		return "", false
+	}
+	prefix, rest := template[:i], template[i:]
+
+	proxied := h.ProxyURL(base, prefix)
+	if !strings.HasPrefix(proxied, base+"/?url=") {
+		if strings.HasSuffix(prefix, "/") && !strings.HasSuffix(proxied, "/") {
+			proxied += "/"
+		}
+		return proxied + rest, true
+	}
+
+	proxied = base + "/?search=" + url.QueryEscape(template)
+	if vars := (opds2.Link{Href: template, Templated: true}).TemplateVariables(); len(vars) > 0 {
+		proxied += "{&" + strings.Join(vars, ",") + "}"
+	}
+
+	return proxied, true
+}
+
+// proxyBase return the scheme and host the request was sent to
+func proxyBase(r *http.Request) string {
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// feedRels are the relations of links leading to another feed when the
+// link has no type
+var feedRels = map[string]bool{
+	"self":                       true,
+	"start":                      true,
+	"up":                         true,
+	"next":                       true,
+	"previous":                   true,
+	"prev":                       true,
+	"first":                      true,
+	"last":                       true,
+	"subsection":                 true,
+	"collection":                 true,
+	"http://opds-spec.org/facet": true,
+	"http://opds-spec.org/group": true,
+}
+
+// isSearchLink check if the link is a templated search returning feeds
+func isSearchLink(l opds2.Link) bool {
+
+	if !l.Templated || !l.HasRel("search") {
+		return false
+	}
+
+	return strings.Contains(l.TypeLink, "atom+xml") || strings.Contains(l.TypeLink, "opds+json")
+}
+
+// isFeedLink check if the link point to a feed that can be proxied, entry
+// documents and opensearch descriptions are left untouched
+func isFeedLink(l opds2.Link) bool {
+
+	if l.Templated {
+		return false
+	}
+	if l.TypeLink != "" {
+		return (strings.Contains(l.TypeLink, "atom+xml") && !strings.Contains(l.TypeLink, "type=entry")) ||
+			strings.Contains(l.TypeLink, "opds+json")
+	}
+	for _, r := range l.Rel {
+		if feedRels[r] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+const atomFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:test</id>
+  <title>Test</title>
+  <updated>2020-01-01T00:00:00Z</updated>
+  <link rel="next" href="/page2.atom" type="application/atom+xml;profile=opds-catalog;kind=acquisition"/>
+</feed>`
+
+func newUpstream(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write([]byte(atomFeed))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
+
+func TestPrefix(t *testing.T) {
+	upstream := newUpstream(t)
+	h := New(Options{Prefixes: map[string]string{"/up/": upstream.URL + "/catalog/"}})
+
+	w := get(h, "/up/new.atom?page=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), `"href":"http://example.com/?url=`) {
+		t.Errorf("next link = %s", w.Body)
+	}
+
+	for _, target := range []string{"/up/@evil.com/", "/up//evil.com/", "/up/../../x", "/up/%2e%2e/%2e%2e/x"} {
+		upstreamURL, status := h.upstreamURL(httptest.NewRequest("GET", target, nil))
+		if status == http.StatusOK && !strings.HasPrefix(upstreamURL, upstream.URL+"/catalog/") {
+			t.Errorf("%s is mapped to %s", target, upstreamURL)
+		}
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	h := New(Options{Prefixes: map[string]string{
+		"/a/": "https://a.org/opds/",
+		"/b":  "https://b.org/catalog.atom",
+	}})
+
+	tests := []struct {
+		upstream string
+		want     string
+	}{
+		{"https://a.org/opds/new.atom?page=2", "http://proxy/a/new.atom?page=2"},
+		{"https://A.org/opds/", "http://proxy/a/"},
+		{"https://a.org.evil.com/opds/new.atom", "http://proxy/?url=https%3A%2F%2Fa.org.evil.com%2Fopds%2Fnew.atom"},
+		{"https://a.org/other.atom", "http://proxy/?url=https%3A%2F%2Fa.org%2Fother.atom"},
+		{"https://b.org/catalog.atom", "http://proxy/b"},
+		{"https://b.org/catalog.atom2", "http://proxy/?url=https%3A%2F%2Fb.org%2Fcatalog.atom2"},
+	}
+	for _, test := range tests {
+		if got := h.ProxyURL("http://proxy", test.upstream); got != test.want {
+			t.Errorf("ProxyURL(%q) = %q, want %q", test.upstream, got, test.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	upstream := newUpstream(t)
+	other := newUpstream(t)
+
+	// without allow list only the upstream of the prefixes is accepted
+	h := New(Options{Prefixes: map[string]string{"/up/": "http://catalog.example.com/"}})
+	if !h.Allowed("http://catalog.example.com/new.atom") || h.Allowed(upstream.URL) {
+		t.Error("hosts of the prefixes are not the default allow list")
+	}
+	if New(Options{}).Allowed(upstream.URL) {
+		t.Error("an empty proxy accepts every upstream")
+	}
+	if !New(Options{Allow: []string{"*"}}).Allowed(upstream.URL) {
+		t.Error("* does not accept every upstream")
+	}
+
+	// both test servers are on 127.0.0.1, they differ by their port
+	h = New(Options{Allow: []string{upstream.URL + "/"}})
+	if w := get(h, "/?url="+upstream.URL+"/feed.atom"); w.Code != http.StatusOK {
+		t.Errorf("allowed upstream: status = %d: %s", w.Code, w.Body)
+	}
+	if w := get(h, "/?url="+other.URL+"/feed.atom"); w.Code != http.StatusForbidden {
+		t.Errorf("other upstream: status = %d", w.Code)
+	}
+	w := get(h, "/?url="+upstream.URL+"/redirect?to="+other.URL+"/feed.atom")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "not allowed") {
+		t.Errorf("redirect to other upstream: status = %d: %s", w.Code, w.Body)
+	}
+}
+
+const searchFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:test</id>
+  <title>Test</title>
+  <updated>2020-01-01T00:00:00Z</updated>
+  <link rel="search" href="/catalog/opensearch.xml" type="application/opensearchdescription+xml"/>
+</feed>`
+
+const openSearchDescription = `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <ShortName>Search</ShortName>
+  <Url type="application/atom+xml;profile=opds-catalog" template="/catalog/search?q={searchTerms}&amp;page={startPage?}&amp;lang={language}"/>
+</OpenSearchDescription>`
+
+func newSearchUpstream(t *testing.T, queries *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/catalog/feed.atom", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(searchFeed))
+	})
+	mux.HandleFunc("/catalog/opensearch.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(openSearchDescription))
+	})
+	mux.HandleFunc("/catalog/search", func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+		w.Write([]byte(strings.Replace(atomFeed, "<title>Test</title>", "<title>Results</title>", 1)))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSearchLinks(t *testing.T) {
+	var queries []string
+	upstream := newSearchUpstream(t, &queries)
+
+	tests := []struct {
+		name   string
+		opts   Options
+		feed   string
+		prefix string
+	}{
+		{"prefix", Options{Prefixes: map[string]string{"/up/": upstream.URL + "/catalog/"}}, "/up/feed.atom", "http://example.com/up/search?q={query}"},
+		{"url", Options{Allow: []string{upstream.URL + "/"}}, "/?url=" + upstream.URL + "/catalog/feed.atom", "http://example.com/?search="},
+	}
+	for _, test := range tests {
+		test.opts.SearchLinks = true
+		h := New(test.opts)
+		queries = nil
+
+		w := get(h, test.feed)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", test.name, w.Code, w.Body)
+		}
+		feed, err := opds2.ParseBuffer(w.Body.Bytes())
+		if err != nil || len(feed.Links) != 1 {
+			t.Fatalf("%s: feed %v, links = %+v", test.name, err, feed.Links)
+		}
+		search := feed.Links[0]
+		if !search.Templated || search.TypeLink != "application/opds+json" || !strings.HasPrefix(search.Href, test.prefix) {
+			t.Fatalf("%s: search link = %+v", test.name, search)
+		}
+
+		href, errExpand := search.Expand(map[string]interface{}{"query": "moby dick & co"})
+		if errExpand != nil {
+			t.Fatalf("%s: %v", test.name, errExpand)
+		}
+		w = get(h, strings.TrimPrefix(href, "http://example.com"))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"Results"`) {
+			t.Errorf("%s: results status = %d: %s", test.name, w.Code, w.Body)
+		}
+		if len(queries) != 1 || queries[0] != "q=moby%20dick%20%26%20co&lang=*" {
+			t.Errorf("%s: upstream queries = %q", test.name, queries)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/opds-community/libopds2-go/index"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// maxFacetValues is the number of values of a facet shown in the feeds of
+// publications, the most used ones, the navigation feeds list all of them
+const maxFacetValues = 20
+
+// facets are the facets of the feeds of publications with their title
+var facets = []struct {
+	name  string
+	title string
+}{
+	{"language", "Languages"},
+	{"subject", "Subjects"},
+	{"author", "Authors"},
+}
+
+// newFeed create a feed with a self link, dated with the catalog
+func (v view) newFeed(title string, self string) opds2.Feed {
+	feed := opds2.New(title)
+	modified := v.modified
+	feed.Metadata.Modified = &modified
+	feed.AddLink(self, "self", FeedType, false)
+	feed.AddLink(v.url("/", nil), "start", FeedType, false)
+	return feed
+}
+
+// rootFeed return the navigation to the feeds of the catalog with groups
+// of the latest publications and of the main subjects
+func (v view) rootFeed() opds2.Feed {
+	feed := v.newFeed(v.opts.Title, v.url("/", nil))
+	if v.format == atomExtension {
+		// OPDS 1.2 search links are OpenSearch templates
+		feed.AddLink(v.url("/search", nil)+"?query={searchTerms}", "search", AcquisitionType, false)
+	} else {
+		feed.AddLink(v.url("/search", nil)+"{?query}", "search", FeedType, true)
+	}
+
+	feed.AddNavigation("All publications", v.url("/publications", nil), "subsection", FeedType)
+	for _, f := range facets {
+		feed.AddNavigation(f.title, v.url("/"+f.name+"s", nil), "subsection", FeedType)
+	}
+
+	total := len(v.publications)
+	latest := opds2.FilterPublications(v.publications)
+	opds2.SortPublications(latest, opds2.Reverse(opds2.ByModified))
+	v.addGroup(&feed, "Latest publications", v.url("/publications", url.Values{"sort": {"modified"}}), latest, total)
+
+	c := opds2.NewCollator(v.opts.Locale)
+	for i, s := range facetValues(v.publications, "subject", c) {
+		if i >= v.opts.RootGroups {
+			break
+		}
+		publications := opds2.FilterPublications(v.publications, hasValue("subject", s.Value))
+		v.addGroup(&feed, s.Value, v.url("/publications", url.Values{"subject": {s.Value}}), publications, s.Count)
+	}
+
+	return feed
+}
+
+// addGroup add a group with the first publications, href is the feed of
+// every publication of the group
+func (v view) addGroup(feed *opds2.Feed, title string, href string, publications []opds2.Publication, total int) {
+	collLink := opds2.Link{Href: href, Title: title, Rel: []string{"collection"}, Properties: &opds2.Properties{NumberOfItems: total}}
+	for i, p := range publications {
+		if i >= v.opts.GroupSize {
+			break
+		}
+		feed.AddPublicationInGroup(v.withSelf(p), collLink)
+	}
+}
+
+// publicationsFeed return a page of publications with the facets selected
+// by the query
+func (v view) publicationsFeed(query url.Values) (opds2.Feed, int) {
+
+	current, ok := page(query)
+	if !ok {
+		return opds2.Feed{}, http.StatusBadRequest
+	}
+
+	var filters []opds2.PublicationFilter
+	for _, f := range facets {
+		if value := query.Get(f.name); value != "" {
+			filters = append(filters, hasValue(f.name, value))
+		}
+	}
+	publications := opds2.FilterPublications(v.publications, filters...)
+
+	switch query.Get("sort") {
+	case "":
+	case "title":
+		opds2.SortPublications(publications, opds2.ByTitle(v.opts.Locale))
+	case "author":
+		opds2.SortPublications(publications, opds2.ByAuthor(v.opts.Locale), opds2.ByTitle(v.opts.Locale))
+	case "modified":
+		opds2.SortPublications(publications, opds2.Reverse(opds2.ByModified))
+	case "published":
+		opds2.SortPublications(publications, opds2.Reverse(opds2.ByPublished))
+	default:
+		return opds2.Feed{}, http.StatusBadRequest
+	}
+
+	perPage := v.opts.ItemsPerPage
+	last := (len(publications) + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+	if current > last {
+		return opds2.Feed{}, http.StatusNotFound
+	}
+
+	pageURL := func(n int) string {
+		q := url.Values{}
+		for k, values := range query {
+			q[k] = values
+		}
+		q.Del("page")
+		if n > 1 {
+			q.Set("page", strconv.Itoa(n))
+		}
+		return v.url("/publications", q)
+	}
+
+	feed := v.newFeed("Publications", pageURL(current))
+	var next, previous string
+	if current < last {
+		next = pageURL(current + 1)
+	}
+	if current > 1 {
+		previous = pageURL(current - 1)
+	}
+	feed.AddPagination(len(publications), perPage, current, next, previous, pageURL(1), pageURL(last))
+
+	for i := (current - 1) * perPage; i < len(publications) && i < current*perPage; i++ {
+		feed.Publications = append(feed.Publications, v.withSelf(publications[i]))
+	}
+
+	c := opds2.NewCollator(v.opts.Locale)
+	for _, f := range facets {
+		for i, value := range facetValues(v.publications, f.name, c) {
+			if i >= maxFacetValues {
+				break
+			}
+			q := url.Values{}
+			for k, values := range query {
+				q[k] = values
+			}
+			q.Del("page")
+			q.Set(f.name, value.Value)
+			l := opds2.Link{Href: v.url("/publications", q), Title: value.Value, TypeLink: FeedType,
+				Properties: &opds2.Properties{NumberOfItems: value.Count}}
+			if query.Get(f.name) == value.Value {
+				l.Rel = []string{"self"}
+			}
+			feed.AddFacet(l, f.title)
+		}
+	}
+
+	return feed, http.StatusOK
+}
+
+// searchFeed return a page of the publications matching the query
+func (v view) searchFeed(query url.Values) (opds2.Feed, int) {
+
+	text := query.Get("query")
+	current, ok := page(query)
+	if text == "" || !ok {
+		return opds2.Feed{}, http.StatusBadRequest
+	}
+
+	results := v.index.Search(index.Query{Text: text, Prefix: true, Fuzzy: true, Page: current, ItemsPerPage: v.opts.ItemsPerPage})
+	feed := results.Feed(index.FeedOptions{
+		Title: "Search: " + text,
+		PageURL: func(n int) string {
+			q := url.Values{"query": {text}}
+			if n > 1 {
+				q.Set("page", strconv.Itoa(n))
+			}
+			return v.url("/search", q)
+		},
+	})
+	modified := v.modified
+	feed.Metadata.Modified = &modified
+	feed.AddLink(v.url("/", nil), "start", FeedType, false)
+	for i := range feed.Publications {
+		feed.Publications[i] = v.withSelf(feed.Publications[i])
+	}
+
+	return feed, http.StatusOK
+}
+
+// facetFeed return the navigation to the publications of each value of a
+// facet
+func (v view) facetFeed(name string) opds2.Feed {
+	title := name
+	for _, f := range facets {
+		if f.name == name {
+			title = f.title
+		}
+	}
+
+	feed := v.newFeed(title, v.url("/"+name+"s", nil))
+	for _, value := range facetValues(v.publications, name, opds2.NewCollator(v.opts.Locale)) {
+		feed.Navigation = append(feed.Navigation, opds2.Link{
+			Href:       v.url("/publications", url.Values{name: {value.Value}}),
+			Title:      value.Value,
+			TypeLink:   FeedType,
+			Rel:        []string{"subsection"},
+			Properties: &opds2.Properties{NumberOfItems: value.Count},
+		})
+	}
+
+	return feed
+}
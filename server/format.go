@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/convert"
+	"github.com/opds-community/libopds2-go/opds1"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// media types of the OPDS 1.2 documents served
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	EntryType       = "application/atom+xml;type=entry;profile=opds-catalog"
+)
+
+// extensions selecting a format in the urls, "/index.atom" and
+// "/index.json" are the root feed
+const (
+	jsonExtension = ".json"
+	atomExtension = ".atom"
+)
+
+// media types accepted for each format, */* and application/* accept both
+var (
+	jsonTypes = []string{"application/opds+json", "application/opds-publication+json", "application/json"}
+	atomTypes = []string{"application/atom+xml", "application/xml", "text/xml"}
+)
+
+// view is a request of the catalog in a format, the links of the documents
+// keep the extension of the request so legacy clients stay in their
+// format, ext is empty when the format was negotiated
+type view struct {
+	*Handler
+	format string
+	ext    string
+}
+
+// newView return the view of a request path with the path without
+// extension, accept is used when the path has no extension
+func newView(h *Handler, path string, accept string) (view, string) {
+	for _, ext := range []string{jsonExtension, atomExtension} {
+		if strings.HasSuffix(path, ext) {
+			path = strings.TrimSuffix(path, ext)
+			if path == "/index" {
+				path = "/"
+			}
+			return view{Handler: h, format: ext, ext: ext}, path
+		}
+	}
+	return view{Handler: h, format: negotiate(accept)}, path
+}
+
+// negotiate return the format preferred by an Accept header, OPDS 2.0 when
+// both are accepted with the same quality or none is
+func negotiate(accept string) string {
+	var jsonQ, atomQ float64
+
+	for _, r := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if mediaType == "*/*" || mediaType == "application/*" || hasType(jsonTypes, mediaType) {
+			if q > jsonQ {
+				jsonQ = q
+			}
+		}
+		if mediaType == "*/*" || mediaType == "application/*" || mediaType == "text/*" || hasType(atomTypes, mediaType) {
+			if q > atomQ {
+				atomQ = q
+			}
+		}
+	}
+
+	if atomQ > jsonQ {
+		return atomExtension
+	}
+	return jsonExtension
+}
+
+func hasType(types []string, mediaType string) bool {
+	for _, t := range types {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// url return the url of a path of the catalog with its query, with the
+// extension of the view
+func (v view) url(path string, query url.Values) string {
+	if v.ext != "" {
+		if path == "/" {
+			path = "/index"
+		}
+		path += v.ext
+	}
+	return v.Handler.url(path, query)
+}
+
+// alternateURL return the url of the path in the other format
+func (v view) alternateURL(path string, rawQuery string) string {
+	ext := atomExtension
+	if v.format == atomExtension {
+		ext = jsonExtension
+	}
+	if path == "/" || path == "" {
+		path = "/index"
+	}
+	u := v.opts.BasePath + path + ext
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	return u
+}
+
+// render return the document in the format of the view with its media
+// type, with an alternate link to the other format
+func (v view) render(doc interface{}, path string, rawQuery string) ([]byte, string, error) {
+	alternate := v.alternateURL(path, rawQuery)
+
+	if v.format == atomExtension {
+		switch d := doc.(type) {
+		case *opds2.Feed:
+			feed := convert.ToOPDS1(d)
+			// the conversion can not tell a navigation feed from its links
+			for i := range feed.Links {
+				if feed.Links[i].Rel == "self" {
+					feed.Links[i].TypeLink = feedKind(d)
+				}
+			}
+			// added after the conversion that change the type of the
+			// OPDS 2.0 links
+			feed.Links = append(feed.Links, opds1.Link{Href: alternate, TypeLink: FeedType, Rel: "alternate"})
+			body, err := opds1.Marshal(&feed)
+			return body, feedKind(d), err
+		case *opds2.Publication:
+			d.Links = append(d.Links, opds2.Link{Href: alternate, TypeLink: PublicationType, Rel: []string{"alternate"}})
+			entry := convert.ToOPDS1Entry(d, v.modified)
+			body, err := opds1.MarshalEntry(&entry)
+			return body, EntryType, err
+		}
+	}
+
+	mediaType := FeedType
+	switch d := doc.(type) {
+	case *opds2.Feed:
+		d.AddLink(alternate, "alternate", feedKind(d), false)
+	case *opds2.Publication:
+		d.Links = append(d.Links, opds2.Link{Href: alternate, TypeLink: EntryType, Rel: []string{"alternate"}})
+		mediaType = PublicationType
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, "", err
+	}
+	return b.Bytes(), mediaType, nil
+}
+
+// feedKind return the OPDS 1.2 type of a feed, feeds without publications
+// only link to other feeds
+func feedKind(feed *opds2.Feed) string {
+	if len(feed.Publications) == 0 && len(feed.Groups) == 0 {
+		return NavigationType
+	}
+	return AcquisitionType
+}
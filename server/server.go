@@ -0,0 +1,322 @@
+// Package server serve a browsable OPDS 2.0 catalog of publications kept
+// in memory: a root feed with navigation and groups, paginated feeds of
+// publications with facets by language, subject and author, a search
+// and a manifest for each publication.
+//
+//	h := server.New(publications, server.Options{Title: "My library"})
+//	http.ListenAndServe(":8080", h)
+//
+// The urls served, relative to Options.BasePath, are:
+//
+//	/                          root navigation feed with groups
+//	/publications              publications, ?page=, ?sort=title|author|modified|published,
+//	                           ?language=, ?subject= and ?author= select a facet
+//	/languages, /subjects, /authors
+//	                           navigation feeds of the facet values
+//	/search?query=             search, the root feed has a templated link to it
+//	/publications/{id}         manifest of a publication, the id is a hash
+//	                           of its key
+//
+// Every url serve OPDS 2.0 or OPDS 1.2 negotiated with the Accept header,
+// the extensions ".json" and ".atom" select a format, like "/index.atom"
+// for the root feed, and the documents link to the other format with an
+// alternate link.
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opds-community/libopds2-go/index"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// media types of the documents served
+const (
+	FeedType        = "application/opds+json"
+	PublicationType = "application/opds-publication+json"
+)
+
+// Options configure the catalog
+type Options struct {
+	// Title of the root feed, "Catalog" when empty
+	Title string
+	// BasePath is the path the handler is mounted on, like "/opds", with
+	// the prefix removed from the requests by http.StripPrefix
+	BasePath string
+	// ItemsPerPage is the size of the pages of publications, 20 when zero
+	ItemsPerPage int
+	// GroupSize is the number of publications in the groups of the root
+	// feed, 5 when zero
+	GroupSize int
+	// RootGroups is the number of subjects with a group in the root feed
+	// after the latest publications, 3 when zero
+	RootGroups int
+	// Locale is used to sort by title, author and facet values
+	Locale string
+}
+
+// Handler is the http.Handler of the catalog, it is safe for concurrent
+// use
+type Handler struct {
+	opts Options
+
+	mutex        sync.RWMutex
+	publications []opds2.Publication
+	// ids are the indexes of the publications by id
+	ids      map[string]int
+	index    *index.Index
+	modified time.Time
+}
+
+// New create a catalog of the publications
+func New(publications []opds2.Publication, opts Options) *Handler {
+
+	if opts.Title == "" {
+		opts.Title = "Catalog"
+	}
+	if opts.ItemsPerPage <= 0 {
+		opts.ItemsPerPage = 20
+	}
+	if opts.GroupSize <= 0 {
+		opts.GroupSize = 5
+	}
+	if opts.RootGroups <= 0 {
+		opts.RootGroups = 3
+	}
+	opts.BasePath = strings.TrimSuffix(opts.BasePath, "/")
+
+	h := &Handler{opts: opts}
+	h.SetPublications(publications)
+
+	return h
+}
+
+// SetPublications replace the publications of the catalog, the
+// modification date of the catalog is the latest modification of a
+// publication or now when they have none
+func (h *Handler) SetPublications(publications []opds2.Publication) {
+
+	ids := make(map[string]int)
+	idx := index.New()
+	var modified time.Time
+	for i := range publications {
+		p := &publications[i]
+		ids[publicationID(p)] = i
+		if p.Metadata.Modified != nil && p.Metadata.Modified.After(modified) {
+			modified = *p.Metadata.Modified
+		}
+	}
+	idx.Add(publications...)
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.publications = publications
+	h.ids = ids
+	h.index = idx
+	// Last-Modified has a precision of a second
+	h.modified = modified.UTC().Truncate(time.Second)
+}
+
+// ServeHTTP serve the feeds and manifests of the catalog
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v, path := newView(h, r.URL.EscapedPath(), r.Header.Get("Accept"))
+	if v.ext == "" {
+		// the same url serve both formats
+		w.Header().Add("Vary", "Accept")
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	doc, status := v.document(path, r.URL.Query())
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	body, mediaType, err := v.render(doc, path, r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeBody(w, r, mediaType, body, h.modified)
+}
+
+// writeBody write body with an ETag, ServeContent answer the conditional
+// requests and HEAD
+func writeBody(w http.ResponseWriter, r *http.Request, mediaType string, body []byte, modified time.Time) {
+	sum := sha1.Sum(body)
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+// document return the feed or the manifest at a path, without its
+// extension
+func (v view) document(path string, query url.Values) (interface{}, int) {
+
+	switch path {
+	case "/", "":
+		feed := v.rootFeed()
+		return &feed, http.StatusOK
+	case "/publications":
+		feed, status := v.publicationsFeed(query)
+		return &feed, status
+	case "/search":
+		feed, status := v.searchFeed(query)
+		return &feed, status
+	case "/languages", "/subjects", "/authors":
+		feed := v.facetFeed(strings.TrimSuffix(path[1:], "s"))
+		return &feed, http.StatusOK
+	}
+
+	if strings.HasPrefix(path, "/publications/") {
+		i, ok := v.ids[strings.TrimPrefix(path, "/publications/")]
+		if !ok {
+			return nil, http.StatusNotFound
+		}
+		p := v.withSelf(v.publications[i])
+		return &p, http.StatusOK
+	}
+
+	return nil, http.StatusNotFound
+}
+
+// url return the url of a path of the catalog with its query
+func (h *Handler) url(path string, query url.Values) string {
+	u := h.opts.BasePath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// PublicationURL return the url of the manifest of a publication
+func (h *Handler) PublicationURL(p *opds2.Publication) string {
+	return h.url("/publications/"+publicationID(p), nil)
+}
+
+// publicationID return the id of a publication in the urls, keys are
+// often urls that can not be used in a path and could end with the
+// extension of a format
+func publicationID(p *opds2.Publication) string {
+	sum := sha1.Sum([]byte(p.Key()))
+	return hex.EncodeToString(sum[:10])
+}
+
+// withSelf return a copy of the publication with a self link to its
+// manifest
+func (v view) withSelf(p opds2.Publication) opds2.Publication {
+	self := opds2.Link{Href: v.url("/publications/"+publicationID(&p), nil), TypeLink: PublicationType, Rel: []string{"self"}}
+	if v.format == atomExtension {
+		self.TypeLink = EntryType
+	}
+	links := []opds2.Link{self}
+	for _, l := range p.Links {
+		if !l.HasRel("self") {
+			links = append(links, l)
+		}
+	}
+	p.Links = links
+	// images are required, the ones of a publication without any are
+	// written as an empty array rather than null
+	if p.Images == nil {
+		p.Images = []opds2.Link{}
+	}
+	return p
+}
+
+// page return the page number of the query, 1 when it is missing, false
+// when it is not a positive number
+func page(query url.Values) (int, bool) {
+	s := query.Get("page")
+	if s == "" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// facetValues return the values of a facet of the publications with the
+// number of publications having each, the most used first
+func facetValues(publications []opds2.Publication, facet string, c *opds2.Collator) []index.FacetCount {
+	counts := make(map[string]int)
+
+	for i := range publications {
+		seen := make(map[string]bool)
+		for _, v := range publicationValues(&publications[i], facet) {
+			if v != "" && !seen[v] {
+				seen[v] = true
+				counts[v]++
+			}
+		}
+	}
+
+	var values []index.FacetCount
+	for v, n := range counts {
+		values = append(values, index.FacetCount{Value: v, Count: n})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return c.Compare(values[i].Value, values[j].Value) < 0
+	})
+
+	return values
+}
+
+// publicationValues return the values of a facet for a publication
+func publicationValues(p *opds2.Publication, facet string) []string {
+	var values []string
+
+	switch facet {
+	case "language":
+		values = append(values, p.Metadata.Language...)
+	case "subject":
+		for _, s := range p.Metadata.Subject {
+			values = append(values, s.Name)
+		}
+	case "author":
+		for _, a := range p.Metadata.Author {
+			values = append(values, a.Name.String())
+		}
+	}
+
+	return values
+}
+
+// hasValue keep the publications with the value for the facet
+func hasValue(facet string, value string) opds2.PublicationFilter {
+	return func(p *opds2.Publication) bool {
+		for _, v := range publicationValues(p, facet) {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
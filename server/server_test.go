@@ -0,0 +1,325 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// testPublication return a publication with an open access link
+func testPublication(identifier string, title string, author string, language string, subject string, modified time.Time) opds2.Publication {
+	p := opds2.Publication{}
+	p.Metadata.Identifier = identifier
+	p.Metadata.Title.SingleString = title
+	p.Metadata.Language = []string{language}
+	p.Metadata.Modified = &modified
+	p.Metadata.Subject = []opds2.Subject{{Name: subject}}
+	p.AddAuthor(author, "", "", "", "")
+	p.AddLink("http://example.com/"+strings.ToLower(strings.Replace(title, " ", "-", -1))+".epub",
+		"application/epub+zip", opds2.RelOpenAccess, "")
+	return p
+}
+
+func newTestHandler() *Handler {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	return New([]opds2.Publication{
+		testPublication("urn:isbn:1", "Moby Dick", "Herman Melville", "en", "Sea", day(1)),
+		testPublication("urn:isbn:2", "Les Misérables", "Victor Hugo", "fr", "History", day(2)),
+		testPublication("urn:isbn:3", "Bartleby", "Herman Melville", "en", "Short stories", day(3)),
+		testPublication("http://example.com/file.json", "Notre-Dame de Paris", "Victor Hugo", "fr", "History", day(4)),
+		testPublication("urn:isbn:5", "Typee", "Herman Melville", "en", "Sea", day(5)),
+	}, Options{Title: "Test", ItemsPerPage: 2})
+}
+
+func request(h http.Handler, method string, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// getFeed request an OPDS 2.0 feed and parse it
+func getFeed(t *testing.T, h http.Handler, target string) *opds2.Feed {
+	t.Helper()
+	w := request(h, "GET", target, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d", target, w.Code)
+	}
+	feed, err := opds2.ParseBuffer(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("%s: %s", target, err)
+	}
+	return feed
+}
+
+func titles(publications []opds2.Publication) []string {
+	var t []string
+	for _, p := range publications {
+		t = append(t, p.Metadata.Title.String())
+	}
+	return t
+}
+
+func linkHref(links []opds2.Link, rel string) string {
+	for _, l := range links {
+		for _, r := range l.Rel {
+			if r == rel {
+				return l.Href
+			}
+		}
+	}
+	return ""
+}
+
+func TestNegotiation(t *testing.T) {
+	h := newTestHandler()
+
+	tests := []struct {
+		target string
+		accept string
+		want   string
+	}{
+		{"/", "", FeedType},
+		{"/", "application/opds+json", FeedType},
+		{"/", "application/atom+xml", AcquisitionType},
+		{"/", "application/atom+xml;q=0.9, application/opds+json;q=0.5", AcquisitionType},
+		{"/", "text/html, */*;q=0.1", FeedType},
+		{"/index.atom", "application/opds+json", AcquisitionType},
+		{"/subjects", "application/atom+xml", NavigationType},
+		{"/index.json", "application/atom+xml", FeedType},
+		{"/publications", "application/atom+xml", AcquisitionType},
+		{"/publications.json", "", FeedType},
+	}
+	for _, test := range tests {
+		w := request(h, "GET", test.target, map[string]string{"Accept": test.accept})
+		if got := w.Header().Get("Content-Type"); got != test.want {
+			t.Errorf("%s with %q: Content-Type = %q, want %q", test.target, test.accept, got, test.want)
+		}
+		negotiated := !strings.HasSuffix(test.target, ".atom") && !strings.HasSuffix(test.target, ".json")
+		if vary := w.Header().Get("Vary") == "Accept"; vary != negotiated {
+			t.Errorf("%s: Vary = %q", test.target, w.Header().Get("Vary"))
+		}
+	}
+
+	// links of an url with an extension keep the extension
+	w := request(h, "GET", "/index.atom", nil)
+	if !strings.Contains(w.Body.String(), `href="/publications.atom"`) {
+		t.Errorf("root feed in atom does not link to /publications.atom: %s", w.Body)
+	}
+	feed := getFeed(t, h, "/index.json")
+	if got := linkHref(feed.Links, "alternate"); got != "/index.atom" {
+		t.Errorf("alternate = %q", got)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	h := newTestHandler()
+
+	feed := getFeed(t, h, "/publications?sort=title")
+	if feed.Metadata.NumberOfItems != 5 || feed.Metadata.ItemsPerPage != 2 || feed.Metadata.CurrentPage != 1 {
+		t.Errorf("metadata = %+v", feed.Metadata)
+	}
+	if got := titles(feed.Publications); strings.Join(got, ",") != "Bartleby,Les Misérables" {
+		t.Errorf("first page = %v", got)
+	}
+	if got := linkHref(feed.Links, "last"); got != "/publications?page=3&sort=title" {
+		t.Errorf("last = %q", got)
+	}
+
+	feed = getFeed(t, h, linkHref(feed.Links, "next"))
+	if got := titles(feed.Publications); strings.Join(got, ",") != "Moby Dick,Notre-Dame de Paris" {
+		t.Errorf("second page = %v", got)
+	}
+	if got := linkHref(feed.Links, "previous"); got != "/publications?sort=title" {
+		t.Errorf("previous = %q", got)
+	}
+
+	feed = getFeed(t, h, "/publications?sort=title&page=3")
+	if got := titles(feed.Publications); len(got) != 1 || linkHref(feed.Links, "next") != "" {
+		t.Errorf("last page = %v, next = %q", got, linkHref(feed.Links, "next"))
+	}
+
+	for target, status := range map[string]int{
+		"/publications?page=4":      http.StatusNotFound,
+		"/publications?page=0":      http.StatusBadRequest,
+		"/publications?sort=colour": http.StatusBadRequest,
+	} {
+		if w := request(h, "GET", target, nil); w.Code != status {
+			t.Errorf("%s: status = %d, want %d", target, w.Code, status)
+		}
+	}
+}
+
+func TestFacets(t *testing.T) {
+	h := newTestHandler()
+
+	feed := getFeed(t, h, "/publications?language=fr&sort=title")
+	if got := titles(feed.Publications); strings.Join(got, ",") != "Les Misérables,Notre-Dame de Paris" {
+		t.Errorf("publications in french = %v", got)
+	}
+
+	var active []string
+	for _, f := range feed.Facets {
+		for _, l := range f.Links {
+			if linkHref([]opds2.Link{l}, "self") != "" {
+				active = append(active, f.Metadata.Title+"="+l.Title)
+			}
+			if f.Metadata.Title == "Authors" && l.Title == "Herman Melville" && l.Properties.NumberOfItems != 3 {
+				t.Errorf("count of %s = %d", l.Title, l.Properties.NumberOfItems)
+			}
+		}
+	}
+	if strings.Join(active, ",") != "Languages=fr" {
+		t.Errorf("active facets = %v", active)
+	}
+
+	feed = getFeed(t, h, "/authors")
+	if len(feed.Navigation) != 2 || feed.Navigation[0].Title != "Herman Melville" {
+		t.Errorf("authors = %+v", feed.Navigation)
+	}
+	author := feed.Navigation[1]
+	feed = getFeed(t, h, author.Href)
+	if len(feed.Publications) != 2 {
+		t.Errorf("publications of %s = %v", author.Title, titles(feed.Publications))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	h := newTestHandler()
+
+	root := getFeed(t, h, "/")
+	search := opds2.Link{}
+	for _, l := range root.Links {
+		if linkHref([]opds2.Link{l}, "search") != "" {
+			search = l
+		}
+	}
+	if !search.Templated {
+		t.Fatalf("search link = %+v", search)
+	}
+	target, err := search.Expand(map[string]interface{}{"query": "moby"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed := getFeed(t, h, target)
+	if got := titles(feed.Publications); len(got) != 1 || got[0] != "Moby Dick" {
+		t.Errorf("search moby = %v", got)
+	}
+	feed = getFeed(t, h, "/search?query=melvile")
+	if len(feed.Publications) != 2 || linkHref(feed.Links, "next") == "" {
+		t.Errorf("fuzzy search = %v, next = %q", titles(feed.Publications), linkHref(feed.Links, "next"))
+	}
+
+	if w := request(h, "GET", "/search", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("search without query: status = %d", w.Code)
+	}
+}
+
+func TestManifests(t *testing.T) {
+	h := newTestHandler()
+
+	feed := getFeed(t, h, "/publications")
+	if len(feed.Publications) == 0 {
+		t.Fatal("no publication")
+	}
+	for page := feed; ; {
+		for _, p := range page.Publications {
+			self := linkHref(p.Links, "self")
+			w := request(h, "GET", self, nil)
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != PublicationType {
+				t.Errorf("%s: %s: status = %d, type = %q", p.Metadata.Identifier, self, w.Code, w.Header().Get("Content-Type"))
+				continue
+			}
+			manifest, err := opds2.ParsePublicationBuffer(w.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Metadata.Identifier != p.Metadata.Identifier || linkHref(manifest.Links, "self") != self {
+				t.Errorf("%s: manifest of %s", self, manifest.Metadata.Identifier)
+			}
+			if !strings.Contains(w.Body.String(), `"images":[]`) {
+				t.Errorf("%s: images not written as an empty array", self)
+			}
+
+			atom := request(h, "GET", linkHref(manifest.Links, "alternate"), nil)
+			if atom.Code != http.StatusOK || atom.Header().Get("Content-Type") != EntryType {
+				t.Errorf("%s: alternate status = %d, type = %q", self, atom.Code, atom.Header().Get("Content-Type"))
+			}
+		}
+		next := linkHref(page.Links, "next")
+		if next == "" {
+			break
+		}
+		page = getFeed(t, h, next)
+	}
+
+	if w := request(h, "GET", "/publications/unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown publication: status = %d", w.Code)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	h := newTestHandler()
+
+	for _, target := range []string{"/", "/publications?page=2", "/index.atom", "/publications.atom?language=en"} {
+		w := request(h, "GET", target, nil)
+		etag := w.Header().Get("ETag")
+		modified := w.Header().Get("Last-Modified")
+		if etag == "" || modified != "Sun, 05 Jan 2020 00:00:00 GMT" {
+			t.Errorf("%s: ETag = %q, Last-Modified = %q", target, etag, modified)
+		}
+
+		if w := request(h, "GET", target, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+			t.Errorf("%s: If-None-Match: status = %d", target, w.Code)
+		}
+		if w := request(h, "GET", target, map[string]string{"If-Modified-Since": modified}); w.Code != http.StatusNotModified {
+			t.Errorf("%s: If-Modified-Since: status = %d", target, w.Code)
+		}
+		if w := request(h, "GET", target, map[string]string{"If-None-Match": `"other"`}); w.Code != http.StatusOK {
+			t.Errorf("%s: other ETag: status = %d", target, w.Code)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	h := newTestHandler()
+
+	get := request(h, "GET", "/publications", nil)
+	head := request(h, "HEAD", "/publications", nil)
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Errorf("HEAD: status = %d, body = %q", head.Code, head.Body)
+	}
+	for _, k := range []string{"Content-Type", "Content-Length", "ETag", "Last-Modified"} {
+		if head.Header().Get(k) == "" || head.Header().Get(k) != get.Header().Get(k) {
+			t.Errorf("HEAD: %s = %q, GET %s = %q", k, head.Header().Get(k), k, get.Header().Get(k))
+		}
+	}
+
+	if w := request(h, "POST", "/publications", nil); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST: status = %d, Allow = %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestAtomWithoutModified(t *testing.T) {
+	p := testPublication("urn:isbn:1", "Moby Dick", "Herman Melville", "en", "Sea", time.Time{})
+	p.Metadata.Modified = nil
+	h := New([]opds2.Publication{p}, Options{})
+
+	// the entries are dated with the catalog so the documents do not change
+	for _, target := range []string{"/publications.atom", "/publications/" + publicationID(&p) + ".atom"} {
+		first := request(h, "GET", target, nil)
+		time.Sleep(10 * time.Millisecond)
+		second := request(h, "GET", target, map[string]string{"If-None-Match": first.Header().Get("ETag")})
+		if second.Code != http.StatusNotModified {
+			t.Errorf("%s: status = %d", target, second.Code)
+		}
+	}
+}
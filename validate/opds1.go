@@ -0,0 +1,210 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds1"
+)
+
+// OPDS1XML check an OPDS 1.x feed document, the error is only for a
+// document that can not be parsed
+func OPDS1XML(buff []byte) ([]Violation, error) {
+
+	feed, err := opds1.ParseBuffer(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	return OPDS1(feed), nil
+}
+
+// OPDS1 check a feed against the rules of OPDS 1.2 and of the Atom
+// elements it requires, the pointer of the violations is an XPath like
+// /feed/entry[2]/link[1] as an xml document has no JSON pointer
+func OPDS1(feed *opds1.Feed) []Violation {
+	var violations []Violation
+	add := func(pointer string, severity Severity, rule string, format string, args ...interface{}) {
+		violations = append(violations, Violation{Pointer: pointer, Severity: severity, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if feed.ID == "" {
+		add("/feed", Error, "atom-required", "missing atom:id")
+	}
+	if feed.Title == "" {
+		add("/feed", Error, "atom-required", "missing atom:title")
+	}
+	if feed.Updated.IsZero() {
+		add("/feed", Error, "atom-required", "missing atom:updated")
+	}
+	if !hasOPDS1Rel(feed.Links, "self") {
+		add("/feed", Warning, "self-link", "a feed should have a link with the self relation")
+	}
+
+	active := make(map[string]int)
+	for i, l := range feed.Links {
+		pointer := fmt.Sprintf("/feed/link[%d]", i+1)
+		violations = append(violations, opds1LinkRules(l, pointer)...)
+		if l.Rel != "http://opds-spec.org/facet" {
+			continue
+		}
+		if l.Title == "" {
+			add(pointer, Error, "facet", "a facet link must have a title")
+		}
+		if l.FacetGroup == "" {
+			add(pointer, Warning, "facet", "a facet link should have an opds:facetGroup")
+		}
+		if l.ActiveFacet {
+			active[l.FacetGroup]++
+			if active[l.FacetGroup] == 2 {
+				add(pointer, Error, "facet", "more than one active facet in the group %q", l.FacetGroup)
+			}
+		}
+	}
+
+	// a feed with publications is an acquisition feed, all its entries
+	// must be publications
+	acquisitionFeed := false
+	for _, e := range feed.Entries {
+		if hasOPDS1Acquisition(e.Links) {
+			acquisitionFeed = true
+		}
+	}
+
+	for i, e := range feed.Entries {
+		pointer := fmt.Sprintf("/feed/entry[%d]", i+1)
+
+		if e.ID == "" {
+			add(pointer, Error, "atom-required", "missing atom:id")
+		}
+		if e.Title == "" {
+			add(pointer, Error, "atom-required", "missing atom:title")
+		}
+		if e.Updated == nil || e.Updated.IsZero() {
+			add(pointer, Error, "atom-required", "missing atom:updated")
+		}
+
+		switch {
+		case len(e.Links) == 0:
+			add(pointer, Error, "entry-link", "an entry must have a link to a publication or a catalog feed")
+		case acquisitionFeed && !hasOPDS1Acquisition(e.Links):
+			add(pointer, Error, "acquisition-link", "an entry of an acquisition feed must have at least one acquisition link")
+		}
+
+		if e.Language != "" && !languageTag.MatchString(e.Language) {
+			add(pointer+"/language", Warning, "language", "%q is not a BCP 47 language tag", e.Language)
+		}
+		if !validContentType(e.Summary.ContentType) {
+			add(pointer+"/summary", Error, "content-type", "unknown content type %q", e.Summary.ContentType)
+		}
+		if !validContentType(e.Content.ContentType) {
+			add(pointer+"/content", Error, "content-type", "unknown content type %q", e.Content.ContentType)
+		}
+
+		for j, l := range e.Links {
+			violations = append(violations, opds1LinkRules(l, fmt.Sprintf("%s/link[%d]", pointer, j+1))...)
+		}
+	}
+
+	return violations
+}
+
+var (
+	languageTag  = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// opds1Rels are the acquisition relations defined by OPDS 1.2
+var opds1Rels = map[string]bool{
+	"http://opds-spec.org/acquisition":             true,
+	"http://opds-spec.org/acquisition/open-access": true,
+	"http://opds-spec.org/acquisition/borrow":      true,
+	"http://opds-spec.org/acquisition/buy":         true,
+	"http://opds-spec.org/acquisition/sample":      true,
+	"http://opds-spec.org/acquisition/preview":     true,
+	"http://opds-spec.org/acquisition/subscribe":   true,
+}
+
+// opds1LinkRules check a link of a feed or an entry
+func opds1LinkRules(l opds1.Link, pointer string) []Violation {
+	var violations []Violation
+	add := func(severity Severity, rule string, format string, args ...interface{}) {
+		violations = append(violations, Violation{Pointer: pointer, Severity: severity, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if l.Href == "" {
+		add(Error, "link-href", "a link must have an href")
+	}
+
+	if strings.HasPrefix(l.Rel, "http://opds-spec.org/acquisition") {
+		if !opds1Rels[l.Rel] {
+			add(Error, "acquisition-link", "unknown acquisition relation %q", l.Rel)
+		}
+		if l.TypeLink == "" {
+			add(Warning, "link-type", "an acquisition link should have a media type")
+		}
+	}
+
+	switch l.Rel {
+	case "http://opds-spec.org/image", "http://opds-spec.org/image/thumbnail",
+		"x-stanza-cover-image", "x-stanza-cover-image-thumbnail":
+		if l.TypeLink != "" && !strings.HasPrefix(l.TypeLink, "image/") {
+			add(Error, "image-type", "%q is not an image media type", l.TypeLink)
+		}
+	}
+
+	if l.Price.CurrencyCode != "" && !currencyCode.MatchString(l.Price.CurrencyCode) {
+		add(Error, "price", "%q is not an ISO 4217 currency code", l.Price.CurrencyCode)
+	}
+	if l.Price.CurrencyCode == "" && l.Price.Value != 0 {
+		add(Error, "price", "a price must have a currency code")
+	}
+
+	violations = append(violations, opds1IndirectRules(l.IndirectAcquisition, pointer)...)
+
+	return violations
+}
+
+func opds1IndirectRules(indirect []opds1.IndirectAcquisition, pointer string) []Violation {
+	var violations []Violation
+
+	for i, ia := range indirect {
+		p := fmt.Sprintf("%s/indirectAcquisition[%d]", pointer, i+1)
+		if ia.TypeAcquisition == "" {
+			violations = append(violations, Violation{Pointer: p, Severity: Error, Rule: "indirect-acquisition",
+				Message: "an indirect acquisition must have a media type"})
+		}
+		violations = append(violations, opds1IndirectRules(ia.IndirectAcquisition, p)...)
+	}
+
+	return violations
+}
+
+// validContentType check the type of an atom text construct, text, html,
+// xhtml or a media type for content
+func validContentType(t string) bool {
+	switch t {
+	case "", "text", "html", "xhtml":
+		return true
+	}
+	return strings.Contains(t, "/")
+}
+
+func hasOPDS1Rel(links []opds1.Link, rel string) bool {
+	for _, l := range links {
+		if l.Rel == rel {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOPDS1Acquisition(links []opds1.Link) bool {
+	for _, l := range links {
+		if strings.HasPrefix(l.Rel, "http://opds-spec.org/acquisition") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,530 @@
+package validate
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// schemas are the OPDS 2.0 schemas and the Readium Web Publication
+// Manifest schemas they reference
+//
+//go:embed schemas
+var schemaFiles embed.FS
+
+// schema ids of the documents that can be validated
+const (
+	FeedSchema        = "https://drafts.opds.io/schema/feed.schema.json"
+	PublicationSchema = "https://drafts.opds.io/schema/publication.schema.json"
+)
+
+// schemaSet hold the decoded schemas by id, only the subset of JSON Schema
+// draft 7 used by the bundled schemas is supported
+type schemaSet struct {
+	docs     map[string]interface{}
+	patterns map[string]*regexp.Regexp
+	mutex    sync.Mutex
+}
+
+var (
+	bundledOnce sync.Once
+	bundled     *schemaSet
+	bundledErr  error
+)
+
+// loadSchemas decode the embedded schemas once
+func loadSchemas() (*schemaSet, error) {
+
+	bundledOnce.Do(func() {
+		set := &schemaSet{docs: make(map[string]interface{}), patterns: make(map[string]*regexp.Regexp)}
+		bundledErr = fs.WalkDir(schemaFiles, "schemas", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+				return err
+			}
+			buff, errRead := schemaFiles.ReadFile(path)
+			if errRead != nil {
+				return errRead
+			}
+			var doc map[string]interface{}
+			if errJSON := json.Unmarshal(buff, &doc); errJSON != nil {
+				return fmt.Errorf("%s: %s", path, errJSON)
+			}
+			id, _ := doc["$id"].(string)
+			if id == "" {
+				return fmt.Errorf("%s: missing $id", path)
+			}
+			set.docs[id] = doc
+			return nil
+		})
+		bundled = set
+	})
+
+	return bundled, bundledErr
+}
+
+// validate check value against the schema with the id, the violations
+// are reported with pointers relative to pointer
+func (s *schemaSet) validate(id string, value interface{}, pointer string) []Violation {
+	var out []Violation
+
+	doc, ok := s.docs[id]
+	if !ok {
+		return []Violation{{Pointer: pointer, Severity: Error, Rule: "schema", Message: "unknown schema " + id}}
+	}
+	base, _ := url.Parse(id)
+	s.check(base, doc, value, pointer, &out)
+
+	return out
+}
+
+// check validate value against the schema sch found in the document at
+// base and append the violations to out
+func (s *schemaSet) check(base *url.URL, sch interface{}, value interface{}, pointer string, out *[]Violation) {
+
+	m, ok := sch.(map[string]interface{})
+	if !ok {
+		// a false schema reject every value
+		if allowed, isBool := sch.(bool); isBool && !allowed {
+			s.report(out, pointer, "value is not allowed")
+		}
+		return
+	}
+
+	if ref, ok := m["$ref"].(string); ok {
+		refBase, target, err := s.resolve(base, ref)
+		if err != nil {
+			s.report(out, pointer, err.Error())
+			return
+		}
+		// keywords next to $ref are ignored in draft 7
+		s.check(refBase, target, value, pointer, out)
+		return
+	}
+
+	if t, ok := m["type"]; ok && !matchType(t, value) {
+		s.report(out, pointer, fmt.Sprintf("expected %s, got %s", typeList(t), jsonType(value)))
+		// the other keywords would only repeat the type error
+		return
+	}
+
+	if c, ok := m["const"]; ok && !jsonEqual(c, value) {
+		s.report(out, pointer, fmt.Sprintf("value must be %s", jsonString(c)))
+	}
+	if e, ok := m["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range e {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			var allowed []string
+			for _, a := range e {
+				allowed = append(allowed, jsonString(a))
+			}
+			s.report(out, pointer, fmt.Sprintf("value %s must be one of %s", jsonString(value), strings.Join(allowed, ", ")))
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		s.checkString(m, value, pointer, out)
+	case float64:
+		s.checkNumber(m, value, pointer, out)
+	case []interface{}:
+		s.checkArray(base, m, value, pointer, out)
+	case map[string]interface{}:
+		s.checkObject(base, m, value, pointer, out)
+	}
+
+	if all, ok := m["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.check(base, sub, value, pointer, out)
+		}
+	}
+	if anyOf, ok := m["anyOf"].([]interface{}); ok {
+		if best, n := s.matching(base, anyOf, value, pointer); n == 0 {
+			s.reportBranch(out, pointer, "value does not match any of the allowed schemas", best)
+		}
+	}
+	if oneOf, ok := m["oneOf"].([]interface{}); ok {
+		best, n := s.matching(base, oneOf, value, pointer)
+		if n == 0 {
+			s.reportBranch(out, pointer, "value does not match any of the allowed schemas", best)
+		} else if n > 1 {
+			s.report(out, pointer, "value match more than one schema of oneOf")
+		}
+	}
+	if not, ok := m["not"]; ok {
+		var sub []Violation
+		s.check(base, not, value, pointer, &sub)
+		if len(sub) == 0 {
+			s.report(out, pointer, "value match a forbidden schema")
+		}
+	}
+	if cond, ok := m["if"]; ok {
+		var sub []Violation
+		s.check(base, cond, value, pointer, &sub)
+		if len(sub) == 0 {
+			if then, ok := m["then"]; ok {
+				s.check(base, then, value, pointer, out)
+			}
+		} else if els, ok := m["else"]; ok {
+			s.check(base, els, value, pointer, out)
+		}
+	}
+}
+
+// matching count the schemas matched by value, best are the violations
+// of the closest schema when none match
+func (s *schemaSet) matching(base *url.URL, schemas []interface{}, value interface{}, pointer string) ([]Violation, int) {
+	var best []Violation
+	n := 0
+
+	for _, sub := range schemas {
+		var v []Violation
+		s.check(base, sub, value, pointer, &v)
+		if len(v) == 0 {
+			n++
+			continue
+		}
+		if best == nil || len(v) < len(best) || isTypeMismatch(best) && !isTypeMismatch(v) {
+			best = v
+		}
+	}
+
+	return best, n
+}
+
+// isTypeMismatch check if the violations only say the value has the
+// wrong type, a branch with more specific errors is a better explanation
+func isTypeMismatch(v []Violation) bool {
+	return len(v) == 1 && strings.HasPrefix(v[0].Message, "expected ")
+}
+
+// reportBranch report the violations of the closest schema of an anyOf
+// or oneOf, or message when the value has none of the allowed types
+func (s *schemaSet) reportBranch(out *[]Violation, pointer string, message string, best []Violation) {
+	if len(best) == 0 || isTypeMismatch(best) {
+		s.report(out, pointer, message)
+		return
+	}
+	*out = append(*out, best...)
+}
+
+func (s *schemaSet) report(out *[]Violation, pointer string, message string) {
+	*out = append(*out, Violation{Pointer: pointer, Severity: Error, Rule: "schema", Message: message})
+}
+
+func (s *schemaSet) checkString(m map[string]interface{}, value string, pointer string, out *[]Violation) {
+
+	length := len([]rune(value))
+	if n, ok := m["minLength"].(float64); ok && float64(length) < n {
+		s.report(out, pointer, fmt.Sprintf("string shorter than %v", n))
+	}
+	if n, ok := m["maxLength"].(float64); ok && float64(length) > n {
+		s.report(out, pointer, fmt.Sprintf("string longer than %v", n))
+	}
+	if p, ok := m["pattern"].(string); ok {
+		re, err := s.pattern(p)
+		if err != nil {
+			s.report(out, pointer, err.Error())
+		} else if !re.MatchString(value) {
+			s.report(out, pointer, fmt.Sprintf("%q does not match %s", value, p))
+		}
+	}
+	if f, ok := m["format"].(string); ok {
+		if err := checkFormat(f, value); err != nil {
+			s.report(out, pointer, fmt.Sprintf("%q is not a valid %s: %s", value, f, err))
+		}
+	}
+}
+
+func (s *schemaSet) checkNumber(m map[string]interface{}, value float64, pointer string, out *[]Violation) {
+
+	if n, ok := m["minimum"].(float64); ok && value < n {
+		s.report(out, pointer, fmt.Sprintf("value must be >= %v", n))
+	}
+	if n, ok := m["exclusiveMinimum"].(float64); ok && value <= n {
+		s.report(out, pointer, fmt.Sprintf("value must be > %v", n))
+	}
+	if n, ok := m["maximum"].(float64); ok && value > n {
+		s.report(out, pointer, fmt.Sprintf("value must be <= %v", n))
+	}
+	if n, ok := m["exclusiveMaximum"].(float64); ok && value >= n {
+		s.report(out, pointer, fmt.Sprintf("value must be < %v", n))
+	}
+}
+
+func (s *schemaSet) checkArray(base *url.URL, m map[string]interface{}, value []interface{}, pointer string, out *[]Violation) {
+
+	if n, ok := m["minItems"].(float64); ok && float64(len(value)) < n {
+		s.report(out, pointer, fmt.Sprintf("array must have at least %v items", n))
+	}
+	if n, ok := m["maxItems"].(float64); ok && float64(len(value)) > n {
+		s.report(out, pointer, fmt.Sprintf("array must have at most %v items", n))
+	}
+	if unique, _ := m["uniqueItems"].(bool); unique {
+		for i := range value {
+			for j := 0; j < i; j++ {
+				if jsonEqual(value[i], value[j]) {
+					s.report(out, pointer+"/"+strconv.Itoa(i), fmt.Sprintf("duplicate of item %d", j))
+					break
+				}
+			}
+		}
+	}
+
+	switch items := m["items"].(type) {
+	case []interface{}:
+		for i, sub := range items {
+			if i < len(value) {
+				s.check(base, sub, value[i], pointer+"/"+strconv.Itoa(i), out)
+			}
+		}
+	case nil:
+	default:
+		for i, item := range value {
+			s.check(base, items, item, pointer+"/"+strconv.Itoa(i), out)
+		}
+	}
+
+	if contains, ok := m["contains"]; ok {
+		found := false
+		for i, item := range value {
+			var sub []Violation
+			s.check(base, contains, item, pointer+"/"+strconv.Itoa(i), &sub)
+			if len(sub) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.report(out, pointer, "no item match the required schema")
+		}
+	}
+}
+
+func (s *schemaSet) checkObject(base *url.URL, m map[string]interface{}, value map[string]interface{}, pointer string, out *[]Violation) {
+
+	if required, ok := m["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := value[name]; !ok {
+				s.report(out, pointer, fmt.Sprintf("missing required property %q", name))
+			}
+		}
+	}
+	if n, ok := m["minProperties"].(float64); ok && float64(len(value)) < n {
+		s.report(out, pointer, fmt.Sprintf("object must have at least %v properties", n))
+	}
+
+	properties, _ := m["properties"].(map[string]interface{})
+	patterns, _ := m["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := m["additionalProperties"]
+	names, hasNames := m["propertyNames"]
+
+	for _, key := range sortedKeys(value) {
+		child := pointer + "/" + escapePointer(key)
+		if hasNames {
+			s.check(base, names, key, child, out)
+		}
+
+		matched := false
+		if sub, ok := properties[key]; ok {
+			matched = true
+			s.check(base, sub, value[key], child, out)
+		}
+		for _, p := range sortedKeys(patterns) {
+			re, err := s.pattern(p)
+			if err == nil && re.MatchString(key) {
+				matched = true
+				s.check(base, patterns[p], value[key], child, out)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				s.report(out, child, fmt.Sprintf("property %q is not allowed", key))
+			} else {
+				s.check(base, additional, value[key], child, out)
+			}
+		}
+	}
+}
+
+// resolve find the schema referenced by ref from a document at base
+func (s *schemaSet) resolve(base *url.URL, ref string) (*url.URL, interface{}, error) {
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid $ref %q", ref)
+	}
+	target := base.ResolveReference(u)
+	fragment := target.Fragment
+	target.Fragment = ""
+
+	doc, ok := s.docs[target.String()]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown schema %s", target)
+	}
+	if fragment == "" {
+		return target, doc, nil
+	}
+
+	sch := doc
+	for _, token := range strings.Split(strings.TrimPrefix(fragment, "/"), "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		m, ok := sch.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown $ref %q", ref)
+		}
+		if sch, ok = m[token]; !ok {
+			return nil, nil, fmt.Errorf("unknown $ref %q", ref)
+		}
+	}
+
+	return target, sch, nil
+}
+
+// pattern compile the regular expressions of the schemas once
+func (s *schemaSet) pattern(p string) (*regexp.Regexp, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if re, ok := s.patterns[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q in schema", p)
+	}
+	s.patterns[p] = re
+
+	return re, nil
+}
+
+func checkFormat(format string, value string) error {
+
+	switch format {
+	case "uri":
+		u, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" {
+			return fmt.Errorf("missing scheme")
+		}
+	case "uri-reference":
+		_, err := url.Parse(value)
+		return err
+	case "uri-template":
+		_, err := opds2.Link{Href: value}.Expand(nil)
+		return err
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err
+	}
+
+	return nil
+}
+
+// matchType check value against the type keyword, a string or a list
+func matchType(t interface{}, value interface{}) bool {
+
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && isType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func isType(name string, value interface{}) bool {
+	if name == "integer" {
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	if name == "number" {
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonType(value) == name
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeList(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		var names []string
+		for _, n := range list {
+			names = append(names, fmt.Sprint(n))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonString(value interface{}) string {
+	buff, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(buff)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escape a token of a JSON pointer as defined in RFC 6901
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
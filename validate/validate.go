@@ -0,0 +1,263 @@
+// Package validate check OPDS 2.0 feeds and publications against the
+// OPDS 2.0 JSON Schemas, bundled with the package, and against the rules
+// of the specification the schemas can not express
+// https://github.com/opds-community/drafts/tree/master/schema
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// Severity tell if a violation make the document invalid
+type Severity int
+
+// severities from the most to the least important
+const (
+	Error Severity = iota
+	Warning
+	Info
+)
+
+var severityNames = []string{"error", "warning", "info"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return "severity(" + strconv.Itoa(int(s)) + ")"
+	}
+	return severityNames[s]
+}
+
+// MarshalText write the severity as its name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText read a severity name
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if string(text) == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("validate: unknown severity %q", text)
+}
+
+// Violation is a problem found in a document, Pointer is the JSON pointer
+// of the value at fault and Rule is "schema" for schema violations or the
+// name of the rule
+type Violation struct {
+	Pointer  string   `json:"pointer"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+}
+
+func (v Violation) String() string {
+	pointer := v.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Sprintf("%s %s: %s (%s)", v.Severity, pointer, v.Message, v.Rule)
+}
+
+// HasErrors check if one of the violations is an error
+func HasErrors(violations []Violation) bool {
+	for _, v := range violations {
+		if v.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Feed check a feed, it is validated as it is written in JSON
+func Feed(feed *opds2.Feed) ([]Violation, error) {
+
+	buff, err := json.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	return FeedJSON(buff)
+}
+
+// FeedJSON check a feed document, the error is only for a document that
+// is not JSON
+func FeedJSON(buff []byte) ([]Violation, error) {
+	return document(buff, FeedSchema, feedRules)
+}
+
+// Publication check a publication, it is validated as it is written in
+// JSON
+func Publication(publication *opds2.Publication) ([]Violation, error) {
+
+	buff, err := json.Marshal(publication)
+	if err != nil {
+		return nil, err
+	}
+
+	return PublicationJSON(buff)
+}
+
+// PublicationJSON check an OPDS publication document
+func PublicationJSON(buff []byte) ([]Violation, error) {
+	return document(buff, PublicationSchema, func(value interface{}) []Violation {
+		return publicationRules(value, "")
+	})
+}
+
+func document(buff []byte, id string, rules func(interface{}) []Violation) ([]Violation, error) {
+	var value interface{}
+
+	if err := json.Unmarshal(buff, &value); err != nil {
+		return nil, err
+	}
+
+	schemas, err := loadSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	violations := schemas.validate(id, value, "")
+	violations = append(violations, rules(value)...)
+	// violations of the same value are reported together
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Pointer < violations[j].Pointer
+	})
+
+	return violations, nil
+}
+
+// imageTypes are the media types every client must support, each
+// publication must have an image in one of them
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/avif": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// feedRules check the rules of the specification the feed schema does
+// not express
+func feedRules(value interface{}) []Violation {
+	var violations []Violation
+
+	feed, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if links, ok := feed["links"].([]interface{}); ok && !containsRel(links, "self") {
+		violations = append(violations, Violation{Pointer: "/links", Severity: Error, Rule: "self-link",
+			Message: "a feed must have a link with the self relation"})
+	}
+
+	if publications, ok := feed["publications"].([]interface{}); ok {
+		for i, p := range publications {
+			violations = append(violations, publicationRules(p, "/publications/"+strconv.Itoa(i))...)
+		}
+	}
+	if groups, ok := feed["groups"].([]interface{}); ok {
+		for g, group := range groups {
+			group, _ := group.(map[string]interface{})
+			publications, _ := group["publications"].([]interface{})
+			for i, p := range publications {
+				violations = append(violations, publicationRules(p, fmt.Sprintf("/groups/%d/publications/%d", g, i))...)
+			}
+		}
+	}
+
+	return violations
+}
+
+// publicationRules check the rules the publication schema does not express
+// on the publication at pointer
+func publicationRules(value interface{}, pointer string) []Violation {
+	var violations []Violation
+
+	publication, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if links, ok := publication["links"].([]interface{}); ok {
+		acquisition := false
+		for _, l := range links {
+			for _, r := range rels(l) {
+				if strings.HasPrefix(r, opds2.RelAcquisition) {
+					acquisition = true
+				}
+			}
+		}
+		if !acquisition {
+			violations = append(violations, Violation{Pointer: pointer + "/links", Severity: Error, Rule: "acquisition-link",
+				Message: "a publication must have at least one acquisition link"})
+		}
+	}
+
+	if images, ok := publication["images"].([]interface{}); ok && len(images) > 0 {
+		supported := false
+		for i, image := range images {
+			image, _ := image.(map[string]interface{})
+			imagePointer := pointer + "/images/" + strconv.Itoa(i)
+			t, _ := image["type"].(string)
+			// parameters like charset are not part of the media type
+			mediaType := strings.TrimSpace(strings.ToLower(strings.SplitN(t, ";", 2)[0]))
+			switch {
+			case t == "":
+				violations = append(violations, Violation{Pointer: imagePointer, Severity: Warning, Rule: "image-type",
+					Message: "image without media type"})
+			case !strings.HasPrefix(mediaType, "image/"):
+				violations = append(violations, Violation{Pointer: imagePointer + "/type", Severity: Error, Rule: "image-type",
+					Message: fmt.Sprintf("%q is not an image media type", t)})
+			case imageTypes[mediaType]:
+				supported = true
+			}
+		}
+		if !supported {
+			violations = append(violations, Violation{Pointer: pointer + "/images", Severity: Error, Rule: "image-type",
+				Message: "a publication must have an image in image/jpeg, image/avif, image/png or image/gif"})
+		}
+	}
+
+	return violations
+}
+
+// containsRel check if one of the links has the relation
+func containsRel(links []interface{}, rel string) bool {
+	for _, l := range links {
+		for _, r := range rels(l) {
+			if r == rel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rels return the relations of a link, a string or an array in JSON
+func rels(link interface{}) []string {
+	l, _ := link.(map[string]interface{})
+
+	switch rel := l["rel"].(type) {
+	case string:
+		return []string{rel}
+	case []interface{}:
+		var list []string
+		for _, r := range rel {
+			if s, ok := r.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+
+	return nil
+}
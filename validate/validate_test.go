@@ -0,0 +1,113 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opds-community/libopds2-go/convert"
+	"github.com/opds-community/libopds2-go/opds2"
+)
+
+// builtFeed return a feed using most of the builders
+func builtFeed(t *testing.T) opds2.Feed {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	p := opds2.NewPublication().
+		Title("Moby Dick").
+		Identifier("urn:isbn:9780000000000").
+		Author(opds2.Contributor{Name: opds2.MultiLanguage{SingleString: "Herman Melville"}, SortAs: "Melville, Herman"}).
+		Translator(opds2.Contributor{Name: opds2.MultiLanguage{SingleString: "Jean Giono"}}).
+		Language("en").
+		Modified(modified).
+		Published(modified).
+		Description("Call me Ishmael.").
+		Subject(opds2.Subject{Name: "Sea stories", Code: "FIC047000", Scheme: "http://www.bisg.org/standards/bisac_subject/"}).
+		Series("Classics", 2).
+		AcquisitionLink(opds2.RelBuy, "https://example.com/moby.epub?format=epub&drm=none", "application/epub+zip", &opds2.Price{Currency: "USD", Value: 4.99}).
+		IndirectAcquisition("application/vnd.adobe.adept+xml").
+		AcquisitionLink(opds2.RelSample, "https://example.com/moby-sample.epub", "application/epub+zip", nil).
+		Cover("https://example.com/moby.jpg", "image/jpeg", 900, 600).
+		Image("https://example.com/moby-small.jpg", "image/jpeg", 90, 60).
+		MustBuild()
+
+	feed, err := opds2.NewFeed("New releases").
+		Modified(modified).
+		SelfLink("https://example.com/new.json?page=2").
+		SearchLink("https://example.com/search{?query}").
+		Pagination(opds2.Pagination{NumberOfItems: 30, ItemsPerPage: 10, CurrentPage: 2,
+			Next: "https://example.com/new.json?page=3", Previous: "https://example.com/new.json?page=1"}).
+		Facet("Language", opds2.Link{Href: "https://example.com/new.json?lang=en", TypeLink: "application/opds+json", Title: "English"}).
+		Publication(p).
+		Group(opds2.Link{Href: "https://example.com/classics.json", Title: "Classics", TypeLink: "application/opds+json"}, p).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func TestGeneratedFeeds(t *testing.T) {
+	navigation := opds2.NewFeed("Catalog").
+		SelfLink("https://example.com/").
+		Navigation(opds2.Link{Href: "https://example.com/new.json", Title: "New releases", TypeLink: "application/opds+json", Rel: []string{"current"}})
+	navigationFeed, err := navigation.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := convert.ParseBuffer([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/terms/">
+  <id>urn:example:new</id>
+  <title>New releases</title>
+  <updated>2020-01-02T03:04:05Z</updated>
+  <link rel="self" href="/new.atom" type="application/atom+xml;profile=opds-catalog;kind=acquisition"/>
+  <entry>
+    <id>urn:isbn:9780000000000</id>
+    <title>Moby Dick</title>
+    <updated>2020-01-02T03:04:05Z</updated>
+    <author><name>Herman Melville</name></author>
+    <dc:language>en</dc:language>
+    <link rel="http://opds-spec.org/acquisition/open-access" href="/moby.epub" type="application/epub+zip"/>
+    <link rel="http://opds-spec.org/image" href="/moby.jpg" type="image/jpeg"/>
+  </entry>
+</feed>`), "https://example.com/new.atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := map[string]opds2.Feed{
+		"builder":    builtFeed(t),
+		"navigation": navigationFeed,
+		"converted":  converted,
+	}
+	for name, feed := range feeds {
+		violations, err := Feed(&feed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range violations {
+			t.Errorf("%s: %s", name, v)
+		}
+	}
+}
+
+func TestPublicationWithoutImage(t *testing.T) {
+	p := opds2.NewPublication().
+		Title("Moby Dick").
+		AcquisitionLink(opds2.RelOpenAccess, "https://example.com/moby.epub", "application/epub+zip", nil).
+		MustBuild()
+
+	violations, err := Publication(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		if v.Pointer == "/images" && strings.Contains(v.Message, "null") {
+			t.Errorf("images written as null: %s", v)
+		}
+	}
+	if !HasErrors(violations) {
+		t.Error("a publication needs an image")
+	}
+}